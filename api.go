@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/redact"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// fullRun is queued to run for all repositories instead of a single one.
+const fullRun = ""
+
+// serveScheduler queues a full run at the times of SCHEDULE while serving,
+// unless it is paused.
+type serveScheduler struct {
+	paused atomic.Bool
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// run queues the runs until ctx is done. The schedule of the current
+// configuration applies to the run after the next.
+func (s *serveScheduler) run(ctx context.Context, current func() *config.Config, queue *syncQueue) {
+	for {
+		cfg := current()
+		next := cfg.Schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("Warning: Schedule %q never matches, no runs are scheduled", cfg.Schedule)
+			return
+		}
+		s.mu.Lock()
+		s.next = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if s.paused.Load() {
+			log.Printf("Scheduler is paused, skipping the run scheduled at %s", next.Format(time.RFC1123))
+			continue
+		}
+		if !queue.add(fullRun) {
+			log.Printf("Warning: Too many pending repositories, skipping the run scheduled at %s", next.Format(time.RFC1123))
+		}
+	}
+}
+
+// recentRuns is how many runs the server remembers for the API and dashboard.
+const recentRuns = 20
+
+// runRecord is the outcome of a run or sync of the server.
+type runRecord struct {
+	// Repository is empty for runs of all repositories
+	Repository string    `json:"repository,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Duration is how long the run took.
+func (r runRecord) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt).Round(time.Second)
+}
+
+// runHistory keeps the most recent runs of the server in memory.
+type runHistory struct {
+	mu   sync.Mutex
+	runs []runRecord
+}
+
+func (h *runHistory) record(fullName string, startedAt time.Time, err error) {
+	record := runRecord{Repository: fullName, StartedAt: startedAt, FinishedAt: time.Now()}
+	if err != nil {
+		record.Error = redact.String(err.Error())
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs = append(h.runs, record)
+	if len(h.runs) > recentRuns {
+		h.runs = h.runs[len(h.runs)-recentRuns:]
+	}
+}
+
+// recent returns the remembered runs, latest first.
+func (h *runHistory) recent() []runRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := make([]runRecord, len(h.runs))
+	for i, run := range h.runs {
+		runs[len(runs)-1-i] = run
+	}
+	return runs
+}
+
+// schedulerStatus is the state of the scheduler reported by the API.
+type schedulerStatus struct {
+	Enabled bool       `json:"enabled"`
+	Paused  bool       `json:"paused"`
+	Next    *time.Time `json:"next,omitempty"`
+}
+
+func (s *serveScheduler) status() schedulerStatus {
+	if s == nil {
+		return schedulerStatus{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := schedulerStatus{Enabled: true, Paused: s.paused.Load()}
+	if !s.next.IsZero() {
+		next := s.next
+		status.Next = &next
+	}
+	return status
+}
+
+// repoStatus is what the state recorded about a repository, as reported by the API.
+type repoStatus struct {
+	Repository string `json:"repository"`
+	state.Mirror
+}
+
+// managementAPI lets dashboards and automation drive the server: trigger a
+// run or the sync of a repository, read the recorded status of the mirrors
+// and pause the scheduler. Every request needs API_TOKEN as bearer token, only
+// the dashboard takes it as basic auth password for browsers.
+type managementAPI struct {
+	token     string
+	queue     *syncQueue
+	current   func() *config.Config
+	reload    func()
+	scheduler *serveScheduler
+	history   *runHistory
+}
+
+func (a *managementAPI) register(mux *http.ServeMux) {
+	mux.Handle("POST /api/run", a.authorized(a.triggerRun))
+	mux.Handle("POST /api/repos/{owner}/{name}/sync", a.authorized(a.triggerSync))
+	mux.Handle("POST /api/repos/{owner}/{name}/exclude", a.authorized(a.excludeRepo))
+	mux.Handle("GET /api/runs", a.authorized(a.listRuns))
+	mux.Handle("GET /api/repos", a.authorized(a.listRepos))
+	mux.Handle("GET /api/repos/{owner}/{name}", a.authorized(a.getRepo))
+	mux.Handle("GET /api/scheduler", a.authorized(a.getScheduler))
+	mux.Handle("POST /api/scheduler/pause", a.authorized(a.pauseScheduler(true)))
+	mux.Handle("POST /api/scheduler/resume", a.authorized(a.pauseScheduler(false)))
+	a.registerDashboard(mux)
+}
+
+// authorized lets requests with the API token as bearer token through.
+// Browsers don't send those on their own, so other sites can't forge them.
+func (a *managementAPI) authorized(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, "invalid API token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (a *managementAPI) triggerRun(w http.ResponseWriter, r *http.Request) {
+	if !a.queue.add(fullRun) {
+		writeAPIError(w, http.StatusServiceUnavailable, "too many pending repositories")
+		return
+	}
+	log.Printf("Run requested through the API")
+	writeAPIResponse(w, http.StatusAccepted, map[string]string{"queued": "all"})
+}
+
+func (a *managementAPI) triggerSync(w http.ResponseWriter, r *http.Request) {
+	fullName := r.PathValue("owner") + "/" + r.PathValue("name")
+	if !a.queue.add(fullName) {
+		writeAPIError(w, http.StatusServiceUnavailable, "too many pending repositories")
+		return
+	}
+	log.Printf("Sync of %s requested through the API", fullName)
+	writeAPIResponse(w, http.StatusAccepted, map[string]string{"queued": fullName})
+}
+
+func (a *managementAPI) excludeRepo(w http.ResponseWriter, r *http.Request) {
+	fullName := r.PathValue("owner") + "/" + r.PathValue("name")
+	if err := a.exclude(fullName); errors.Is(err, errInvalidName) {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, map[string]string{"excluded": fullName})
+}
+
+// repoNamePattern matches the owner/name of a GitHub repository, which never
+// holds line breaks or the wildcards of EXCLUDE_FILE patterns.
+var repoNamePattern = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+
+// errInvalidName is returned for repositories GitHub can't have.
+var errInvalidName = errors.New("invalid repository name")
+
+// exclude adds the repository to EXCLUDE_FILE and reloads the configuration,
+// so the following runs leave it alone. Its mirror is kept.
+func (a *managementAPI) exclude(fullName string) error {
+	if !repoNamePattern.MatchString(fullName) {
+		// Anything else would add other patterns to the file
+		return fmt.Errorf("%w %q", errInvalidName, fullName)
+	}
+	path := a.current().ExcludeFile
+	if path == "" {
+		return fmt.Errorf("repositories are excluded through a file, set EXCLUDE_FILE")
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	entry := fullName + "\n"
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		entry = "\n" + entry
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if _, err := file.WriteString(entry); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	log.Printf("Excluded %s through the API", fullName)
+	a.reload()
+	return nil
+}
+
+func (a *managementAPI) listRuns(w http.ResponseWriter, r *http.Request) {
+	writeAPIResponse(w, http.StatusOK, a.history.recent())
+}
+
+func (a *managementAPI) listRepos(w http.ResponseWriter, r *http.Request) {
+	mirrors, ok := a.mirrors(w)
+	if !ok {
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, repoStatuses(mirrors))
+}
+
+// repoStatuses orders the recorded mirrors by repository.
+func repoStatuses(mirrors map[string]state.Mirror) []repoStatus {
+	statuses := make([]repoStatus, 0, len(mirrors))
+	for fullName, mirror := range mirrors {
+		statuses = append(statuses, repoStatus{Repository: fullName, Mirror: mirror})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Repository < statuses[j].Repository })
+	return statuses
+}
+
+func (a *managementAPI) getRepo(w http.ResponseWriter, r *http.Request) {
+	mirrors, ok := a.mirrors(w)
+	if !ok {
+		return
+	}
+	fullName := r.PathValue("owner") + "/" + r.PathValue("name")
+	for name, mirror := range mirrors {
+		if strings.EqualFold(name, fullName) {
+			writeAPIResponse(w, http.StatusOK, repoStatus{Repository: name, Mirror: mirror})
+			return
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, "no mirror recorded for "+fullName)
+}
+
+// errNoState is returned for the status of the mirrors without a state file.
+var errNoState = errors.New("the status is read from the state, set STATE_FILE")
+
+// mirrors writes an error response if the mirrors can't be read.
+func (a *managementAPI) mirrors(w http.ResponseWriter) (map[string]state.Mirror, bool) {
+	mirrors, err := a.readMirrors()
+	if errors.Is(err, errNoState) {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "failed to read the state")
+		return nil, false
+	}
+	return mirrors, true
+}
+
+// readMirrors reads the mirrors recorded by the last runs from the state file.
+func (a *managementAPI) readMirrors() (map[string]state.Mirror, error) {
+	cfg := a.current()
+	if cfg.StateFile == "" {
+		return nil, errNoState
+	}
+	store, err := state.Open(cfg.StateFile)
+	if err != nil {
+		log.Printf("Warning: Failed to open the state for the API: %v", err)
+		return nil, err
+	}
+	return store.Mirrors(), nil
+}
+
+func (a *managementAPI) getScheduler(w http.ResponseWriter, r *http.Request) {
+	writeAPIResponse(w, http.StatusOK, a.scheduler.status())
+}
+
+func (a *managementAPI) pauseScheduler(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.scheduler == nil {
+			writeAPIError(w, http.StatusConflict, "no runs are scheduled, set SCHEDULE")
+			return
+		}
+		a.scheduler.paused.Store(paused)
+		if paused {
+			log.Printf("Scheduler paused through the API")
+		} else {
+			log.Printf("Scheduler resumed through the API")
+		}
+		writeAPIResponse(w, http.StatusOK, a.scheduler.status())
+	}
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIResponse(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/redact"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func TestManagementAPI(t *testing.T) {
+	const token = "api-token"
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := state.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.RecordMirror("Octo/Demo", &state.Mirror{Owner: "me", Name: "demo", LastRun: time.Now(), LastError: "clone failed"})
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	newAPI := func(scheduler *serveScheduler) (*managementAPI, http.Handler) {
+		cfg := &config.Config{StateFile: path}
+		api := &managementAPI{token: token, queue: newSyncQueue(), current: func() *config.Config { return cfg }, reload: func() {}, scheduler: scheduler, history: &runHistory{}}
+		mux := http.NewServeMux()
+		api.register(mux)
+		return api, mux
+	}
+	send := func(handler http.Handler, method, target, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("rejects requests without the token", func(t *testing.T) {
+		_, handler := newAPI(nil)
+		if rec := send(handler, http.MethodPost, "/api/run", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+		if rec := send(handler, http.MethodPost, "/api/run", "wrong"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects cross-site posts with the stored basic auth", func(t *testing.T) {
+		scheduler := &serveScheduler{}
+		_, handler := newAPI(scheduler)
+		req := httptest.NewRequest(http.MethodPost, "/api/scheduler/pause", nil)
+		req.SetBasicAuth("admin", token)
+		req.Header.Set("Origin", "https://evil.example.com")
+		req.Header.Set("Sec-Fetch-Site", "cross-site")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+		if scheduler.paused.Load() {
+			t.Error("expected the scheduler to keep running")
+		}
+	})
+
+	t.Run("queues runs and syncs", func(t *testing.T) {
+		api, handler := newAPI(nil)
+		if rec := send(handler, http.MethodPost, "/api/run", token); rec.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d", rec.Code)
+		}
+		if got := <-api.queue.next; got != fullRun {
+			t.Errorf("expected a full run to be queued, got %q", got)
+		}
+		if rec := send(handler, http.MethodPost, "/api/repos/octo/demo/sync", token); rec.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d", rec.Code)
+		}
+		if got := <-api.queue.next; got != "octo/demo" {
+			t.Errorf("expected octo/demo to be queued, got %q", got)
+		}
+	})
+
+	t.Run("reports the recorded status", func(t *testing.T) {
+		_, handler := newAPI(nil)
+		rec := send(handler, http.MethodGet, "/api/repos/octo/demo", token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		var status repoStatus
+		if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		if status.Repository != "Octo/Demo" || status.Name != "demo" || status.LastError != "clone failed" {
+			t.Errorf("unexpected status: %+v", status)
+		}
+
+		var statuses []repoStatus
+		rec = send(handler, http.MethodGet, "/api/repos", token)
+		if err := json.NewDecoder(rec.Body).Decode(&statuses); err != nil || len(statuses) != 1 {
+			t.Errorf("expected one status, got %s", rec.Body)
+		}
+
+		if rec := send(handler, http.MethodGet, "/api/repos/octo/missing", token); rec.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("pauses the scheduler", func(t *testing.T) {
+		scheduler := &serveScheduler{}
+		_, handler := newAPI(scheduler)
+		if rec := send(handler, http.MethodPost, "/api/scheduler/pause", token); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if !scheduler.paused.Load() {
+			t.Error("expected the scheduler to be paused")
+		}
+		send(handler, http.MethodPost, "/api/scheduler/resume", token)
+		if scheduler.paused.Load() {
+			t.Error("expected the scheduler to be resumed")
+		}
+
+		_, handler = newAPI(nil)
+		if rec := send(handler, http.MethodPost, "/api/scheduler/pause", token); rec.Code != http.StatusConflict {
+			t.Errorf("expected 409 without a schedule, got %d", rec.Code)
+		}
+	})
+
+	t.Run("masks secrets in run errors", func(t *testing.T) {
+		redact.Add("ghp_secret-token")
+		defer redact.Reset()
+		history := &runHistory{}
+		history.record(fullRun, time.Now(), errors.New("clone of https://ghp_secret-token@github.com failed"))
+		if runs := history.recent(); len(runs) != 1 || strings.Contains(runs[0].Error, "ghp_secret-token") {
+			t.Errorf("expected the token to be masked, got %+v", runs)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+// Package audit records the changes made to Gitea in an append-only file of
+// JSON lines.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a line of the audit log.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// Target is the API path or, for pushes, the repository changed
+	Target string `json:"target"`
+	// Payload summarizes the request without secrets
+	Payload map[string]interface{} `json:"payload,omitempty"`
+	Status  int                    `json:"status,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+	// Sudo is the user the request was made as if not the token's
+	Sudo string `json:"sudo,omitempty"`
+}
+
+// Log appends entries to a file. A nil Log records nothing.
+type Log struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open creates the audit log at path unless it exists.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{path: path}, nil
+}
+
+// Record appends the entry, setting its time if missing. The file is opened
+// for every entry so it can be rotated while running.
+func (l *Log) Record(entry Entry) error {
+	if l == nil {
+		return nil
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Summarize returns the scalar top-level fields of a request body. Nested
+// values and fields that may hold credentials are left out.
+func Summarize(body interface{}) map[string]interface{} {
+	if body == nil {
+		return nil
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+
+	summary := make(map[string]interface{})
+	for name, value := range fields {
+		if sensitive(name) {
+			continue
+		}
+		switch value.(type) {
+		case string, bool, float64:
+			summary[name] = value
+		}
+	}
+	if len(summary) == 0 {
+		return nil
+	}
+	return summary
+}
+
+func sensitive(field string) bool {
+	field = strings.ToLower(field)
+	for _, word := range []string{"token", "password", "secret", "key", "auth"} {
+		if strings.Contains(field, word) {
+			return true
+		}
+	}
+	return false
+}
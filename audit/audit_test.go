@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Record(Entry{Method: "POST", Target: "/api/v1/orgs", Status: 201}); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Record(Entry{Method: "DELETE", Target: "/api/v1/repos/me/demo", Error: "connection refused"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", data)
+	}
+	var entry Entry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Method != "DELETE" || entry.Error != "connection refused" || entry.Time.IsZero() {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestRecordWithoutLog(t *testing.T) {
+	var log *Log
+	if err := log.Record(Entry{Method: "POST"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summary := Summarize(map[string]interface{}{
+		"repo_name":  "demo",
+		"private":    true,
+		"uid":        7,
+		"auth_token": "secret",
+		"config":     map[string]string{"secret": "hook"},
+	})
+
+	if len(summary) != 3 || summary["repo_name"] != "demo" || summary["private"] != true || summary["uid"] != float64(7) {
+		t.Errorf("unexpected summary: %v", summary)
+	}
+	if Summarize(nil) != nil {
+		t.Error("expected no summary without body")
+	}
+}
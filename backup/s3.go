@@ -0,0 +1,325 @@
+// Package backup stores git bundles of the mirrored repositories in an S3
+// compatible bucket, as second backup that doesn't depend on Gitea.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+)
+
+// unsignedPayload skips hashing uploads, which S3 allows for signed requests.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// maxPartSize is the largest object S3 accepts in one upload, and the
+// largest part of a multipart upload.
+const maxPartSize = 5 << 30
+
+// S3 is a minimal client of the S3 API using path-style requests, which all
+// S3 compatible stores understand.
+type S3 struct {
+	cfg        *config.BackupConfig
+	httpClient *http.Client
+	now        func() time.Time
+	// partSize is the size above which bundles are uploaded in parts
+	partSize int64
+}
+
+func NewS3(cfg *config.BackupConfig) *S3 {
+	return &S3{cfg: cfg, httpClient: &http.Client{}, now: time.Now, partSize: maxPartSize}
+}
+
+// Backup uploads the bundle below the prefix of name and removes the oldest
+// bundles beyond the retention.
+func (s *S3) Backup(ctx context.Context, name, bundlePath string) error {
+	prefix := s.cfg.Prefix + name + "/"
+	key := prefix + s.now().UTC().Format("20060102T150405Z") + ".bundle"
+	if err := s.upload(ctx, key, bundlePath); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+
+	keys, err := s.list(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+
+	// The timestamps in the keys sort chronologically
+	sort.Strings(keys)
+	for len(keys) > s.cfg.Retention {
+		if err := s.delete(ctx, keys[0]); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", keys[0], err)
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
+func (s *S3) upload(ctx context.Context, key, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > s.partSize {
+		return s.uploadParts(ctx, key, file, info.Size())
+	}
+
+	req, err := s.newRequest(ctx, "PUT", key, nil, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	_, err = s.do(req, http.StatusOK)
+	return err
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// uploadParts uploads a file too large for a single upload in parts of
+// partSize. A failed upload is aborted, so its parts don't linger.
+func (s *S3) uploadParts(ctx context.Context, key string, file *os.File, size int64) error {
+	req, err := s.newRequest(ctx, "POST", key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	body, err := s.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &initiated); err != nil {
+		return err
+	}
+
+	parts, err := s.uploadPartsOf(ctx, key, initiated.UploadID, file, size)
+	if err == nil {
+		err = s.completeParts(ctx, key, initiated.UploadID, parts)
+	}
+	if err != nil {
+		if req, abortErr := s.newRequest(context.WithoutCancel(ctx), "DELETE", key, url.Values{"uploadId": {initiated.UploadID}}, nil); abortErr == nil {
+			s.do(req, http.StatusNoContent)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *S3) uploadPartsOf(ctx context.Context, key, uploadID string, file *os.File, size int64) ([]completedPart, error) {
+	var parts []completedPart
+	for offset := int64(0); offset < size; offset += s.partSize {
+		number := len(parts) + 1
+		length := min(s.partSize, size-offset)
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		req, err := s.newRequest(ctx, "PUT", key, query, io.NewSectionReader(file, offset, length))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = length
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("part %d: status %d: %s", number, resp.StatusCode, strings.TrimSpace(string(respBody)))
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	}
+	return parts, nil
+}
+
+func (s *S3) completeParts(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	content, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	req, err := s.newRequest(ctx, "POST", key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	body, err := s.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	// S3 reports errors of the completion in a successful response
+	if bytes.Contains(body, []byte("<Error>")) {
+		return fmt.Errorf("failed to complete the upload: %s", strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3) list(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		req, err := s.newRequest(ctx, "GET", "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := s.do(req, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+
+		if !result.IsTruncated {
+			return keys, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s *S3) delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, "DELETE", key, nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = s.do(req, http.StatusNoContent)
+	return err
+}
+
+func (s *S3) newRequest(ctx context.Context, method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(s.cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Path += "/" + s.cfg.Bucket
+	if key != "" {
+		endpoint.Path += "/" + key
+	}
+	endpoint.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, unsignedPayload)
+	return req, nil
+}
+
+func (s *S3) do(req *http.Request, expected int) ([]byte, error) {
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expected {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// sign adds an AWS Signature Version 4 to the request.
+func (s *S3) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := []string{"host"}
+	for name := range req.Header {
+		headers = append(headers, strings.ToLower(name))
+	}
+	sort.Strings(headers)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := req.Host
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		} else if value == "" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes the query sorted by key as S3 expects it, with
+// spaces as %20 rather than +.
+func canonicalQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,137 @@
+// Package bundle writes and reads exports of repositories as git bundles
+// with a manifest, which carry them into Gitea instances without internet
+// access.
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/gitcmd"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+const manifestFile = "manifest.json"
+
+// Manifest lists the repositories of an export.
+type Manifest struct {
+	CreatedAt    time.Time `json:"createdAt"`
+	Repositories []Entry   `json:"repositories"`
+}
+
+// Entry describes an exported repository.
+type Entry struct {
+	FullName      string   `json:"fullName"`
+	Owner         string   `json:"owner"`
+	Name          string   `json:"name"`
+	Organization  string   `json:"organization,omitempty"`
+	DefaultBranch string   `json:"defaultBranch,omitempty"`
+	Private       bool     `json:"private"`
+	Fork          bool     `json:"fork,omitempty"`
+	Parent        string   `json:"parent,omitempty"`
+	Topics        []string `json:"topics,omitempty"`
+	// Bundle is the path of the git bundle relative to the manifest
+	Bundle string `json:"bundle"`
+}
+
+// NewEntry describes a repository whose bundle is stored at path.
+func NewEntry(repo *repository.Repository, path string) Entry {
+	return Entry{
+		FullName:      repo.FullName,
+		Owner:         repo.Owner,
+		Name:          repo.Name,
+		Organization:  repo.Organization,
+		DefaultBranch: repo.DefaultBranch,
+		Private:       repo.Private,
+		Fork:          repo.Fork,
+		Parent:        repo.Provenance.Parent,
+		Topics:        repo.Topics,
+		Bundle:        filepath.ToSlash(path),
+	}
+}
+
+// Repository returns the exported repository.
+func (e Entry) Repository() *repository.Repository {
+	return &repository.Repository{
+		Name:          e.Name,
+		Owner:         e.Owner,
+		FullName:      e.FullName,
+		Organization:  e.Organization,
+		DefaultBranch: e.DefaultBranch,
+		Private:       e.Private,
+		Fork:          e.Fork,
+		Topics:        e.Topics,
+		Provenance: repository.Provenance{
+			Provider: "github",
+			Parent:   e.Parent,
+		},
+	}
+}
+
+// Create writes the branches and tags of the repository at url to a bundle
+// at path. Empty repositories can't be bundled and fail.
+func Create(ctx context.Context, url, authorization, path string) error {
+	local, err := os.MkdirTemp("", "export-*.git")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(local)
+
+	if err := gitcmd.Run(ctx, "", "init", "--bare", "--quiet", local); err != nil {
+		return err
+	}
+	fetch := append([]string{"-C", local, "fetch", "--quiet", url}, gitcmd.Refspecs...)
+	if err := gitcmd.Run(ctx, authorization, fetch...); err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := gitcmd.Run(ctx, "", "-C", local, "bundle", "create", "--quiet", absolute, "--branches", "--tags"); err != nil {
+		return fmt.Errorf("failed to bundle %s: %w", url, err)
+	}
+	return nil
+}
+
+// WriteManifest stores the manifest in dir.
+func WriteManifest(dir string, manifest *Manifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFile), content, 0o644)
+}
+
+// ReadManifest loads the manifest of the export in dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	for _, entry := range manifest.Repositories {
+		if !filepath.IsLocal(filepath.FromSlash(entry.Bundle)) {
+			return nil, fmt.Errorf("bundle of %s points outside the export: %s", entry.FullName, entry.Bundle)
+		}
+	}
+	return &manifest, nil
+}
+
+// IsArchive reports whether path names a gzipped tarball rather than a directory.
+func IsArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
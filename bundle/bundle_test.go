@@ -0,0 +1,86 @@
+package bundle
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	repo := &repository.Repository{Name: "demo", Owner: "octo", FullName: "octo/demo", Private: true, Provenance: repository.Provenance{Parent: "other/demo"}}
+	manifest := &Manifest{CreatedAt: time.Now().UTC(), Repositories: []Entry{NewEntry(repo, filepath.Join("octo", "demo.bundle"))}}
+
+	if err := WriteManifest(dir, manifest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	read, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	restored := read.Repositories[0].Repository()
+	if restored.FullName != "octo/demo" || !restored.Private || restored.Provenance.Parent != "other/demo" {
+		t.Errorf("unexpected repository %+v", restored)
+	}
+	if read.Repositories[0].Bundle != "octo/demo.bundle" {
+		t.Errorf("unexpected bundle path %q", read.Repositories[0].Bundle)
+	}
+
+	t.Run("rejects bundles outside the export", func(t *testing.T) {
+		manifest.Repositories[0].Bundle = "../demo.bundle"
+		WriteManifest(dir, manifest)
+		if _, err := ReadManifest(dir); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "octo"), 0o755)
+	os.WriteFile(filepath.Join(dir, "octo", "demo.bundle"), []byte("content"), 0o644)
+
+	archive := filepath.Join(t.TempDir(), "export.tar.gz")
+	if err := Pack(dir, archive); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := t.TempDir()
+	if err := Unpack(archive, out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(out, "octo", "demo.bundle"))
+	if err != nil || string(content) != "content" {
+		t.Errorf("unexpected content %q: %v", content, err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	source := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet", source},
+		{"-C", source, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "--allow-empty", "-m", "initial"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, output)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "octo", "demo.bundle")
+	if err := Create(context.Background(), source, "", path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output, err := exec.Command("git", "bundle", "list-heads", path).CombinedOutput(); err != nil {
+		t.Errorf("invalid bundle: %v: %s", err, output)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/logger"
+)
+
+// runCheck validates the configuration in environ without mirroring
+// anything: it reports unknown and ignored settings, the error that keeps
+// the configuration from loading, or the effective configuration.
+func runCheck(environ []string, out io.Writer) error {
+	diagnostics := config.Check(environ)
+	for _, diagnostic := range diagnostics {
+		fmt.Fprintf(out, "Warning: %s\n", diagnostic)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return fmt.Errorf("the configuration is invalid")
+	}
+	registerSecrets(cfg)
+	logger.New().WriteConfig(out, cfg)
+
+	if len(diagnostics) > 0 {
+		return fmt.Errorf("found %d problems in the configuration", len(diagnostics))
+	}
+	fmt.Fprintln(out, "The configuration is valid")
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunCheck(t *testing.T) {
+	t.Setenv("GITHUB_USERNAME", "octo")
+	t.Setenv("GITEA_URL", "https://gitea.url")
+	t.Setenv("GITEA_TOKEN", "secret-token")
+
+	t.Run("prints the effective configuration", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := runCheck([]string{"GITHUB_USERNAME=octo"}, &out); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), `"username": "octo"`) || strings.Contains(out.String(), "secret-token") {
+			t.Errorf("expected the redacted configuration, got %s", out.String())
+		}
+	})
+
+	t.Run("reports typos", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := runCheck([]string{"MIROR_ISSUES=true"}, &out); err == nil {
+			t.Error("expected an error")
+		}
+		if !strings.Contains(out.String(), "did you mean MIRROR_ISSUES?") {
+			t.Errorf("expected a suggestion, got %s", out.String())
+		}
+	})
+
+	t.Run("reports invalid configurations", func(t *testing.T) {
+		t.Setenv("SORT_BY", "random")
+		var out bytes.Buffer
+		if err := runCheck(nil, &out); err == nil {
+			t.Error("expected an error")
+		}
+		if !strings.Contains(out.String(), "Error: invalid configuration") {
+			t.Errorf("expected the load error, got %s", out.String())
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// variables lists every environment variable the configuration reads.
+var variables = []string{
+	"ALERT_WEBHOOK_URL",
+	"ALERT_WEBHOOK_URL_FILE",
+	"API_TOKEN",
+	"API_TOKEN_FILE",
+	"AUDIT_LOG",
+	"BACKUP_RETENTION",
+	"BACKUP_S3_ACCESS_KEY",
+	"BACKUP_S3_ACCESS_KEY_FILE",
+	"BACKUP_S3_BUCKET",
+	"BACKUP_S3_ENDPOINT",
+	"BACKUP_S3_PREFIX",
+	"BACKUP_S3_REGION",
+	"BACKUP_S3_SECRET_KEY",
+	"BACKUP_S3_SECRET_KEY_FILE",
+	"CLONE_CACHE_DIR",
+	"CLONE_FALLBACK",
+	"CONFIG_FILE",
+	"DEFAULT_BRANCH_ONLY",
+	"DELAY",
+	"DELAY_JITTER",
+	"DEPLOY_KEYS",
+	"DRY_RUN",
+	"EXCLUDE",
+	"EXCLUDE_FILE",
+	"EXCLUDE_ORGS",
+	"EXCLUDE_REGEX",
+	"FAILURE_BACKOFF_AFTER",
+	"FAILURE_BACKOFF_SECONDS",
+	"FOLLOW_RENAMES",
+	"GITEA_ATTIC_ORGANIZATION",
+	"GITEA_CA_CERT",
+	"GITEA_CHECK_QUOTA",
+	"GITEA_DISK_BUDGET_MB",
+	"GITEA_INSECURE_SKIP_VERIFY",
+	"GITEA_MAX_REPO_CREATION",
+	"GITEA_MIGRATE_TIMEOUT",
+	"GITEA_MIGRATIONS_PER_MINUTE",
+	"GITEA_ORGANIZATION",
+	"GITEA_ORG_VISIBILITY",
+	"GITEA_PROXY",
+	"GITEA_REQUESTS_PER_SECOND",
+	"GITEA_STARRED_ORGANIZATION",
+	"GITEA_SUDO_USER",
+	"GITEA_TIMEOUT",
+	"GITEA_TOKEN",
+	"GITEA_TOKEN_FILE",
+	"GITEA_URL",
+	"GITEA_WATCHED_ORGANIZATION",
+	"GITEA_WEBHOOK_CONTENT_TYPE",
+	"GITEA_WEBHOOK_EVENTS",
+	"GITEA_WEBHOOK_SECRET",
+	"GITEA_WEBHOOK_SECRET_FILE",
+	"GITEA_WEBHOOK_URL",
+	"GITHUB_API_URL",
+	"GITHUB_DISCOVERY",
+	"GITHUB_PROXY",
+	"GITHUB_TOKEN",
+	"GITHUB_TOKEN_FILE",
+	"GITHUB_USERNAME",
+	"GITHUB_WEBHOOK_SECRET",
+	"GITHUB_WEBHOOK_SECRET_FILE",
+	"HEALTHCHECK_PING_URL",
+	"HEALTHCHECK_PING_URL_FILE",
+	"INCLUDE",
+	"INCLUDE_FILE",
+	"INCLUDE_ORGS",
+	"INCLUDE_REGEX",
+	"LEADER_LEASE_SECONDS",
+	"LEADER_LOCK",
+	"LFS_ENDPOINT",
+	"LOCK_FILE",
+	"LOG_LEVEL",
+	"MAX_MIRROR_LAG",
+	"MAX_NEW_MIRRORS_PER_RUN",
+	"MIGRATION_WAIT_TIMEOUT",
+	"MIRROR_AVATARS",
+	"MIRROR_ISSUES",
+	"MIRROR_ISSUE_ATTACHMENTS",
+	"MIRROR_LFS",
+	"MIRROR_ORGANIZATIONS",
+	"MIRROR_PRIVATE_REPOSITORIES",
+	"MIRROR_RELEASE_ARCHIVES",
+	"MIRROR_REPO_UNITS",
+	"MIRROR_STARRED",
+	"MIRROR_TEAMS",
+	"MIRROR_WATCHED",
+	"MIRROR_RULESETS",
+	"MIRROR_WEBHOOKS",
+	"MOVE_TRANSFERRED_MIRRORS",
+	"NAME_COLLISION_STRATEGY",
+	"NATIVE_MIGRATION",
+	"NATIVE_MIGRATION_ITEMS",
+	"ORG_MAPPING",
+	"ORG_NAME_TEMPLATE",
+	"ORPHAN_CLEANUP",
+	"ORPHAN_RETENTION_DAYS",
+	"OUTPUT",
+	"PRESERVE_ISSUE_TIMESTAMPS",
+	"PRESERVE_ORG_STRUCTURE",
+	"PROGRESS_INTERVAL",
+	"PROTECTED_REPOS",
+	"PROTECT_TOPIC",
+	"PUSH_MIRROR_OWNER",
+	"QUEUE_BATCH_SIZE",
+	"QUEUE_URL",
+	"REPAIR_BROKEN_MIRRORS",
+	"REPAIR_PARTIAL_MIGRATIONS",
+	"REPO_LOG_DIR",
+	"REPO_NAME_TEMPLATE",
+	"SCHEDULE",
+	"SECRETS_PROVIDER",
+	"SECRETS_REFRESH_INTERVAL",
+	"SERVE_ADDR",
+	"SINGLE_REPO",
+	"SINGLE_RUN",
+	"SKIP_FORKS",
+	"SKIP_STARRED_ISSUES",
+	"SKIP_TAGS",
+	"SKIP_UNCHANGED",
+	"SORT_BY",
+	"SOURCE_TYPE",
+	"SOURCE_URL",
+	"STARRED_VISIBILITY",
+	"STAR_INTERVAL_MS",
+	"STATE_FILE",
+	"TOPIC_MAPPING",
+	"UPDATE_MIRROR_CREDENTIALS",
+	"USER_MAP",
+	"USE_SPECIFIC_USER",
+	"VAULT_ADDR",
+	"VAULT_SECRET_PATH",
+	"VAULT_TOKEN",
+	"VAULT_TOKEN_FILE",
+	"VERIFY_CONTENT",
+	"VISIBILITY_OVERRIDE",
+	"WAIT_FOR_MIGRATION",
+}
+
+// ignoredSettings are combinations of settings that are accepted but where
+// one setting doesn't do anything.
+var ignoredSettings = []struct {
+	variable string
+	other    string
+	// together means variable is ignored if other is set, otherwise if it isn't
+	together bool
+}{
+	{"MIRROR_ORGANIZATIONS", "SINGLE_REPO", true},
+	{"MIRROR_STARRED", "SINGLE_REPO", true},
+	{"MIRROR_WATCHED", "SINGLE_REPO", true},
+	{"MIRROR_PRIVATE_REPOSITORIES", "SINGLE_REPO", true},
+	{"INCLUDE_ORGS", "MIRROR_ORGANIZATIONS", false},
+	{"EXCLUDE_ORGS", "MIRROR_ORGANIZATIONS", false},
+	{"GITEA_STARRED_ORGANIZATION", "MIRROR_STARRED", false},
+	{"STARRED_VISIBILITY", "MIRROR_STARRED", false},
+	{"SKIP_STARRED_ISSUES", "MIRROR_STARRED", false},
+	{"SKIP_STARRED_ISSUES", "MIRROR_ISSUES", false},
+	{"MIRROR_ISSUE_ATTACHMENTS", "MIRROR_ISSUES", false},
+	{"GITEA_WATCHED_ORGANIZATION", "MIRROR_WATCHED", false},
+	{"MIGRATION_WAIT_TIMEOUT", "WAIT_FOR_MIGRATION", false},
+	{"SKIP_TAGS", "DEFAULT_BRANCH_ONLY", false},
+	{"LEADER_LEASE_SECONDS", "LEADER_LOCK", false},
+	{"QUEUE_BATCH_SIZE", "QUEUE_URL", false},
+	{"FAILURE_BACKOFF_SECONDS", "FAILURE_BACKOFF_AFTER", false},
+	{"MOVE_TRANSFERRED_MIRRORS", "FOLLOW_RENAMES", false},
+	{"NATIVE_MIGRATION_ITEMS", "NATIVE_MIGRATION", false},
+	{"PRESERVE_ISSUE_TIMESTAMPS", "MIRROR_ISSUES", false},
+	{"GITEA_ATTIC_ORGANIZATION", "ORPHAN_CLEANUP", false},
+	{"ORPHAN_RETENTION_DAYS", "ORPHAN_CLEANUP", false},
+	{"DELAY", "SCHEDULE", true},
+	{"DELAY", "SINGLE_RUN", true},
+}
+
+// ownPrefixes mark variables that are meant for this tool. Other unknown
+// variables are only reported if they look like a typo.
+var ownPrefixes = []string{"MIRROR_", "GITEA_"}
+
+// Diagnostic is a problem with the environment found by Check.
+type Diagnostic struct {
+	Variable string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Variable, d.Message)
+}
+
+// Check reports unknown variables, likely typos of known ones, and settings
+// that have no effect in combination with others. environ is in the form of
+// os.Environ.
+func Check(environ []string) []Diagnostic {
+	env := make(map[string]string)
+	for _, entry := range environ {
+		name, value, _ := strings.Cut(entry, "=")
+		env[name] = value
+	}
+	known := make(map[string]bool, len(variables))
+	for _, variable := range variables {
+		known[variable] = true
+	}
+	set := func(variable string) bool {
+		value := env[variable]
+		if value == "false" || value == "FALSE" || value == "0" {
+			return false
+		}
+		return value != ""
+	}
+
+	var diagnostics []Diagnostic
+	for name := range env {
+		if known[name] {
+			continue
+		}
+		if suggestion := closestVariable(name); suggestion != "" {
+			diagnostics = append(diagnostics, Diagnostic{name, fmt.Sprintf("unknown setting, did you mean %s?", suggestion)})
+			continue
+		}
+		for _, prefix := range ownPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				diagnostics = append(diagnostics, Diagnostic{name, "unknown setting"})
+				break
+			}
+		}
+	}
+
+	for _, ignored := range ignoredSettings {
+		if !set(ignored.variable) || set(ignored.other) != ignored.together {
+			continue
+		}
+		if ignored.together {
+			diagnostics = append(diagnostics, Diagnostic{ignored.variable, fmt.Sprintf("has no effect together with %s", ignored.other)})
+		} else {
+			diagnostics = append(diagnostics, Diagnostic{ignored.variable, fmt.Sprintf("has no effect without %s", ignored.other)})
+		}
+	}
+
+	// A fixed LFS server would be asked for the objects of every repository
+	if endpoint := env["LFS_ENDPOINT"]; endpoint != "" && !strings.Contains(endpoint, "{{") {
+		diagnostics = append(diagnostics, Diagnostic{"LFS_ENDPOINT", "is the same for every repository, use a template like https://lfs.example.com/{{.FullName}}.git/info/lfs or leave it unset"})
+	}
+
+	// Gitea imports only the wiki into pull mirrors, it drops the other items
+	// of mirror migrations and all mirrors here are pull mirrors
+	if set("NATIVE_MIGRATION") {
+		var dropped []string
+		for _, item := range strings.Split(env["NATIVE_MIGRATION_ITEMS"], ",") {
+			if item = strings.TrimSpace(item); item != "" && item != "wiki" {
+				dropped = append(dropped, item)
+			}
+		}
+		if len(dropped) > 0 {
+			diagnostics = append(diagnostics, Diagnostic{"NATIVE_MIGRATION_ITEMS", fmt.Sprintf("Gitea doesn't import %s into pull mirrors, only the wiki", strings.Join(dropped, ", "))})
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Variable < diagnostics[j].Variable
+	})
+	return diagnostics
+}
+
+// closestVariable returns the known variable name is a likely typo of. Short
+// names only allow a single edit, so unrelated variables aren't reported.
+func closestVariable(name string) string {
+	maxDistance := 1
+	if len(name) >= 8 {
+		maxDistance = 2
+	}
+
+	closest := ""
+	for _, variable := range variables {
+		if distance := editDistance(name, variable); distance <= maxDistance {
+			closest, maxDistance = variable, distance-1
+		}
+	}
+	return closest
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	t.Run("suggests known settings for typos", func(t *testing.T) {
+		diagnostics := Check([]string{"MIROR_ISSUES=true", "GITHUB_USERNAME=octo", "PATH=/usr/bin"})
+		if len(diagnostics) != 1 || diagnostics[0].String() != "MIROR_ISSUES: unknown setting, did you mean MIRROR_ISSUES?" {
+			t.Errorf("unexpected diagnostics: %v", diagnostics)
+		}
+	})
+
+	t.Run("reports unknown settings with an own prefix", func(t *testing.T) {
+		diagnostics := Check([]string{"GITEA_MIRROR_EVERYTHING=true"})
+		if len(diagnostics) != 1 || diagnostics[0].Message != "unknown setting" {
+			t.Errorf("unexpected diagnostics: %v", diagnostics)
+		}
+	})
+
+	t.Run("reports ignored settings", func(t *testing.T) {
+		diagnostics := Check([]string{"SINGLE_REPO=https://github.com/octo/demo", "MIRROR_ORGANIZATIONS=true", "MIRROR_STARRED=false", "INCLUDE_ORGS=octo"})
+		var messages []string
+		for _, diagnostic := range diagnostics {
+			messages = append(messages, diagnostic.String())
+		}
+		want := []string{"MIRROR_ORGANIZATIONS: has no effect together with SINGLE_REPO"}
+		if !slices.Equal(messages, want) {
+			t.Errorf("expected %v, got %v", want, messages)
+		}
+	})
+
+	t.Run("reports fixed LFS endpoints", func(t *testing.T) {
+		if diagnostics := Check([]string{"LFS_ENDPOINT=https://lfs.example.com"}); len(diagnostics) != 1 || diagnostics[0].Variable != "LFS_ENDPOINT" {
+			t.Errorf("unexpected diagnostics: %v", diagnostics)
+		}
+		if diagnostics := Check([]string{"LFS_ENDPOINT=https://lfs.example.com/{{.FullName}}.git/info/lfs"}); len(diagnostics) != 0 {
+			t.Errorf("expected templates to pass, got %v", diagnostics)
+		}
+	})
+
+	t.Run("reports items pull mirrors don't import", func(t *testing.T) {
+		diagnostics := Check([]string{"NATIVE_MIGRATION=true", "NATIVE_MIGRATION_ITEMS=wiki, releases,issues"})
+		if len(diagnostics) != 1 || diagnostics[0].Variable != "NATIVE_MIGRATION_ITEMS" || !strings.Contains(diagnostics[0].Message, "releases, issues") {
+			t.Errorf("unexpected diagnostics: %v", diagnostics)
+		}
+		if diagnostics := Check([]string{"NATIVE_MIGRATION=true", "NATIVE_MIGRATION_ITEMS=wiki"}); len(diagnostics) != 0 {
+			t.Errorf("expected the wiki to pass, got %v", diagnostics)
+		}
+	})
+
+	t.Run("knows every documented setting", func(t *testing.T) {
+		readme, err := os.ReadFile("../README.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range regexp.MustCompile(`(?m)^\| ([A-Z][A-Z0-9_]+) +\|`).FindAllStringSubmatch(string(readme), -1) {
+			if !slices.Contains(variables, match[1]) {
+				t.Errorf("%s is documented but unknown to the check", match[1])
+			}
+		}
+	})
+}
@@ -1,19 +1,36 @@
 package config
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"text/template"
+
+	"github.com/jaedle/mirror-to-gitea/schedule"
+	"github.com/jaedle/mirror-to-gitea/secrets"
+	"github.com/jaedle/mirror-to-gitea/transport"
 )
 
 type GitHubConfig struct {
-	Username             string
+	Username string
+	// PushMirrorOwner is the GitHub user or organization the push-mirrors
+	// command backs up Gitea repositories to
+	PushMirrorOwner      string
 	Token                string
+	Tokens               []string
+	APIURL               string
+	Proxy                string
 	SkipForks            bool
 	PrivateRepositories  bool
 	MirrorIssues         bool
 	MirrorStarred        bool
+	MirrorWatched        bool
 	MirrorOrganizations  bool
 	UseSpecificUser      bool
 	SingleRepo           string
@@ -21,24 +38,221 @@ type GitHubConfig struct {
 	ExcludeOrgs          []string
 	PreserveOrgStructure bool
 	SkipStarredIssues    bool
+	ReleaseArchives      bool
+	RehostAttachments    bool
+	MirrorLFS            bool
+	// LFSEndpoint renders the LFS server of a repository, nil lets Gitea
+	// derive it from the clone URL
+	LFSEndpointTemplate string
+	LFSEndpoint         *template.Template
+	MirrorWebhooks      bool
+	// MirrorRulesets translates rulesets to branch and tag protections
+	MirrorRulesets  bool
+	MirrorTeams     bool
+	MirrorAvatars   bool
+	NativeMigration bool
+	// NativeItems lists what the native migration imports, nil imports all
+	NativeItems []string
+	// PreserveTimestamps dates mirrored issues and comments back to GitHub's
+	PreserveTimestamps bool
+	Discovery          string
+	// FollowRenames re-points mirrors of renamed or transferred repositories,
+	// MoveTransferred also moves them to the new owner's Gitea organization
+	FollowRenames   bool
+	MoveTransferred bool
+	// WebhookSecret validates the deliveries received by the serve command
+	WebhookSecret string
+}
+
+// SourceConfig selects where repositories are mirrored from. With a Gitea
+// source the GitHub username and token are those of the user on that
+// instance.
+type SourceConfig struct {
+	Type string // github or gitea
+	URL  string
 }
 
 type GiteaConfig struct {
-	URL             string
-	Token           string
+	URL   string
+	Token string
+	Proxy string
+	// SudoUser makes an admin token act as this user
+	SudoUser string
+	// AuditLog is a file recording every change made to Gitea, disabled if empty
+	AuditLog string
+	// CACert is a PEM file of additional certificate authorities to trust
+	CACert             string
+	InsecureSkipVerify bool
+	// Timeouts in seconds, zero disables them
+	TimeoutSeconds        int
+	MigrateTimeoutSeconds int
+	// RequestsPerSecond and MigrationsPerMinute limit the requests sent to
+	// Gitea, zero disabling the limit
+	RequestsPerSecond   int
+	MigrationsPerMinute int
+	// WaitForMigration polls new mirrors until their content has been cloned
+	WaitForMigration     bool
+	MigrationWaitSeconds int
+	// CloneFallback clones and pushes repositories whose migration failed,
+	// keeping the clones below CloneCacheDir
+	CloneFallback bool
+	CloneCacheDir string
+	// DefaultBranchOnly pushes only the default branch of new repositories,
+	// and their tags unless SkipTags is set, instead of mirroring them
+	DefaultBranchOnly bool
+	SkipTags          bool
+	// RepairBrokenMirrors re-migrates mirrors Gitea fails to sync
+	RepairBrokenMirrors bool
+	// RepairPartialMigrations deletes and re-migrates mirrors left empty by
+	// a migration that failed midway
+	RepairPartialMigrations bool
+	// UpdateMirrorCredentials re-migrates private mirrors once the GitHub
+	// token they were created with changed
+	UpdateMirrorCredentials bool
+	// VerifyContent compares the branches of existing mirrors with GitHub and
+	// either reports or resyncs diverged ones, disabled if empty
+	VerifyContent string
+	// OrphanCleanup archives mirrors whose GitHub repository was deleted or
+	// moves them to AtticOrganization, deleting them after
+	// OrphanRetentionDays unless that is 0; disabled if empty
+	OrphanCleanup       string
+	AtticOrganization   string
+	OrphanRetentionDays int
+	// ProtectTopic and ProtectedRepos exempt mirrors from anything that would
+	// delete, move or replace them, by a topic on Gitea or by Gitea full name
+	ProtectTopic   string
+	ProtectedRepos []string
+
 	Organization    string
 	Visibility      string
 	StarredReposOrg string
+	WatchedReposOrg string
+
+	RepoNameTemplate string
+	RepoName         *template.Template
+	// OrgMapping and OrgName rename the organizations of
+	// PRESERVE_ORG_STRUCTURE, the mapping taking precedence
+	OrgMapping      map[string]string
+	OrgNameTemplate string
+	OrgName         *template.Template
+	// TopicMapping routes repositories by lower-cased GitHub topic to Gitea organizations
+	TopicMapping      map[string]string
+	CollisionStrategy string
+	MaxRepoCreation   int
+	// DiskBudgetMB caps the space the repositories of the targets take, unlimited if 0
+	DiskBudgetMB int
+	// CheckQuota compares the new mirrors of a run with the quotas of Forgejo
+	CheckQuota        bool
+	StarIntervalMs    int
+	StarredVisibility string
+	// VisibilityOverride is public or private to set the visibility of new
+	// mirrors, or source to copy it from GitHub
+	VisibilityOverride string
+
+	// Webhook installed on every mirror, disabled if WebhookURL is empty
+	WebhookURL         string
+	WebhookContentType string
+	WebhookEvents      []string
+	WebhookSecret      string
+
+	DeployKeys []DeployKey
+	// RepoUnits lists the units new mirrors keep, nil leaves them as created
+	RepoUnits []string
+}
+
+// SecretsConfig selects where tokens are read from if they aren't set in
+// the environment.
+type SecretsConfig struct {
+	Provider        string // env or vault
+	VaultAddr       string
+	VaultPath       string
+	RefreshInterval int // in seconds
+
+	// Source provides the secrets listed in Rotating, nil for env
+	Source   secrets.Provider
+	Rotating []string
+}
+
+// BackupConfig locates the S3 compatible bucket that receives git bundles
+// of the mirrored repositories.
+type BackupConfig struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// Retention is the number of bundles kept per repository
+	Retention int
 }
 
 type Config struct {
-	GitHub    GitHubConfig
-	Gitea     GiteaConfig
-	DryRun    bool
-	Delay     int
-	Include   []string
-	Exclude   []string
-	SingleRun bool
+	Source       SourceConfig
+	GitHub       GitHubConfig
+	Gitea        GiteaConfig
+	DryRun       bool
+	Delay        int
+	Include      []string
+	Exclude      []string
+	IncludeRegex *regexp.Regexp
+	ExcludeRegex *regexp.Regexp
+	// ExcludeFile is the EXCLUDE_FILE the dashboard adds excluded repositories to
+	ExcludeFile string
+	SingleRun   bool
+	SortBy      string
+	ConfigFile  string
+	Rules       []Rule
+	// Organizations holds settings by lower-cased GitHub organization
+	Organizations map[string]*Organization
+	// UserMap maps GitHub logins to Gitea usernames
+	UserMap map[string]string
+	Secrets SecretsConfig
+	// StateFile persists data such as cached GitHub responses between runs
+	StateFile string
+	// SkipUnchanged skips repositories not pushed to since their last successful run
+	SkipUnchanged bool
+	// FailureBackoffAfter consecutive failures skip a repository for
+	// FailureBackoff seconds, doubling with every further failure; disabled if 0
+	FailureBackoffAfter int
+	FailureBackoff      int
+	// ServeAddr is where the serve command listens for GitHub webhooks
+	ServeAddr string
+	// APIToken enables the management API of the serve command and
+	// authenticates its requests
+	APIToken string
+	// Schedule runs the mirroring at the times of a cron expression instead of after DELAY
+	Schedule *schedule.Schedule
+	// DelayJitter is the maximum random delay in seconds before each run
+	DelayJitter int
+	// LockFile keeps two runs sharing it from mirroring at the same time
+	LockFile string
+	// Backup is nil unless bundles are backed up to S3
+	Backup *BackupConfig
+	// ProgressInterval is the minimum number of seconds between progress reports of a run
+	ProgressInterval int
+	// MaxNewMirrorsPerRun caps the migrations of a run, unlimited if 0
+	MaxNewMirrorsPerRun int
+	// MaxMirrorLag in seconds raises an alert for mirrors out of date for
+	// longer, disabled if 0
+	MaxMirrorLag int
+	// AlertWebhookURL receives the alerts, they are only logged if empty
+	AlertWebhookURL string
+	// LeaderLock is the lease file or redis:// URL replicas elect the one
+	// running the schedule with, LeaderLease the TTL of the lease in seconds
+	LeaderLock  string
+	LeaderLease int
+	// Queue is the redis:// URL of the queue workers mirror from, runs only
+	// discover if set
+	Queue          string
+	QueueBatchSize int
+	// HealthcheckPingURL is pinged at the start and end of every run
+	HealthcheckPingURL string
+	// Output is text, or ndjson to emit an event per action to stdout
+	Output string
+	// LogLevel is info, or debug to trace every request sent to GitHub and Gitea
+	LogLevel string
+	// RepoLogDir keeps a log file per repository below it, disabled if empty
+	RepoLogDir string
 }
 
 func readEnv(variable string) string {
@@ -53,6 +267,111 @@ func mustReadEnv(variable string) (string, error) {
 	return val, nil
 }
 
+// readSecret reads a secret from the variable or from the file named by the
+// variable with a _FILE suffix, e.g. for Docker or Kubernetes secrets. If
+// neither is set, the secret is looked up in the configured secrets provider.
+func readSecret(secretsCfg *SecretsConfig, variable string) (string, error) {
+	val := os.Getenv(variable)
+	file := os.Getenv(variable + "_FILE")
+	if file != "" {
+		if val != "" {
+			return "", fmt.Errorf("invalid configuration, only one of %s and %s_FILE may be set", variable, variable)
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("invalid configuration, cannot read %s_FILE: %w", variable, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	if val != "" || secretsCfg == nil || secretsCfg.Source == nil {
+		return val, nil
+	}
+
+	val, err := secretsCfg.Source.Secret(context.Background(), variable)
+	if err != nil {
+		return "", fmt.Errorf("invalid configuration, cannot read %s from %s: %w", variable, secretsCfg.Provider, err)
+	}
+	if val != "" {
+		secretsCfg.Rotating = append(secretsCfg.Rotating, variable)
+	}
+	return val, nil
+}
+
+func mustReadSecret(secretsCfg *SecretsConfig, variable string) (string, error) {
+	val, err := readSecret(secretsCfg, variable)
+	if err != nil {
+		return "", err
+	}
+	if val == "" {
+		return "", fmt.Errorf("invalid configuration, please provide %s or %s_FILE", variable, variable)
+	}
+	return val, nil
+}
+
+// readBackupConfig reads the S3 backup settings, nil if BACKUP_S3_BUCKET is unset.
+func readBackupConfig(secretsCfg *SecretsConfig) (*BackupConfig, error) {
+	bucket := readEnv("BACKUP_S3_BUCKET")
+	if bucket == "" {
+		return nil, nil
+	}
+
+	backup := &BackupConfig{
+		Endpoint:  readEnv("BACKUP_S3_ENDPOINT"),
+		Bucket:    bucket,
+		Region:    readEnv("BACKUP_S3_REGION"),
+		Prefix:    readEnv("BACKUP_S3_PREFIX"),
+		Retention: readInt("BACKUP_RETENTION", 7),
+	}
+	if backup.Region == "" {
+		backup.Region = "us-east-1"
+	}
+	if backup.Endpoint == "" {
+		backup.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", backup.Region)
+	}
+	if backup.Retention < 1 {
+		return nil, fmt.Errorf("invalid configuration, BACKUP_RETENTION must keep at least one bundle, got %d", backup.Retention)
+	}
+
+	var err error
+	if backup.AccessKey, err = mustReadSecret(secretsCfg, "BACKUP_S3_ACCESS_KEY"); err != nil {
+		return nil, err
+	}
+	if backup.SecretKey, err = mustReadSecret(secretsCfg, "BACKUP_S3_SECRET_KEY"); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// readSecretsConfig sets up the secrets provider selected by SECRETS_PROVIDER.
+func readSecretsConfig() (*SecretsConfig, error) {
+	secretsCfg := &SecretsConfig{
+		Provider:        readEnv("SECRETS_PROVIDER"),
+		RefreshInterval: readInt("SECRETS_REFRESH_INTERVAL", 300),
+	}
+
+	switch secretsCfg.Provider {
+	case "", "env":
+		secretsCfg.Provider = "env"
+	case "vault":
+		secretsCfg.VaultAddr = readEnv("VAULT_ADDR")
+		secretsCfg.VaultPath = readEnv("VAULT_SECRET_PATH")
+		vaultToken, err := readSecret(nil, "VAULT_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		if secretsCfg.VaultAddr == "" || secretsCfg.VaultPath == "" || vaultToken == "" {
+			return nil, fmt.Errorf("invalid configuration, the vault secrets provider requires VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH")
+		}
+		secretsCfg.Source = secrets.NewVault(secretsCfg.VaultAddr, vaultToken, secretsCfg.VaultPath)
+	default:
+		return nil, fmt.Errorf("invalid configuration, SECRETS_PROVIDER must be one of env or vault")
+	}
+
+	return secretsCfg, nil
+}
+
 func readBoolean(variable string) bool {
 	val := os.Getenv(variable)
 	return val == "true" || val == "TRUE" || val == "1"
@@ -70,6 +389,77 @@ func readInt(variable string, defaultValue int) int {
 	return intVal
 }
 
+func readRegex(variable string) (*regexp.Regexp, error) {
+	val := os.Getenv(variable)
+	if val == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(val)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration, %s is not a valid regular expression: %w", variable, err)
+	}
+	return re, nil
+}
+
+func readProxy(variable string) (string, error) {
+	val := readEnv(variable)
+	if val == "" {
+		return "", nil
+	}
+	if _, err := transport.ParseProxy(val); err != nil {
+		return "", fmt.Errorf("invalid configuration, %s: %w", variable, err)
+	}
+	return val, nil
+}
+
+// readJSONMap reads a JSON object of strings either inline from the variable
+// or from the file the variable points to.
+func readJSONMap(variable string) (map[string]string, error) {
+	val := strings.TrimSpace(os.Getenv(variable))
+	if val == "" {
+		return map[string]string{}, nil
+	}
+
+	data := []byte(val)
+	if !strings.HasPrefix(val, "{") {
+		fileData, err := os.ReadFile(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration, cannot read %s: %w", variable, err)
+		}
+		data = fileData
+	}
+
+	result := map[string]string{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid configuration, %s must be a JSON object of strings: %w", variable, err)
+	}
+	return result, nil
+}
+
+// readListFile reads the newline-delimited entries of the file the variable
+// points to, skipping blank lines and # comments.
+func readListFile(variable string) ([]string, error) {
+	path := readEnv(variable)
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration, cannot read %s: %w", variable, err)
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries, nil
+}
+
 func splitAndTrim(s string) []string {
 	if s == "" {
 		return []string{}
@@ -87,6 +477,11 @@ func splitAndTrim(s string) []string {
 
 func Load() (*Config, error) {
 	const defaultDelay = 3600
+	const defaultProgressInterval = 60
+	const defaultLeaderLease = 60
+	const defaultQueueBatchSize = 10
+	const defaultFailureBackoff = 3600
+	const defaultOrphanRetention = 30
 	const defaultInclude = "*"
 	const defaultExclude = ""
 
@@ -100,16 +495,31 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
-	giteaToken, err := mustReadEnv("GITEA_TOKEN")
+	secretsCfg, err := readSecretsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	giteaToken, err := mustReadSecret(secretsCfg, "GITEA_TOKEN")
 	if err != nil {
 		return nil, err
 	}
 
-	githubToken := readEnv("GITHUB_TOKEN")
+	githubToken, err := readSecret(secretsCfg, "GITHUB_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	// Several comma separated tokens are used in turn as their quota runs out
+	githubTokens := splitAndTrim(githubToken)
+	if len(githubTokens) > 0 {
+		githubToken = githubTokens[0]
+	}
 	privateRepositories := readBoolean("MIRROR_PRIVATE_REPOSITORIES")
 	mirrorIssues := readBoolean("MIRROR_ISSUES")
 	mirrorStarred := readBoolean("MIRROR_STARRED")
+	mirrorWatched := readBoolean("MIRROR_WATCHED")
 	mirrorOrganizations := readBoolean("MIRROR_ORGANIZATIONS")
+	mirrorWebhooks := readBoolean("MIRROR_WEBHOOKS")
 	singleRepo := readEnv("SINGLE_REPO")
 
 	// Validate GitHub token requirements
@@ -117,12 +527,116 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid configuration, mirroring private repositories requires setting GITHUB_TOKEN")
 	}
 
-	if (mirrorIssues || mirrorStarred || mirrorOrganizations || singleRepo != "") && githubToken == "" {
-		return nil, fmt.Errorf("invalid configuration, mirroring issues, starred repositories, organizations, or a single repo requires setting GITHUB_TOKEN")
+	if (mirrorIssues || mirrorStarred || mirrorWatched || mirrorOrganizations || singleRepo != "") && githubToken == "" {
+		return nil, fmt.Errorf("invalid configuration, mirroring issues, starred or watched repositories, organizations, or a single repo requires setting GITHUB_TOKEN")
+	}
+
+	preserveOrgStructure := readBoolean("PRESERVE_ORG_STRUCTURE")
+	mirrorTeams := readBoolean("MIRROR_TEAMS")
+	if mirrorTeams && (!preserveOrgStructure || githubToken == "") {
+		return nil, fmt.Errorf("invalid configuration, mirroring teams requires PRESERVE_ORG_STRUCTURE and GITHUB_TOKEN")
+	}
+
+	// Social preview images are only exposed through GraphQL
+	mirrorAvatars := readBoolean("MIRROR_AVATARS")
+	if mirrorAvatars && githubToken == "" {
+		return nil, fmt.Errorf("invalid configuration, mirroring avatars requires setting GITHUB_TOKEN")
+	}
+
+	// GraphQL needs authentication, so anonymous runs stay on REST
+	discovery := readEnv("GITHUB_DISCOVERY")
+	if discovery == "" {
+		discovery = "rest"
+		if githubToken != "" {
+			discovery = "graphql"
+		}
+	}
+	if discovery != "graphql" && discovery != "rest" {
+		return nil, fmt.Errorf("invalid configuration, GITHUB_DISCOVERY must be one of graphql or rest")
+	}
+	if discovery == "graphql" && githubToken == "" {
+		return nil, fmt.Errorf("invalid configuration, GraphQL discovery requires setting GITHUB_TOKEN")
+	}
+
+	if mirrorWebhooks && githubToken == "" {
+		return nil, fmt.Errorf("invalid configuration, mirroring webhooks requires setting GITHUB_TOKEN")
+	}
+
+	sourceType := readEnv("SOURCE_TYPE")
+	if sourceType == "" {
+		sourceType = "github"
+	}
+	if sourceType != "github" && sourceType != "gitea" {
+		return nil, fmt.Errorf("invalid configuration, SOURCE_TYPE must be one of github or gitea")
+	}
+	sourceURL := readEnv("SOURCE_URL")
+	if sourceType == "gitea" {
+		if sourceURL == "" {
+			return nil, fmt.Errorf("invalid configuration, SOURCE_TYPE gitea requires setting SOURCE_URL")
+		}
+		// These read issues, metadata or settings through the GitHub API
+		if mirrorIssues || mirrorWatched || mirrorTeams || mirrorAvatars || mirrorWebhooks || singleRepo != "" || readBoolean("MIRROR_RELEASE_ARCHIVES") {
+			return nil, fmt.Errorf("invalid configuration, mirroring issues, watched repositories, teams, avatars, webhooks, release archives or a single repo requires SOURCE_TYPE github")
+		}
+	}
+
+	githubProxy, err := readProxy("GITHUB_PROXY")
+	if err != nil {
+		return nil, err
+	}
+
+	giteaProxy, err := readProxy("GITEA_PROXY")
+	if err != nil {
+		return nil, err
+	}
+
+	mirrorLFS := readBoolean("MIRROR_LFS")
+	lfsEndpointTemplate := readEnv("LFS_ENDPOINT")
+	if lfsEndpointTemplate != "" && !mirrorLFS {
+		return nil, fmt.Errorf("invalid configuration, LFS_ENDPOINT requires MIRROR_LFS")
+	}
+	var lfsEndpoint *template.Template
+	if lfsEndpointTemplate != "" {
+		lfsEndpoint, err = parseNameTemplate(lfsEndpointTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration, LFS_ENDPOINT: %w", err)
+		}
+	}
+
+	includeRegex, err := readRegex("INCLUDE_REGEX")
+	if err != nil {
+		return nil, err
+	}
+
+	excludeRegex, err := readRegex("EXCLUDE_REGEX")
+	if err != nil {
+		return nil, err
+	}
+
+	var runSchedule *schedule.Schedule
+	if spec := readEnv("SCHEDULE"); spec != "" {
+		if readBoolean("SINGLE_RUN") {
+			return nil, fmt.Errorf("invalid configuration, SCHEDULE can't be combined with SINGLE_RUN")
+		}
+		runSchedule, err = schedule.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration, SCHEDULE: %w", err)
+		}
 	}
 
+	includeList, err := readListFile("INCLUDE_FILE")
+	if err != nil {
+		return nil, err
+	}
+
+	excludeList, err := readListFile("EXCLUDE_FILE")
+	if err != nil {
+		return nil, err
+	}
+
+	// Only fall back to the match-all glob when no include regex or list narrows the selection
 	includeStr := readEnv("INCLUDE")
-	if includeStr == "" {
+	if includeStr == "" && includeRegex == nil && readEnv("INCLUDE_FILE") == "" {
 		includeStr = defaultInclude
 	}
 
@@ -131,6 +645,291 @@ func Load() (*Config, error) {
 		excludeStr = defaultExclude
 	}
 
+	repoNameTemplate := readEnv("REPO_NAME_TEMPLATE")
+	var repoName *template.Template
+	if repoNameTemplate != "" {
+		repoName, err = parseNameTemplate(repoNameTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration, REPO_NAME_TEMPLATE: %w", err)
+		}
+	}
+
+	orgMapping, err := readJSONMap("ORG_MAPPING")
+	if err != nil {
+		return nil, err
+	}
+	topics, err := readJSONMap("TOPIC_MAPPING")
+	if err != nil {
+		return nil, err
+	}
+	var topicMapping map[string]string
+	if topics != nil {
+		// GitHub topics are always lower case
+		topicMapping = make(map[string]string, len(topics))
+		for topic, org := range topics {
+			topicMapping[strings.ToLower(topic)] = org
+		}
+	}
+	orgNameTemplate := readEnv("ORG_NAME_TEMPLATE")
+	var orgName *template.Template
+	if orgNameTemplate != "" {
+		orgName, err = parseNameTemplate(orgNameTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration, ORG_NAME_TEMPLATE: %w", err)
+		}
+	}
+
+	collisionStrategy := readEnv("NAME_COLLISION_STRATEGY")
+	if collisionStrategy == "" {
+		collisionStrategy = "prefix"
+	}
+	if collisionStrategy != "prefix" && collisionStrategy != "suffix" && collisionStrategy != "error" {
+		return nil, fmt.Errorf("invalid configuration, NAME_COLLISION_STRATEGY must be one of prefix, suffix or error")
+	}
+
+	requestsPerSecond := readInt("GITEA_REQUESTS_PER_SECOND", 0)
+	migrationsPerMinute := readInt("GITEA_MIGRATIONS_PER_MINUTE", 0)
+	if requestsPerSecond < 0 || migrationsPerMinute < 0 {
+		return nil, fmt.Errorf("invalid configuration, GITEA_REQUESTS_PER_SECOND and GITEA_MIGRATIONS_PER_MINUTE must not be negative")
+	}
+
+	output := readEnv("OUTPUT")
+	if output == "" {
+		output = "text"
+	}
+	if output != "text" && output != "ndjson" {
+		return nil, fmt.Errorf("invalid configuration, OUTPUT must be one of text or ndjson")
+	}
+
+	logLevel := readEnv("LOG_LEVEL")
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	if logLevel != "info" && logLevel != "debug" {
+		return nil, fmt.Errorf("invalid configuration, LOG_LEVEL must be one of info or debug")
+	}
+
+	verifyContent := readEnv("VERIFY_CONTENT")
+	if verifyContent != "" && verifyContent != "report" && verifyContent != "resync" {
+		return nil, fmt.Errorf("invalid configuration, VERIFY_CONTENT must be one of report or resync")
+	}
+	if verifyContent != "" && sourceType != "github" {
+		return nil, fmt.Errorf("invalid configuration, VERIFY_CONTENT requires SOURCE_TYPE github")
+	}
+
+	starredVisibility := readEnv("STARRED_VISIBILITY")
+	if starredVisibility == "" {
+		starredVisibility = "source"
+	}
+	if starredVisibility != "public" && starredVisibility != "private" && starredVisibility != "source" {
+		return nil, fmt.Errorf("invalid configuration, STARRED_VISIBILITY must be one of public, private or source")
+	}
+
+	visibilityOverride := readEnv("VISIBILITY_OVERRIDE")
+	if visibilityOverride == "" {
+		visibilityOverride = "source"
+	}
+	if visibilityOverride != "public" && visibilityOverride != "private" && visibilityOverride != "source" {
+		return nil, fmt.Errorf("invalid configuration, VISIBILITY_OVERRIDE must be one of public, private or source")
+	}
+
+	webhookContentType := readEnv("GITEA_WEBHOOK_CONTENT_TYPE")
+	if webhookContentType == "" {
+		webhookContentType = "json"
+	}
+	if webhookContentType != "json" && webhookContentType != "form" {
+		return nil, fmt.Errorf("invalid configuration, GITEA_WEBHOOK_CONTENT_TYPE must be one of json or form")
+	}
+
+	webhookSecret, err := readSecret(secretsCfg, "GITEA_WEBHOOK_SECRET")
+	if err != nil {
+		return nil, err
+	}
+
+	githubWebhookSecret, err := readSecret(secretsCfg, "GITHUB_WEBHOOK_SECRET")
+	if err != nil {
+		return nil, err
+	}
+
+	webhookEvents := splitAndTrim(readEnv("GITEA_WEBHOOK_EVENTS"))
+	if len(webhookEvents) == 0 {
+		webhookEvents = []string{"push"}
+	}
+
+	deployKeys, err := readDeployKeys("DEPLOY_KEYS")
+	if err != nil {
+		return nil, err
+	}
+
+	// Unset leaves the units alone, only some listed disables all others
+	var repoUnits []string
+	if units := readEnv("MIRROR_REPO_UNITS"); units != "" {
+		repoUnits = splitAndTrim(units)
+	}
+	for _, unit := range repoUnits {
+		if !slices.Contains([]string{"code", "issues", "wiki", "pulls", "projects", "releases", "packages", "actions"}, unit) {
+			return nil, fmt.Errorf("invalid configuration, MIRROR_REPO_UNITS must only contain code, issues, wiki, pulls, projects, releases, packages or actions")
+		}
+	}
+
+	var nativeItems []string
+	if items := readEnv("NATIVE_MIGRATION_ITEMS"); items != "" {
+		nativeItems = splitAndTrim(items)
+	}
+	for _, item := range nativeItems {
+		if !slices.Contains([]string{"labels", "milestones", "releases", "wiki", "issues", "pull-requests"}, item) {
+			return nil, fmt.Errorf("invalid configuration, NATIVE_MIGRATION_ITEMS must only contain labels, milestones, releases, wiki, issues or pull-requests")
+		}
+	}
+
+	sortBy := readEnv("SORT_BY")
+	switch sortBy {
+	case "", "name", "size", "stars", "forks":
+	default:
+		return nil, fmt.Errorf("invalid configuration, SORT_BY must be one of name, size, stars or forks")
+	}
+
+	userMap, err := readJSONMap("USER_MAP")
+	if err != nil {
+		return nil, err
+	}
+
+	configFile := readEnv("CONFIG_FILE")
+	fileConfig := &FileConfig{}
+	if configFile != "" {
+		fileConfig, err = loadFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stateFile := readEnv("STATE_FILE")
+	lockFile := readEnv("LOCK_FILE")
+	if lockFile == "" {
+		lockFile = filepath.Join(os.TempDir(), "mirror-to-gitea.lock")
+		if stateFile != "" && !strings.HasPrefix(stateFile, "redis://") {
+			lockFile = stateFile + ".lock"
+		}
+	}
+
+	// Pushed repositories aren't mirrors, only the state tells them apart
+	cloneFallback := readBoolean("CLONE_FALLBACK")
+	if cloneFallback && stateFile == "" {
+		return nil, fmt.Errorf("invalid configuration, CLONE_FALLBACK requires setting STATE_FILE")
+	}
+	// Like the clone fallback, pushed repositories are told apart by the state
+	defaultBranchOnly := readBoolean("DEFAULT_BRANCH_ONLY")
+	if defaultBranchOnly && stateFile == "" {
+		return nil, fmt.Errorf("invalid configuration, DEFAULT_BRANCH_ONLY requires setting STATE_FILE")
+	}
+	// The state remembers the token each mirror was created with
+	updateMirrorCredentials := readBoolean("UPDATE_MIRROR_CREDENTIALS")
+	if updateMirrorCredentials && stateFile == "" {
+		return nil, fmt.Errorf("invalid configuration, UPDATE_MIRROR_CREDENTIALS requires setting STATE_FILE")
+	}
+	// Only the state knows when a repository was pushed to at the last run
+	skipUnchanged := readBoolean("SKIP_UNCHANGED")
+	if skipUnchanged && stateFile == "" {
+		return nil, fmt.Errorf("invalid configuration, SKIP_UNCHANGED requires setting STATE_FILE")
+	}
+	failureBackoffAfter := readInt("FAILURE_BACKOFF_AFTER", 0)
+	if failureBackoffAfter < 0 {
+		return nil, fmt.Errorf("invalid configuration, FAILURE_BACKOFF_AFTER must not be negative")
+	}
+	if failureBackoffAfter > 0 && stateFile == "" {
+		return nil, fmt.Errorf("invalid configuration, FAILURE_BACKOFF_AFTER requires setting STATE_FILE")
+	}
+	failureBackoff := readInt("FAILURE_BACKOFF_SECONDS", defaultFailureBackoff)
+	if failureBackoff < 1 {
+		return nil, fmt.Errorf("invalid configuration, FAILURE_BACKOFF_SECONDS must be at least 1")
+	}
+	// Only the state knows when an orphan was retired
+	orphanCleanup := readEnv("ORPHAN_CLEANUP")
+	if orphanCleanup != "" && orphanCleanup != "archive" && orphanCleanup != "attic" {
+		return nil, fmt.Errorf("invalid configuration, ORPHAN_CLEANUP must be one of: archive, attic")
+	}
+	if orphanCleanup != "" && stateFile == "" {
+		return nil, fmt.Errorf("invalid configuration, ORPHAN_CLEANUP requires setting STATE_FILE")
+	}
+	atticOrg := readEnv("GITEA_ATTIC_ORGANIZATION")
+	if atticOrg == "" {
+		atticOrg = "attic"
+	}
+	diskBudget := readInt("GITEA_DISK_BUDGET_MB", 0)
+	if diskBudget < 0 {
+		return nil, fmt.Errorf("invalid configuration, GITEA_DISK_BUDGET_MB must not be negative")
+	}
+
+	orphanRetention := readInt("ORPHAN_RETENTION_DAYS", defaultOrphanRetention)
+	if orphanRetention < 0 {
+		return nil, fmt.Errorf("invalid configuration, ORPHAN_RETENTION_DAYS must not be negative")
+	}
+	protectTopic := readEnv("PROTECT_TOPIC")
+	if protectTopic == "" {
+		protectTopic = "keep"
+	}
+	backup, err := readBackupConfig(secretsCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cloneCacheDir := readEnv("CLONE_CACHE_DIR")
+	if cloneCacheDir == "" {
+		cloneCacheDir = filepath.Join(os.TempDir(), "mirror-to-gitea")
+	}
+
+	delayJitter := readInt("DELAY_JITTER", 0)
+	if delayJitter < 0 {
+		return nil, fmt.Errorf("invalid configuration, DELAY_JITTER must not be negative")
+	}
+
+	progressInterval := readInt("PROGRESS_INTERVAL", defaultProgressInterval)
+	if progressInterval < 0 {
+		return nil, fmt.Errorf("invalid configuration, PROGRESS_INTERVAL must not be negative")
+	}
+
+	maxNewMirrors := readInt("MAX_NEW_MIRRORS_PER_RUN", 0)
+	if maxNewMirrors < 0 {
+		return nil, fmt.Errorf("invalid configuration, MAX_NEW_MIRRORS_PER_RUN must not be negative")
+	}
+	maxMirrorLag := readInt("MAX_MIRROR_LAG", 0)
+	if maxMirrorLag < 0 {
+		return nil, fmt.Errorf("invalid configuration, MAX_MIRROR_LAG must not be negative")
+	}
+	alertWebhookURL, err := readSecret(secretsCfg, "ALERT_WEBHOOK_URL")
+	if err != nil {
+		return nil, err
+	}
+	leaderLock := readEnv("LEADER_LOCK")
+	if leaderLock != "" && runSchedule == nil {
+		return nil, fmt.Errorf("invalid configuration, LEADER_LOCK requires SCHEDULE")
+	}
+	leaderLease := readInt("LEADER_LEASE_SECONDS", defaultLeaderLease)
+	if leaderLease < 3 {
+		return nil, fmt.Errorf("invalid configuration, LEADER_LEASE_SECONDS must be at least 3")
+	}
+	queueURL := readEnv("QUEUE_URL")
+	if queueURL != "" && !strings.HasPrefix(queueURL, "redis://") {
+		return nil, fmt.Errorf("invalid configuration, QUEUE_URL must be a redis:// URL")
+	}
+	queueBatchSize := readInt("QUEUE_BATCH_SIZE", defaultQueueBatchSize)
+	if queueBatchSize < 1 {
+		return nil, fmt.Errorf("invalid configuration, QUEUE_BATCH_SIZE must be at least 1")
+	}
+	healthcheckPingURL, err := readSecret(secretsCfg, "HEALTHCHECK_PING_URL")
+	if err != nil {
+		return nil, err
+	}
+
+	serveAddr := readEnv("SERVE_ADDR")
+	if serveAddr == "" {
+		serveAddr = ":8080"
+	}
+	apiToken, err := readSecret(secretsCfg, "API_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+
 	starredOrg := readEnv("GITEA_STARRED_ORGANIZATION")
 	if starredOrg == "" {
 		starredOrg = "github"
@@ -142,33 +941,139 @@ func Load() (*Config, error) {
 	}
 
 	config := &Config{
+		Source: SourceConfig{
+			Type: sourceType,
+			URL:  strings.TrimSuffix(sourceURL, "/"),
+		},
 		GitHub: GitHubConfig{
 			Username:             githubUsername,
+			PushMirrorOwner:      readEnv("PUSH_MIRROR_OWNER"),
 			Token:                githubToken,
+			Tokens:               githubTokens,
+			APIURL:               readEnv("GITHUB_API_URL"),
+			Proxy:                githubProxy,
 			SkipForks:            readBoolean("SKIP_FORKS"),
 			PrivateRepositories:  privateRepositories,
 			MirrorIssues:         mirrorIssues,
 			MirrorStarred:        mirrorStarred,
+			MirrorWatched:        mirrorWatched,
 			MirrorOrganizations:  mirrorOrganizations,
 			UseSpecificUser:      readBoolean("USE_SPECIFIC_USER"),
 			SingleRepo:           singleRepo,
 			IncludeOrgs:          splitAndTrim(readEnv("INCLUDE_ORGS")),
 			ExcludeOrgs:          splitAndTrim(readEnv("EXCLUDE_ORGS")),
-			PreserveOrgStructure: readBoolean("PRESERVE_ORG_STRUCTURE"),
+			PreserveOrgStructure: preserveOrgStructure,
 			SkipStarredIssues:    readBoolean("SKIP_STARRED_ISSUES"),
+			ReleaseArchives:      readBoolean("MIRROR_RELEASE_ARCHIVES"),
+			RehostAttachments:    readBoolean("MIRROR_ISSUE_ATTACHMENTS"),
+			MirrorLFS:            mirrorLFS,
+			LFSEndpointTemplate:  lfsEndpointTemplate,
+			LFSEndpoint:          lfsEndpoint,
+			MirrorWebhooks:       mirrorWebhooks,
+			MirrorRulesets:       readBoolean("MIRROR_RULESETS"),
+			MirrorTeams:          mirrorTeams,
+			MirrorAvatars:        mirrorAvatars,
+			NativeMigration:      readBoolean("NATIVE_MIGRATION"),
+			NativeItems:          nativeItems,
+			PreserveTimestamps:   readBoolean("PRESERVE_ISSUE_TIMESTAMPS"),
+			Discovery:            discovery,
+			FollowRenames:        readBoolean("FOLLOW_RENAMES"),
+			MoveTransferred:      readBoolean("MOVE_TRANSFERRED_MIRRORS"),
+			WebhookSecret:        githubWebhookSecret,
 		},
 		Gitea: GiteaConfig{
-			URL:             giteaURL,
-			Token:           giteaToken,
-			Organization:    readEnv("GITEA_ORGANIZATION"),
-			Visibility:      visibility,
-			StarredReposOrg: starredOrg,
+			URL:      giteaURL,
+			Token:    giteaToken,
+			Proxy:    giteaProxy,
+			SudoUser: readEnv("GITEA_SUDO_USER"),
+			AuditLog: readEnv("AUDIT_LOG"),
+
+			CACert:             readEnv("GITEA_CA_CERT"),
+			InsecureSkipVerify: readBoolean("GITEA_INSECURE_SKIP_VERIFY"),
+
+			TimeoutSeconds:          readInt("GITEA_TIMEOUT", 30),
+			MigrateTimeoutSeconds:   readInt("GITEA_MIGRATE_TIMEOUT", 0),
+			RequestsPerSecond:       requestsPerSecond,
+			MigrationsPerMinute:     migrationsPerMinute,
+			WaitForMigration:        readBoolean("WAIT_FOR_MIGRATION"),
+			MigrationWaitSeconds:    readInt("MIGRATION_WAIT_TIMEOUT", 600),
+			CloneFallback:           cloneFallback,
+			CloneCacheDir:           cloneCacheDir,
+			DefaultBranchOnly:       defaultBranchOnly,
+			SkipTags:                readBoolean("SKIP_TAGS"),
+			VerifyContent:           verifyContent,
+			RepairBrokenMirrors:     readBoolean("REPAIR_BROKEN_MIRRORS"),
+			RepairPartialMigrations: readBoolean("REPAIR_PARTIAL_MIGRATIONS"),
+			UpdateMirrorCredentials: updateMirrorCredentials,
+			OrphanCleanup:           orphanCleanup,
+			AtticOrganization:       atticOrg,
+			OrphanRetentionDays:     orphanRetention,
+			ProtectTopic:            protectTopic,
+			ProtectedRepos:          splitAndTrim(readEnv("PROTECTED_REPOS")),
+			Organization:            readEnv("GITEA_ORGANIZATION"),
+			Visibility:              visibility,
+			StarredReposOrg:         starredOrg,
+			WatchedReposOrg:         readEnv("GITEA_WATCHED_ORGANIZATION"),
+
+			RepoNameTemplate:   repoNameTemplate,
+			RepoName:           repoName,
+			OrgMapping:         orgMapping,
+			TopicMapping:       topicMapping,
+			OrgNameTemplate:    orgNameTemplate,
+			OrgName:            orgName,
+			CollisionStrategy:  collisionStrategy,
+			MaxRepoCreation:    readInt("GITEA_MAX_REPO_CREATION", -1),
+			DiskBudgetMB:       diskBudget,
+			CheckQuota:         readBoolean("GITEA_CHECK_QUOTA"),
+			StarIntervalMs:     readInt("STAR_INTERVAL_MS", 200),
+			StarredVisibility:  starredVisibility,
+			VisibilityOverride: visibilityOverride,
+
+			WebhookURL:         readEnv("GITEA_WEBHOOK_URL"),
+			WebhookContentType: webhookContentType,
+			WebhookEvents:      webhookEvents,
+			WebhookSecret:      webhookSecret,
+
+			DeployKeys: deployKeys,
+			RepoUnits:  repoUnits,
 		},
-		DryRun:    readBoolean("DRY_RUN"),
-		Delay:     readInt("DELAY", defaultDelay),
-		Include:   splitAndTrim(includeStr),
-		Exclude:   splitAndTrim(excludeStr),
-		SingleRun: readBoolean("SINGLE_RUN"),
+		DryRun:        readBoolean("DRY_RUN"),
+		Delay:         readInt("DELAY", defaultDelay),
+		Include:       append(splitAndTrim(includeStr), includeList...),
+		Exclude:       append(splitAndTrim(excludeStr), excludeList...),
+		IncludeRegex:  includeRegex,
+		ExcludeRegex:  excludeRegex,
+		ExcludeFile:   readEnv("EXCLUDE_FILE"),
+		SingleRun:     readBoolean("SINGLE_RUN"),
+		SortBy:        sortBy,
+		ConfigFile:    configFile,
+		Rules:         fileConfig.Rules,
+		Organizations: fileConfig.Organizations,
+		UserMap:       userMap,
+		Secrets:       *secretsCfg,
+		StateFile:     stateFile,
+		SkipUnchanged: skipUnchanged,
+		Backup:        backup,
+		ServeAddr:     serveAddr,
+		APIToken:      apiToken,
+		Schedule:      runSchedule,
+		DelayJitter:   delayJitter,
+		LockFile:      lockFile,
+
+		ProgressInterval:    progressInterval,
+		MaxNewMirrorsPerRun: maxNewMirrors,
+		FailureBackoffAfter: failureBackoffAfter,
+		FailureBackoff:      failureBackoff,
+		MaxMirrorLag:        maxMirrorLag,
+		AlertWebhookURL:     alertWebhookURL,
+		HealthcheckPingURL:  healthcheckPingURL,
+		LeaderLock:          leaderLock,
+		LeaderLease:         leaderLease,
+		Queue:               queueURL,
+		QueueBatchSize:      queueBatchSize,
+		Output:              output,
+		LogLevel:            logLevel,
+		RepoLogDir:          readEnv("REPO_LOG_DIR"),
 	}
 
 	return config, nil
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DeployKey is a public SSH key installed read-only on every mirror.
+type DeployKey struct {
+	Title string `json:"title"`
+	Key   string `json:"key"`
+}
+
+// readDeployKeys reads public keys in authorized_keys format, one per line,
+// either inline from the variable or from the file it points to. The key
+// comment is used as title.
+func readDeployKeys(variable string) ([]DeployKey, error) {
+	val := strings.TrimSpace(os.Getenv(variable))
+	if val == "" {
+		return nil, nil
+	}
+
+	// A key always contains a space between type and data, a path usually doesn't
+	if !strings.Contains(val, " ") {
+		data, err := os.ReadFile(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration, cannot read %s: %w", variable, err)
+		}
+		val = string(data)
+	}
+
+	var keys []DeployKey
+	for _, line := range strings.Split(val, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid configuration, %s contains an invalid key: %s", variable, line)
+		}
+
+		title := fmt.Sprintf("mirror-to-gitea-%d", len(keys)+1)
+		if len(fields) > 2 {
+			title = strings.Join(fields[2:], " ")
+		}
+		keys = append(keys, DeployKey{Title: title, Key: fields[0] + " " + fields[1]})
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// FileConfig is the optional JSON configuration file referenced by CONFIG_FILE.
+// It holds settings that don't fit into flat environment variables.
+type FileConfig struct {
+	Rules []Rule `json:"rules"`
+	// Organizations holds settings by GitHub organization
+	Organizations map[string]*Organization `json:"organizations"`
+}
+
+// Organization overrides the filters, target and visibility for the
+// repositories of a GitHub organization. Rules still take precedence.
+type Organization struct {
+	// Include and Exclude replace INCLUDE and EXCLUDE if set
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// TargetOrganization is the Gitea organization to mirror to
+	TargetOrganization string `json:"targetOrganization,omitempty"`
+	// Visibility of the Gitea organization if it is created
+	Visibility string `json:"visibility,omitempty"`
+	Private    *bool  `json:"private,omitempty"`
+}
+
+// Rule overrides mirroring behavior for repositories matching a pattern.
+// Patterns follow the INCLUDE/EXCLUDE syntax; the first matching rule wins.
+type Rule struct {
+	Match              string `json:"match"`
+	TargetOrganization string `json:"targetOrganization,omitempty"`
+	NameTemplate       string `json:"nameTemplate,omitempty"`
+	Private            *bool  `json:"private,omitempty"`
+	MirrorInterval     string `json:"mirrorInterval,omitempty"`
+	SkipIssues         bool   `json:"skipIssues,omitempty"`
+
+	Name *template.Template `json:"-"`
+}
+
+func loadFile(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration, cannot read CONFIG_FILE: %w", err)
+	}
+
+	var fileConfig FileConfig
+	if err := json.Unmarshal(data, &fileConfig); err != nil {
+		return nil, fmt.Errorf("invalid configuration, cannot parse CONFIG_FILE: %w", err)
+	}
+
+	for i := range fileConfig.Rules {
+		if err := fileConfig.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid configuration, rule %d: %w", i+1, err)
+		}
+	}
+
+	// GitHub logins are case-insensitive
+	organizations := make(map[string]*Organization, len(fileConfig.Organizations))
+	for name, org := range fileConfig.Organizations {
+		if org.Visibility != "" && org.Visibility != "public" && org.Visibility != "private" {
+			return nil, fmt.Errorf("invalid configuration, organization %s: visibility must be public or private", name)
+		}
+		organizations[strings.ToLower(name)] = org
+	}
+	fileConfig.Organizations = organizations
+
+	return &fileConfig, nil
+}
+
+func (r *Rule) compile() error {
+	if r.Match == "" {
+		return fmt.Errorf("match pattern is required")
+	}
+
+	if r.NameTemplate != "" {
+		tmpl, err := parseNameTemplate(r.NameTemplate)
+		if err != nil {
+			return err
+		}
+		r.Name = tmpl
+	}
+
+	if r.MirrorInterval != "" {
+		if _, err := time.ParseDuration(r.MirrorInterval); err != nil {
+			return fmt.Errorf("invalid mirror interval %q: %w", r.MirrorInterval, err)
+		}
+	}
+
+	return nil
+}
+
+func parseNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template %q: %w", text, err)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// confirmation asks before each new mirror is migrated. Answering all
+// confirms the remaining ones at once, quit declines them.
+type confirmation struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+	all     bool
+	quit    bool
+}
+
+func newConfirmation(in io.Reader, out io.Writer) *confirmation {
+	return &confirmation{scanner: bufio.NewScanner(in), out: out}
+}
+
+// confirm asks the question until it gets an answer. Anything but yes or
+// all declines, as does the end of the input.
+func (c *confirmation) confirm(question string) bool {
+	if c == nil || c.all {
+		return true
+	}
+	if c.quit {
+		return false
+	}
+
+	for {
+		fmt.Fprintf(c.out, "%s [y]es, [n]o, [a]ll, [q]uit: ", question)
+		if !c.scanner.Scan() {
+			fmt.Fprintln(c.out, "\nSkipping the remaining new repositories")
+			c.quit = true
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(c.scanner.Text())) {
+		case "y", "yes":
+			return true
+		case "n", "no", "":
+			return false
+		case "a", "all":
+			c.all = true
+			return true
+		case "q", "quit":
+			c.quit = true
+			fmt.Fprintln(c.out, "Skipping the remaining new repositories")
+			return false
+		}
+	}
+}
+
+// stopped reports whether the user quit, so the remaining repositories are skipped.
+func (c *confirmation) stopped() bool {
+	return c != nil && c.quit
+}
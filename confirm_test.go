@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConfirmation(t *testing.T) {
+	answers := func(input string, questions int) []bool {
+		c := newConfirmation(strings.NewReader(input), io.Discard)
+		var got []bool
+		for range questions {
+			got = append(got, c.confirm("Migrate?"))
+		}
+		return got
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  []bool
+	}{
+		{"asks every time", "y\nn\nyes\n", []bool{true, false, true}},
+		{"repeats unknown answers", "maybe\ny\n\n", []bool{true, false}},
+		{"all confirms the rest", "n\na\n", []bool{false, true, true, true}},
+		{"quit declines the rest", "y\nq\n", []bool{true, false, false}},
+		{"the end of the input declines", "y\n", []bool{true, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := answers(tt.input, len(tt.want)); !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	var c *confirmation
+	if !c.confirm("Migrate?") || c.stopped() {
+		t.Error("expected runs without confirmation to migrate everything")
+	}
+}
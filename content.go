@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// verifyContent compares the branch tips of an existing mirror with GitHub.
+// Gitea syncs mirrors on its own schedule, so differences only count once
+// Gitea synced after the last push to GitHub; those mirrors are broken and
+// either fail the repository or get resynced, depending on VERIFY_CONTENT.
+func verifyContent(ctx context.Context, repo *repository.Repository, giteaTarget *gitea.Target, fallback bool, cfg *config.Config, giteaClient *gitea.Client, ghClient *github.Client) error {
+	if !fallback {
+		status, err := giteaClient.GetMirrorStatus(giteaTarget.Name, repo.GiteaName())
+		if err != nil {
+			return err
+		}
+		if status == nil || !status.Mirror {
+			return nil
+		}
+		if repo.Stats.PushedAt.After(status.MirrorUpdated) {
+			// Not synced since the last push, the lag alone says nothing
+			return nil
+		}
+	}
+
+	want, err := ghrepo.BranchHeads(ctx, ghClient, repo.Owner, repo.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list GitHub branches: %w", err)
+	}
+	if cfg.Gitea.DefaultBranchOnly && repo.DefaultBranch != "" {
+		// Only the default branch is pushed, the others are meant to be missing
+		want = map[string]string{repo.DefaultBranch: want[repo.DefaultBranch]}
+	}
+	got, err := giteaClient.ListBranches(giteaTarget.Name, repo.GiteaName())
+	if err != nil {
+		return err
+	}
+
+	diverged := branchDifferences(want, got)
+	if len(diverged) == 0 {
+		return nil
+	}
+	if cfg.Gitea.VerifyContent != "resync" {
+		return fmt.Errorf("mirror differs from GitHub in %s", strings.Join(diverged, ", "))
+	}
+
+	log.Printf("Mirror of %s differs from GitHub in %s, resyncing", repo.FullName, strings.Join(diverged, ", "))
+	if fallback {
+		return pushFallback(ctx, repo, giteaTarget, cfg, giteaClient)
+	}
+	return giteaClient.SyncMirror(repo, giteaTarget, cfg.DryRun)
+}
+
+// branchDifferences returns the GitHub branches that are missing on Gitea or
+// point to another commit there, sorted by name.
+func branchDifferences(want, got map[string]string) []string {
+	var diverged []string
+	for name, sha := range want {
+		if got[name] != sha {
+			diverged = append(diverged, name)
+		}
+	}
+	sort.Strings(diverged)
+	return diverged
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestBranchDifferences(t *testing.T) {
+	want := map[string]string{"main": "a", "dev": "b", "feature": "c"}
+	got := map[string]string{"main": "a", "dev": "x", "stale": "d"}
+
+	if diverged := branchDifferences(want, got); !slices.Equal(diverged, []string{"dev", "feature"}) {
+		t.Errorf("expected dev and feature, got %v", diverged)
+	}
+	if diverged := branchDifferences(want, want); len(diverged) != 0 {
+		t.Errorf("expected no differences, got %v", diverged)
+	}
+}
+
+func TestVerifyContent(t *testing.T) {
+	synced := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status := `{"mirror":true,"mirror_updated":"` + synced.Format(time.RFC3339) + `"}`
+
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name":"main","commit":{"sha":"1111"}},{"name":"dev","commit":{"sha":"2222"}}]`))
+	}))
+	defer githubServer.Close()
+
+	syncs := 0
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/repos/me/demo":
+			w.Write([]byte(status))
+		case "/api/v1/repos/me/demo/branches":
+			w.Write([]byte(`[{"name":"main","commit":{"id":"1111"}},{"name":"dev","commit":{"id":"0000"}}]`))
+		case "/api/v1/repos/me/demo/mirror-sync":
+			syncs++
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	run := func(mode string, pushedAt time.Time, defaultBranchOnly bool) error {
+		cfg := &config.Config{Gitea: config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5, VerifyContent: mode, DefaultBranchOnly: defaultBranchOnly}}
+		giteaClient, err := gitea.NewClient(&cfg.Gitea)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ghClient, err := ghrepo.NewClient("", ghrepo.ClientOptions{APIURL: githubServer.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo := &repository.Repository{Owner: "octo", Name: "demo", FullName: "octo/demo", DefaultBranch: "main", Stats: repository.Stats{PushedAt: pushedAt}}
+		return verifyContent(context.Background(), repo, &gitea.Target{Name: "me", Type: "user"}, false, cfg, giteaClient, ghClient)
+	}
+
+	t.Run("reports diverged branches", func(t *testing.T) {
+		err := run("report", synced.Add(-time.Hour), false)
+		if err == nil || err.Error() != "mirror differs from GitHub in dev" {
+			t.Errorf("expected dev to differ, got %v", err)
+		}
+	})
+
+	t.Run("ignores pushes Gitea didn't sync yet", func(t *testing.T) {
+		if err := run("report", synced.Add(time.Hour), false); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("only compares the default branch with DEFAULT_BRANCH_ONLY", func(t *testing.T) {
+		if err := run("report", synced.Add(-time.Hour), true); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("resyncs diverged mirrors", func(t *testing.T) {
+		if err := run("resync", synced.Add(-time.Hour), false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if syncs != 1 {
+			t.Errorf("expected one sync, got %d", syncs)
+		}
+	})
+}
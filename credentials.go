@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"slices"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// credentialExtension holds the fingerprint of the GitHub token a private
+// mirror clones with, for recordMirror.
+const credentialExtension = "credential"
+
+// tokenFingerprint identifies a GitHub token without storing it.
+func tokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// configuredCredential reports whether the fingerprint belongs to one of the
+// configured GitHub tokens. Rotated tokens are used alternately, so a mirror
+// may clone with any of them.
+func configuredCredential(cfg *config.Config, fingerprint string) bool {
+	return fingerprint == tokenFingerprint(cfg.GitHub.Token) || slices.ContainsFunc(cfg.GitHub.Tokens, func(token string) bool {
+		return fingerprint == tokenFingerprint(token)
+	})
+}
+
+// updateMirrorCredentials hands the private mirror of a repository the
+// current GitHub token if it clones with a token that is no longer
+// configured, which goes stale once that token is revoked. The mirror is updated in place; should
+// Gitea keep cloning with the old token, REPAIR_BROKEN_MIRRORS replaces it.
+// Mirrors recorded before are assumed to use the configured token.
+func updateMirrorCredentials(
+	ctx context.Context,
+	repo *repository.Repository,
+	rule *config.Rule,
+	giteaTarget *gitea.Target,
+	cfg *config.Config,
+	giteaClient *gitea.Client,
+	ghClient *github.Client,
+	store *state.Store,
+	mirrors map[string]gitea.RepoLink,
+) error {
+	current := tokenFingerprint(cfg.GitHub.Token)
+	mirror, _ := store.Mirror(repo.FullName)
+	if mirror.Credential == "" {
+		repo.SetExtension(credentialExtension, current)
+		return nil
+	}
+	if configuredCredential(cfg, mirror.Credential) {
+		return nil
+	}
+	status, err := giteaClient.GetMirrorStatus(giteaTarget.Name, repo.GiteaName())
+	if err != nil {
+		return err
+	}
+	if status != nil && protectedMirror(giteaTarget.Name, repo.GiteaName(), status.Topics, "re-migrating", cfg) {
+		return nil
+	}
+
+	if cfg.DryRun {
+		log.Printf("DRY RUN: Would update %s/%s with the new GitHub token", giteaTarget.Name, repo.GiteaName())
+		return nil
+	}
+
+	log.Printf("GitHub token changed since %s/%s was mirrored, updating it", giteaTarget.Name, repo.GiteaName())
+	if err := giteaClient.UpdateMirror(repo, giteaTarget, cfg.GitHub.Token, mirrorOptions(ctx, repo, rule, cfg, ghClient, mirrors)); err != nil {
+		return err
+	}
+	repo.SetExtension(credentialExtension, current)
+	return nil
+}
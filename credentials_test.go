@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func TestConfiguredCredential(t *testing.T) {
+	rotated := &config.Config{GitHub: config.GitHubConfig{Token: "one", Tokens: []string{"one", "two"}}}
+	added := &config.Config{GitHub: config.GitHubConfig{Token: "three", Tokens: []string{"one", "two", "three"}}}
+	removed := &config.Config{GitHub: config.GitHubConfig{Token: "two", Tokens: []string{"two"}}}
+
+	if tokenFingerprint("one") == tokenFingerprint("two") {
+		t.Error("expected tokens to have their own fingerprint")
+	}
+	if !configuredCredential(rotated, tokenFingerprint("two")) {
+		t.Error("expected a rotated token not in use to be configured")
+	}
+	if !configuredCredential(added, tokenFingerprint("one")) {
+		t.Error("expected adding a token to keep the others configured")
+	}
+	if configuredCredential(removed, tokenFingerprint("one")) || !configuredCredential(removed, tokenFingerprint("two")) {
+		t.Error("expected only the removed token to be no longer configured")
+	}
+}
+
+func TestUpdateMirrorCredentials(t *testing.T) {
+	updates := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "PATCH /api/v1/repos/me/secret":
+			var settings map[string]string
+			json.NewDecoder(r.Body).Decode(&settings)
+			if settings["auth_token"] == "new" {
+				updates++
+			}
+			w.Write([]byte(`{}`))
+		case "POST /api/v1/repos/me/secret/mirror-sync":
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHub: config.GitHubConfig{Token: "new"},
+		Gitea:  config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5, UpdateMirrorCredentials: true},
+	}
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, _ := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	target := &gitea.Target{ID: 1, Name: "me", Type: "user"}
+
+	update := func(credential string) *repository.Repository {
+		store.RecordMirror("octo/secret", &state.Mirror{Owner: "me", Name: "secret", Credential: credential})
+		repo := &repository.Repository{Name: "secret", FullName: "octo/secret", Private: true}
+		if err := updateMirrorCredentials(context.Background(), repo, nil, target, cfg, giteaClient, nil, store, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return repo
+	}
+
+	t.Run("stamps mirrors recorded without a credential", func(t *testing.T) {
+		repo := update("")
+		recordMirror(store, repo, target, nil)
+		if mirror, _ := store.Mirror("octo/secret"); mirror.Credential != tokenFingerprint(cfg.GitHub.Token) || updates != 0 {
+			t.Errorf("expected the configured token to be recorded without updating, got %q after %d updates", mirror.Credential, updates)
+		}
+	})
+
+	t.Run("updates mirrors of another token in place", func(t *testing.T) {
+		repo := update("0123456789abcdef")
+		recordMirror(store, repo, target, nil)
+		if mirror, _ := store.Mirror("octo/secret"); mirror.Credential != tokenFingerprint(cfg.GitHub.Token) || updates != 1 {
+			t.Errorf("expected one update with the configured token, got %q after %d updates", mirror.Credential, updates)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/subtle"
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+//go:embed web/dashboard.html
+var dashboardFiles embed.FS
+
+var dashboardTemplate = template.Must(template.New("dashboard.html").Funcs(template.FuncMap{"size": formatSize}).ParseFS(dashboardFiles, "web/dashboard.html"))
+
+// dashboardData is what the dashboard shows.
+type dashboardData struct {
+	Runs        []runRecord
+	Scheduler   schedulerStatus
+	StateError  string
+	Repos       []repoStatus
+	Errors      []repoStatus
+	CanExclude  bool
+	Message     string
+	MessageFail bool
+}
+
+// registerDashboard serves the web dashboard on / with buttons posting back
+// to /dashboard. Browsers log in with the API token as basic auth password.
+func (a *managementAPI) registerDashboard(mux *http.ServeMux) {
+	mux.Handle("GET /{$}", a.loggedIn(a.dashboard))
+	mux.Handle("POST /dashboard/repos/{owner}/{name}/sync", a.loggedIn(sameOrigin(a.dashboardSync)))
+	mux.Handle("POST /dashboard/repos/{owner}/{name}/exclude", a.loggedIn(sameOrigin(a.dashboardExclude)))
+	mux.Handle("POST /dashboard/run", a.loggedIn(sameOrigin(a.dashboardRun)))
+}
+
+// loggedIn lets requests with the API token as basic auth password through
+// and asks browsers to log in otherwise. Browsers send the stored credentials
+// with requests from other sites too, so posts also need sameOrigin.
+func (a *managementAPI) loggedIn(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, token, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mirror-to-gitea"`)
+			http.Error(w, "invalid API token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (a *managementAPI) dashboard(w http.ResponseWriter, r *http.Request) {
+	data := dashboardData{
+		Runs:        a.history.recent(),
+		Scheduler:   a.scheduler.status(),
+		CanExclude:  a.current().ExcludeFile != "",
+		Message:     r.URL.Query().Get("message"),
+		MessageFail: r.URL.Query().Get("failed") != "",
+	}
+	mirrors, err := a.readMirrors()
+	if err != nil {
+		data.StateError = err.Error()
+	}
+	data.Repos = repoStatuses(mirrors)
+	for _, repo := range data.Repos {
+		if repo.LastError != "" {
+			data.Errors = append(data.Errors, repo)
+		}
+	}
+	sort.SliceStable(data.Errors, func(i, j int) bool { return data.Errors[i].LastRun.After(data.Errors[j].LastRun) })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Printf("Warning: Failed to render the dashboard: %v", err)
+	}
+}
+
+func (a *managementAPI) dashboardRun(w http.ResponseWriter, r *http.Request) {
+	if !a.queue.add(fullRun) {
+		redirectDashboard(w, r, "Too many pending repositories, try again later", true)
+		return
+	}
+	log.Printf("Run requested through the dashboard")
+	redirectDashboard(w, r, "Queued a run for all repositories", false)
+}
+
+func (a *managementAPI) dashboardSync(w http.ResponseWriter, r *http.Request) {
+	fullName := r.PathValue("owner") + "/" + r.PathValue("name")
+	if !a.queue.add(fullName) {
+		redirectDashboard(w, r, "Too many pending repositories, try again later", true)
+		return
+	}
+	log.Printf("Sync of %s requested through the dashboard", fullName)
+	redirectDashboard(w, r, "Queued a sync of "+fullName, false)
+}
+
+func (a *managementAPI) dashboardExclude(w http.ResponseWriter, r *http.Request) {
+	fullName := r.PathValue("owner") + "/" + r.PathValue("name")
+	if err := a.exclude(fullName); err != nil {
+		redirectDashboard(w, r, err.Error(), true)
+		return
+	}
+	redirectDashboard(w, r, "Excluded "+fullName+" from the following runs", false)
+}
+
+// redirectDashboard shows the dashboard again with the outcome of an action.
+func redirectDashboard(w http.ResponseWriter, r *http.Request, message string, failed bool) {
+	query := url.Values{"message": {message}}
+	if failed {
+		query.Set("failed", "1")
+	}
+	http.Redirect(w, r, "/?"+query.Encode(), http.StatusSeeOther)
+}
+
+// sameOrigin rejects form posts from other sites, which browsers would send
+// with the stored basic auth credentials.
+func sameOrigin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" {
+			http.Error(w, "cross-site request", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "cross-site request", http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func TestDashboard(t *testing.T) {
+	const token = "api-token"
+
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	store, err := state.Open(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.RecordMirror("octo/demo", &state.Mirror{Owner: "me", Name: "demo", LastRun: time.Now(), Language: "Go", SizeKB: 2048, Stars: 42, Forks: 7})
+	store.RecordMirror("octo/broken", &state.Mirror{Owner: "me", Name: "broken", LastRun: time.Now(), LastError: "clone failed"})
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	excludePath := filepath.Join(dir, "exclude.txt")
+	if err := os.WriteFile(excludePath, []byte("# excluded\nold"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := 0
+	history := &runHistory{}
+	history.record(fullRun, time.Now().Add(-time.Minute), errors.New("GitHub unreachable"))
+	cfg := &config.Config{StateFile: statePath, ExcludeFile: excludePath}
+	api := &managementAPI{token: token, queue: newSyncQueue(), current: func() *config.Config { return cfg }, reload: func() { reloaded++ }, history: history}
+	mux := http.NewServeMux()
+	api.register(mux)
+
+	send := func(method, target string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.SetBasicAuth("admin", token)
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("asks browsers to log in", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("expected a basic auth challenge, got %d", rec.Code)
+		}
+	})
+
+	t.Run("shows runs, errors and mirrors", func(t *testing.T) {
+		rec := send(http.MethodGet, "/", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		body := rec.Body.String()
+		for _, want := range []string{"GitHub unreachable", "clone failed", "octo/demo", "/dashboard/repos/octo/broken/exclude", "<td>Go</td>", "<td>" + formatSize(2048) + "</td>", "<td>42</td>", "<td>7</td>"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("expected the dashboard to show %q", want)
+			}
+		}
+	})
+
+	t.Run("queues a sync", func(t *testing.T) {
+		rec := send(http.MethodPost, "/dashboard/repos/octo/demo/sync", nil)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("expected a redirect, got %d", rec.Code)
+		}
+		if got := <-api.queue.next; got != "octo/demo" {
+			t.Errorf("expected octo/demo to be queued, got %q", got)
+		}
+	})
+
+	t.Run("excludes a repository", func(t *testing.T) {
+		if rec := send(http.MethodPost, "/dashboard/repos/octo/broken/exclude", nil); rec.Code != http.StatusSeeOther {
+			t.Fatalf("expected a redirect, got %d", rec.Code)
+		}
+		content, err := os.ReadFile(excludePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "# excluded\nold\nocto/broken\n"; string(content) != want {
+			t.Errorf("expected %q, got %q", want, content)
+		}
+		if reloaded != 1 {
+			t.Errorf("expected the configuration to be reloaded once, got %d", reloaded)
+		}
+	})
+
+	t.Run("rejects names that would add patterns", func(t *testing.T) {
+		before, _ := os.ReadFile(excludePath)
+		for _, target := range []string{"/dashboard/repos/octo/a%0A**/exclude", "/dashboard/repos/octo/*/exclude"} {
+			rec := send(http.MethodPost, target, nil)
+			if rec.Code != http.StatusSeeOther || !strings.Contains(rec.Header().Get("Location"), "failed=1") {
+				t.Errorf("expected %s to fail, got %d %s", target, rec.Code, rec.Header().Get("Location"))
+			}
+		}
+		if after, _ := os.ReadFile(excludePath); string(after) != string(before) {
+			t.Errorf("expected %s to stay unchanged, got %q", excludePath, after)
+		}
+	})
+
+	t.Run("rejects cross-site posts", func(t *testing.T) {
+		rec := send(http.MethodPost, "/dashboard/run", map[string]string{"Origin": "https://evil.example"})
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// inventoryDifference is a line of the diff report.
+type inventoryDifference struct {
+	status string
+	github string
+	gitea  string
+	detail string
+}
+
+// runDiff compares the selected GitHub repositories with the repositories on
+// Gitea without changing either side. It reports repositories missing on
+// Gitea, mirrors whose GitHub repository is gone and mirrors whose default
+// branch points to another commit than on GitHub, and fails if it found any.
+func runDiff(ctx context.Context, cfg *config.Config, out io.Writer) error {
+	ghClient, err := ghrepo.NewClient(cfg.GitHub.Token, ghrepo.ClientOptions{APIURL: cfg.GitHub.APIURL, Proxy: cfg.GitHub.Proxy})
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		return fmt.Errorf("failed to create Gitea client: %w", err)
+	}
+	giteaUser, err := giteaClient.GetUser()
+	if err != nil {
+		return fmt.Errorf("failed to get Gitea user: %w", err)
+	}
+
+	repos, err := fetchRepositories(ctx, ghClient, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Group the repositories by the Gitea owner they are mirrored to
+	expected := make(map[string]map[string]*repository.Repository)
+	for _, repo := range repos {
+		rule := findRule(cfg.Rules, repo)
+		applyMirrorName(repo, rule, cfg)
+		owner := targetName(repo, rule, cfg, giteaUser.Name)
+		if expected[owner] == nil {
+			expected[owner] = make(map[string]*repository.Repository)
+		}
+		expected[owner][strings.ToLower(repo.GiteaName())] = repo
+	}
+
+	var diffs []inventoryDifference
+	for owner, wanted := range expected {
+		target := giteaUser
+		if !strings.EqualFold(owner, giteaUser.Name) {
+			if target, err = giteaClient.GetOrganization(owner); err != nil {
+				log.Printf("Warning: Failed to get Gitea organization %s, treating it as missing: %v", owner, err)
+				target = nil
+			}
+		}
+
+		existing := make(map[string]gitea.RepositoryInfo)
+		if target != nil {
+			listed, err := giteaClient.ListRepositories(target)
+			if err != nil {
+				return err
+			}
+			for _, info := range listed {
+				existing[strings.ToLower(info.Name)] = info
+			}
+		}
+
+		for key, repo := range wanted {
+			mirror := fmt.Sprintf("%s/%s", owner, repo.GiteaName())
+			info, ok := existing[key]
+			if !ok {
+				diffs = append(diffs, inventoryDifference{"missing", repo.FullName, mirror, "not on Gitea"})
+				continue
+			}
+			if cfg.Source.Type == "gitea" {
+				continue
+			}
+			if detail := compareHeads(ctx, ghClient, giteaClient, repo, owner, info); detail != "" {
+				diffs = append(diffs, inventoryDifference{"diverged", repo.FullName, mirror, detail})
+			}
+		}
+
+		for key, info := range existing {
+			if _, ok := wanted[key]; ok || !info.Mirror {
+				continue
+			}
+			if detail := missingUpstream(ctx, ghClient, info); detail != "" {
+				diffs = append(diffs, inventoryDifference{"orphaned", "-", owner + "/" + info.Name, detail})
+			}
+		}
+	}
+
+	if len(diffs) == 0 {
+		fmt.Fprintf(out, "All %d repositories are mirrored and up to date\n", len(repos))
+		return nil
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].status != diffs[j].status {
+			return diffs[i].status < diffs[j].status
+		}
+		return diffs[i].gitea < diffs[j].gitea
+	})
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tGITHUB\tGITEA\tDETAIL")
+	for _, diff := range diffs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", diff.status, diff.github, diff.gitea, diff.detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%d differences found", len(diffs))
+}
+
+// targetName returns the Gitea owner a repository is mirrored to, following
+// the routing of resolveTarget without looking anything up.
+func targetName(repo *repository.Repository, rule *config.Rule, cfg *config.Config, username string) string {
+	settings := organizationSettings(repo, cfg)
+	switch {
+	case rule != nil && rule.TargetOrganization != "":
+		return rule.TargetOrganization
+	case settings != nil && settings.TargetOrganization != "":
+		return settings.TargetOrganization
+	case topicOrganization(repo, cfg) != "":
+		return topicOrganization(repo, cfg)
+	case repo.Starred && cfg.Gitea.StarredReposOrg != "":
+		return cfg.Gitea.StarredReposOrg
+	case repo.Watched && cfg.Gitea.WatchedReposOrg != "":
+		return cfg.Gitea.WatchedReposOrg
+	case cfg.GitHub.PreserveOrgStructure && repo.Organization != "":
+		return giteaOrganization(repo.Organization, cfg)
+	case cfg.Gitea.Organization != "":
+		return cfg.Gitea.Organization
+	}
+	return username
+}
+
+// compareHeads describes how the default branch of a mirror differs from
+// GitHub, or returns an empty string if both point to the same commit.
+func compareHeads(ctx context.Context, ghClient *github.Client, giteaClient *gitea.Client, repo *repository.Repository, owner string, info gitea.RepositoryInfo) string {
+	if repo.DefaultBranch == "" {
+		return ""
+	}
+	if info.Empty {
+		return "empty on Gitea"
+	}
+
+	want, err := ghrepo.BranchHead(ctx, ghClient, repo.Owner, repo.Name, repo.DefaultBranch)
+	if err != nil {
+		return fmt.Sprintf("could not read %s on GitHub: %v", repo.DefaultBranch, err)
+	}
+	got, err := giteaClient.BranchHead(owner, info.Name, repo.DefaultBranch)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("could not read %s on Gitea: %v", repo.DefaultBranch, err)
+	case got == "":
+		return fmt.Sprintf("%s is missing on Gitea", repo.DefaultBranch)
+	case got != want:
+		return fmt.Sprintf("%s is at %s on GitHub but at %s on Gitea", repo.DefaultBranch, shortSHA(want), shortSHA(got))
+	}
+	return ""
+}
+
+// missingUpstream describes why a mirror outside the selection has no GitHub
+// repository anymore, or returns an empty string if it mirrors a repository
+// that still exists but isn't selected, or something other than GitHub.
+func missingUpstream(ctx context.Context, ghClient *github.Client, info gitea.RepositoryInfo) string {
+	if info.OriginalURL == "" {
+		return "no upstream recorded"
+	}
+	owner, name, ok := githubUpstream(info.OriginalURL)
+	if !ok {
+		return ""
+	}
+
+	exists, err := ghrepo.RepositoryExists(ctx, ghClient, owner, name)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("could not look up %s/%s: %v", owner, name, err)
+	case !exists:
+		return fmt.Sprintf("%s/%s no longer exists on GitHub", owner, name)
+	}
+	return ""
+}
+
+// githubUpstream returns the GitHub repository a mirror was migrated from,
+// ok is false for mirrors of anything else.
+func githubUpstream(originalURL string) (owner, name string, ok bool) {
+	u, err := url.Parse(originalURL)
+	if err != nil || !strings.EqualFold(u.Host, "github.com") {
+		return "", "", false
+	}
+	return strings.Cut(strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), "/")
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
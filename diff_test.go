@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+)
+
+func TestRunDiff(t *testing.T) {
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/octo/repos":
+			w.Write([]byte(`[
+				{"id":1,"name":"current","full_name":"octo/current","clone_url":"https://github.com/octo/current.git","owner":{"login":"octo"},"default_branch":"main"},
+				{"id":2,"name":"behind","full_name":"octo/behind","clone_url":"https://github.com/octo/behind.git","owner":{"login":"octo"},"default_branch":"main"},
+				{"id":3,"name":"new","full_name":"octo/new","clone_url":"https://github.com/octo/new.git","owner":{"login":"octo"},"default_branch":"main"}
+			]`))
+		case "/repos/octo/current/branches/main", "/repos/octo/behind/branches/main":
+			w.Write([]byte(`{"name":"main","commit":{"sha":"1111111111111111"}}`))
+		case "/repos/octo/unselected":
+			w.Write([]byte(`{"name":"unselected","full_name":"octo/unselected"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer githubServer.Close()
+
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/user":
+			w.Write([]byte(`{"id":1,"username":"mirror"}`))
+		case "/api/v1/users/mirror/repos":
+			w.Write([]byte(`[
+				{"name":"current","mirror":true},
+				{"name":"behind","mirror":true},
+				{"name":"gone","mirror":true,"original_url":"https://github.com/octo/gone.git"},
+				{"name":"unselected","mirror":true,"original_url":"https://github.com/octo/unselected.git"},
+				{"name":"own","mirror":false}
+			]`))
+		case "/api/v1/repos/mirror/current/branches/main":
+			w.Write([]byte(`{"name":"main","commit":{"id":"1111111111111111"}}`))
+		case "/api/v1/repos/mirror/behind/branches/main":
+			w.Write([]byte(`{"name":"main","commit":{"id":"2222222222222222"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	cfg := &config.Config{
+		GitHub:  config.GitHubConfig{Username: "octo", APIURL: githubServer.URL},
+		Gitea:   config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5},
+		Include: []string{"**"},
+	}
+	var out bytes.Buffer
+	err := runDiff(context.Background(), cfg, &out)
+	if err == nil || err.Error() != "3 differences found" {
+		t.Fatalf("expected 3 differences, got %v:\n%s", err, out.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header and 3 rows, got:\n%s", out.String())
+	}
+	for i, want := range []string{
+		"diverged  octo/behind  mirror/behind  main is at 1111111 on GitHub but at 2222222 on Gitea",
+		"missing   octo/new     mirror/new     not on Gitea",
+		"orphaned  -            mirror/gone    octo/gone no longer exists on GitHub",
+	} {
+		if strings.TrimSpace(lines[i+1]) != want {
+			t.Errorf("row %d: expected %q, got %q", i+1, want, lines[i+1])
+		}
+	}
+}
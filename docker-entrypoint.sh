@@ -2,6 +2,11 @@
 
 set -e
 
+# With a cron schedule the binary keeps running and waits for the runs itself
+if [ -n "${SCHEDULE}" ]; then
+  exec /app/mirror-to-gitea
+fi
+
 # Get custom delay, else use 3600 seconds
 DELAY="${DELAY:-3600}"
 
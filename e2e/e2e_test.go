@@ -0,0 +1,91 @@
+//go:build e2e
+
+// Package e2e runs the complete mirroring pipeline against a disposable Gitea
+// container and recorded GitHub API responses. Run it with
+//
+//	go test -tags e2e -v ./e2e/...
+//
+// It requires docker and git on the host.
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestMirror(t *testing.T) {
+	gitRoot := t.TempDir()
+	createBareRepository(t, gitRoot, "demo")
+
+	apiURL, _ := startFixtureServer(t, gitRoot)
+	gitea := startGitea(t)
+	binary := buildBinary(t)
+
+	cmd := exec.Command(binary)
+	cmd.Env = append(os.Environ(),
+		"GITHUB_USERNAME=e2e-user",
+		"GITHUB_TOKEN=fixture-token",
+		"GITHUB_API_URL="+apiURL,
+		"GITHUB_DISCOVERY=rest",
+		"GITEA_URL="+gitea.url,
+		"GITEA_TOKEN="+gitea.token,
+		"GITEA_ORGANIZATION=mirrors",
+		"MIRROR_ISSUES=true",
+		"SKIP_FORKS=true",
+		"SINGLE_RUN=true",
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("mirroring failed: %v", err)
+	}
+
+	t.Run("creates the organization", func(t *testing.T) {
+		if status := gitea.get(t, "/api/v1/orgs/mirrors", nil); status != 200 {
+			t.Errorf("expected organization mirrors, got status %d", status)
+		}
+	})
+
+	t.Run("mirrors the repository", func(t *testing.T) {
+		var repo struct {
+			Mirror        bool   `json:"mirror"`
+			DefaultBranch string `json:"default_branch"`
+		}
+		if status := gitea.get(t, "/api/v1/repos/mirrors/demo", &repo); status != 200 {
+			t.Fatalf("expected repository mirrors/demo, got status %d", status)
+		}
+
+		if !repo.Mirror {
+			t.Error("expected repository to be a mirror")
+		}
+		if repo.DefaultBranch != "main" {
+			t.Errorf("expected default branch main, got %s", repo.DefaultBranch)
+		}
+	})
+
+	t.Run("skips forks", func(t *testing.T) {
+		if status := gitea.get(t, "/api/v1/repos/mirrors/forked", nil); status != 404 {
+			t.Errorf("expected fork to be skipped, got status %d", status)
+		}
+	})
+
+	t.Run("mirrors the issues", func(t *testing.T) {
+		var issues []struct {
+			Title string `json:"title"`
+			State string `json:"state"`
+		}
+		if status := gitea.get(t, "/api/v1/repos/mirrors/demo/issues?state=all&type=issues", &issues); status != 200 {
+			t.Fatalf("expected issues of mirrors/demo, got status %d", status)
+		}
+
+		if len(issues) != 2 {
+			t.Fatalf("expected 2 issues, got %d", len(issues))
+		}
+		for _, issue := range issues {
+			if issue.Title == "Closed issues stay closed" && issue.State != "closed" {
+				t.Errorf("expected the closed GitHub issue to be closed, got %s", issue.State)
+			}
+		}
+	})
+}
@@ -0,0 +1,180 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	defaultGiteaImage = "gitea/gitea:1.22"
+	giteaUser         = "e2e"
+	giteaPassword     = "e2e-password"
+
+	// gitURLPlaceholder is replaced in the fixtures with the address of the local git server
+	gitURLPlaceholder = "{{GIT_URL}}"
+)
+
+// giteaContainer is a disposable Gitea instance running in docker.
+type giteaContainer struct {
+	id    string
+	url   string
+	token string
+}
+
+func startGitea(t *testing.T) *giteaContainer {
+	t.Helper()
+
+	image := os.Getenv("E2E_GITEA_IMAGE")
+	if image == "" {
+		image = defaultGiteaImage
+	}
+
+	id := run(t, "docker", "run", "-d", "--rm",
+		"-p", "127.0.0.1::3000",
+		"--add-host", "host.docker.internal:host-gateway",
+		"-e", "GITEA__security__INSTALL_LOCK=true",
+		"-e", "GITEA__database__DB_TYPE=sqlite3",
+		"-e", "GITEA__migrations__ALLOW_LOCALNETWORKS=true",
+		image)
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "-f", id).Run()
+	})
+
+	port := run(t, "docker", "port", id, "3000/tcp")
+	container := &giteaContainer{
+		id:  id,
+		url: "http://" + strings.TrimSpace(strings.Split(port, "\n")[0]),
+	}
+	container.waitUntilReady(t)
+
+	run(t, "docker", "exec", "-u", "git", id, "gitea", "admin", "user", "create",
+		"--admin", "--username", giteaUser, "--password", giteaPassword,
+		"--email", giteaUser+"@example.com", "--must-change-password=false")
+	container.token = run(t, "docker", "exec", "-u", "git", id, "gitea", "admin", "user", "generate-access-token",
+		"--username", giteaUser, "--token-name", "e2e", "--scopes", "all", "--raw")
+
+	return container
+}
+
+func (g *giteaContainer) waitUntilReady(t *testing.T) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Minute)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(g.url + "/api/v1/version")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	t.Fatalf("gitea at %s did not become ready", g.url)
+}
+
+// get decodes the Gitea API response of path into v and returns the status code.
+func (g *giteaContainer) get(t *testing.T, path string, v interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", g.url+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "token "+g.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK && v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decoding %s: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// startFixtureServer serves the recorded GitHub API responses below
+// testdata/github and the bare git repositories of gitRoot below /git/. It
+// listens on all interfaces so the Gitea container can clone from it.
+func startFixtureServer(t *testing.T, gitRoot string) (apiURL, gitURL string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	gitURL = fmt.Sprintf("http://host.docker.internal:%d/git", port)
+
+	mux := http.NewServeMux()
+	mux.Handle("/git/", http.StripPrefix("/git/", http.FileServer(http.Dir(gitRoot))))
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api")
+		fixture, err := os.ReadFile(filepath.Join("testdata", "github", filepath.FromSlash(path)+".json"))
+		if err != nil {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bytes.ReplaceAll(fixture, []byte(gitURLPlaceholder), []byte(gitURL)))
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return fmt.Sprintf("http://127.0.0.1:%d/api", port), gitURL
+}
+
+// createBareRepository creates a bare repository with a single commit that can
+// be cloned over the dumb HTTP protocol.
+func createBareRepository(t *testing.T, root, name string) {
+	t.Helper()
+
+	work := filepath.Join(t.TempDir(), name)
+	run(t, "git", "init", "-q", "-b", "main", work)
+	run(t, "git", "-C", work, "-c", "user.name=e2e", "-c", "user.email=e2e@example.com",
+		"commit", "-q", "--allow-empty", "-m", "Initial commit")
+
+	bare := filepath.Join(root, name+".git")
+	run(t, "git", "clone", "-q", "--bare", work, bare)
+	run(t, "git", "-C", bare, "update-server-info")
+}
+
+// buildBinary compiles the application into a temporary directory.
+func buildBinary(t *testing.T) string {
+	t.Helper()
+
+	binary := filepath.Join(t.TempDir(), "mirror-to-gitea")
+	run(t, "go", "build", "-o", binary, "..")
+	return binary
+}
+
+func run(t *testing.T, name string, args ...string) string {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%s %s: %v\n%s", name, strings.Join(args, " "), err, stderr.String())
+	}
+	return strings.TrimSpace(stdout.String())
+}
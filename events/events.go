@@ -0,0 +1,67 @@
+// Package events emits a structured event per action as a JSON line, for
+// OUTPUT=ndjson. Nothing is emitted until an output is set.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/runlog"
+)
+
+// Event types.
+const (
+	RepoDiscovered       = "repo_discovered"
+	RepositoriesSelected = "repositories_selected"
+	RepoMirrored         = "repo_mirrored"
+	RepoSynced           = "repo_synced"
+	RepoMetrics          = "repo_metrics"
+	IssueCreated         = "issue_created"
+	Progress             = "progress"
+	Error                = "error"
+)
+
+// Fields carry the details of an event.
+type Fields map[string]interface{}
+
+var (
+	mu     sync.Mutex
+	output io.Writer
+)
+
+// SetOutput makes Emit write to w, or disables events if w is nil.
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	output = w
+}
+
+// Emit writes an event with the time, its type and fields as a line of JSON.
+func Emit(event string, fields Fields) {
+	mu.Lock()
+	defer mu.Unlock()
+	if output == nil {
+		return
+	}
+
+	line := make(map[string]interface{}, len(fields)+2)
+	for name, value := range fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		line[name] = value
+	}
+	line["time"] = time.Now().UTC().Format(time.RFC3339)
+	line["event"] = event
+	if id := runlog.RunID(); id != "" {
+		line["run"] = id
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	output.Write(append(data, '\n'))
+}
@@ -0,0 +1,41 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEmit(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(nil)
+
+	Emit(RepoMirrored, Fields{"repository": "octo/demo", "target": "me"})
+	Emit(Error, Fields{"repository": "octo/other", "error": errors.New("status 500")})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 events, got %q", out.String())
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event["event"] != Error || event["error"] != "status 500" || event["time"] == nil {
+		t.Errorf("unexpected event: %v", event)
+	}
+}
+
+func TestEmitWithoutOutput(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetOutput(nil)
+
+	Emit(RepoMirrored, Fields{"repository": "octo/demo"})
+	if out.Len() != 0 {
+		t.Errorf("expected no events, got %q", out.String())
+	}
+}
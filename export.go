@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/bundle"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitcmd"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// runExport writes git bundles of the selected GitHub repositories and a
+// manifest describing them to a directory or, if path ends in .tar.gz, a
+// tarball, for an import into a Gitea instance without internet access.
+func runExport(ctx context.Context, cfg *config.Config, path string) error {
+	if path == "" {
+		return fmt.Errorf("usage: mirror-to-gitea export <directory or .tar.gz>")
+	}
+
+	ghClient, err := ghrepo.NewClient(cfg.GitHub.Token, ghrepo.ClientOptions{APIURL: cfg.GitHub.APIURL, Proxy: cfg.GitHub.Proxy})
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+
+	repos, err := fetchRepositories(ctx, ghClient, cfg)
+	if err != nil {
+		return err
+	}
+	log.Printf("Found %d repositories to export", len(repos))
+
+	dir := path
+	if bundle.IsArchive(path) {
+		if dir, err = os.MkdirTemp("", "export-*"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	manifest := &bundle.Manifest{CreatedAt: time.Now().UTC()}
+	summary := newRunSummary()
+	for _, repo := range repos {
+		rel := filepath.Join(strings.ToLower(repo.Owner), repo.Name+".bundle")
+		err := bundle.Create(ctx, repo.URL, gitcmd.GitHubAuthorization(cfg.GitHub.Token), filepath.Join(dir, rel))
+		if err != nil {
+			log.Printf("Error exporting repository %s: %v", repo.FullName, err)
+		} else {
+			log.Printf("Exported %s", repo.FullName)
+			manifest.Repositories = append(manifest.Repositories, bundle.NewEntry(repo, rel))
+		}
+		summary.record(repo.FullName, err)
+	}
+
+	if err := bundle.WriteManifest(dir, manifest); err != nil {
+		return err
+	}
+	if bundle.IsArchive(path) {
+		if err := bundle.Pack(dir, path); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	summary.print()
+	return nil
+}
+
+// runImport creates the repositories of an export on Gitea and pushes their
+// bundles. Repositories that already exist are updated.
+func runImport(ctx context.Context, cfg *config.Config, path string) error {
+	if path == "" {
+		return fmt.Errorf("usage: mirror-to-gitea import <directory or .tar.gz>")
+	}
+
+	dir := path
+	if bundle.IsArchive(path) {
+		var err error
+		if dir, err = os.MkdirTemp("", "import-*"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		if err := bundle.Unpack(path, dir); err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+
+	manifest, err := bundle.ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+	log.Printf("Found %d repositories exported on %s", len(manifest.Repositories), manifest.CreatedAt.Format(time.DateTime))
+
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		return fmt.Errorf("failed to create Gitea client: %w", err)
+	}
+	detectServer(giteaClient)
+	giteaUser, err := giteaClient.GetUser()
+	if err != nil {
+		return fmt.Errorf("failed to get Gitea user: %w", err)
+	}
+
+	if cfg.Gitea.Organization != "" {
+		if err := giteaClient.CreateOrganization(cfg.Gitea.Organization, cfg.Gitea.Visibility, nil, cfg.DryRun); err != nil {
+			log.Printf("Warning: Failed to create Gitea organization %s: %v", cfg.Gitea.Organization, err)
+		}
+	}
+
+	orgTargets := make(map[string]*gitea.Target)
+	summary := newRunSummary()
+	for _, entry := range manifest.Repositories {
+		repo := entry.Repository()
+
+		target := getDefaultTarget(cfg, giteaClient, giteaUser)
+		if cfg.GitHub.PreserveOrgStructure && repo.Organization != "" {
+			giteaOrg := giteaOrganization(repo.Organization, cfg)
+			if orgTarget, ok := orgTargets[repo.Organization]; ok {
+				target = orgTarget
+			} else if err := giteaClient.CreateOrganization(giteaOrg, cfg.Gitea.Visibility, nil, cfg.DryRun); err != nil {
+				log.Printf("Error creating Gitea organization %s: %v", giteaOrg, err)
+			} else if orgTarget, err := giteaClient.GetOrganization(giteaOrg); err == nil {
+				orgTargets[repo.Organization] = orgTarget
+				target = orgTarget
+			}
+		}
+
+		err := importRepository(ctx, repo, filepath.Join(dir, filepath.FromSlash(entry.Bundle)), target, cfg, giteaClient)
+		if err != nil {
+			log.Printf("Error importing repository %s: %v", repo.FullName, err)
+		}
+		summary.record(repo.FullName, err)
+	}
+
+	summary.print()
+	return nil
+}
+
+func importRepository(ctx context.Context, repo *repository.Repository, bundlePath string, target *gitea.Target, cfg *config.Config, giteaClient *gitea.Client) error {
+	exists, err := giteaClient.IsRepositoryMirrored(repo.GiteaName(), target)
+	if err != nil {
+		return err
+	}
+
+	if cfg.DryRun {
+		log.Printf("DRY RUN: Would import %s to %s %s", repo.FullName, target.Type, target.Name)
+		return nil
+	}
+
+	if !exists {
+		opts := gitea.MirrorOptions{Private: mirrorPrivate(repo, cfg)}
+		if repo.Fork && repo.Provenance.Parent != "" {
+			opts.Description, opts.Website = forkUpstream(repo.Provenance.Parent, nil, cfg.Gitea.URL, sourceURL(cfg))
+		}
+		if err := giteaClient.CreateRepository(repo, target, opts); err != nil {
+			return err
+		}
+	}
+
+	bundlePath, err = filepath.Abs(bundlePath)
+	if err != nil {
+		return err
+	}
+	return giteaClient.PushBundle(ctx, repo, target, bundlePath)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func filterRepositories(repos []*repository.Repository, cfg *config.Config) []*repository.Repository {
+	var filtered []*repository.Repository
+
+	for _, repo := range repos {
+		include, exclude := cfg.Include, cfg.Exclude
+		if settings := organizationSettings(repo, cfg); settings != nil {
+			if len(settings.Include) > 0 {
+				include = settings.Include
+			}
+			if len(settings.Exclude) > 0 {
+				exclude = settings.Exclude
+			}
+		}
+
+		// Check include patterns
+		includeMatch := matchesAny(include, repo)
+		if !includeMatch && cfg.IncludeRegex != nil {
+			includeMatch = cfg.IncludeRegex.MatchString(matchSubject(cfg.IncludeRegex.String(), repo))
+		}
+
+		if !includeMatch {
+			continue
+		}
+
+		// Check exclude patterns
+		excludeMatch := matchesAny(exclude, repo)
+		if !excludeMatch && cfg.ExcludeRegex != nil {
+			excludeMatch = cfg.ExcludeRegex.MatchString(matchSubject(cfg.ExcludeRegex.String(), repo))
+		}
+
+		if !excludeMatch {
+			filtered = append(filtered, repo)
+		}
+	}
+
+	return filtered
+}
+
+func matchesAny(patterns []string, repo *repository.Repository) bool {
+	for _, pattern := range patterns {
+		matched, err := doublestar.Match(pattern, matchSubject(pattern, repo))
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSubject returns the full name (owner/repo) for patterns that contain a
+// slash, so org-scoped filters like "myorg/**" work, and the bare name otherwise.
+func matchSubject(pattern string, repo *repository.Repository) string {
+	if strings.Contains(pattern, "/") {
+		return repo.FullName
+	}
+	return repo.Name
+}
+
+// protectedMirror reports whether the Gitea mirror owner/name is exempt from
+// anything that would delete, move or replace it, as it is listed in
+// PROTECTED_REPOS or carries the protection topic. It logs why the operation
+// is skipped.
+func protectedMirror(owner, name string, topics []string, operation string, cfg *config.Config) bool {
+	fullName := owner + "/" + name
+	for _, pattern := range cfg.Gitea.ProtectedRepos {
+		if matched, err := doublestar.Match(strings.ToLower(pattern), strings.ToLower(fullName)); err == nil && matched {
+			log.Printf("Mirror %s is protected by PROTECTED_REPOS, not %s it", fullName, operation)
+			return true
+		}
+	}
+	for _, topic := range topics {
+		if cfg.Gitea.ProtectTopic != "" && strings.EqualFold(topic, cfg.Gitea.ProtectTopic) {
+			log.Printf("Mirror %s is protected by its %s topic, not %s it", fullName, topic, operation)
+			return true
+		}
+	}
+	return false
+}
+
+// sortRepositories orders the repositories for processing: by name, smallest
+// first for size, and most popular first for stars and forks.
+func sortRepositories(repos []*repository.Repository, sortBy string) {
+	var less func(a, b *repository.Repository) bool
+	switch sortBy {
+	case "name":
+		less = func(a, b *repository.Repository) bool { return a.FullName < b.FullName }
+	case "size":
+		less = func(a, b *repository.Repository) bool { return a.Stats.Size < b.Stats.Size }
+	case "stars":
+		less = func(a, b *repository.Repository) bool { return a.Stats.Stars > b.Stats.Stars }
+	case "forks":
+		less = func(a, b *repository.Repository) bool { return a.Stats.Forks > b.Stats.Forks }
+	default:
+		return
+	}
+
+	sort.SliceStable(repos, func(i, j int) bool { return less(repos[i], repos[j]) })
+}
+
+// findRule returns the first rule whose pattern matches the repository.
+func findRule(rules []config.Rule, repo *repository.Repository) *config.Rule {
+	for i := range rules {
+		if matchesAny([]string{rules[i].Match}, repo) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// organizationSettings returns the settings configured for the GitHub owner
+// of the repository, or nil.
+func organizationSettings(repo *repository.Repository, cfg *config.Config) *config.Organization {
+	return cfg.Organizations[strings.ToLower(repo.Owner)]
+}
+
+// topicOrganization returns the Gitea organization TOPIC_MAPPING routes the
+// repository to by its first mapped topic, or an empty string.
+func topicOrganization(repo *repository.Repository, cfg *config.Config) string {
+	for _, topic := range repo.Topics {
+		if org, ok := cfg.Gitea.TopicMapping[strings.ToLower(topic)]; ok {
+			return org
+		}
+	}
+	return ""
+}
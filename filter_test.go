@@ -0,0 +1,158 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestFilterRepositories(t *testing.T) {
+	repos := []*repository.Repository{
+		{Name: "infra", FullName: "myorg/infra"},
+		{Name: "website", FullName: "myorg/website"},
+		{Name: "infra", FullName: "otherorg/infra"},
+		{Name: "dotfiles", FullName: "me/dotfiles"},
+	}
+
+	names := func(repos []*repository.Repository) []string {
+		result := make([]string, 0, len(repos))
+		for _, repo := range repos {
+			result = append(result, repo.FullName)
+		}
+		return result
+	}
+
+	assertNames := func(t *testing.T, got []*repository.Repository, expected ...string) {
+		t.Helper()
+		actual := names(got)
+		if len(actual) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+		for i := range expected {
+			if actual[i] != expected[i] {
+				t.Fatalf("expected %v, got %v", expected, actual)
+			}
+		}
+	}
+
+	t.Run("matches bare names without a slash", func(t *testing.T) {
+		cfg := &config.Config{Include: []string{"infra"}}
+
+		assertNames(t, filterRepositories(repos, cfg), "myorg/infra", "otherorg/infra")
+	})
+
+	t.Run("matches full names for patterns with a slash", func(t *testing.T) {
+		cfg := &config.Config{Include: []string{"myorg/**"}}
+
+		assertNames(t, filterRepositories(repos, cfg), "myorg/infra", "myorg/website")
+	})
+
+	t.Run("excludes by full name", func(t *testing.T) {
+		cfg := &config.Config{Include: []string{"*"}, Exclude: []string{"otherorg/*"}}
+
+		assertNames(t, filterRepositories(repos, cfg), "myorg/infra", "myorg/website", "me/dotfiles")
+	})
+
+	t.Run("applies regex filters alongside globs", func(t *testing.T) {
+		cfg := &config.Config{
+			Include:      []string{"dotfiles"},
+			IncludeRegex: regexp.MustCompile("^myorg/"),
+			ExcludeRegex: regexp.MustCompile("^web"),
+		}
+
+		assertNames(t, filterRepositories(repos, cfg), "myorg/infra", "me/dotfiles")
+	})
+
+	t.Run("applies organization filters instead of the global ones", func(t *testing.T) {
+		owned := []*repository.Repository{
+			{Name: "infra", FullName: "MyOrg/infra", Owner: "MyOrg"},
+			{Name: "website", FullName: "MyOrg/website", Owner: "MyOrg"},
+			{Name: "infra", FullName: "otherorg/infra", Owner: "otherorg"},
+			{Name: "website", FullName: "otherorg/website", Owner: "otherorg"},
+		}
+		cfg := &config.Config{
+			Include: []string{"*"},
+			Exclude: []string{"infra"},
+			Organizations: map[string]*config.Organization{
+				"myorg": {Exclude: []string{"website"}},
+			},
+		}
+
+		assertNames(t, filterRepositories(owned, cfg), "MyOrg/infra", "otherorg/website")
+	})
+}
+
+func TestSortRepositories(t *testing.T) {
+	repos := func() []*repository.Repository {
+		return []*repository.Repository{
+			{FullName: "me/b", Stats: repository.Stats{Size: 300, Stars: 5, Forks: 1}},
+			{FullName: "me/a", Stats: repository.Stats{Size: 100, Stars: 1, Forks: 7}},
+			{FullName: "me/c", Stats: repository.Stats{Size: 200, Stars: 9, Forks: 3}},
+		}
+	}
+
+	tests := []struct {
+		sortBy   string
+		expected []string
+	}{
+		{"", []string{"me/b", "me/a", "me/c"}},
+		{"name", []string{"me/a", "me/b", "me/c"}},
+		{"size", []string{"me/a", "me/c", "me/b"}},
+		{"stars", []string{"me/c", "me/b", "me/a"}},
+		{"forks", []string{"me/a", "me/c", "me/b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("sorts by "+tt.sortBy, func(t *testing.T) {
+			sorted := repos()
+			sortRepositories(sorted, tt.sortBy)
+
+			for i, name := range tt.expected {
+				if sorted[i].FullName != name {
+					t.Fatalf("expected %s at position %d, got %s", name, i, sorted[i].FullName)
+				}
+			}
+		})
+	}
+}
+
+func TestTopicOrganization(t *testing.T) {
+	cfg := &config.Config{Gitea: config.GiteaConfig{TopicMapping: map[string]string{"ansible": "infra", "game": "hobby"}}}
+	tests := []struct {
+		topics []string
+		org    string
+	}{
+		{[]string{"go", "game", "ansible"}, "hobby"},
+		{[]string{"ansible"}, "infra"},
+		{[]string{"go"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		repo := &repository.Repository{Name: "demo", Topics: tt.topics}
+		if org := topicOrganization(repo, cfg); org != tt.org {
+			t.Errorf("expected %q for topics %v, got %q", tt.org, tt.topics, org)
+		}
+	}
+}
+
+func TestProtectedMirror(t *testing.T) {
+	cfg := &config.Config{Gitea: config.GiteaConfig{ProtectTopic: "keep", ProtectedRepos: []string{"mirrors/legacy", "Team/*"}}}
+	tests := []struct {
+		owner     string
+		name      string
+		topics    []string
+		protected bool
+	}{
+		{"mirrors", "legacy", nil, true},
+		{"team", "site", nil, true},
+		{"mirrors", "demo", []string{"go", "keep"}, true},
+		{"mirrors", "demo", []string{"go"}, false},
+	}
+	for _, tt := range tests {
+		if protected := protectedMirror(tt.owner, tt.name, tt.topics, "deleting", cfg); protected != tt.protected {
+			t.Errorf("expected %s/%s with topics %v to be protected %v, got %v", tt.owner, tt.name, tt.topics, tt.protected, protected)
+		}
+	}
+}
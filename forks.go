@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// forkParent returns the full name of the upstream of a fork, or an empty
+// string if it can't be determined.
+func forkParent(ctx context.Context, repo *repository.Repository, cfg *config.Config, ghClient *github.Client) string {
+	// Everything but REST discovery on GitHub lists the parent with the fork
+	if repo.Provenance.Parent != "" || cfg.GitHub.Discovery != "rest" || cfg.Source.Type == "gitea" {
+		return repo.Provenance.Parent
+	}
+
+	parent, err := ghrepo.Parent(ctx, ghClient, repo.Owner, repo.Name)
+	if err != nil {
+		log.Printf("Warning: Failed to look up the upstream of fork %s: %v", repo.FullName, err)
+	}
+	return parent
+}
+
+// forkUpstream describes where a fork came from. Gitea can't turn a pull
+// mirror into a fork of another repository, so the upstream goes into the
+// description and website of the mirror. The website points at the mirror of
+// the parent if it is part of the run and at the source otherwise.
+func forkUpstream(parent string, mirrors map[string]gitea.RepoLink, giteaURL, sourceURL string) (description, website string) {
+	description = fmt.Sprintf("Fork of %s", parent)
+	if mirror, ok := mirrors[strings.ToLower(parent)]; ok {
+		return description, fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(giteaURL, "/"), mirror.Owner, mirror.Name)
+	}
+	return description, strings.TrimSuffix(sourceURL, "/") + "/" + parent
+}
+
+// sourceURL returns the web address of the instance repositories are
+// mirrored from.
+func sourceURL(cfg *config.Config) string {
+	if cfg.Source.Type == "gitea" {
+		return cfg.Source.URL
+	}
+	return "https://github.com"
+}
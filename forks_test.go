@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/gitea"
+)
+
+func TestForkUpstream(t *testing.T) {
+	mirrors := map[string]gitea.RepoLink{"upstream/tool": {Owner: "archive", Name: "tool"}}
+
+	t.Run("links the mirror of a parent in the run", func(t *testing.T) {
+		description, website := forkUpstream("Upstream/tool", mirrors, "https://gitea.example/", "https://github.com")
+		if description != "Fork of Upstream/tool" {
+			t.Errorf("unexpected description %q", description)
+		}
+		if website != "https://gitea.example/archive/tool" {
+			t.Errorf("unexpected website %q", website)
+		}
+	})
+
+	t.Run("links GitHub for other parents", func(t *testing.T) {
+		_, website := forkUpstream("other/lib", mirrors, "https://gitea.example", "https://github.com")
+		if website != "https://github.com/other/lib" {
+			t.Errorf("unexpected website %q", website)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+// Package gitcmd runs the git command line client.
+package gitcmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Refspecs are the refs copied between repositories. GitHub also serves
+// refs/pull/*, which Gitea refuses to receive.
+var Refspecs = []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+
+// BranchRefspecs copy only the branch, and the tags if requested.
+func BranchRefspecs(branch string, tags bool) []string {
+	refspecs := []string{fmt.Sprintf("+refs/heads/%s:refs/heads/%s", branch, branch)}
+	if tags {
+		refspecs = append(refspecs, Refspecs[1])
+	}
+	return refspecs
+}
+
+// Run runs git with args. A non-empty authorization is sent as header of
+// every HTTP request. It is passed through the environment, so it never ends
+// up in the config of a repository.
+func Run(ctx context.Context, authorization string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if authorization != "" {
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: "+authorization)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// GitHubAuthorization returns the authorization of a GitHub token for git
+// over HTTP, or an empty string without token.
+func GitHubAuthorization(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte("x-access-token:"+token))
+}
@@ -0,0 +1,138 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// githubAttachmentPattern matches files uploaded to GitHub issues, both the
+// legacy image CDN and the newer user-attachments URLs.
+var githubAttachmentPattern = regexp.MustCompile(`https://(?:user-images\.githubusercontent\.com|private-user-images\.githubusercontent\.com|github\.com/user-attachments/(?:assets|files)|github\.com/[^/\s]+/[^/\s]+/assets)/[^\s)"'<>\]]+`)
+
+type Attachment struct {
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// rehostIssueAttachments uploads every GitHub hosted attachment referenced in
+// the body to the Gitea issue and rewrites the links to the uploaded copies.
+func (c *Client) rehostIssueAttachments(repo *repository.Repository, target *Target, issueNumber int, body, githubToken string) error {
+	links := githubAttachmentPattern.FindAllString(body, -1)
+	if len(links) == 0 {
+		return nil
+	}
+
+	rehosted := make(map[string]string)
+	for _, link := range links {
+		if _, ok := rehosted[link]; ok {
+			continue
+		}
+
+		attachment, err := c.rehostAttachment(repo, target, issueNumber, link, githubToken)
+		if err != nil {
+			return fmt.Errorf("error re-hosting %s: %w", link, err)
+		}
+		rehosted[link] = attachment.BrowserDownloadURL
+	}
+
+	for original, replacement := range rehosted {
+		body = strings.ReplaceAll(body, original, replacement)
+	}
+
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/issues/%d", target.Name, repo.GiteaName(), issueNumber)
+	_, statusCode, err := c.doRequest("PATCH", path, map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated && statusCode != http.StatusOK {
+		return fmt.Errorf("failed to update issue body: status %d", statusCode)
+	}
+
+	return nil
+}
+
+func (c *Client) rehostAttachment(repo *repository.Repository, target *Target, issueNumber int, link, githubToken string) (*Attachment, error) {
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The CDN links are pre-signed, attachments on github.com need the token for private repositories
+	if req.URL.Host == "github.com" && githubToken != "" {
+		req.Header.Set("Authorization", "token "+githubToken)
+	}
+
+	resp, err := c.downloadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download attachment: status %d", resp.StatusCode)
+	}
+
+	file, err := os.CreateTemp("", "mirror-to-gitea-attachment-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		return nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	name := attachmentName(resp.Request.URL, resp.Header.Get("Content-Type"))
+	uploadPath := fmt.Sprintf("/api/v1/repos/%s/%s/issues/%d/assets?name=%s", target.Name, repo.GiteaName(), issueNumber, url.QueryEscape(name))
+	respBody, statusCode, err := c.doMultipartRequest(uploadPath, "attachment", name, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to upload attachment: status %d", statusCode)
+	}
+
+	var attachment Attachment
+	if err := json.Unmarshal(respBody, &attachment); err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// attachmentName derives a file name from the download URL, adding an
+// extension from the content type for extension-less attachment IDs.
+func attachmentName(u *url.URL, contentType string) string {
+	name := path.Base(u.Path)
+	if name == "" || name == "/" || name == "." {
+		name = "attachment"
+	}
+
+	if path.Ext(name) == "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			if extensions, err := mime.ExtensionsByType(mediaType); err == nil && len(extensions) > 0 {
+				name += extensions[0]
+			}
+		}
+	}
+
+	return name
+}
@@ -0,0 +1,93 @@
+package gitea
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestGitHubAttachmentPattern(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"![screenshot](https://user-images.githubusercontent.com/1/2-abc.png)", "https://user-images.githubusercontent.com/1/2-abc.png"},
+		{`<img src="https://private-user-images.githubusercontent.com/1/2.png?jwt=token">`, "https://private-user-images.githubusercontent.com/1/2.png?jwt=token"},
+		{"https://github.com/user-attachments/assets/0c4f-11ef", "https://github.com/user-attachments/assets/0c4f-11ef"},
+		{"[log](https://github.com/user-attachments/files/123/build.log)", "https://github.com/user-attachments/files/123/build.log"},
+		{"https://github.com/octo/demo/assets/1/2", "https://github.com/octo/demo/assets/1/2"},
+		{"https://github.com/octo/demo/issues/1", ""},
+		{"https://example.com/user-attachments/assets/1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := githubAttachmentPattern.FindString(tt.text); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAttachmentName(t *testing.T) {
+	tests := []struct {
+		link        string
+		contentType string
+		expected    string
+	}{
+		{"https://user-images.githubusercontent.com/1/2-abc.png", "image/png", "2-abc.png"},
+		{"https://github.com/user-attachments/files/123/build.log", "text/plain", "build.log"},
+		{"https://github.com/user-attachments/assets/0c4f-11ef", "image/png", "0c4f-11ef.png"},
+		{"https://github.com/user-attachments/assets/0c4f-11ef", "application/x-unknown", "0c4f-11ef"},
+		{"https://github.com/user-attachments/assets/0c4f-11ef", "", "0c4f-11ef"},
+		{"https://github.com/", "image/png", "attachment.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.link+" "+tt.contentType, func(t *testing.T) {
+			u, _ := url.Parse(tt.link)
+			if got := attachmentName(u, tt.contentType); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRehostAttachment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/assets/screenshot":
+			if r.Header.Get("X-Download-Client") == "" {
+				t.Error("expected the attachment to be downloaded with the download client")
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		case "/api/v1/repos/me/demo/issues/3/assets":
+			if name := r.URL.Query().Get("name"); name != "screenshot.png" {
+				t.Errorf("unexpected attachment name %q", name)
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":1,"name":"screenshot.png","browser_download_url":"https://gitea.example.com/attachments/1"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetDownloadClient(&http.Client{Transport: markingTransport{}})
+
+	repo := &repository.Repository{Name: "demo", FullName: "octo/demo"}
+	attachment, err := client.rehostAttachment(repo, &Target{Name: "me", Type: "user"}, 3, server.URL+"/assets/screenshot", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attachment.BrowserDownloadURL != "https://gitea.example.com/attachments/1" {
+		t.Errorf("unexpected attachment %+v", attachment)
+	}
+}
@@ -0,0 +1,49 @@
+package gitea
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// TransferRepository moves the repository name of the target to newOwner,
+// keeping its name.
+func (c *Client) TransferRepository(target *Target, name, newOwner string) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/transfer", target.Name, name)
+	_, statusCode, err := c.doRequest("POST", path, map[string]string{"new_owner": newOwner})
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusAccepted && statusCode != http.StatusCreated {
+		return fmt.Errorf("failed to transfer repository %s/%s to %s: status %d", target.Name, name, newOwner, statusCode)
+	}
+
+	c.indexMu.Lock()
+	if names, ok := c.repoIndex[strings.ToLower(target.Name)]; ok {
+		delete(names, strings.ToLower(name))
+	}
+	if names, ok := c.repoIndex[strings.ToLower(newOwner)]; ok {
+		names[strings.ToLower(name)] = true
+	}
+	c.indexMu.Unlock()
+
+	log.Printf("Transferred %s/%s to %s", target.Name, name, newOwner)
+	return nil
+}
+
+// ArchiveRepository marks the repository name of the target as archived,
+// which makes it read-only.
+func (c *Client) ArchiveRepository(target *Target, name string) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s", target.Name, name)
+	_, statusCode, err := c.doRequest("PATCH", path, map[string]bool{"archived": true})
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("failed to archive repository %s/%s: status %d", target.Name, name, statusCode)
+	}
+
+	log.Printf("Archived %s/%s", target.Name, name)
+	return nil
+}
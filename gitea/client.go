@@ -3,30 +3,58 @@ package gitea
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/audit"
 	"github.com/jaedle/mirror-to-gitea/config"
-	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/provider"
+	"github.com/jaedle/mirror-to-gitea/redact"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/transport"
 )
 
 type Client struct {
 	baseURL    string
 	token      string
 	httpClient *http.Client
+	// downloadClient fetches release archives, attachments and avatars from
+	// the source, which the settings of httpClient don't apply to
+	downloadClient *http.Client
+	// tokenSource replaces the static token if set
+	tokenSource func() (string, error)
+	// sudoUser is impersonated by an admin token if set
+	sudoUser string
+	// server is set by DetectServer
+	server *Server
+	// audit records all changing requests, nil if disabled
+	audit *audit.Log
+	// migrateTimeout limits migrate requests, which clone the whole repository
+	migrateTimeout time.Duration
+	// requests counts every request sent, for the metrics of a run
+	requests *transport.Counter
+
+	// admin is whether the user is a site admin, looked up once by IsAdmin
+	adminOnce sync.Once
+	admin     bool
+
+	// repoIndex holds the lower-cased repository names of each target
+	indexMu   sync.Mutex
+	repoIndex map[string]map[string]bool
 }
 
-type Target struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
-	Type string `json:"type"` // "user" or "organization"
-}
+// Target is the user or organization mirrors are created for.
+type Target = provider.Owner
 
 type User struct {
 	ID       int64  `json:"id"`
@@ -40,59 +68,207 @@ type Organization struct {
 
 type MigrateRepoRequest struct {
 	AuthToken string `json:"auth_token,omitempty"`
-	CloneAddr string `json:"clone_addr"`
-	Mirror    bool   `json:"mirror"`
-	RepoName  string `json:"repo_name"`
-	UID       int64  `json:"uid"`
-	Private   bool   `json:"private"`
+	// AuthUsername and AuthPassword replace the token on Gogs
+	AuthUsername string `json:"auth_username,omitempty"`
+	AuthPassword string `json:"auth_password,omitempty"`
+	CloneAddr    string `json:"clone_addr"`
+	Mirror       bool   `json:"mirror"`
+	RepoName     string `json:"repo_name"`
+	UID          int64  `json:"uid"`
+	Private      bool   `json:"private"`
+
+	MirrorInterval string `json:"mirror_interval,omitempty"`
+	LFS            bool   `json:"lfs,omitempty"`
+	LFSEndpoint    string `json:"lfs_endpoint,omitempty"`
+	Description    string `json:"description,omitempty"`
+
+	// Service selects the Gitea migrator, which imports the selected items
+	Service      string `json:"service,omitempty"`
+	Issues       bool   `json:"issues,omitempty"`
+	Labels       bool   `json:"labels,omitempty"`
+	Milestones   bool   `json:"milestones,omitempty"`
+	Releases     bool   `json:"releases,omitempty"`
+	PullRequests bool   `json:"pull_requests,omitempty"`
+	Wiki         bool   `json:"wiki,omitempty"`
 }
 
-type Issue struct {
-	Title  string `json:"title"`
-	Body   string `json:"body"`
-	State  string `json:"state"`
-	Closed bool   `json:"closed"`
-}
+// MirrorOptions carries per-repository settings for the migrate request.
+type MirrorOptions = provider.MirrorOptions
 
-type Label struct {
-	Name  string `json:"name"`
-	Color string `json:"color"`
-}
+// Client implements the target of the mirroring
+var _ provider.Target = (*Client)(nil)
 
-type IssueResponse struct {
-	Number int `json:"number"`
-}
+func NewClient(cfg *config.GiteaConfig) (*Client, error) {
+	base, err := transport.NewHTTPTransport(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.InsecureSkipVerify {
+		log.Printf("Warning: TLS certificate verification is disabled for Gitea")
+	}
+	if err := transport.ConfigureTLS(base, cfg.CACert, cfg.InsecureSkipVerify); err != nil {
+		return nil, err
+	}
+
+	// The timeout applies per attempt so rate limit waits don't count against it
+	requests := &transport.Counter{}
+	retry := transport.NewRetryTransport(transport.NewDebugTransport(transport.NewCountingTransport(base, requests)))
+	retry.Timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+
+	var auditLog *audit.Log
+	if cfg.AuditLog != "" {
+		if auditLog, err = audit.Open(cfg.AuditLog); err != nil {
+			return nil, err
+		}
+	}
 
-func NewClient(cfg *config.GiteaConfig) *Client {
 	return &Client{
-		baseURL: cfg.URL,
-		token:   cfg.Token,
+		audit:    auditLog,
+		baseURL:  cfg.URL,
+		token:    cfg.Token,
+		sudoUser: cfg.SudoUser,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			// Waiting for the limit doesn't count against the timeout of an attempt
+			Transport: transport.NewRateLimitTransport(retry, cfg.RequestsPerSecond, cfg.MigrationsPerMinute),
 		},
+		downloadClient: http.DefaultClient,
+		migrateTimeout: time.Duration(cfg.MigrateTimeoutSeconds) * time.Second,
+		requests:       requests,
+	}, nil
+}
+
+// Requests returns the number of requests sent to Gitea so far, retries included.
+func (c *Client) Requests() int64 {
+	return c.requests.Count()
+}
+
+// SetDownloadClient makes the client download release archives, attachments
+// and avatars from the source with client instead of the default client.
+func (c *Client) SetDownloadClient(client *http.Client) {
+	c.downloadClient = client
+}
+
+// SetTokenSource makes the client fetch its token before every request, e.g.
+// from a secrets provider that rotates it.
+func (c *Client) SetTokenSource(source func() (string, error)) {
+	c.tokenSource = source
+}
+
+func (c *Client) authorization() (string, error) {
+	if c.tokenSource == nil {
+		// Anonymous access to public repositories of a source instance
+		if c.token == "" {
+			return "", nil
+		}
+		return "token " + c.token, nil
+	}
+	token, err := c.tokenSource()
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch Gitea token: %w", err)
 	}
+	return "token " + token, nil
 }
 
 func (c *Client) doRequest(method, path string, body interface{}) ([]byte, int, error) {
+	respBody, statusCode, _, err := c.doRequestWithHeaders(method, path, body)
+	return respBody, statusCode, err
+}
+
+func (c *Client) doRequestWithHeaders(method, path string, body interface{}) ([]byte, int, http.Header, error) {
+	return c.doRequestContext(context.Background(), method, path, body)
+}
+
+func (c *Client) doRequestContext(ctx context.Context, method, path string, body interface{}) ([]byte, int, http.Header, error) {
 	var reqBody io.Reader
 	if body != nil {
 		jsonData, err := json.Marshal(body)
 		if err != nil {
-			return nil, 0, err
+			return nil, 0, nil, err
 		}
 		reqBody = bytes.NewBuffer(jsonData)
 	}
 
 	url := c.baseURL + path
-	req, err := http.NewRequest(method, url, reqBody)
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, nil, err
 	}
 
-	req.Header.Set("Authorization", "token "+c.token)
+	authorization, err := c.authorization()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
 	req.Header.Set("Content-Type", "application/json")
+	if c.sudoUser != "" {
+		req.Header.Set("Sudo", c.sudoUser)
+	}
 
 	resp, err := c.httpClient.Do(req)
+	if method != http.MethodGet {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		c.recordAudit(method, path, body, status, err)
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, resp.Header, err
+	}
+
+	return respBody, resp.StatusCode, resp.Header, nil
+}
+
+func (c *Client) doMultipartRequest(path, fieldName, fileName string, content io.Reader) ([]byte, int, error) {
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		part, err := writer.CreateFormFile(fieldName, fileName)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, content); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	req, err := http.NewRequest("POST", c.baseURL+path, pr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	authorization, err := c.authorization()
+	if err != nil {
+		return nil, 0, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if c.sudoUser != "" {
+		req.Header.Set("Sudo", c.sudoUser)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	c.recordAudit("POST", path, map[string]string{"file": fileName}, status, err)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -106,6 +282,21 @@ func (c *Client) doRequest(method, path string, body interface{}) ([]byte, int,
 	return respBody, resp.StatusCode, nil
 }
 
+// recordAudit writes a change to the audit log. Failing to do so doesn't
+// fail the change, which already happened.
+func (c *Client) recordAudit(method, target string, body interface{}, status int, err error) {
+	if c.audit == nil {
+		return
+	}
+	entry := audit.Entry{Method: method, Target: target, Payload: audit.Summarize(body), Status: status, Sudo: c.sudoUser}
+	if err != nil {
+		entry.Error = redact.String(err.Error())
+	}
+	if err := c.audit.Record(entry); err != nil {
+		log.Printf("Warning: Failed to write audit log: %v", err)
+	}
+}
+
 func (c *Client) GetUser() (*Target, error) {
 	respBody, statusCode, err := c.doRequest("GET", "/api/v1/user", nil)
 	if err != nil {
@@ -150,7 +341,9 @@ func (c *Client) GetOrganization(orgName string) (*Target, error) {
 	}, nil
 }
 
-func (c *Client) CreateOrganization(orgName, visibility string, dryRun bool) error {
+// CreateOrganization creates the organization unless it exists. A non-nil
+// profile sets the display name, description, website, location and avatar.
+func (c *Client) CreateOrganization(orgName, visibility string, profile *repository.OrganizationProfile, dryRun bool) error {
 	if dryRun {
 		log.Printf("DRY RUN: Would create Gitea organization: %s (%s)", orgName, visibility)
 		return nil
@@ -168,180 +361,367 @@ func (c *Client) CreateOrganization(orgName, visibility string, dryRun bool) err
 		"username":   orgName,
 		"visibility": visibility,
 	}
+	if profile != nil {
+		createReq["full_name"] = profile.FullName
+		createReq["description"] = profile.Description
+		createReq["website"] = profile.Website
+		createReq["location"] = profile.Location
+	}
 
-	_, statusCode, err := c.doRequest("POST", "/api/v1/orgs", createReq)
+	_, statusCode, err := c.doRequest("POST", c.organizationRequest(createReq), createReq)
 	if err != nil {
 		return err
 	}
 
-	if statusCode == http.StatusCreated || statusCode == http.StatusUnprocessableEntity {
-		log.Printf("Created organization: %s", orgName)
-		return nil
+	if statusCode != http.StatusCreated && statusCode != http.StatusUnprocessableEntity {
+		return fmt.Errorf("failed to create organization %s: status %d", orgName, statusCode)
 	}
 
-	return fmt.Errorf("failed to create organization %s: status %d", orgName, statusCode)
+	log.Printf("Created organization: %s", orgName)
+
+	if profile != nil && profile.AvatarURL != "" && statusCode == http.StatusCreated {
+		if err := c.uploadOrganizationAvatar(orgName, profile.AvatarURL); err != nil {
+			log.Printf("Warning: Failed to set avatar of organization %s: %v", orgName, err)
+		}
+	}
+
+	return nil
 }
 
-func (c *Client) IsRepositoryMirrored(repoName string, target *Target) (bool, error) {
-	path := fmt.Sprintf("/api/v1/repos/%s/%s", target.Name, repoName)
-	_, statusCode, _ := c.doRequest("GET", path, nil)
-	return statusCode == http.StatusOK, nil
+func (c *Client) uploadOrganizationAvatar(orgName, avatarURL string) error {
+	return c.uploadAvatar(fmt.Sprintf("/api/v1/orgs/%s/avatar", orgName), avatarURL)
 }
 
-func (c *Client) MirrorRepository(repo *ghrepo.Repository, target *Target, githubToken string) error {
-	migrateReq := MigrateRepoRequest{
-		AuthToken: githubToken,
-		CloneAddr: repo.URL,
-		Mirror:    true,
-		RepoName:  repo.Name,
-		UID:       target.ID,
-		Private:   repo.Private,
+// SetRepositoryAvatar downloads the image and sets it as avatar of the mirror.
+func (c *Client) SetRepositoryAvatar(repo *repository.Repository, target *Target, imageURL string) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/avatar", target.Name, repo.GiteaName())
+	if err := c.uploadAvatar(path, imageURL); err != nil {
+		return err
 	}
+	log.Printf("Set avatar of repository %s", repo.GiteaName())
+	return nil
+}
 
-	_, statusCode, err := c.doRequest("POST", "/api/v1/repos/migrate", migrateReq)
+func (c *Client) uploadAvatar(path, imageURL string) error {
+	resp, err := c.downloadClient.Get(imageURL)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
-	if statusCode != http.StatusCreated {
-		return fmt.Errorf("failed to mirror repository %s: status %d", repo.Name, statusCode)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download avatar: status %d", resp.StatusCode)
 	}
 
-	log.Printf("Successfully mirrored: %s", repo.Name)
-	return nil
-}
-
-func (c *Client) StarRepository(repoName string, target *Target, dryRun bool) error {
-	if dryRun {
-		log.Printf("DRY RUN: Would star repository in Gitea: %s/%s", target.Name, repoName)
-		return nil
+	image, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
 	}
 
-	path := fmt.Sprintf("/api/v1/user/starred/%s/%s", target.Name, repoName)
-	_, statusCode, err := c.doRequest("PUT", path, nil)
+	_, statusCode, err := c.doRequest("POST", path, map[string]string{"image": base64.StdEncoding.EncodeToString(image)})
 	if err != nil {
 		return err
 	}
 
 	if statusCode != http.StatusNoContent {
-		return fmt.Errorf("failed to star repository %s/%s: status %d", target.Name, repoName, statusCode)
+		return fmt.Errorf("failed to upload avatar: status %d", statusCode)
 	}
 
-	log.Printf("Successfully starred repository in Gitea: %s/%s", target.Name, repoName)
 	return nil
 }
 
-func (c *Client) MirrorIssues(ctx context.Context, ghClient *github.Client, repo *ghrepo.Repository, target *Target, githubToken string, dryRun bool) error {
-	if !repo.HasIssues {
-		log.Printf("Repository %s doesn't have issues enabled. Skipping issues mirroring.", repo.Name)
-		return nil
+// IsRepositoryMirrored reports whether the target already has a repository
+// of that name. The repositories of each target are listed once per run and
+// answered from memory; if listing fails the repository is looked up directly.
+func (c *Client) IsRepositoryMirrored(repoName string, target *Target) (bool, error) {
+	names, err := c.repositoryIndex(target)
+	if err != nil {
+		log.Printf("Warning: Failed to list repositories of %s, checking %s individually: %v", target.Name, repoName, err)
+		path := fmt.Sprintf("/api/v1/repos/%s/%s", target.Name, repoName)
+		_, statusCode, _ := c.doRequest("GET", path, nil)
+		return statusCode == http.StatusOK, nil
 	}
 
-	if dryRun {
-		log.Printf("DRY RUN: Would mirror issues for repository: %s", repo.Name)
-		return nil
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+	return names[strings.ToLower(repoName)], nil
+}
+
+func (c *Client) repositoryIndex(target *Target) (map[string]bool, error) {
+	key := strings.ToLower(target.Name)
+
+	c.indexMu.Lock()
+	names, ok := c.repoIndex[key]
+	c.indexMu.Unlock()
+	if ok {
+		return names, nil
 	}
 
-	// Fetch issues from GitHub
-	issues, err := c.fetchGitHubIssues(ctx, ghClient, repo)
+	names, err := c.listRepositoryNames(target)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	log.Printf("Found %d issues for %s", len(issues), repo.Name)
-
-	// Create issues one by one to maintain order
-	for _, issue := range issues {
-		if err := c.createGiteaIssue(issue, repo, target); err != nil {
-			log.Printf("Error creating issue '%s': %v", issue.GetTitle(), err)
-		}
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+	if c.repoIndex == nil {
+		c.repoIndex = make(map[string]map[string]bool)
 	}
+	c.repoIndex[key] = names
+	return names, nil
+}
 
-	log.Printf("Completed mirroring issues for %s", repo.Name)
-	return nil
+// markMirrored records a newly created repository in the index.
+func (c *Client) markMirrored(repoName string, target *Target) {
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+	if names, ok := c.repoIndex[strings.ToLower(target.Name)]; ok {
+		names[strings.ToLower(repoName)] = true
+	}
 }
 
-func (c *Client) fetchGitHubIssues(ctx context.Context, ghClient *github.Client, repo *ghrepo.Repository) ([]*github.Issue, error) {
-	opt := &github.IssueListByRepoOptions{
-		State:       "all",
-		ListOptions: github.ListOptions{PerPage: 100},
+func (c *Client) listRepositoryNames(target *Target) (map[string]bool, error) {
+	repos, err := c.ListRepositories(target)
+	if err != nil {
+		return nil, err
 	}
 
-	var allIssues []*github.Issue
-	for {
-		issues, resp, err := ghClient.Issues.ListByRepo(ctx, repo.Owner, repo.Name, opt)
+	names := make(map[string]bool, len(repos))
+	for _, repo := range repos {
+		names[strings.ToLower(repo.Name)] = true
+	}
+	return names, nil
+}
+
+// RepositoryInfo is a repository as listed by Gitea.
+type RepositoryInfo struct {
+	Name          string   `json:"name"`
+	Mirror        bool     `json:"mirror"`
+	Empty         bool     `json:"empty"`
+	OriginalURL   string   `json:"original_url"`
+	DefaultBranch string   `json:"default_branch"`
+	Private       bool     `json:"private"`
+	Description   string   `json:"description"`
+	Topics        []string `json:"topics"`
+	// Size is in kilobytes
+	Size int `json:"size"`
+}
+
+// ListRepositories returns all repositories owned by the target.
+func (c *Client) ListRepositories(target *Target) ([]RepositoryInfo, error) {
+	var all []RepositoryInfo
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/api/v1/users/%s/repos?page=%d&limit=%d", target.Name, page, listPageSize)
+		if target.Type == "organization" {
+			path = fmt.Sprintf("/api/v1/orgs/%s/repos?page=%d&limit=%d", target.Name, page, listPageSize)
+		}
+
+		respBody, statusCode, headers, err := c.doRequestWithHeaders("GET", path, nil)
 		if err != nil {
-			return nil, fmt.Errorf("error fetching issues for %s/%s: %w", repo.Owner, repo.Name, err)
+			return nil, err
 		}
-		allIssues = append(allIssues, issues...)
-		if resp.NextPage == 0 {
-			break
+
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to list repositories of %s: status %d", target.Name, statusCode)
 		}
-		opt.Page = resp.NextPage
+
+		var repos []RepositoryInfo
+		if err := json.Unmarshal(respBody, &repos); err != nil {
+			return nil, err
+		}
+		all = append(all, repos...)
+
+		// The server may cap the page size, so prefer the total count if present
+		total, err := strconv.Atoi(headers.Get("X-Total-Count"))
+		if len(repos) == 0 || (err == nil && len(all) >= total) || (err != nil && len(repos) < listPageSize) {
+			return all, nil
+		}
+	}
+}
+
+// BranchHead returns the SHA of the commit a branch of owner/name points to,
+// or an empty string if the branch doesn't exist.
+func (c *Client) BranchHead(owner, name, branch string) (string, error) {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/branches/%s", owner, name, url.PathEscape(branch))
+	respBody, statusCode, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("failed to get branch %s of %s/%s: status %d", branch, owner, name, statusCode)
 	}
 
-	return allIssues, nil
+	var b struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	if err := json.Unmarshal(respBody, &b); err != nil {
+		return "", err
+	}
+	return b.Commit.ID, nil
 }
 
-func (c *Client) createGiteaIssue(issue *github.Issue, repo *ghrepo.Repository, target *Target) error {
-	body := fmt.Sprintf("*Originally created by @%s on %s*\n\n%s",
-		issue.GetUser().GetLogin(),
-		issue.GetCreatedAt().Format("2006-01-02"),
-		issue.GetBody())
+// ListBranches returns the commit SHA of every branch of owner/name.
+func (c *Client) ListBranches(owner, name string) (map[string]string, error) {
+	heads := make(map[string]string)
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/api/v1/repos/%s/%s/branches?page=%d&limit=%d", owner, name, page, listPageSize)
+		respBody, statusCode, headers, err := c.doRequestWithHeaders("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	giteaIssue := Issue{
-		Title:  issue.GetTitle(),
-		Body:   body,
-		State:  issue.GetState(),
-		Closed: issue.GetState() == "closed",
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to list branches of %s/%s: status %d", owner, name, statusCode)
+		}
+
+		var branches []struct {
+			Name   string `json:"name"`
+			Commit struct {
+				ID string `json:"id"`
+			} `json:"commit"`
+		}
+		if err := json.Unmarshal(respBody, &branches); err != nil {
+			return nil, err
+		}
+
+		for _, b := range branches {
+			heads[b.Name] = b.Commit.ID
+		}
+
+		total, err := strconv.Atoi(headers.Get("X-Total-Count"))
+		if len(branches) == 0 || (err == nil && len(heads) >= total) || (err != nil && len(branches) < listPageSize) {
+			return heads, nil
+		}
 	}
+}
 
-	path := fmt.Sprintf("/api/v1/repos/%s/%s/issues", target.Name, repo.Name)
-	respBody, statusCode, err := c.doRequest("POST", path, giteaIssue)
+// CountRepositories returns the number of repositories owned by the target.
+func (c *Client) CountRepositories(target *Target) (int, error) {
+	path := fmt.Sprintf("/api/v1/users/%s/repos?limit=1", target.Name)
+	if target.Type == "organization" {
+		path = fmt.Sprintf("/api/v1/orgs/%s/repos?limit=1", target.Name)
+	}
+
+	_, statusCode, headers, err := c.doRequestWithHeaders("GET", path, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	if statusCode != http.StatusCreated {
-		return fmt.Errorf("failed to create issue: status %d", statusCode)
+	if statusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to list repositories of %s: status %d", target.Name, statusCode)
 	}
 
-	var issueResp IssueResponse
-	if err := json.Unmarshal(respBody, &issueResp); err != nil {
-		return err
+	count, err := strconv.Atoi(headers.Get("X-Total-Count"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read repository count of %s: %w", target.Name, err)
+	}
+
+	return count, nil
+}
+
+// MaxRepoCreation returns the number of repositories the target may own, -1
+// if it has no limit of its own and the MAX_CREATION_LIMIT of the instance
+// applies. Servers that don't expose the limit count as the latter.
+func (c *Client) MaxRepoCreation(target *Target) (int, error) {
+	path := "/api/v1/users/" + target.Name
+	if target.Type == "organization" {
+		path = "/api/v1/orgs/" + target.Name
+	}
+
+	respBody, statusCode, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return 0, err
+	}
+	if statusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to get %s: status %d", target.Name, statusCode)
 	}
 
-	log.Printf("Created issue #%d: %s", issueResp.Number, issue.GetTitle())
+	var owner struct {
+		MaxRepoCreation *int `json:"max_repo_creation"`
+	}
+	if err := json.Unmarshal(respBody, &owner); err != nil {
+		return 0, err
+	}
+	if owner.MaxRepoCreation == nil {
+		return -1, nil
+	}
+	return *owner.MaxRepoCreation, nil
+}
 
-	// Add labels if the issue has any
-	if len(issue.Labels) > 0 {
-		for _, label := range issue.Labels {
-			c.addLabelToIssue(repo, target, issueResp.Number, label.GetName())
+func (c *Client) MirrorRepository(repo *repository.Repository, target *Target, githubToken string, opts MirrorOptions) error {
+	migrateReq := MigrateRepoRequest{
+		AuthToken:      githubToken,
+		CloneAddr:      repo.URL,
+		Mirror:         true,
+		RepoName:       repo.GiteaName(),
+		UID:            target.ID,
+		Private:        opts.Private,
+		MirrorInterval: opts.MirrorInterval,
+		LFS:            opts.LFS,
+		LFSEndpoint:    opts.LFSEndpoint,
+		Description:    opts.Description,
+	}
+	if opts.Native {
+		migrateReq.Service = opts.Service
+		if migrateReq.Service == "" {
+			migrateReq.Service = "github"
 		}
+		migrateReq.Labels = opts.Imports("labels")
+		migrateReq.Milestones = opts.Imports("milestones")
+		migrateReq.Releases = opts.Imports("releases")
+		migrateReq.Wiki = opts.Imports("wiki")
+		migrateReq.Issues = opts.Imports("issues")
+		migrateReq.PullRequests = opts.Imports("pull-requests")
+	}
+	c.adaptMigrateRequest(&migrateReq)
+
+	ctx := transport.WithTimeout(context.Background(), c.migrateTimeout)
+	_, statusCode, _, err := c.doRequestContext(ctx, "POST", "/api/v1/repos/migrate", migrateReq)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("failed to mirror repository %s: status %d", repo.GiteaName(), statusCode)
 	}
 
+	c.markMirrored(repo.GiteaName(), target)
+	log.Printf("Successfully mirrored: %s", repo.GiteaName())
+
+	// The migrate endpoint doesn't take a website
+	if opts.Website != "" {
+		path := fmt.Sprintf("/api/v1/repos/%s/%s", target.Name, repo.GiteaName())
+		_, statusCode, err := c.doRequest("PATCH", path, map[string]string{"website": opts.Website})
+		if err != nil || statusCode != http.StatusOK {
+			log.Printf("Warning: Failed to set website of %s: status %d, %v", repo.GiteaName(), statusCode, err)
+		}
+	}
 	return nil
 }
 
-func (c *Client) addLabelToIssue(repo *ghrepo.Repository, target *Target, issueNumber int, labelName string) {
-	// First try to create the label if it doesn't exist
-	labelPath := fmt.Sprintf("/api/v1/repos/%s/%s/labels", target.Name, repo.Name)
-	label := Label{
-		Name:  labelName,
-		Color: generateRandomColor(),
+// SyncMirror makes Gitea fetch the mirror from its source right away instead
+// of waiting for the mirror interval.
+func (c *Client) SyncMirror(repo *repository.Repository, target *Target, dryRun bool) error {
+	if dryRun {
+		log.Printf("DRY RUN: Would sync mirror %s/%s", target.Name, repo.GiteaName())
+		return nil
 	}
-	c.doRequest("POST", labelPath, label)
 
-	// Then add the label to the issue
-	issueLabelPath := fmt.Sprintf("/api/v1/repos/%s/%s/issues/%d/labels", target.Name, repo.Name, issueNumber)
-	labelList := map[string][]string{
-		"labels": {labelName},
+	_, statusCode, err := c.doRequest("POST", fmt.Sprintf("/api/v1/repos/%s/%s/mirror-sync", target.Name, repo.GiteaName()), nil)
+	if err != nil {
+		return err
 	}
-	if _, statusCode, err := c.doRequest("POST", issueLabelPath, labelList); err != nil || statusCode != http.StatusOK {
-		log.Printf("Error adding label %s to issue: %v", labelName, err)
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("failed to sync mirror %s/%s: status %d", target.Name, repo.GiteaName(), statusCode)
 	}
-}
 
-func generateRandomColor() string {
-	return fmt.Sprintf("%06x", rand.Intn(0xFFFFFF))
+	log.Printf("Triggered sync of mirror %s/%s", target.Name, repo.GiteaName())
+	return nil
 }
@@ -0,0 +1,50 @@
+package gitea
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+type createDeployKeyRequest struct {
+	Title    string `json:"title"`
+	Key      string `json:"key"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// AddDeployKeys installs the keys as read-only deploy keys on the mirror.
+func (c *Client) AddDeployKeys(repo *repository.Repository, target *Target, keys []config.DeployKey, dryRun bool) {
+	for _, key := range keys {
+		if dryRun {
+			log.Printf("DRY RUN: Would add deploy key %s to %s/%s", key.Title, target.Name, repo.GiteaName())
+			continue
+		}
+
+		if err := c.addDeployKey(repo, target, key); err != nil {
+			log.Printf("Error adding deploy key %s to %s: %v", key.Title, repo.GiteaName(), err)
+			continue
+		}
+		log.Printf("Added deploy key %s to %s/%s", key.Title, target.Name, repo.GiteaName())
+	}
+}
+
+func (c *Client) addDeployKey(repo *repository.Repository, target *Target, key config.DeployKey) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/keys", target.Name, repo.GiteaName())
+	_, statusCode, err := c.doRequest("POST", path, createDeployKeyRequest{
+		Title:    key.Title,
+		Key:      key.Key,
+		ReadOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("failed to add deploy key: status %d", statusCode)
+	}
+
+	return nil
+}
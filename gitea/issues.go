@@ -0,0 +1,421 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/events"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// issueMarker matches the hidden source reference in mirrored issues.
+var issueMarker = regexp.MustCompile(`<!-- mirrored-from: (\S+#\d+) -->`)
+
+// DefaultIssueRetryDelay is the first wait after Gitea throttled the
+// creation of issues or comments, doubled with every retry.
+const DefaultIssueRetryDelay = 5 * time.Second
+
+const issueRetries = 5
+
+// errThrottled is returned once Gitea kept throttling a request.
+var errThrottled = errors.New("throttled by Gitea")
+
+type Issue struct {
+	Title     string   `json:"title"`
+	Body      string   `json:"body"`
+	State     string   `json:"state"`
+	Closed    bool     `json:"closed"`
+	Assignees []string `json:"assignees,omitempty"`
+}
+
+type Label struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type IssueResponse struct {
+	Number int    `json:"number"`
+	State  string `json:"state"`
+}
+
+// IssueOptions controls how issues are mirrored.
+type IssueOptions struct {
+	GitHubToken       string
+	RehostAttachments bool
+	// UserMap maps GitHub logins to Gitea usernames
+	UserMap map[string]string
+	// Mirrors locates the Gitea mirrors of the run by lower-cased GitHub full
+	// name, references to their issues are rewritten to the mirrored copies
+	Mirrors map[string]RepoLink
+	// Since limits the sync to issues updated after it, all issues when zero
+	Since time.Time
+	// RetryDelay replaces DefaultIssueRetryDelay if set
+	RetryDelay time.Duration
+	// Timestamps dates new issues and comments back to their GitHub dates,
+	// which Gitea only accepts from admins
+	Timestamps bool
+	DryRun     bool
+}
+
+// MirrorIssues creates the GitHub issues missing on the mirror and carries
+// over edits, comments, labels and state changes to those mirrored before.
+func (c *Client) MirrorIssues(ctx context.Context, ghClient *github.Client, repo *repository.Repository, target *Target, opts IssueOptions) error {
+	if !repo.HasIssues {
+		log.Printf("Repository %s doesn't have issues enabled. Skipping issues mirroring.", repo.Name)
+		return nil
+	}
+
+	if opts.DryRun {
+		log.Printf("DRY RUN: Would mirror issues for repository: %s", repo.Name)
+		return nil
+	}
+
+	// Issues created by earlier runs carry a marker, so re-runs don't duplicate them
+	mirrored, imported, err := c.listMirroredIssues(target.Name, repo.GiteaName())
+	if err != nil {
+		return err
+	}
+	if imported {
+		log.Printf("Issues of %s were imported by the Gitea migrator. Skipping issues mirroring.", repo.Name)
+		return nil
+	}
+	refs := c.newReferences(repo, opts.Mirrors, mirrored)
+
+	// Fetch issues from GitHub
+	issues, err := c.fetchGitHubIssues(ctx, ghClient, repo, opts.Since)
+	if err != nil {
+		return err
+	}
+
+	if opts.Since.IsZero() {
+		log.Printf("Found %d issues for %s", len(issues), repo.Name)
+	} else {
+		log.Printf("Found %d issues for %s updated since %s", len(issues), repo.Name, opts.Since.Format(time.RFC3339))
+	}
+
+	// Create issues one by one to maintain order. Neither Gitea nor Forgejo
+	// expose a bulk issue import endpoint in their REST API; batched imports
+	// are only possible through the migrate endpoint at repository creation.
+	for i := len(issues) - 1; i >= 0; i-- {
+		issue := issues[i]
+
+		number, created := 0, false
+		if existing, ok := mirrored[issueSource(repo, issue.GetNumber())]; ok {
+			number = existing.Number
+			if err := c.updateGiteaIssue(issue, existing, repo, target, refs, opts); err != nil {
+				log.Printf("Error updating issue #%d '%s': %v", number, issue.GetTitle(), err)
+			}
+		} else {
+			number, err = c.createGiteaIssue(ctx, issue, repo, target, refs, opts)
+			if errors.Is(err, errThrottled) || ctx.Err() != nil {
+				// The remaining issues are picked up by the next run
+				return fmt.Errorf("stopped mirroring issues of %s: %w", repo.Name, err)
+			}
+			if err != nil {
+				log.Printf("Error creating issue '%s': %v", issue.GetTitle(), err)
+				continue
+			}
+			refs.add(issueSource(repo, issue.GetNumber()), number)
+			created = true
+		}
+
+		if issue.GetComments() > 0 {
+			err := c.mirrorComments(ctx, ghClient, issue, repo, target, number, refs, opts)
+			if errors.Is(err, errThrottled) || ctx.Err() != nil {
+				return fmt.Errorf("stopped mirroring issues of %s: %w", repo.Name, err)
+			}
+			if err != nil {
+				log.Printf("Error mirroring comments of issue #%d: %v", number, err)
+			}
+		}
+
+		// Labels and comments touch the issue, so it is dated back last
+		if created && opts.Timestamps {
+			if err := c.setIssueUpdatedAt(repo, target, number, issue.GetUpdatedAt().Time); err != nil {
+				log.Printf("Warning: Failed to set the date of issue #%d: %v", number, err)
+			}
+		}
+	}
+
+	log.Printf("Completed mirroring issues for %s", repo.Name)
+	return nil
+}
+
+func (c *Client) fetchGitHubIssues(ctx context.Context, ghClient *github.Client, repo *repository.Repository, since time.Time) ([]*github.Issue, error) {
+	opt := &github.IssueListByRepoOptions{
+		State:       "all",
+		Since:       since,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var allIssues []*github.Issue
+	for {
+		issues, resp, err := ghClient.Issues.ListByRepo(ctx, repo.Owner, repo.Name, opt)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching issues for %s/%s: %w", repo.Owner, repo.Name, err)
+		}
+		allIssues = append(allIssues, issues...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return allIssues, nil
+}
+
+// doThrottledRequest sends a request creating issue content. Gitea throttles
+// rapid issue creation with 403 or 429 responses, often without saying for
+// how long, so the request is retried after a doubling delay.
+func (c *Client) doThrottledRequest(ctx context.Context, method, path string, body interface{}, delay time.Duration) ([]byte, int, error) {
+	if delay <= 0 {
+		delay = DefaultIssueRetryDelay
+	}
+	for attempt := 0; ; attempt++ {
+		respBody, statusCode, _, err := c.doRequestContext(ctx, method, path, body)
+		if err != nil || statusCode != http.StatusForbidden && statusCode != http.StatusTooManyRequests {
+			return respBody, statusCode, err
+		}
+		if attempt == issueRetries {
+			return respBody, statusCode, fmt.Errorf("%w: status %d after %d retries", errThrottled, statusCode, issueRetries)
+		}
+
+		log.Printf("Gitea throttled %s %s with status %d, retrying in %s", method, path, statusCode, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// issueBody renders the body of the mirrored copy of a GitHub issue.
+func issueBody(issue *github.Issue, repo *repository.Repository, refs *references, userMap map[string]string) string {
+	// Gitea doesn't take a closing date, so it is kept in the attribution line
+	var closed string
+	if issue.ClosedAt != nil {
+		closed = fmt.Sprintf(", closed on %s", issue.GetClosedAt().Format("2006-01-02"))
+	}
+	return fmt.Sprintf("*Originally created by %s on %s%s*\n\n%s\n\n<!-- mirrored-from: %s -->",
+		authorReference(issue.GetUser().GetLogin(), userMap),
+		issue.GetCreatedAt().Format("2006-01-02"),
+		closed,
+		refs.rewrite(issue.GetBody()),
+		issueSource(repo, issue.GetNumber()))
+}
+
+func (c *Client) createGiteaIssue(ctx context.Context, issue *github.Issue, repo *repository.Repository, target *Target, refs *references, opts IssueOptions) (int, error) {
+	body := issueBody(issue, repo, refs, opts.UserMap)
+
+	giteaIssue := Issue{
+		Title:     issue.GetTitle(),
+		Body:      body,
+		State:     issue.GetState(),
+		Closed:    issue.GetState() == "closed",
+		Assignees: mapAssignees(issue.Assignees, opts.UserMap),
+	}
+
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/issues", target.Name, repo.GiteaName())
+	respBody, statusCode, err := c.doThrottledRequest(ctx, "POST", path, giteaIssue, opts.RetryDelay)
+	if err != nil {
+		return 0, err
+	}
+
+	// Gitea rejects assignees without access to the repository, so retry unassigned
+	if statusCode == http.StatusUnprocessableEntity && len(giteaIssue.Assignees) > 0 {
+		log.Printf("Warning: Could not assign %v to issue '%s', creating it unassigned", giteaIssue.Assignees, issue.GetTitle())
+		giteaIssue.Assignees = nil
+		respBody, statusCode, err = c.doThrottledRequest(ctx, "POST", path, giteaIssue, opts.RetryDelay)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if statusCode != http.StatusCreated {
+		return 0, fmt.Errorf("failed to create issue: status %d", statusCode)
+	}
+
+	var issueResp IssueResponse
+	if err := json.Unmarshal(respBody, &issueResp); err != nil {
+		return 0, err
+	}
+
+	log.Printf("Created issue #%d: %s", issueResp.Number, issue.GetTitle())
+	events.Emit(events.IssueCreated, events.Fields{
+		"repository": repo.FullName,
+		"mirror":     target.Name + "/" + repo.GiteaName(),
+		"number":     issueResp.Number,
+		"source":     issue.GetNumber(),
+		"title":      issue.GetTitle(),
+	})
+
+	// The create endpoint ignores the closed flag, so close the issue afterwards
+	if giteaIssue.Closed && issueResp.State != "closed" {
+		if err := c.closeIssue(repo, target, issueResp.Number); err != nil {
+			log.Printf("Warning: Failed to close issue #%d: %v", issueResp.Number, err)
+		}
+	}
+
+	if opts.RehostAttachments {
+		if err := c.rehostIssueAttachments(repo, target, issueResp.Number, body, opts.GitHubToken); err != nil {
+			log.Printf("Warning: Failed to re-host attachments of issue #%d: %v", issueResp.Number, err)
+		}
+	}
+
+	// Add labels if the issue has any
+	if len(issue.Labels) > 0 {
+		for _, label := range issue.Labels {
+			c.addLabelToIssue(repo, target, issueResp.Number, label.GetName())
+		}
+	}
+
+	return issueResp.Number, nil
+}
+
+func (c *Client) closeIssue(repo *repository.Repository, target *Target, issueNumber int) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/issues/%d", target.Name, repo.GiteaName(), issueNumber)
+	_, statusCode, err := c.doRequest("PATCH", path, map[string]string{"state": "closed"})
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusCreated && statusCode != http.StatusOK {
+		return fmt.Errorf("status %d", statusCode)
+	}
+	return nil
+}
+
+// issueSource identifies a GitHub issue in the marker of its mirrored copy.
+func issueSource(repo *repository.Repository, number int) string {
+	return fmt.Sprintf("%s#%d", repo.FullName, number)
+}
+
+// mirroredIssue is the current state of an issue copied to the mirror.
+type mirroredIssue struct {
+	Number    int
+	Title     string
+	Body      string
+	State     string
+	Labels    []string
+	UpdatedAt time.Time
+}
+
+// listMirroredIssues returns the issues of the Gitea repository owner/name
+// keyed by the source found in their marker. The flag reports whether the
+// Gitea migrator imported issues, which it marks with their original author.
+func (c *Client) listMirroredIssues(owner, name string) (map[string]*mirroredIssue, bool, error) {
+	sources := make(map[string]*mirroredIssue)
+	imported := false
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/api/v1/repos/%s/%s/issues?state=all&type=issues&page=%d&limit=%d", owner, name, page, listPageSize)
+		respBody, statusCode, err := c.doRequest("GET", path, nil)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if statusCode != http.StatusOK {
+			return nil, false, fmt.Errorf("failed to list issues of %s/%s: status %d", owner, name, statusCode)
+		}
+
+		var issues []struct {
+			Number         int       `json:"number"`
+			Title          string    `json:"title"`
+			Body           string    `json:"body"`
+			State          string    `json:"state"`
+			UpdatedAt      time.Time `json:"updated_at"`
+			Labels         []Label   `json:"labels"`
+			OriginalAuthor string    `json:"original_author"`
+		}
+		if err := json.Unmarshal(respBody, &issues); err != nil {
+			return nil, false, err
+		}
+
+		for _, issue := range issues {
+			if issue.OriginalAuthor != "" {
+				imported = true
+			}
+			mirrored := &mirroredIssue{
+				Number:    issue.Number,
+				Title:     issue.Title,
+				Body:      issue.Body,
+				State:     issue.State,
+				UpdatedAt: issue.UpdatedAt,
+			}
+			for _, label := range issue.Labels {
+				mirrored.Labels = append(mirrored.Labels, label.Name)
+			}
+			for _, match := range issueMarker.FindAllStringSubmatch(issue.Body, -1) {
+				sources[match[1]] = mirrored
+			}
+		}
+
+		if len(issues) < listPageSize {
+			return sources, imported, nil
+		}
+	}
+}
+
+func (c *Client) addLabelToIssue(repo *repository.Repository, target *Target, issueNumber int, labelName string) {
+	// First try to create the label if it doesn't exist
+	labelPath := fmt.Sprintf("/api/v1/repos/%s/%s/labels", target.Name, repo.GiteaName())
+	label := Label{
+		Name:  labelName,
+		Color: generateRandomColor(),
+	}
+	c.doRequest("POST", labelPath, label)
+
+	// Then add the label to the issue
+	issueLabelPath := fmt.Sprintf("/api/v1/repos/%s/%s/issues/%d/labels", target.Name, repo.GiteaName(), issueNumber)
+	labelList := map[string][]string{
+		"labels": {labelName},
+	}
+	if _, statusCode, err := c.doRequest("POST", issueLabelPath, labelList); err != nil || statusCode != http.StatusOK {
+		log.Printf("Error adding label %s to issue: %v", labelName, err)
+	}
+}
+
+// authorReference mentions the mapped Gitea user, falling back to the GitHub login.
+func authorReference(login string, userMap map[string]string) string {
+	if giteaUser, ok := lookupUser(userMap, login); ok {
+		return fmt.Sprintf("@%s (GitHub: %s)", giteaUser, login)
+	}
+	return "@" + login
+}
+
+// mapAssignees translates GitHub assignees to Gitea users, dropping unmapped ones.
+func mapAssignees(assignees []*github.User, userMap map[string]string) []string {
+	var result []string
+	for _, assignee := range assignees {
+		if giteaUser, ok := lookupUser(userMap, assignee.GetLogin()); ok {
+			result = append(result, giteaUser)
+		}
+	}
+	return result
+}
+
+// lookupUser returns the Gitea user a GitHub login is mapped to. GitHub
+// logins are case-insensitive, so the map may spell them differently.
+func lookupUser(userMap map[string]string, login string) (string, bool) {
+	if giteaUser, ok := userMap[login]; ok {
+		return giteaUser, true
+	}
+	for githubLogin, giteaUser := range userMap {
+		if strings.EqualFold(githubLogin, login) {
+			return giteaUser, true
+		}
+	}
+	return "", false
+}
+
+func generateRandomColor() string {
+	return fmt.Sprintf("%06x", rand.Intn(0xFFFFFF))
+}
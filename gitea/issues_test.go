@@ -0,0 +1,34 @@
+package gitea
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-github/v66/github"
+)
+
+func TestUserMapping(t *testing.T) {
+	userMap := map[string]string{"Alice": "alice-gitea", "bob": "bob-gitea"}
+
+	tests := []struct {
+		login     string
+		reference string
+	}{
+		{"Alice", "@alice-gitea (GitHub: Alice)"},
+		{"alice", "@alice-gitea (GitHub: alice)"},
+		{"BOB", "@bob-gitea (GitHub: BOB)"},
+		{"carol", "@carol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.login, func(t *testing.T) {
+			if got := authorReference(tt.login, userMap); got != tt.reference {
+				t.Errorf("expected %q, got %q", tt.reference, got)
+			}
+		})
+	}
+
+	assignees := []*github.User{{Login: github.String("ALICE")}, {Login: github.String("carol")}, {Login: github.String("Bob")}}
+	if got := mapAssignees(assignees, userMap); !slices.Equal(got, []string{"alice-gitea", "bob-gitea"}) {
+		t.Errorf("expected the mapped assignees regardless of case, got %v", got)
+	}
+}
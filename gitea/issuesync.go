@@ -0,0 +1,194 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// commentMarker matches the hidden source reference in mirrored comments.
+var commentMarker = regexp.MustCompile(`<!-- mirrored-from: \S+#\d+/comment-(\d+) -->`)
+
+type mirroredComment struct {
+	ID        int64     `json:"id"`
+	Body      string    `json:"body"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// updateGiteaIssue carries title, body, state and label changes of a GitHub
+// issue over to its mirrored copy.
+func (c *Client) updateGiteaIssue(issue *github.Issue, existing *mirroredIssue, repo *repository.Repository, target *Target, refs *references, opts IssueOptions) error {
+	// Edits on the mirror, like re-hosted attachments, are newer than the
+	// GitHub issue and must not be overwritten again
+	if !issue.GetUpdatedAt().After(existing.UpdatedAt) {
+		return nil
+	}
+
+	changes := make(map[string]string)
+	if issue.GetTitle() != existing.Title {
+		changes["title"] = issue.GetTitle()
+	}
+	body := issueBody(issue, repo, refs, opts.UserMap)
+	if body != existing.Body {
+		changes["body"] = body
+	}
+	if issue.GetState() != existing.State {
+		changes["state"] = issue.GetState()
+	}
+
+	if len(changes) > 0 {
+		path := fmt.Sprintf("/api/v1/repos/%s/%s/issues/%d", target.Name, repo.GiteaName(), existing.Number)
+		_, statusCode, err := c.doRequest("PATCH", path, changes)
+		if err != nil {
+			return err
+		}
+		if statusCode != http.StatusCreated && statusCode != http.StatusOK {
+			return fmt.Errorf("failed to update issue: status %d", statusCode)
+		}
+		log.Printf("Updated issue #%d: %s", existing.Number, issue.GetTitle())
+
+		if _, ok := changes["body"]; ok && opts.RehostAttachments {
+			if err := c.rehostIssueAttachments(repo, target, existing.Number, body, opts.GitHubToken); err != nil {
+				log.Printf("Warning: Failed to re-host attachments of issue #%d: %v", existing.Number, err)
+			}
+		}
+	}
+
+	var labels []string
+	for _, label := range issue.Labels {
+		labels = append(labels, label.GetName())
+	}
+	slices.Sort(labels)
+	current := slices.Clone(existing.Labels)
+	slices.Sort(current)
+	if !slices.Equal(labels, current) {
+		if err := c.replaceIssueLabels(repo, target, existing.Number, labels); err != nil {
+			return fmt.Errorf("failed to update labels: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// replaceIssueLabels sets the labels of an issue, creating missing ones.
+func (c *Client) replaceIssueLabels(repo *repository.Repository, target *Target, issueNumber int, labelNames []string) error {
+	labelPath := fmt.Sprintf("/api/v1/repos/%s/%s/labels", target.Name, repo.GiteaName())
+	for _, name := range labelNames {
+		c.doRequest("POST", labelPath, Label{Name: name, Color: generateRandomColor()})
+	}
+
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/issues/%d/labels", target.Name, repo.GiteaName(), issueNumber)
+	_, statusCode, err := c.doRequest("PUT", path, map[string][]string{"labels": labelNames})
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("status %d", statusCode)
+	}
+	return nil
+}
+
+// mirrorComments creates the comments of a GitHub issue missing on its
+// mirrored copy and updates those edited on GitHub since.
+func (c *Client) mirrorComments(ctx context.Context, ghClient *github.Client, issue *github.Issue, repo *repository.Repository, target *Target, issueNumber int, refs *references, opts IssueOptions) error {
+	comments, err := fetchGitHubComments(ctx, ghClient, repo, issue.GetNumber(), opts.Since)
+	if err != nil {
+		return err
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/issues/%d/comments", target.Name, repo.GiteaName(), issueNumber)
+	respBody, statusCode, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("failed to list comments: status %d", statusCode)
+	}
+
+	var existing []mirroredComment
+	if err := json.Unmarshal(respBody, &existing); err != nil {
+		return err
+	}
+
+	mirrored := make(map[string]mirroredComment)
+	for _, comment := range existing {
+		if match := commentMarker.FindStringSubmatch(comment.Body); match != nil {
+			mirrored[match[1]] = comment
+		}
+	}
+
+	for _, comment := range comments {
+		body := fmt.Sprintf("*Originally posted by %s on %s*\n\n%s\n\n<!-- mirrored-from: %s/comment-%d -->",
+			authorReference(comment.GetUser().GetLogin(), opts.UserMap),
+			comment.GetCreatedAt().Format("2006-01-02"),
+			refs.rewrite(comment.GetBody()),
+			issueSource(repo, issue.GetNumber()),
+			comment.GetID())
+
+		copied, ok := mirrored[fmt.Sprint(comment.GetID())]
+		if !ok {
+			newComment := map[string]string{"body": body}
+			if opts.Timestamps {
+				newComment["updated_at"] = comment.GetCreatedAt().UTC().Format(time.RFC3339)
+			}
+			_, statusCode, err := c.doThrottledRequest(ctx, "POST", path, newComment, opts.RetryDelay)
+			if err != nil {
+				return err
+			}
+			if statusCode != http.StatusCreated {
+				return fmt.Errorf("failed to create comment: status %d", statusCode)
+			}
+			continue
+		}
+
+		if copied.Body == body || !comment.GetUpdatedAt().After(copied.UpdatedAt) {
+			continue
+		}
+
+		editPath := fmt.Sprintf("/api/v1/repos/%s/%s/issues/comments/%d", target.Name, repo.GiteaName(), copied.ID)
+		_, statusCode, err := c.doRequest("PATCH", editPath, map[string]string{"body": body})
+		if err != nil {
+			return err
+		}
+		if statusCode != http.StatusOK {
+			return fmt.Errorf("failed to update comment: status %d", statusCode)
+		}
+	}
+
+	return nil
+}
+
+func fetchGitHubComments(ctx context.Context, ghClient *github.Client, repo *repository.Repository, number int, since time.Time) ([]*github.IssueComment, error) {
+	opt := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	if !since.IsZero() {
+		opt.Since = &since
+	}
+
+	var allComments []*github.IssueComment
+	for {
+		comments, resp, err := ghClient.Issues.ListComments(ctx, repo.Owner, repo.Name, number, opt)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching comments of %s/%s#%d: %w", repo.Owner, repo.Name, number, err)
+		}
+		allComments = append(allComments, comments...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return allComments, nil
+}
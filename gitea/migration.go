@@ -0,0 +1,52 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+const migrationPollInterval = 5 * time.Second
+
+type repositoryStatus struct {
+	Empty  bool `json:"empty"`
+	Mirror bool `json:"mirror"`
+}
+
+// WaitForMigration polls the mirror until Gitea has cloned content into it.
+// Gitea removes repositories whose migration failed, so a vanished repository
+// is reported as failure, as is a mirror that is still empty after the timeout.
+func (c *Client) WaitForMigration(repo *repository.Repository, target *Target, timeout time.Duration) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s", target.Name, repo.GiteaName())
+	deadline := time.Now().Add(timeout)
+
+	for {
+		respBody, statusCode, err := c.doRequest("GET", path, nil)
+		if err != nil {
+			return err
+		}
+
+		switch statusCode {
+		case http.StatusOK:
+			var status repositoryStatus
+			if err := json.Unmarshal(respBody, &status); err != nil {
+				return err
+			}
+			if !status.Empty {
+				return nil
+			}
+		case http.StatusNotFound:
+			return fmt.Errorf("migration of %s failed, the repository was removed by Gitea", repo.GiteaName())
+		default:
+			return fmt.Errorf("failed to check migration of %s: status %d", repo.GiteaName(), statusCode)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("migration of %s did not complete within %s, the mirror is still empty", repo.GiteaName(), timeout)
+		}
+		time.Sleep(migrationPollInterval)
+	}
+}
@@ -0,0 +1,38 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// OrganizationPermissions are the rights of a user in an organization.
+type OrganizationPermissions struct {
+	IsOwner             bool `json:"is_owner"`
+	IsAdmin             bool `json:"is_admin"`
+	CanWrite            bool `json:"can_write"`
+	CanCreateRepository bool `json:"can_create_repository"`
+}
+
+// GetOrganizationPermissions returns the permissions of username in orgName,
+// or nil if the organization doesn't exist.
+func (c *Client) GetOrganizationPermissions(username, orgName string) (*OrganizationPermissions, error) {
+	respBody, statusCode, err := c.doRequest("GET", fmt.Sprintf("/api/v1/users/%s/orgs/%s/permissions", username, orgName), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to get permissions in organization %s: status %d", orgName, statusCode)
+	}
+
+	var permissions OrganizationPermissions
+	if err := json.Unmarshal(respBody, &permissions); err != nil {
+		return nil, err
+	}
+	return &permissions, nil
+}
@@ -0,0 +1,120 @@
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jaedle/mirror-to-gitea/gitcmd"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// CreateRepository creates an empty repository for the clone fallback.
+func (c *Client) CreateRepository(repo *repository.Repository, target *Target, opts MirrorOptions) error {
+	path := "/api/v1/user/repos"
+	if target.Type == "organization" {
+		path = fmt.Sprintf("/api/v1/orgs/%s/repos", target.Name)
+	}
+
+	createReq := map[string]interface{}{
+		"name":        repo.GiteaName(),
+		"private":     opts.Private,
+		"description": opts.Description,
+		"website":     opts.Website,
+	}
+	if repo.DefaultBranch != "" {
+		createReq["default_branch"] = repo.DefaultBranch
+	}
+
+	_, statusCode, err := c.doRequest("POST", path, createReq)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("failed to create repository %s: status %d", repo.GiteaName(), statusCode)
+	}
+
+	c.markMirrored(repo.GiteaName(), target)
+	return nil
+}
+
+// PushMirror fetches the refs of the GitHub repository matching refspecs,
+// all branches and tags if nil, into a bare clone below cacheDir and pushes
+// them to the Gitea repository, removing refs deleted on GitHub. Gitea can't
+// turn such a repository into a pull mirror, so it is only updated by calling
+// PushMirror again.
+func (c *Client) PushMirror(ctx context.Context, repo *repository.Repository, target *Target, cacheDir, githubToken string, refspecs []string) error {
+	if refspecs == nil {
+		refspecs = gitcmd.Refspecs
+	}
+
+	clone := filepath.Join(cacheDir, strings.ToLower(repo.FullName)+".git")
+	if _, err := os.Stat(clone); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(clone), 0o755); err != nil {
+			return err
+		}
+		if err := gitcmd.Run(ctx, "", "init", "--bare", "--quiet", clone); err != nil {
+			return fmt.Errorf("failed to create clone of %s: %w", repo.FullName, err)
+		}
+	}
+
+	fetch := append([]string{"-C", clone, "fetch", "--prune", "--quiet", repo.URL}, refspecs...)
+	if err := gitcmd.Run(ctx, gitcmd.GitHubAuthorization(githubToken), fetch...); err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", repo.FullName, err)
+	}
+
+	if err := c.push(ctx, clone, repo, target, refspecs); err != nil {
+		return err
+	}
+
+	log.Printf("Pushed %s to %s/%s", repo.FullName, target.Name, repo.GiteaName())
+	return nil
+}
+
+// PushBundle pushes the branches and tags of a git bundle to the Gitea
+// repository.
+func (c *Client) PushBundle(ctx context.Context, repo *repository.Repository, target *Target, bundlePath string) error {
+	local, err := os.MkdirTemp("", "import-*.git")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(local)
+
+	if err := gitcmd.Run(ctx, "", "init", "--bare", "--quiet", local); err != nil {
+		return err
+	}
+	fetch := append([]string{"-C", local, "fetch", "--quiet", bundlePath}, gitcmd.Refspecs...)
+	if err := gitcmd.Run(ctx, "", fetch...); err != nil {
+		return fmt.Errorf("failed to read bundle of %s: %w", repo.FullName, err)
+	}
+
+	if err := c.push(ctx, local, repo, target, gitcmd.Refspecs); err != nil {
+		return err
+	}
+
+	log.Printf("Imported %s to %s/%s", repo.FullName, target.Name, repo.GiteaName())
+	return nil
+}
+
+// push pushes the refs of a local repository matching refspecs to the Gitea
+// repository, removing the refs missing locally.
+func (c *Client) push(ctx context.Context, local string, repo *repository.Repository, target *Target, refspecs []string) error {
+	authorization, err := c.authorization()
+	if err != nil {
+		return err
+	}
+
+	remote := fmt.Sprintf("%s/%s/%s.git", strings.TrimSuffix(c.baseURL, "/"), target.Name, repo.GiteaName())
+	push := append([]string{"-C", local, "push", "--prune", "--quiet", remote}, refspecs...)
+	err = gitcmd.Run(ctx, authorization, push...)
+	c.recordAudit("PUSH", target.Name+"/"+repo.GiteaName(), nil, 0, err)
+	if err != nil {
+		return fmt.Errorf("failed to push %s: %w", repo.GiteaName(), err)
+	}
+	return nil
+}
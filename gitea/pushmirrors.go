@@ -0,0 +1,69 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// pushMirrorInterval is how often Gitea pushes to a push mirror besides on
+// every commit, its default for pull mirrors.
+const pushMirrorInterval = "8h0m0s"
+
+// RemoteMirror is a push mirror Gitea keeps a remote repository up to date with.
+type RemoteMirror struct {
+	RemoteName    string `json:"remote_name"`
+	RemoteAddress string `json:"remote_address"`
+	Interval      string `json:"interval"`
+	SyncOnCommit  bool   `json:"sync_on_commit"`
+	LastError     string `json:"last_error"`
+}
+
+// ListRemoteMirrors returns the push mirrors of owner/name.
+func (c *Client) ListRemoteMirrors(owner, name string) ([]RemoteMirror, error) {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/push_mirrors", owner, name)
+	respBody, statusCode, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list push mirrors of %s/%s: status %d", owner, name, statusCode)
+	}
+
+	var mirrors []RemoteMirror
+	if err := json.Unmarshal(respBody, &mirrors); err != nil {
+		return nil, err
+	}
+	return mirrors, nil
+}
+
+// AddRemoteMirror makes Gitea push owner/name to remoteURL on every commit
+// and periodically, authenticating with username and password.
+func (c *Client) AddRemoteMirror(owner, name, remoteURL, username, password string, dryRun bool) error {
+	if c.flavor() == FlavorGogs {
+		return fmt.Errorf("Gogs doesn't support push mirrors")
+	}
+	if dryRun {
+		log.Printf("DRY RUN: Would push %s/%s to %s", owner, name, remoteURL)
+		return nil
+	}
+
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/push_mirrors", owner, name)
+	_, statusCode, err := c.doRequest("POST", path, map[string]interface{}{
+		"remote_address":  remoteURL,
+		"remote_username": username,
+		"remote_password": password,
+		"interval":        pushMirrorInterval,
+		"sync_on_commit":  true,
+	})
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK && statusCode != http.StatusCreated {
+		return fmt.Errorf("failed to add push mirror to %s/%s: status %d", owner, name, statusCode)
+	}
+
+	log.Printf("Pushing %s/%s to %s", owner, name, remoteURL)
+	return nil
+}
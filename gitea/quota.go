@@ -0,0 +1,96 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// quotaInfo is the quota of a user or organization on Forgejo. Sizes and
+// limits are in bytes, a negative limit is unlimited.
+type quotaInfo struct {
+	Used struct {
+		Size struct {
+			Repos struct {
+				Public  int64 `json:"public"`
+				Private int64 `json:"private"`
+			} `json:"repos"`
+			Git struct {
+				LFS int64 `json:"LFS"`
+			} `json:"git"`
+			Assets struct {
+				Attachments struct {
+					Issues   int64 `json:"issues"`
+					Releases int64 `json:"releases"`
+				} `json:"attachments"`
+				Artifacts int64 `json:"artifacts"`
+				Packages  struct {
+					All int64 `json:"all"`
+				} `json:"packages"`
+			} `json:"assets"`
+		} `json:"size"`
+	} `json:"used"`
+	Groups []struct {
+		Rules []struct {
+			Limit    int64    `json:"limit"`
+			Subjects []string `json:"subjects"`
+		} `json:"rules"`
+	} `json:"groups"`
+}
+
+// RemainingQuota returns how many bytes the target can still store in
+// repositories under its quota, or -1 without a limit. Gitea has no quotas,
+// only Forgejo reports them.
+func (c *Client) RemainingQuota(target *Target) (int64, error) {
+	path := "/api/v1/user/quota"
+	if target.Type == "organization" {
+		path = fmt.Sprintf("/api/v1/orgs/%s/quota", target.Name)
+	}
+	respBody, statusCode, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return 0, err
+	}
+	switch statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return -1, nil
+	default:
+		return 0, fmt.Errorf("failed to get the quota of %s: status %d", target.Name, statusCode)
+	}
+
+	var quota quotaInfo
+	if err := json.Unmarshal(respBody, &quota); err != nil {
+		return 0, err
+	}
+
+	size := quota.Used.Size
+	repos := size.Repos.Public + size.Repos.Private
+	git := repos + size.Git.LFS
+	all := git + size.Assets.Attachments.Issues + size.Assets.Attachments.Releases + size.Assets.Artifacts + size.Assets.Packages.All
+
+	remaining := int64(-1)
+	for _, group := range quota.Groups {
+		for _, rule := range group.Rules {
+			if rule.Limit < 0 {
+				continue
+			}
+			// The broadest subject of a rule counts, new mirrors add to all of them
+			var used int64
+			switch {
+			case slices.Contains(rule.Subjects, "size:all"):
+				used = all
+			case slices.Contains(rule.Subjects, "size:git:all"):
+				used = git
+			case slices.Contains(rule.Subjects, "size:repos:all"):
+				used = repos
+			default:
+				continue
+			}
+			if left := max(rule.Limit-used, 0); remaining < 0 || left < remaining {
+				remaining = left
+			}
+		}
+	}
+	return remaining, nil
+}
@@ -0,0 +1,98 @@
+package gitea
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+var (
+	// issueURLPattern matches links to GitHub issues and pull requests, an
+	// anchor to one of their comments is dropped when rewritten.
+	issueURLPattern = regexp.MustCompile(`https://github\.com/([\w.-]+/[\w.-]+)/(?:issues|pull)/(\d+)(#issuecomment-\d+)?`)
+	// bareReferencePattern matches #123 unless it is part of a word, a path or
+	// the text of a markdown link.
+	bareReferencePattern = regexp.MustCompile(`(^|[^\w/&\[])#(\d+)\b`)
+)
+
+// RepoLink locates the mirror of a GitHub repository on Gitea.
+type RepoLink struct {
+	Owner string
+	Name  string
+}
+
+// references rewrites GitHub issue references in mirrored bodies to the
+// copies of the issues on Gitea.
+type references struct {
+	client *Client
+	repo   *repository.Repository
+	// mirrors holds the mirrors of the run by lower-cased GitHub full name
+	mirrors map[string]RepoLink
+
+	// numbers maps lower-cased issue sources to Gitea issue numbers for the
+	// repositories in loaded
+	numbers map[string]int
+	loaded  map[string]bool
+}
+
+func (c *Client) newReferences(repo *repository.Repository, mirrors map[string]RepoLink, mirrored map[string]*mirroredIssue) *references {
+	refs := &references{
+		client:  c,
+		repo:    repo,
+		mirrors: mirrors,
+		numbers: make(map[string]int),
+		loaded:  map[string]bool{strings.ToLower(repo.FullName): true},
+	}
+	for source, issue := range mirrored {
+		refs.add(source, issue.Number)
+	}
+	return refs
+}
+
+// add records the Gitea number of a newly mirrored issue.
+func (r *references) add(source string, number int) {
+	r.numbers[strings.ToLower(source)] = number
+}
+
+// rewrite links bare #123 references to the issue of the mirrored repository
+// and points links to mirrored GitHub issues at their Gitea copies. Links to
+// issues that aren't mirrored (yet) keep pointing at GitHub.
+func (r *references) rewrite(body string) string {
+	body = bareReferencePattern.ReplaceAllString(body, fmt.Sprintf("${1}[#${2}](https://github.com/%s/issues/${2})", r.repo.FullName))
+
+	return issueURLPattern.ReplaceAllStringFunc(body, func(link string) string {
+		match := issueURLPattern.FindStringSubmatch(link)
+		fullName := strings.ToLower(match[1])
+		mirror, ok := r.mirrors[fullName]
+		if !ok {
+			return link
+		}
+
+		r.load(fullName, mirror)
+		number, ok := r.numbers[fullName+"#"+match[2]]
+		if !ok {
+			return link
+		}
+		return fmt.Sprintf("%s/%s/%s/issues/%d", strings.TrimSuffix(r.client.baseURL, "/"), mirror.Owner, mirror.Name, number)
+	})
+}
+
+// load fetches the mirrored issues of another repository of the run once.
+func (r *references) load(fullName string, mirror RepoLink) {
+	if r.loaded[fullName] {
+		return
+	}
+	r.loaded[fullName] = true
+
+	mirrored, _, err := r.client.listMirroredIssues(mirror.Owner, mirror.Name)
+	if err != nil {
+		log.Printf("Warning: Failed to list mirrored issues of %s/%s: %v", mirror.Owner, mirror.Name, err)
+		return
+	}
+	for source, issue := range mirrored {
+		r.add(source, issue.Number)
+	}
+}
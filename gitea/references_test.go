@@ -0,0 +1,85 @@
+package gitea
+
+import (
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestIssueURLPattern(t *testing.T) {
+	tests := []struct {
+		text     string
+		fullName string
+		number   string
+	}{
+		{"see https://github.com/octo/demo/issues/12", "octo/demo", "12"},
+		{"fixed by https://github.com/octo/demo.js/pull/7", "octo/demo.js", "7"},
+		{"https://github.com/octo/my-repo/issues/3#issuecomment-99", "octo/my-repo", "3"},
+		{"https://github.com/octo/demo/discussions/4", "", ""},
+		{"https://gitlab.com/octo/demo/issues/12", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			match := issueURLPattern.FindStringSubmatch(tt.text)
+			if tt.fullName == "" {
+				if match != nil {
+					t.Errorf("expected no match, got %v", match)
+				}
+				return
+			}
+			if match == nil || match[1] != tt.fullName || match[2] != tt.number {
+				t.Errorf("expected %s#%s, got %v", tt.fullName, tt.number, match)
+			}
+		})
+	}
+}
+
+func TestBareReferencePattern(t *testing.T) {
+	tests := []struct {
+		text    string
+		matches bool
+	}{
+		{"#12", true},
+		{"fixes #12", true},
+		{"(#12)", true},
+		{"issue#12", false},
+		{"path/#12", false},
+		{"&#12;", false},
+		{"[#12](https://example.com)", false},
+		{"# heading", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if matches := bareReferencePattern.MatchString(tt.text); matches != tt.matches {
+				t.Errorf("expected match %v, got %v", tt.matches, matches)
+			}
+		})
+	}
+}
+
+func TestRewriteReferences(t *testing.T) {
+	refs := &references{
+		client:  &Client{baseURL: "https://gitea.example.com/"},
+		repo:    &repository.Repository{FullName: "octo/demo"},
+		mirrors: map[string]RepoLink{"octo/demo": {Owner: "me", Name: "demo"}, "octo/other": {Owner: "archive", Name: "other"}},
+		numbers: map[string]int{"octo/demo#12": 3, "octo/other#5": 8},
+		loaded:  map[string]bool{"octo/demo": true, "octo/other": true},
+	}
+
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{"fixes #12", "fixes [#12](https://gitea.example.com/me/demo/issues/3)"},
+		{"see https://github.com/Octo/Other/issues/5#issuecomment-1", "see https://gitea.example.com/archive/other/issues/8"},
+		{"not mirrored yet: #13", "not mirrored yet: [#13](https://github.com/octo/demo/issues/13)"},
+		{"https://github.com/someone/else/pull/5", "https://github.com/someone/else/pull/5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			if rewritten := refs.rewrite(tt.body); rewritten != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, rewritten)
+			}
+		})
+	}
+}
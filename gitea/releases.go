@@ -0,0 +1,203 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+type Release struct {
+	ID      int64          `json:"id"`
+	TagName string         `json:"tag_name"`
+	Assets  []ReleaseAsset `json:"assets"`
+}
+
+type ReleaseAsset struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type CreateReleaseRequest struct {
+	TagName string `json:"tag_name"`
+	Name    string `json:"name"`
+	Body    string `json:"body"`
+}
+
+// MirrorReleaseArchives attaches a source tarball for every GitHub tag to the
+// matching release of the Gitea mirror, creating the release if necessary.
+func (c *Client) MirrorReleaseArchives(ctx context.Context, ghClient *github.Client, repo *repository.Repository, target *Target, dryRun bool) error {
+	tags, err := c.fetchGitHubTags(ctx, ghClient, repo)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		tagName := tag.GetName()
+		assetName := fmt.Sprintf("%s-%s.tar.gz", repo.Name, tagName)
+
+		release, err := c.getReleaseByTag(repo.GiteaName(), target, tagName)
+		if err != nil {
+			log.Printf("Error looking up release %s for %s: %v", tagName, repo.Name, err)
+			continue
+		}
+
+		if release != nil && hasAsset(release, assetName) {
+			continue
+		}
+
+		if dryRun {
+			log.Printf("DRY RUN: Would attach source archive %s to release %s of %s/%s", assetName, tagName, target.Name, repo.GiteaName())
+			continue
+		}
+
+		if release == nil {
+			release, err = c.createRelease(repo.GiteaName(), target, tagName)
+			if err != nil {
+				log.Printf("Error creating release %s for %s: %v", tagName, repo.Name, err)
+				continue
+			}
+		}
+
+		if err := c.uploadSourceArchive(ctx, ghClient, repo, target, release, tagName, assetName); err != nil {
+			log.Printf("Error attaching source archive %s to %s: %v", assetName, repo.Name, err)
+			continue
+		}
+
+		log.Printf("Attached source archive %s to release %s of %s/%s", assetName, tagName, target.Name, repo.GiteaName())
+	}
+
+	return nil
+}
+
+func (c *Client) fetchGitHubTags(ctx context.Context, ghClient *github.Client, repo *repository.Repository) ([]*github.RepositoryTag, error) {
+	opt := &github.ListOptions{PerPage: 100}
+
+	var allTags []*github.RepositoryTag
+	for {
+		tags, resp, err := ghClient.Repositories.ListTags(ctx, repo.Owner, repo.Name, opt)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching tags for %s/%s: %w", repo.Owner, repo.Name, err)
+		}
+		allTags = append(allTags, tags...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return allTags, nil
+}
+
+func (c *Client) getReleaseByTag(repoName string, target *Target, tagName string) (*Release, error) {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/releases/tags/%s", target.Name, repoName, url.PathEscape(tagName))
+	respBody, statusCode, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get release: status %d", statusCode)
+	}
+
+	var release Release
+	if err := json.Unmarshal(respBody, &release); err != nil {
+		return nil, err
+	}
+
+	return &release, nil
+}
+
+func (c *Client) createRelease(repoName string, target *Target, tagName string) (*Release, error) {
+	createReq := CreateReleaseRequest{
+		TagName: tagName,
+		Name:    tagName,
+		Body:    "*Source snapshot mirrored from GitHub*",
+	}
+
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/releases", target.Name, repoName)
+	respBody, statusCode, err := c.doRequest("POST", path, createReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to create release: status %d", statusCode)
+	}
+
+	var release Release
+	if err := json.Unmarshal(respBody, &release); err != nil {
+		return nil, err
+	}
+
+	return &release, nil
+}
+
+func (c *Client) uploadSourceArchive(ctx context.Context, ghClient *github.Client, repo *repository.Repository, target *Target, release *Release, tagName, assetName string) error {
+	archiveURL, _, err := ghClient.Repositories.GetArchiveLink(ctx, repo.Owner, repo.Name, github.Tarball, &github.RepositoryContentGetOptions{Ref: tagName}, 3)
+	if err != nil {
+		return fmt.Errorf("error getting archive link: %w", err)
+	}
+
+	// Buffer the archive on disk so large snapshots aren't held in memory
+	archive, err := os.CreateTemp("", "mirror-to-gitea-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", archiveURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.downloadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download archive: status %d", resp.StatusCode)
+	}
+
+	if _, err := io.Copy(archive, resp.Body); err != nil {
+		return err
+	}
+
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/releases/%d/assets?name=%s", target.Name, repo.GiteaName(), release.ID, url.QueryEscape(assetName))
+	_, statusCode, err := c.doMultipartRequest(path, "attachment", assetName, archive)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("failed to upload asset: status %d", statusCode)
+	}
+
+	return nil
+}
+
+func hasAsset(release *Release, name string) bool {
+	for _, asset := range release.Assets {
+		if asset.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package gitea
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// markingTransport marks the requests it sends, to tell which client sent them.
+type markingTransport struct{}
+
+func (markingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Download-Client", "1")
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestUploadSourceArchive(t *testing.T) {
+	var uploaded string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/octo/demo/tarball/v1.0":
+			http.Redirect(w, r, server.URL+"/codeload/octo/demo/v1.0.tar.gz", http.StatusFound)
+		case "/codeload/octo/demo/v1.0.tar.gz":
+			if r.Header.Get("X-Download-Client") == "" {
+				t.Error("expected the archive to be downloaded with the download client")
+			}
+			w.Write([]byte("archive"))
+		case "/api/v1/repos/me/demo/releases/7/assets":
+			if name := r.URL.Query().Get("name"); name != "demo-v1.0.tar.gz" {
+				t.Errorf("unexpected asset name %q", name)
+			}
+			_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			part, err := multipart.NewReader(r.Body, params["boundary"]).NextPart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := io.ReadAll(part)
+			uploaded = string(content)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetDownloadClient(&http.Client{Transport: markingTransport{}})
+	ghClient := github.NewClient(nil)
+	ghClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	repo := &repository.Repository{Name: "demo", Owner: "octo", FullName: "octo/demo"}
+	target := &Target{Name: "me", Type: "user"}
+	if err := client.uploadSourceArchive(context.Background(), ghClient, repo, target, &Release{ID: 7}, "v1.0", "demo-v1.0.tar.gz"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uploaded != "archive" {
+		t.Errorf("expected the archive to be uploaded, got %q", uploaded)
+	}
+}
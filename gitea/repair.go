@@ -0,0 +1,151 @@
+package gitea
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// UpdateMirror repairs a mirror in place: it hands Gitea the GitHub token
+// and mirror interval a new mirror would get and syncs the mirror right
+// away. Everything set up on the mirror after its migration is kept.
+func (c *Client) UpdateMirror(repo *repository.Repository, target *Target, githubToken string, opts MirrorOptions) error {
+	settings := map[string]string{}
+	if githubToken != "" {
+		settings["auth_token"] = githubToken
+	}
+	if opts.MirrorInterval != "" {
+		settings["mirror_interval"] = opts.MirrorInterval
+	}
+	if len(settings) > 0 {
+		path := fmt.Sprintf("/api/v1/repos/%s/%s", target.Name, repo.GiteaName())
+		_, statusCode, err := c.doRequest("PATCH", path, settings)
+		if err != nil {
+			return err
+		}
+		if statusCode != http.StatusOK {
+			return fmt.Errorf("failed to update mirror %s/%s: status %d", target.Name, repo.GiteaName(), statusCode)
+		}
+	}
+	return c.SyncMirror(repo, target, false)
+}
+
+// RemigrateMirror replaces a broken mirror with a fresh migration, for
+// mirrors UpdateMirror didn't repair. The new mirror is migrated under a
+// temporary name, the broken one is moved aside and only deleted once the
+// new one took its name. On failure the broken mirror is restored and the
+// replacement deleted. The caller sets the new mirror up like any other.
+func (c *Client) RemigrateMirror(repo *repository.Repository, target *Target, githubToken string, opts MirrorOptions) error {
+	name := repo.GiteaName()
+	replacement := *repo
+	replacement.MirrorName = name + "-repair"
+	broken := name + "-broken"
+
+	if err := c.MirrorRepository(&replacement, target, githubToken, opts); err != nil {
+		c.discardRepository(target, replacement.MirrorName)
+		return fmt.Errorf("failed to migrate replacement: %w", err)
+	}
+	if err := c.renameRepository(target.Name, name, broken); err != nil {
+		c.discardRepository(target, replacement.MirrorName)
+		return err
+	}
+	if err := c.renameRepository(target.Name, replacement.MirrorName, name); err != nil {
+		if restoreErr := c.renameRepository(target.Name, broken, name); restoreErr != nil {
+			log.Printf("Warning: Failed to restore broken mirror %s/%s from %s: %v", target.Name, name, broken, restoreErr)
+		}
+		c.discardRepository(target, replacement.MirrorName)
+		return err
+	}
+	c.discardRepository(target, broken)
+	c.indexMu.Lock()
+	if names, ok := c.repoIndex[strings.ToLower(target.Name)]; ok {
+		delete(names, strings.ToLower(replacement.MirrorName))
+	}
+	c.indexMu.Unlock()
+
+	log.Printf("Replaced broken mirror %s/%s with a new migration", target.Name, name)
+	return nil
+}
+
+// discardRepository deletes a leftover of RemigrateMirror, which may not
+// exist if the migration failed before creating it.
+func (c *Client) discardRepository(target *Target, name string) {
+	_, statusCode, err := c.doRequest("DELETE", fmt.Sprintf("/api/v1/repos/%s/%s", target.Name, name), nil)
+	if err != nil || (statusCode != http.StatusNoContent && statusCode != http.StatusNotFound) {
+		log.Printf("Warning: Failed to delete %s/%s, delete it by hand: status %d, %v", target.Name, name, statusCode, err)
+	}
+
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+	if names, ok := c.repoIndex[strings.ToLower(target.Name)]; ok {
+		delete(names, strings.ToLower(name))
+	}
+}
+
+// DeleteRepository deletes the repository name of the target.
+func (c *Client) DeleteRepository(target *Target, name string) error {
+	if err := c.deleteRepository(target.Name, name); err != nil {
+		return err
+	}
+
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+	if names, ok := c.repoIndex[strings.ToLower(target.Name)]; ok {
+		delete(names, strings.ToLower(name))
+	}
+	return nil
+}
+
+// RenameRepository renames the repository name of the target to newName.
+func (c *Client) RenameRepository(target *Target, name, newName string) error {
+	if err := c.renameRepository(target.Name, name, newName); err != nil {
+		return err
+	}
+
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+	if names, ok := c.repoIndex[strings.ToLower(target.Name)]; ok {
+		delete(names, strings.ToLower(name))
+		names[strings.ToLower(newName)] = true
+	}
+	return nil
+}
+
+// SetRepositoryPrivate changes the visibility of the repository target/name.
+func (c *Client) SetRepositoryPrivate(target *Target, name string, private bool) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s", target.Name, name)
+	_, statusCode, err := c.doRequest("PATCH", path, map[string]bool{"private": private})
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("failed to change the visibility of %s/%s: status %d", target.Name, name, statusCode)
+	}
+	return nil
+}
+
+func (c *Client) deleteRepository(owner, name string) error {
+	_, statusCode, err := c.doRequest("DELETE", fmt.Sprintf("/api/v1/repos/%s/%s", owner, name), nil)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to delete repository %s/%s: status %d", owner, name, statusCode)
+	}
+	return nil
+}
+
+func (c *Client) renameRepository(owner, name, newName string) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s", owner, name)
+	_, statusCode, err := c.doRequest("PATCH", path, map[string]string{"name": newName})
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("failed to rename repository %s/%s to %s: status %d", owner, name, newName, statusCode)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// BranchProtection is the Gitea counterpart of the rulesets of a GitHub
+// repository for one branch pattern.
+type BranchProtection struct {
+	RuleName             string   `json:"rule_name"`
+	EnablePush           bool     `json:"enable_push"`
+	RequireSignedCommits bool     `json:"require_signed_commits"`
+	RequiredApprovals    int      `json:"required_approvals"`
+	DismissStaleApproval bool     `json:"dismiss_stale_approvals"`
+	EnableStatusCheck    bool     `json:"enable_status_check"`
+	StatusCheckContexts  []string `json:"status_check_contexts"`
+	BlockOnOutdated      bool     `json:"block_on_outdated_branch"`
+}
+
+// Protections are the Gitea equivalents of the active rulesets of a GitHub
+// repository.
+type Protections struct {
+	Branches []BranchProtection
+	// Tags are the name patterns of protected tags
+	Tags []string
+	// LinearHistory disables merge commits on the whole repository, Gitea
+	// can't require it per branch
+	LinearHistory bool
+}
+
+// MirrorRulesets translates the active rulesets of the GitHub repository to
+// branch and tag protections on the mirror. Protections already on the
+// mirror are updated, others are left alone.
+func (c *Client) MirrorRulesets(ctx context.Context, ghClient *github.Client, repo *repository.Repository, target *Target, dryRun bool) error {
+	rulesets, err := fetchGitHubRulesets(ctx, ghClient, repo)
+	if err != nil {
+		return err
+	}
+	protections := translateRulesets(rulesets, repo.DefaultBranch)
+	if len(protections.Branches) == 0 && len(protections.Tags) == 0 && !protections.LinearHistory {
+		return nil
+	}
+
+	if dryRun {
+		log.Printf("DRY RUN: Would protect %d branch and %d tag patterns of %s/%s", len(protections.Branches), len(protections.Tags), target.Name, repo.GiteaName())
+		return nil
+	}
+
+	if len(protections.Branches) > 0 {
+		if err := c.applyBranchProtections(repo, target, protections.Branches); err != nil {
+			return err
+		}
+	}
+	if len(protections.Tags) > 0 {
+		if err := c.applyTagProtections(repo, target, protections.Tags); err != nil {
+			return err
+		}
+	}
+	if protections.LinearHistory {
+		path := fmt.Sprintf("/api/v1/repos/%s/%s", target.Name, repo.GiteaName())
+		_, statusCode, err := c.doRequest("PATCH", path, map[string]bool{"allow_merge_commits": false})
+		if err != nil {
+			return err
+		}
+		if statusCode != http.StatusOK {
+			return fmt.Errorf("failed to disable merge commits: status %d", statusCode)
+		}
+	}
+
+	log.Printf("Mirrored rulesets of %s as %d branch and %d tag protections", repo.Name, len(protections.Branches), len(protections.Tags))
+	return nil
+}
+
+func fetchGitHubRulesets(ctx context.Context, ghClient *github.Client, repo *repository.Repository) ([]*github.Ruleset, error) {
+	summaries, _, err := ghClient.Repositories.GetAllRulesets(ctx, repo.Owner, repo.Name, true)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching rulesets for %s/%s: %w", repo.Owner, repo.Name, err)
+	}
+
+	// The list leaves out the conditions and rules
+	var rulesets []*github.Ruleset
+	for _, summary := range summaries {
+		if summary.Enforcement != "active" {
+			continue
+		}
+		ruleset, _, err := ghClient.Repositories.GetRuleset(ctx, repo.Owner, repo.Name, summary.GetID(), true)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching ruleset %q of %s/%s: %w", summary.Name, repo.Owner, repo.Name, err)
+		}
+		rulesets = append(rulesets, ruleset)
+	}
+	return rulesets, nil
+}
+
+// translateRulesets maps the active rulesets to their closest Gitea
+// equivalents. Rulesets on the same pattern are merged, rules without an
+// equivalent and excluded refs are dropped with a message.
+func translateRulesets(rulesets []*github.Ruleset, defaultBranch string) Protections {
+	var protections Protections
+	branches := make(map[string]*BranchProtection)
+	for _, ruleset := range rulesets {
+		if ruleset.Enforcement != "active" {
+			continue
+		}
+		target := "branch"
+		if ruleset.Target != nil {
+			target = *ruleset.Target
+		}
+		var include []string
+		if ruleset.Conditions != nil && ruleset.Conditions.RefName != nil {
+			include = ruleset.Conditions.RefName.Include
+			if len(ruleset.Conditions.RefName.Exclude) > 0 {
+				log.Printf("Gitea can't exclude refs from protections, ignoring the exclusions %v of ruleset %q", ruleset.Conditions.RefName.Exclude, ruleset.Name)
+			}
+		}
+
+		switch target {
+		case "branch":
+			for _, pattern := range include {
+				name := refPattern(pattern, "refs/heads/", defaultBranch)
+				protection, ok := branches[name]
+				if !ok {
+					protection = &BranchProtection{RuleName: name, EnablePush: true}
+					branches[name] = protection
+				}
+				for _, rule := range ruleset.Rules {
+					if rule.Type == "required_linear_history" {
+						protections.LinearHistory = true
+						continue
+					}
+					if !applyRule(protection, rule) {
+						log.Printf("Gitea has no equivalent of the %s rule of ruleset %q", rule.Type, ruleset.Name)
+					}
+				}
+			}
+		case "tag":
+			// Protected tags can only be created, moved and deleted by
+			// whitelisted users, which covers all of GitHub's tag rules
+			if !slices.ContainsFunc(ruleset.Rules, func(rule *github.RepositoryRule) bool {
+				return rule.Type == "creation" || rule.Type == "update" || rule.Type == "deletion"
+			}) {
+				continue
+			}
+			for _, pattern := range include {
+				if name := refPattern(pattern, "refs/tags/", ""); !slices.Contains(protections.Tags, name) {
+					protections.Tags = append(protections.Tags, name)
+				}
+			}
+		default:
+			log.Printf("Gitea has no equivalent of ruleset %q on %ss", ruleset.Name, target)
+		}
+	}
+
+	for _, protection := range branches {
+		protections.Branches = append(protections.Branches, *protection)
+	}
+	slices.SortFunc(protections.Branches, func(a, b BranchProtection) int {
+		return strings.Compare(a.RuleName, b.RuleName)
+	})
+	return protections
+}
+
+// refPattern converts a ref pattern of a ruleset to a Gitea protection
+// pattern, which matches names without the prefix.
+func refPattern(pattern, prefix, defaultBranch string) string {
+	switch pattern {
+	case "~ALL":
+		return "*"
+	case "~DEFAULT_BRANCH":
+		if defaultBranch != "" {
+			return defaultBranch
+		}
+		return "main"
+	}
+	return strings.TrimPrefix(pattern, prefix)
+}
+
+// applyRule tightens the protection by a rule of a branch ruleset. It
+// reports whether Gitea has an equivalent of the rule. Protected branches
+// can't be deleted or force pushed on Gitea, so those rules always apply.
+func applyRule(protection *BranchProtection, rule *github.RepositoryRule) bool {
+	switch rule.Type {
+	case "deletion", "non_fast_forward":
+	case "update":
+		protection.EnablePush = false
+	case "required_signatures":
+		protection.RequireSignedCommits = true
+	case "pull_request":
+		protection.EnablePush = false
+		var params github.PullRequestRuleParameters
+		if rule.Parameters != nil && json.Unmarshal(*rule.Parameters, &params) == nil {
+			protection.RequiredApprovals = max(protection.RequiredApprovals, params.RequiredApprovingReviewCount)
+			protection.DismissStaleApproval = protection.DismissStaleApproval || params.DismissStaleReviewsOnPush
+		}
+	case "required_status_checks":
+		protection.EnableStatusCheck = true
+		var params github.RequiredStatusChecksRuleParameters
+		if rule.Parameters != nil && json.Unmarshal(*rule.Parameters, &params) == nil {
+			for _, check := range params.RequiredStatusChecks {
+				if !slices.Contains(protection.StatusCheckContexts, check.Context) {
+					protection.StatusCheckContexts = append(protection.StatusCheckContexts, check.Context)
+				}
+			}
+			protection.BlockOnOutdated = protection.BlockOnOutdated || params.StrictRequiredStatusChecksPolicy
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (c *Client) applyBranchProtections(repo *repository.Repository, target *Target, protections []BranchProtection) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/branch_protections", target.Name, repo.GiteaName())
+	respBody, statusCode, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("failed to list branch protections: status %d", statusCode)
+	}
+	var existing []struct {
+		RuleName string `json:"rule_name"`
+	}
+	if err := json.Unmarshal(respBody, &existing); err != nil {
+		return err
+	}
+	protected := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		protected[e.RuleName] = true
+	}
+
+	for _, protection := range protections {
+		method, protectionPath, want := "POST", path, http.StatusCreated
+		if protected[protection.RuleName] {
+			method, protectionPath, want = "PATCH", path+"/"+url.PathEscape(protection.RuleName), http.StatusOK
+		}
+		_, statusCode, err := c.doRequest(method, protectionPath, protection)
+		if err != nil {
+			return err
+		}
+		if statusCode != want {
+			log.Printf("Error protecting branches %s of %s: status %d", protection.RuleName, repo.GiteaName(), statusCode)
+		}
+	}
+	return nil
+}
+
+func (c *Client) applyTagProtections(repo *repository.Repository, target *Target, patterns []string) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/tag_protections", target.Name, repo.GiteaName())
+	respBody, statusCode, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	if statusCode == http.StatusNotFound {
+		log.Printf("Warning: %s doesn't support tag protections, leaving the tags of %s unprotected", c.flavor(), repo.GiteaName())
+		return nil
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("failed to list tag protections: status %d", statusCode)
+	}
+	var existing []struct {
+		NamePattern string `json:"name_pattern"`
+	}
+	if err := json.Unmarshal(respBody, &existing); err != nil {
+		return err
+	}
+	protected := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		protected[e.NamePattern] = true
+	}
+
+	for _, pattern := range patterns {
+		if protected[pattern] {
+			continue
+		}
+		_, statusCode, err := c.doRequest("POST", path, map[string]string{"name_pattern": pattern})
+		if err != nil {
+			return err
+		}
+		if statusCode != http.StatusCreated {
+			log.Printf("Error protecting tags %s of %s: status %d", pattern, repo.GiteaName(), statusCode)
+		}
+	}
+	return nil
+}
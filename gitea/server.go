@@ -0,0 +1,123 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Flavor is the server software behind the Gitea API.
+type Flavor string
+
+const (
+	FlavorGitea   Flavor = "Gitea"
+	FlavorForgejo Flavor = "Forgejo"
+	FlavorGogs    Flavor = "Gogs"
+)
+
+// Server describes the instance the client talks to.
+type Server struct {
+	Flavor  Flavor
+	Version string
+}
+
+func (s *Server) String() string {
+	if s.Version == "" {
+		return string(s.Flavor)
+	}
+	return fmt.Sprintf("%s %s", s.Flavor, s.Version)
+}
+
+// DetectServer identifies the server from its version endpoints and adapts
+// the requests of the client to it. Forgejo answers on its own version
+// endpoint and Gogs has none at all. Without detection the client assumes a
+// current Gitea.
+func (c *Client) DetectServer() (*Server, error) {
+	body, statusCode, err := c.doRequest("GET", "/api/v1/version", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &Server{Flavor: FlavorGitea}
+	switch statusCode {
+	case http.StatusOK:
+		var version struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(body, &version); err != nil {
+			return nil, fmt.Errorf("failed to parse server version: %w", err)
+		}
+		server.Version = version.Version
+		if _, statusCode, err := c.doRequest("GET", "/api/forgejo/v1/version", nil); err == nil && statusCode == http.StatusOK {
+			server.Flavor = FlavorForgejo
+		}
+	case http.StatusNotFound:
+		server.Flavor = FlavorGogs
+	default:
+		return nil, fmt.Errorf("failed to get server version: status %d", statusCode)
+	}
+
+	c.server = server
+	return server, nil
+}
+
+func (c *Client) flavor() Flavor {
+	if c.server == nil {
+		return FlavorGitea
+	}
+	return c.server.Flavor
+}
+
+// adaptMigrateRequest drops or rewrites the fields of a migrate request the
+// server doesn't understand. Gogs only takes basic auth and neither mirror
+// intervals, LFS nor migrators, and Gitea added LFS migrations in 1.15.
+func (c *Client) adaptMigrateRequest(req *MigrateRepoRequest) {
+	switch {
+	case c.flavor() == FlavorGogs:
+		if req.AuthToken != "" {
+			req.AuthUsername, req.AuthPassword, req.AuthToken = "x-access-token", req.AuthToken, ""
+		}
+		if req.Service != "" || req.LFS || req.MirrorInterval != "" {
+			log.Printf("Warning: Gogs doesn't support mirror intervals, LFS or native migrations, mirroring %s without them", req.RepoName)
+		}
+		req.MirrorInterval, req.LFS, req.LFSEndpoint, req.Service = "", false, "", ""
+		req.Issues, req.Labels, req.Milestones, req.Releases, req.PullRequests, req.Wiki = false, false, false, false, false, false
+	case c.flavor() == FlavorGitea && c.server != nil && !versionAtLeast(c.server.Version, 1, 15):
+		if req.LFS {
+			log.Printf("Warning: %s doesn't support LFS migrations, mirroring %s without LFS objects", c.server, req.RepoName)
+		}
+		req.LFS, req.LFSEndpoint = false, ""
+	}
+}
+
+// organizationRequest adapts a create organization request and returns the
+// endpoint to send it to. Gogs creates organizations below the user and has
+// no organization visibility.
+func (c *Client) organizationRequest(createReq map[string]interface{}) string {
+	if c.flavor() == FlavorGogs {
+		delete(createReq, "visibility")
+		return "/api/v1/user/orgs"
+	}
+	return "/api/v1/orgs"
+}
+
+// versionAtLeast reports whether a version like 1.21.4 or 1.22.0+dev-12 is
+// at least major.minor. Unparsable versions are assumed to be current.
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return true
+	}
+	gotMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return true
+	}
+	gotMinor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return true
+	}
+	return gotMajor > major || gotMajor == major && gotMinor >= minor
+}
@@ -0,0 +1,248 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/provider"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func init() {
+	provider.RegisterSource("gitea", newSource)
+}
+
+// SourceOptions selects the repositories read from a Gitea or Forgejo
+// instance mirrored from, like the GitHub fetch options.
+type SourceOptions struct {
+	Username             string
+	PrivateRepositories  bool
+	SkipForks            bool
+	MirrorStarred        bool
+	MirrorOrganizations  bool
+	IncludeOrgs          []string
+	ExcludeOrgs          []string
+	PreserveOrgStructure bool
+}
+
+// Source reads the repositories of a Gitea or Forgejo instance, such as
+// Codeberg, to mirror them to another one.
+type Source struct {
+	client *Client
+	opts   SourceOptions
+}
+
+// NewSource returns the source of the repositories selected by opts.
+func NewSource(client *Client, opts SourceOptions) *Source {
+	return &Source{client: client, opts: opts}
+}
+
+// newSource creates the source at SOURCE_URL with the GitHub settings, which
+// select the user and token on the source instance.
+func newSource(cfg *config.Config) (provider.Source, error) {
+	client, err := NewClient(&config.GiteaConfig{
+		URL:            cfg.Source.URL,
+		Token:          cfg.GitHub.Token,
+		Proxy:          cfg.GitHub.Proxy,
+		TimeoutSeconds: cfg.Gitea.TimeoutSeconds,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source Gitea client: %w", err)
+	}
+	return NewSource(client, SourceOptions{
+		Username:             cfg.GitHub.Username,
+		PrivateRepositories:  cfg.GitHub.PrivateRepositories,
+		SkipForks:            cfg.GitHub.SkipForks,
+		MirrorStarred:        cfg.GitHub.MirrorStarred,
+		MirrorOrganizations:  cfg.GitHub.MirrorOrganizations,
+		IncludeOrgs:          cfg.GitHub.IncludeOrgs,
+		ExcludeOrgs:          cfg.GitHub.ExcludeOrgs,
+		PreserveOrgStructure: cfg.GitHub.PreserveOrgStructure,
+	}), nil
+}
+
+// ListRepositories implements provider.Source.
+func (s *Source) ListRepositories(ctx context.Context) ([]*repository.Repository, error) {
+	return s.client.SourceRepositories(s.opts)
+}
+
+type sourceRepository struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	Owner    struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	CloneURL      string `json:"clone_url"`
+	HTMLURL       string `json:"html_url"`
+	DefaultBranch string `json:"default_branch"`
+	Private       bool   `json:"private"`
+	Fork          bool   `json:"fork"`
+	Parent        *struct {
+		FullName string `json:"full_name"`
+	} `json:"parent"`
+	HasIssues bool      `json:"has_issues"`
+	Topics    []string  `json:"topics"`
+	Language  string    `json:"language"`
+	Size      int       `json:"size"`
+	Stars     int       `json:"stars_count"`
+	Forks     int       `json:"forks_count"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SourceRepositories lists the repositories of the user on this instance
+// for mirroring them to another one. Private repositories are those the
+// token's user owns, so the user has to be the one authenticated.
+func (c *Client) SourceRepositories(opts SourceOptions) ([]*repository.Repository, error) {
+	path := fmt.Sprintf("/api/v1/users/%s/repos", opts.Username)
+	if opts.PrivateRepositories {
+		path = "/api/v1/user/repos"
+	}
+	owned, err := c.listSourceRepositories(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch repositories: %w", err)
+	}
+
+	var repositories []*repository.Repository
+	for _, repo := range owned {
+		// The authenticated listing includes repositories of organizations
+		if strings.EqualFold(repo.Owner, opts.Username) {
+			repositories = append(repositories, repo)
+		}
+	}
+
+	if opts.MirrorStarred {
+		starred, err := c.listSourceRepositories(fmt.Sprintf("/api/v1/users/%s/starred", opts.Username))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch starred repositories: %w", err)
+		}
+		for _, repo := range starred {
+			repo.Starred = true
+		}
+		repositories = append(repositories, starred...)
+	}
+
+	if opts.MirrorOrganizations {
+		orgs, err := c.listSourceOrganizations(opts.Username)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch organizations: %w", err)
+		}
+		for _, org := range orgs {
+			if len(opts.IncludeOrgs) > 0 && !slices.Contains(opts.IncludeOrgs, org) || slices.Contains(opts.ExcludeOrgs, org) {
+				continue
+			}
+			log.Printf("Fetching repositories for organization: %s", org)
+			orgRepos, err := c.listSourceRepositories(fmt.Sprintf("/api/v1/orgs/%s/repos", org))
+			if err != nil {
+				log.Printf("Error fetching repositories for org %s: %v", org, err)
+				continue
+			}
+			if opts.PreserveOrgStructure {
+				for _, repo := range orgRepos {
+					repo.Organization = org
+				}
+			}
+			repositories = append(repositories, orgRepos...)
+		}
+	}
+
+	// Starred repositories may also be owned ones
+	seen := make(map[string]bool)
+	var result []*repository.Repository
+	for _, repo := range repositories {
+		if seen[repo.URL] || opts.SkipForks && repo.Fork {
+			continue
+		}
+		seen[repo.URL] = true
+		result = append(result, repo)
+	}
+	return result, nil
+}
+
+func (c *Client) listSourceRepositories(path string) ([]*repository.Repository, error) {
+	var all []*repository.Repository
+	for page := 1; ; page++ {
+		respBody, statusCode, err := c.doRequest("GET", fmt.Sprintf("%s?page=%d&limit=%d", path, page, listPageSize), nil)
+		if err != nil {
+			return nil, err
+		}
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to list %s: status %d", path, statusCode)
+		}
+
+		var repos []sourceRepository
+		if err := json.Unmarshal(respBody, &repos); err != nil {
+			return nil, err
+		}
+		for _, repo := range repos {
+			all = append(all, repo.toRepository())
+		}
+		if len(repos) < listPageSize {
+			return all, nil
+		}
+	}
+}
+
+func (c *Client) listSourceOrganizations(username string) ([]string, error) {
+	var all []string
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/api/v1/users/%s/orgs?page=%d&limit=%d", username, page, listPageSize)
+		respBody, statusCode, err := c.doRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to list organizations of %s: status %d", username, statusCode)
+		}
+
+		var orgs []Organization
+		if err := json.Unmarshal(respBody, &orgs); err != nil {
+			return nil, err
+		}
+		for _, org := range orgs {
+			all = append(all, org.Username)
+		}
+		if len(orgs) < listPageSize {
+			return all, nil
+		}
+	}
+}
+
+func (r sourceRepository) toRepository() *repository.Repository {
+	repo := &repository.Repository{
+		ID:            strconv.FormatInt(r.ID, 10),
+		Name:          r.Name,
+		Owner:         r.Owner.Login,
+		FullName:      r.FullName,
+		URL:           r.CloneURL,
+		DefaultBranch: r.DefaultBranch,
+		Private:       r.Private,
+		Fork:          r.Fork,
+		HasIssues:     r.HasIssues,
+		Topics:        r.Topics,
+		Stats: repository.Stats{
+			Language: r.Language,
+			Size:     r.Size,
+			Stars:    r.Stars,
+			Forks:    r.Forks,
+			// Gitea doesn't tell when a repository was pushed to last
+			PushedAt: r.UpdatedAt,
+		},
+		Provenance: repository.Provenance{
+			Provider: "gitea",
+			HTMLURL:  r.HTMLURL,
+		},
+	}
+	if r.Parent != nil {
+		repo.Provenance.Parent = r.Parent.FullName
+	}
+	return repo
+}
@@ -0,0 +1,137 @@
+package gitea
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const listPageSize = 50
+
+// StarBatch collects the repositories to star during a run and stars them in
+// one paced pass at the end, skipping repositories that are already starred.
+type StarBatch struct {
+	client   *Client
+	interval time.Duration
+	dryRun   bool
+	pending  []string
+	queued   map[string]bool
+}
+
+type starredRepository struct {
+	FullName string `json:"full_name"`
+}
+
+func (c *Client) NewStarBatch(interval time.Duration, dryRun bool) *StarBatch {
+	return &StarBatch{
+		client:   c,
+		interval: interval,
+		dryRun:   dryRun,
+		queued:   make(map[string]bool),
+	}
+}
+
+// Add queues a repository of the target to be starred.
+func (b *StarBatch) Add(target *Target, repoName string) {
+	fullName := target.Name + "/" + repoName
+	if b.queued[strings.ToLower(fullName)] {
+		return
+	}
+	b.queued[strings.ToLower(fullName)] = true
+	b.pending = append(b.pending, fullName)
+}
+
+// Flush stars all queued repositories that aren't starred yet. It returns
+// the errors of the repositories it failed to star.
+func (b *StarBatch) Flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+
+	starred, err := b.client.listStarred()
+	if err != nil {
+		return err
+	}
+
+	interval := b.interval
+	starredCount, skipped := 0, 0
+	var errs []error
+	for _, fullName := range b.pending {
+		if starred[strings.ToLower(fullName)] {
+			skipped++
+			continue
+		}
+
+		if b.dryRun {
+			log.Printf("DRY RUN: Would star repository in Gitea: %s", fullName)
+			continue
+		}
+
+		if starredCount > 0 && interval > 0 {
+			time.Sleep(interval)
+		}
+
+		statusCode, err := b.client.star(fullName)
+		if err != nil || statusCode != http.StatusNoContent {
+			if err == nil {
+				err = fmt.Errorf("status %d", statusCode)
+			}
+			errs = append(errs, fmt.Errorf("failed to star %s: %w", fullName, err))
+			// Slow down if Gitea is still pushing back after the retries
+			if statusCode == http.StatusTooManyRequests {
+				interval *= 2
+				if interval == 0 {
+					interval = time.Second
+				}
+			}
+			continue
+		}
+
+		starredCount++
+		log.Printf("Successfully starred repository in Gitea: %s", fullName)
+	}
+
+	log.Printf("Starring completed: %d starred, %d already starred, %d failed", starredCount, skipped, len(errs))
+	b.pending = nil
+	return errors.Join(errs...)
+}
+
+func (c *Client) listStarred() (map[string]bool, error) {
+	starred := make(map[string]bool)
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/api/v1/user/starred?page=%d&limit=%d", page, listPageSize)
+		respBody, statusCode, headers, err := c.doRequestWithHeaders("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to list starred repositories: status %d", statusCode)
+		}
+
+		var repos []starredRepository
+		if err := json.Unmarshal(respBody, &repos); err != nil {
+			return nil, err
+		}
+
+		for _, repo := range repos {
+			starred[strings.ToLower(repo.FullName)] = true
+		}
+
+		// The server may cap the page size, so prefer the total count if present
+		total, err := strconv.Atoi(headers.Get("X-Total-Count"))
+		if len(repos) == 0 || (err == nil && len(starred) >= total) || (err != nil && len(repos) < listPageSize) {
+			return starred, nil
+		}
+	}
+}
+
+func (c *Client) star(fullName string) (int, error) {
+	_, statusCode, err := c.doRequest("PUT", "/api/v1/user/starred/"+fullName, nil)
+	return statusCode, err
+}
@@ -0,0 +1,51 @@
+package gitea
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+)
+
+func TestStarBatchFlush(t *testing.T) {
+	var starred []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v1/user/starred":
+			w.Header().Set("X-Total-Count", "1")
+			w.Write([]byte(`[{"full_name":"me/Done"}]`))
+		case r.Method == "PUT" && r.URL.Path == "/api/v1/user/starred/me/denied":
+			w.WriteHeader(http.StatusForbidden)
+		case r.Method == "PUT":
+			starred = append(starred, strings.TrimPrefix(r.URL.Path, "/api/v1/user/starred/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := &Target{Name: "me", Type: "user"}
+	batch := client.NewStarBatch(0, false)
+	for _, name := range []string{"new", "done", "denied", "NEW"} {
+		batch.Add(target, name)
+	}
+
+	err = batch.Flush()
+	if err == nil || !strings.Contains(err.Error(), "me/denied: status 403") {
+		t.Errorf("expected the failed repository to be reported, got %v", err)
+	}
+	if len(starred) != 1 || starred[0] != "me/new" {
+		t.Errorf("expected only the new repository to be starred once, got %v", starred)
+	}
+	if err := batch.Flush(); err != nil {
+		t.Errorf("expected an empty batch to succeed, got %v", err)
+	}
+}
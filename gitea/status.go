@@ -0,0 +1,42 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// MirrorStatus is the sync state Gitea reports for a mirror.
+type MirrorStatus struct {
+	Mirror         bool      `json:"mirror"`
+	Empty          bool      `json:"empty"`
+	MirrorInterval string    `json:"mirror_interval"`
+	MirrorUpdated  time.Time `json:"mirror_updated"`
+	Created        time.Time `json:"created_at"`
+	Archived       bool      `json:"archived"`
+	Topics         []string  `json:"topics"`
+}
+
+// GetMirrorStatus returns the status of the repository owner/name, or nil if
+// it doesn't exist.
+func (c *Client) GetMirrorStatus(owner, name string) (*MirrorStatus, error) {
+	respBody, statusCode, err := c.doRequest("GET", fmt.Sprintf("/api/v1/repos/%s/%s", owner, name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to get repository %s/%s: status %d", owner, name, statusCode)
+	}
+
+	var status MirrorStatus
+	if err := json.Unmarshal(respBody, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
@@ -0,0 +1,337 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// teamUnits are the repository units a mirrored team gets access to.
+var teamUnits = []string{"repo.code", "repo.issues", "repo.pulls", "repo.releases", "repo.wiki"}
+
+// AccessOptions controls how teams and collaborators are replicated.
+type AccessOptions struct {
+	// UserMap maps GitHub logins to Gitea usernames, unmapped users are skipped
+	UserMap map[string]string
+	DryRun  bool
+}
+
+type Team struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type createTeamRequest struct {
+	Name                    string   `json:"name"`
+	Description             string   `json:"description"`
+	Permission              string   `json:"permission"`
+	Units                   []string `json:"units"`
+	IncludesAllRepositories bool     `json:"includes_all_repositories"`
+}
+
+// MirrorTeams replicates the teams of the GitHub organization org into the
+// Gitea organization target. repoNames maps the GitHub names of the
+// mirrored repositories of the organization to their Gitea names; team
+// repositories that aren't mirrored are ignored.
+func (c *Client) MirrorTeams(ctx context.Context, ghClient *github.Client, org string, target *Target, repoNames map[string]string, opts AccessOptions) error {
+	githubTeams, err := fetchGitHubTeams(ctx, ghClient, org)
+	if err != nil {
+		return err
+	}
+
+	giteaTeams, err := c.listTeams(target.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, githubTeam := range githubTeams {
+		name := githubTeam.GetSlug()
+		if opts.DryRun {
+			log.Printf("DRY RUN: Would mirror team %s of organization %s", name, target.Name)
+			continue
+		}
+
+		team, ok := giteaTeams[name]
+		if !ok {
+			team, err = c.createTeam(target.Name, githubTeam)
+			if err != nil {
+				log.Printf("Error creating team %s in organization %s: %v", name, target.Name, err)
+				continue
+			}
+			log.Printf("Created team %s in organization %s", name, target.Name)
+		}
+
+		members, err := fetchGitHubTeamMembers(ctx, ghClient, org, name)
+		if err != nil {
+			log.Printf("Error fetching members of team %s: %v", name, err)
+		} else {
+			c.syncTeamMembers(team, members, opts.UserMap)
+		}
+
+		repos, err := fetchGitHubTeamRepositories(ctx, ghClient, org, name)
+		if err != nil {
+			log.Printf("Error fetching repositories of team %s: %v", name, err)
+		}
+		for _, repo := range repos {
+			giteaName, ok := repoNames[repo.GetName()]
+			if !ok {
+				continue
+			}
+			path := fmt.Sprintf("/api/v1/teams/%d/repos/%s/%s", team.ID, target.Name, giteaName)
+			if _, statusCode, err := c.doRequest("PUT", path, nil); err != nil || statusCode != http.StatusNoContent {
+				log.Printf("Error adding repository %s to team %s: status %d, %v", giteaName, name, statusCode, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// syncTeamMembers adds the mapped GitHub members to the Gitea team and
+// removes the mapped users that left the GitHub team. Gitea users not in the
+// user map were added by hand and stay.
+func (c *Client) syncTeamMembers(team *Team, members []*github.User, userMap map[string]string) {
+	wanted := make(map[string]bool)
+	for _, member := range members {
+		giteaUser, ok := lookupUser(userMap, member.GetLogin())
+		if !ok {
+			log.Printf("Skipping member %s of team %s: not in user map", member.GetLogin(), team.Name)
+			continue
+		}
+		wanted[strings.ToLower(giteaUser)] = true
+		path := fmt.Sprintf("/api/v1/teams/%d/members/%s", team.ID, url.PathEscape(giteaUser))
+		if _, statusCode, err := c.doRequest("PUT", path, nil); err != nil || statusCode != http.StatusNoContent {
+			log.Printf("Error adding %s to team %s: status %d, %v", giteaUser, team.Name, statusCode, err)
+		}
+	}
+
+	mapped := make(map[string]bool, len(userMap))
+	for _, giteaUser := range userMap {
+		mapped[strings.ToLower(giteaUser)] = true
+	}
+	current, err := c.listTeamMembers(team.ID)
+	if err != nil {
+		log.Printf("Error listing members of team %s: %v", team.Name, err)
+		return
+	}
+	for _, login := range current {
+		if !mapped[strings.ToLower(login)] || wanted[strings.ToLower(login)] {
+			continue
+		}
+		path := fmt.Sprintf("/api/v1/teams/%d/members/%s", team.ID, url.PathEscape(login))
+		if _, statusCode, err := c.doRequest("DELETE", path, nil); err != nil || statusCode != http.StatusNoContent {
+			log.Printf("Error removing %s from team %s: status %d, %v", login, team.Name, statusCode, err)
+			continue
+		}
+		log.Printf("Removed %s from team %s", login, team.Name)
+	}
+}
+
+func (c *Client) listTeamMembers(teamID int64) ([]string, error) {
+	var logins []string
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/api/v1/teams/%d/members?page=%d&limit=%d", teamID, page, listPageSize)
+		respBody, statusCode, err := c.doRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to list team members: status %d", statusCode)
+		}
+
+		var users []struct {
+			Login string `json:"login"`
+		}
+		if err := json.Unmarshal(respBody, &users); err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			logins = append(logins, user.Login)
+		}
+
+		if len(users) < listPageSize {
+			return logins, nil
+		}
+	}
+}
+
+// MirrorCollaborators grants the direct collaborators of the GitHub repository
+// the same access to the mirror.
+func (c *Client) MirrorCollaborators(ctx context.Context, ghClient *github.Client, repo *repository.Repository, target *Target, opts AccessOptions) error {
+	collaborators, err := fetchGitHubCollaborators(ctx, ghClient, repo)
+	if err != nil {
+		return err
+	}
+
+	for _, collaborator := range collaborators {
+		giteaUser, ok := lookupUser(opts.UserMap, collaborator.GetLogin())
+		if !ok {
+			continue
+		}
+
+		permission := giteaPermission(collaborator.GetRoleName())
+		if opts.DryRun {
+			log.Printf("DRY RUN: Would add %s as %s collaborator to %s/%s", giteaUser, permission, target.Name, repo.GiteaName())
+			continue
+		}
+
+		path := fmt.Sprintf("/api/v1/repos/%s/%s/collaborators/%s", target.Name, repo.GiteaName(), url.PathEscape(giteaUser))
+		if _, statusCode, err := c.doRequest("PUT", path, map[string]string{"permission": permission}); err != nil || statusCode != http.StatusNoContent {
+			log.Printf("Error adding collaborator %s to %s: status %d, %v", giteaUser, repo.GiteaName(), statusCode, err)
+		}
+	}
+
+	return nil
+}
+
+// giteaPermission translates a GitHub permission or role to a Gitea access mode.
+func giteaPermission(githubPermission string) string {
+	switch githubPermission {
+	case "admin", "maintain":
+		return "admin"
+	case "push", "write", "triage":
+		return "write"
+	default:
+		return "read"
+	}
+}
+
+func (c *Client) listTeams(org string) (map[string]*Team, error) {
+	teams := make(map[string]*Team)
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/api/v1/orgs/%s/teams?page=%d&limit=%d", org, page, listPageSize)
+		respBody, statusCode, err := c.doRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to list teams of %s: status %d", org, statusCode)
+		}
+
+		var pageTeams []*Team
+		if err := json.Unmarshal(respBody, &pageTeams); err != nil {
+			return nil, err
+		}
+
+		for _, team := range pageTeams {
+			teams[team.Name] = team
+		}
+
+		if len(pageTeams) < listPageSize {
+			return teams, nil
+		}
+	}
+}
+
+func (c *Client) createTeam(org string, githubTeam *github.Team) (*Team, error) {
+	req := createTeamRequest{
+		Name:        githubTeam.GetSlug(),
+		Description: githubTeam.GetDescription(),
+		Permission:  giteaPermission(githubTeam.GetPermission()),
+		Units:       teamUnits,
+	}
+
+	respBody, statusCode, err := c.doRequest("POST", fmt.Sprintf("/api/v1/orgs/%s/teams", org), req)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to create team: status %d", statusCode)
+	}
+
+	var team Team
+	if err := json.Unmarshal(respBody, &team); err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+func fetchGitHubTeams(ctx context.Context, ghClient *github.Client, org string) ([]*github.Team, error) {
+	opt := &github.ListOptions{PerPage: 100}
+
+	var allTeams []*github.Team
+	for {
+		teams, resp, err := ghClient.Teams.ListTeams(ctx, org, opt)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching teams for %s: %w", org, err)
+		}
+		allTeams = append(allTeams, teams...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return allTeams, nil
+}
+
+func fetchGitHubTeamMembers(ctx context.Context, ghClient *github.Client, org, slug string) ([]*github.User, error) {
+	opt := &github.TeamListTeamMembersOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var allMembers []*github.User
+	for {
+		members, resp, err := ghClient.Teams.ListTeamMembersBySlug(ctx, org, slug, opt)
+		if err != nil {
+			return nil, err
+		}
+		allMembers = append(allMembers, members...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return allMembers, nil
+}
+
+func fetchGitHubTeamRepositories(ctx context.Context, ghClient *github.Client, org, slug string) ([]*github.Repository, error) {
+	opt := &github.ListOptions{PerPage: 100}
+
+	var allRepos []*github.Repository
+	for {
+		repos, resp, err := ghClient.Teams.ListTeamReposBySlug(ctx, org, slug, opt)
+		if err != nil {
+			return nil, err
+		}
+		allRepos = append(allRepos, repos...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return allRepos, nil
+}
+
+func fetchGitHubCollaborators(ctx context.Context, ghClient *github.Client, repo *repository.Repository) ([]*github.User, error) {
+	opt := &github.ListCollaboratorsOptions{
+		Affiliation: "direct",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var allCollaborators []*github.User
+	for {
+		collaborators, resp, err := ghClient.Repositories.ListCollaborators(ctx, repo.Owner, repo.Name, opt)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching collaborators for %s/%s: %w", repo.Owner, repo.Name, err)
+		}
+		allCollaborators = append(allCollaborators, collaborators...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return allCollaborators, nil
+}
@@ -0,0 +1,94 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+)
+
+func TestGiteaPermission(t *testing.T) {
+	tests := []struct {
+		github   string
+		expected string
+	}{
+		{"admin", "admin"},
+		{"maintain", "admin"},
+		{"push", "write"},
+		{"write", "write"},
+		{"triage", "write"},
+		{"pull", "read"},
+		{"read", "read"},
+		{"", "read"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.github, func(t *testing.T) {
+			if got := giteaPermission(tt.github); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMirrorTeams(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	var created createTeamRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method + " " + r.URL.Path {
+		case "GET /orgs/acme/teams":
+			w.Write([]byte(`[{"slug":"devs","permission":"push"}]`))
+		case "GET /orgs/acme/teams/devs/members":
+			w.Write([]byte(`[{"login":"alice"},{"login":"carol"}]`))
+		case "GET /orgs/acme/teams/devs/repos":
+			w.Write([]byte(`[{"name":"api"},{"name":"unmirrored"}]`))
+		case "GET /api/v1/orgs/acme/teams":
+			w.Write([]byte(`[]`))
+		case "POST /api/v1/orgs/acme/teams":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":5,"name":"devs"}`))
+		case "GET /api/v1/teams/5/members":
+			w.Write([]byte(`[{"login":"alice-g"},{"login":"bob-g"},{"login":"manual"}]`))
+		default:
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghClient := github.NewClient(nil)
+	ghClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	opts := AccessOptions{UserMap: map[string]string{"alice": "alice-g", "bob": "bob-g"}}
+	target := &Target{Name: "acme", Type: "organization"}
+	if err := client.MirrorTeams(context.Background(), ghClient, "acme", target, map[string]string{"api": "api-mirror"}, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if created.Name != "devs" || created.Permission != "write" {
+		t.Errorf("expected the team to be created with write access, got %+v", created)
+	}
+	// Unmapped GitHub members are skipped, Gitea members added by hand stay
+	expected := []string{
+		"PUT /api/v1/teams/5/members/alice-g",
+		"DELETE /api/v1/teams/5/members/bob-g",
+		"PUT /api/v1/teams/5/repos/acme/api-mirror",
+	}
+	if !slices.Equal(requests, expected) {
+		t.Errorf("expected %v, got %v", expected, requests)
+	}
+}
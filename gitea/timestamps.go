@@ -0,0 +1,46 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// IsAdmin reports whether the token, or the user it impersonates, is a site
+// admin. Gitea only honors the updated_at of issues and comments sent by
+// admins. The answer is looked up once.
+func (c *Client) IsAdmin() bool {
+	c.adminOnce.Do(func() {
+		respBody, statusCode, err := c.doRequest("GET", "/api/v1/user", nil)
+		if err != nil || statusCode != http.StatusOK {
+			log.Printf("Warning: Failed to check whether the Gitea user is an admin: status %d, %v", statusCode, err)
+			return
+		}
+		var user struct {
+			IsAdmin bool `json:"is_admin"`
+		}
+		if err := json.Unmarshal(respBody, &user); err != nil {
+			log.Printf("Warning: Failed to check whether the Gitea user is an admin: %v", err)
+			return
+		}
+		c.admin = user.IsAdmin
+	})
+	return c.admin
+}
+
+// setIssueUpdatedAt dates the last change of an issue back to updatedAt.
+func (c *Client) setIssueUpdatedAt(repo *repository.Repository, target *Target, issueNumber int, updatedAt time.Time) error {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/issues/%d", target.Name, repo.GiteaName(), issueNumber)
+	_, statusCode, err := c.doRequest("PATCH", path, map[string]string{"updated_at": updatedAt.UTC().Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusCreated && statusCode != http.StatusOK {
+		return fmt.Errorf("status %d", statusCode)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package gitea
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// repoUnits maps the units of MIRROR_REPO_UNITS to the repository fields
+// switching them. The code can't be disabled.
+var repoUnits = map[string]string{
+	"issues":   "has_issues",
+	"wiki":     "has_wiki",
+	"pulls":    "has_pull_requests",
+	"projects": "has_projects",
+	"releases": "has_releases",
+	"packages": "has_packages",
+	"actions":  "has_actions",
+}
+
+// SetRepoUnits keeps the units of the mirror listed in keep and disables
+// all others, so the mirror doesn't invite contributions that go nowhere.
+func (c *Client) SetRepoUnits(repo *repository.Repository, target *Target, keep []string, dryRun bool) error {
+	changes := make(map[string]bool, len(repoUnits))
+	var disabled []string
+	for unit, field := range repoUnits {
+		changes[field] = slices.Contains(keep, unit)
+		if !changes[field] {
+			disabled = append(disabled, unit)
+		}
+	}
+	slices.Sort(disabled)
+
+	if dryRun {
+		log.Printf("DRY RUN: Would disable %s of %s/%s", strings.Join(disabled, ", "), target.Name, repo.GiteaName())
+		return nil
+	}
+
+	path := fmt.Sprintf("/api/v1/repos/%s/%s", target.Name, repo.GiteaName())
+	_, statusCode, err := c.doRequest("PATCH", path, changes)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("failed to set units of %s: status %d", repo.GiteaName(), statusCode)
+	}
+
+	log.Printf("Disabled %s of %s/%s", strings.Join(disabled, ", "), target.Name, repo.GiteaName())
+	return nil
+}
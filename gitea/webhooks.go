@@ -0,0 +1,221 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// githubHookEvents maps GitHub webhook events to their Gitea counterparts.
+// Events without a counterpart are dropped.
+var githubHookEvents = map[string][]string{
+	"create":                      {"create"},
+	"delete":                      {"delete"},
+	"fork":                        {"fork"},
+	"push":                        {"push"},
+	"issues":                      {"issues", "issue_assign", "issue_label", "issue_milestone"},
+	"issue_comment":               {"issue_comment"},
+	"pull_request":                {"pull_request", "pull_request_assign", "pull_request_label", "pull_request_milestone", "pull_request_sync"},
+	"pull_request_review":         {"pull_request_review_approved", "pull_request_review_rejected"},
+	"pull_request_review_comment": {"pull_request_comment"},
+	"release":                     {"release"},
+	"gollum":                      {"wiki"},
+	"repository":                  {"repository"},
+}
+
+// Webhook describes a webhook to install on a mirror.
+type Webhook struct {
+	URL         string
+	ContentType string
+	Events      []string // Gitea event names
+	Secret      string
+}
+
+// WebhookOptions controls which webhooks are installed on a mirror.
+type WebhookOptions struct {
+	// CopyFromGitHub replicates the webhooks of the GitHub repository, without their secrets
+	CopyFromGitHub bool
+	// Extra webhooks installed on every mirror
+	Extra  []Webhook
+	DryRun bool
+}
+
+type createHookRequest struct {
+	Type   string            `json:"type"`
+	Config map[string]string `json:"config"`
+	Events []string          `json:"events"`
+	Active bool              `json:"active"`
+}
+
+type hookResponse struct {
+	ID     int64             `json:"id"`
+	Config map[string]string `json:"config"`
+}
+
+// MirrorWebhooks installs the configured webhooks on the Gitea mirror. Hooks
+// whose URL is already registered on the mirror are skipped.
+func (c *Client) MirrorWebhooks(ctx context.Context, ghClient *github.Client, repo *repository.Repository, target *Target, opts WebhookOptions) error {
+	hooks := append([]Webhook{}, opts.Extra...)
+	if opts.CopyFromGitHub {
+		githubHooks, err := fetchGitHubWebhooks(ctx, ghClient, repo)
+		if err != nil {
+			return err
+		}
+		hooks = append(hooks, githubHooks...)
+	}
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	if opts.DryRun {
+		log.Printf("DRY RUN: Would install %d webhooks on %s/%s", len(hooks), target.Name, repo.GiteaName())
+		return nil
+	}
+
+	existing, err := c.listWebhookURLs(repo, target)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		if existing[hook.URL] {
+			continue
+		}
+		if err := c.createWebhook(repo, target, hook); err != nil {
+			log.Printf("Error installing webhook %s on %s: %v", hook.URL, repo.GiteaName(), err)
+			continue
+		}
+		existing[hook.URL] = true
+		log.Printf("Installed webhook %s on %s/%s", hook.URL, target.Name, repo.GiteaName())
+	}
+
+	return nil
+}
+
+func fetchGitHubWebhooks(ctx context.Context, ghClient *github.Client, repo *repository.Repository) ([]Webhook, error) {
+	opt := &github.ListOptions{PerPage: 100}
+
+	var hooks []Webhook
+	for {
+		githubHooks, resp, err := ghClient.Repositories.ListHooks(ctx, repo.Owner, repo.Name, opt)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching webhooks for %s/%s: %w", repo.Owner, repo.Name, err)
+		}
+
+		for _, githubHook := range githubHooks {
+			if !githubHook.GetActive() || githubHook.Config.GetURL() == "" {
+				continue
+			}
+
+			events := translateHookEvents(githubHook.Events)
+			if len(events) == 0 {
+				log.Printf("Skipping webhook %s of %s: none of its events %v are supported by Gitea", githubHook.Config.GetURL(), repo.Name, githubHook.Events)
+				continue
+			}
+
+			hooks = append(hooks, Webhook{
+				URL:         githubHook.Config.GetURL(),
+				ContentType: githubHook.Config.GetContentType(),
+				Events:      events,
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return hooks, nil
+}
+
+// translateHookEvents converts GitHub event names to Gitea event names,
+// sorted so the hooks of every mirror list them alike. The GitHub wildcard
+// selects every event Gitea knows about.
+func translateHookEvents(events []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	add := func(giteaEvents []string) {
+		for _, event := range giteaEvents {
+			if !seen[event] {
+				seen[event] = true
+				result = append(result, event)
+			}
+		}
+	}
+
+	for _, event := range events {
+		if event == "*" {
+			for _, giteaEvents := range githubHookEvents {
+				add(giteaEvents)
+			}
+			continue
+		}
+		add(githubHookEvents[event])
+	}
+
+	slices.Sort(result)
+	return result
+}
+
+func (c *Client) listWebhookURLs(repo *repository.Repository, target *Target) (map[string]bool, error) {
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/hooks", target.Name, repo.GiteaName())
+	respBody, statusCode, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list webhooks: status %d", statusCode)
+	}
+
+	var hooks []hookResponse
+	if err := json.Unmarshal(respBody, &hooks); err != nil {
+		return nil, err
+	}
+
+	urls := make(map[string]bool)
+	for _, hook := range hooks {
+		urls[hook.Config["url"]] = true
+	}
+	return urls, nil
+}
+
+func (c *Client) createWebhook(repo *repository.Repository, target *Target, hook Webhook) error {
+	contentType := hook.ContentType
+	if contentType == "" {
+		contentType = "json"
+	}
+
+	req := createHookRequest{
+		Type: "gitea",
+		Config: map[string]string{
+			"url":          hook.URL,
+			"content_type": contentType,
+		},
+		Events: hook.Events,
+		Active: true,
+	}
+	if hook.Secret != "" {
+		req.Config["secret"] = hook.Secret
+	}
+
+	path := fmt.Sprintf("/api/v1/repos/%s/%s/hooks", target.Name, repo.GiteaName())
+	_, statusCode, err := c.doRequest("POST", path, req)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("failed to create webhook: status %d", statusCode)
+	}
+
+	return nil
+}
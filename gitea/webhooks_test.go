@@ -0,0 +1,40 @@
+package gitea
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTranslateHookEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   []string
+		expected []string
+	}{
+		{"single event", []string{"push"}, []string{"push"}},
+		{"sorted", []string{"release", "create"}, []string{"create", "release"}},
+		{"expanded", []string{"pull_request_review"}, []string{"pull_request_review_approved", "pull_request_review_rejected"}},
+		{"without counterpart", []string{"push", "check_run"}, []string{"push"}},
+		{"deduplicated", []string{"issues", "issues"}, []string{"issue_assign", "issue_label", "issue_milestone", "issues"}},
+		{"none", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := translateHookEvents(tt.events); !slices.Equal(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("wildcard", func(t *testing.T) {
+		all := translateHookEvents([]string{"*"})
+		if !slices.IsSorted(all) || !slices.Contains(all, "wiki") || !slices.Contains(all, "pull_request_sync") {
+			t.Errorf("expected every Gitea event in order, got %v", all)
+		}
+		for i := 0; i < 10; i++ {
+			if again := translateHookEvents([]string{"push", "*"}); !slices.Equal(again, all) {
+				t.Fatalf("expected the same events every time, got %v and %v", all, again)
+			}
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package github
+
+import (
+	"context"
+
+	"github.com/google/go-github/v66/github"
+)
+
+const socialImageQuery = `query($owner: String!, $name: String!) {
+  repository(owner: $owner, name: $name) { usesCustomOpenGraphImage openGraphImageUrl }
+}`
+
+// SocialImage returns the custom social preview image of a repository, or an
+// empty string if GitHub generates it. The REST API doesn't expose the image,
+// so this is a GraphQL request and needs a token.
+func SocialImage(ctx context.Context, client *github.Client, owner, name string) (string, error) {
+	var resp struct {
+		Repository *struct {
+			UsesCustomOpenGraphImage bool   `json:"usesCustomOpenGraphImage"`
+			OpenGraphImageURL        string `json:"openGraphImageUrl"`
+		} `json:"repository"`
+	}
+	vars := map[string]interface{}{"owner": owner, "name": name}
+	if err := graphQL(ctx, client, socialImageQuery, vars, &resp); err != nil {
+		return "", err
+	}
+
+	if resp.Repository == nil || !resp.Repository.UsesCustomOpenGraphImage {
+		return "", nil
+	}
+	return resp.Repository.OpenGraphImageURL, nil
+}
@@ -0,0 +1,405 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// repositoryFields selects everything toRepository needs in one pass.
+const repositoryFields = `
+fragment page on RepositoryConnection {
+  pageInfo { hasNextPage endCursor }
+  nodes {
+    databaseId name nameWithOwner url isPrivate isFork hasIssuesEnabled
+    owner { login }
+    defaultBranchRef { name }
+    primaryLanguage { name }
+    diskUsage stargazerCount forkCount pushedAt
+    parent { nameWithOwner }
+    usesCustomOpenGraphImage openGraphImageUrl
+    repositoryTopics(first: 20) { nodes { topic { name } } }
+  }
+}`
+
+// Every repository query aliases its root to "owner" and the connection to
+// "repos", so all of them share one response type.
+const (
+	publicRepositoriesQuery = `query($login: String!, $cursor: String) {
+  owner: user(login: $login) { repos: repositories(first: 100, after: $cursor, privacy: PUBLIC, ownerAffiliations: [OWNER]) { ...page } }
+}` + repositoryFields
+
+	privateRepositoriesQuery = `query($cursor: String) {
+  owner: viewer { repos: repositories(first: 100, after: $cursor, privacy: PRIVATE, ownerAffiliations: [OWNER]) { ...page } }
+}` + repositoryFields
+
+	starredRepositoriesQuery = `query($login: String!, $cursor: String) {
+  owner: user(login: $login) { repos: starredRepositories(first: 100, after: $cursor) { ...page } }
+}` + repositoryFields
+
+	viewerStarredRepositoriesQuery = `query($cursor: String) {
+  owner: viewer { repos: starredRepositories(first: 100, after: $cursor) { ...page } }
+}` + repositoryFields
+
+	watchedRepositoriesQuery = `query($login: String!, $cursor: String) {
+  owner: user(login: $login) { repos: watching(first: 100, after: $cursor) { ...page } }
+}` + repositoryFields
+
+	viewerWatchedRepositoriesQuery = `query($cursor: String) {
+  owner: viewer { repos: watching(first: 100, after: $cursor) { ...page } }
+}` + repositoryFields
+
+	organizationRepositoriesQuery = `query($login: String!, $cursor: String) {
+  owner: organization(login: $login) { repos: repositories(first: 100, after: $cursor) { ...page } }
+}` + repositoryFields
+
+	publicOrganizationRepositoriesQuery = `query($login: String!, $cursor: String) {
+  owner: organization(login: $login) { repos: repositories(first: 100, after: $cursor, privacy: PUBLIC) { ...page } }
+}` + repositoryFields
+
+	organizationsQuery = `query($login: String!, $cursor: String) {
+  owner: user(login: $login) { orgs: organizations(first: 100, after: $cursor) { pageInfo { hasNextPage endCursor } nodes { login } } }
+}`
+
+	viewerOrganizationsQuery = `query($cursor: String) {
+  owner: viewer { orgs: organizations(first: 100, after: $cursor) { pageInfo { hasNextPage endCursor } nodes { login } } }
+}`
+)
+
+type pageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type graphQLRepository struct {
+	DatabaseID       int64  `json:"databaseId"`
+	Name             string `json:"name"`
+	NameWithOwner    string `json:"nameWithOwner"`
+	URL              string `json:"url"`
+	IsPrivate        bool   `json:"isPrivate"`
+	IsFork           bool   `json:"isFork"`
+	HasIssuesEnabled bool   `json:"hasIssuesEnabled"`
+	Owner            struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	DefaultBranchRef *struct {
+		Name string `json:"name"`
+	} `json:"defaultBranchRef"`
+	PrimaryLanguage *struct {
+		Name string `json:"name"`
+	} `json:"primaryLanguage"`
+	DiskUsage      int       `json:"diskUsage"`
+	StargazerCount int       `json:"stargazerCount"`
+	ForkCount      int       `json:"forkCount"`
+	PushedAt       time.Time `json:"pushedAt"`
+	Parent         *struct {
+		NameWithOwner string `json:"nameWithOwner"`
+	} `json:"parent"`
+	UsesCustomOpenGraphImage bool   `json:"usesCustomOpenGraphImage"`
+	OpenGraphImageURL        string `json:"openGraphImageUrl"`
+	RepositoryTopics         struct {
+		Nodes []struct {
+			Topic struct {
+				Name string `json:"name"`
+			} `json:"topic"`
+		} `json:"nodes"`
+	} `json:"repositoryTopics"`
+}
+
+type repositoriesResponse struct {
+	Owner *struct {
+		Repos struct {
+			PageInfo pageInfo            `json:"pageInfo"`
+			Nodes    []graphQLRepository `json:"nodes"`
+		} `json:"repos"`
+	} `json:"owner"`
+}
+
+type organizationsResponse struct {
+	Owner *struct {
+		Orgs struct {
+			PageInfo pageInfo `json:"pageInfo"`
+			Nodes    []struct {
+				Login string `json:"login"`
+			} `json:"nodes"`
+		} `json:"orgs"`
+	} `json:"owner"`
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// fetchWithGraphQL discovers the same repositories as the REST calls of
+// GetRepositories with a few paginated GraphQL queries.
+func fetchWithGraphQL(ctx context.Context, client *github.Client, opts FetchOptions) ([]*repository.Repository, error) {
+	var login string
+	if opts.UseSpecificUser {
+		login = opts.Username
+	}
+
+	repositories, err := queryRepositories(ctx, client, publicRepositoriesQuery, opts.Username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch public repositories: %w", err)
+	}
+
+	if opts.PrivateRepositories {
+		privateRepos, err := queryRepositories(ctx, client, privateRepositoriesQuery, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch private repositories: %w", err)
+		}
+		repositories = append(repositories, privateRepos...)
+	}
+
+	if opts.MirrorStarred {
+		starredRepos, err := queryRepositories(ctx, client, viewerQuery(login, starredRepositoriesQuery, viewerStarredRepositoriesQuery), login)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch starred repositories: %w", err)
+		}
+		for _, repo := range starredRepos {
+			repo.Starred = true
+		}
+		repositories = append(repositories, starredRepos...)
+	}
+
+	if opts.MirrorWatched {
+		watchedRepos, err := queryRepositories(ctx, client, viewerQuery(login, watchedRepositoriesQuery, viewerWatchedRepositoriesQuery), login)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch watched repositories: %w", err)
+		}
+		for _, repo := range watchedRepos {
+			repo.Watched = true
+		}
+		repositories = append(repositories, watchedRepos...)
+	}
+
+	if opts.MirrorOrganizations {
+		orgs, err := queryOrganizations(ctx, client, login)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch organizations: %w", err)
+		}
+
+		orgs = filterOrganizations(orgs, opts.IncludeOrgs, opts.ExcludeOrgs)
+		log.Printf("Processing repositories from %d organizations", len(orgs))
+
+		query := publicOrganizationRepositoriesQuery
+		if opts.PrivateRepositories {
+			query = organizationRepositoriesQuery
+		}
+		for _, org := range orgs {
+			orgRepos, err := queryRepositories(ctx, client, query, org)
+			if err != nil {
+				log.Printf("Error fetching repositories for org %s: %v", org, err)
+				continue
+			}
+			log.Printf("Found %d repositories for org: %s", len(orgRepos), org)
+
+			if opts.PreserveOrgStructure {
+				for _, repo := range orgRepos {
+					repo.Organization = org
+				}
+			}
+			repositories = append(repositories, orgRepos...)
+		}
+	}
+
+	return repositories, nil
+}
+
+func viewerQuery(login, userQuery, viewerQuery string) string {
+	if login == "" {
+		return viewerQuery
+	}
+	return userQuery
+}
+
+func queryRepositories(ctx context.Context, client *github.Client, query, login string) ([]*repository.Repository, error) {
+	var repositories []*repository.Repository
+	var cursor *string
+	for {
+		vars := map[string]interface{}{"cursor": cursor}
+		if login != "" {
+			vars["login"] = login
+		}
+
+		var resp repositoriesResponse
+		if err := graphQL(ctx, client, query, vars, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Owner == nil {
+			return nil, fmt.Errorf("owner %s not found", login)
+		}
+
+		for _, node := range resp.Owner.Repos.Nodes {
+			repositories = append(repositories, fromGraphQL(node))
+		}
+
+		if !resp.Owner.Repos.PageInfo.HasNextPage {
+			return repositories, nil
+		}
+		endCursor := resp.Owner.Repos.PageInfo.EndCursor
+		cursor = &endCursor
+	}
+}
+
+func queryOrganizations(ctx context.Context, client *github.Client, login string) ([]string, error) {
+	query := viewerQuery(login, organizationsQuery, viewerOrganizationsQuery)
+
+	var orgs []string
+	var cursor *string
+	for {
+		vars := map[string]interface{}{"cursor": cursor}
+		if login != "" {
+			vars["login"] = login
+		}
+
+		var resp organizationsResponse
+		if err := graphQL(ctx, client, query, vars, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Owner == nil {
+			return nil, fmt.Errorf("user %s not found", login)
+		}
+
+		for _, node := range resp.Owner.Orgs.Nodes {
+			orgs = append(orgs, node.Login)
+		}
+
+		if !resp.Owner.Orgs.PageInfo.HasNextPage {
+			return orgs, nil
+		}
+		endCursor := resp.Owner.Orgs.PageInfo.EndCursor
+		cursor = &endCursor
+	}
+}
+
+func filterOrganizations(orgs, includeOrgs, excludeOrgs []string) []string {
+	var result []string
+	for _, org := range orgs {
+		if len(includeOrgs) > 0 && !contains(includeOrgs, org) {
+			continue
+		}
+		if contains(excludeOrgs, org) {
+			continue
+		}
+		result = append(result, org)
+	}
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func fromGraphQL(node graphQLRepository) *repository.Repository {
+	r := &repository.Repository{
+		ID:        strconv.FormatInt(node.DatabaseID, 10),
+		Name:      node.Name,
+		URL:       node.URL + ".git",
+		Private:   node.IsPrivate,
+		Fork:      node.IsFork,
+		Owner:     node.Owner.Login,
+		FullName:  node.NameWithOwner,
+		HasIssues: node.HasIssuesEnabled,
+		Stats: repository.Stats{
+			Size:     node.DiskUsage,
+			Stars:    node.StargazerCount,
+			Forks:    node.ForkCount,
+			PushedAt: node.PushedAt,
+		},
+		Provenance: repository.Provenance{
+			Provider: "github",
+			HTMLURL:  node.URL,
+		},
+	}
+	if node.DefaultBranchRef != nil {
+		r.DefaultBranch = node.DefaultBranchRef.Name
+	}
+	if node.PrimaryLanguage != nil {
+		r.Stats.Language = node.PrimaryLanguage.Name
+	}
+	if node.Parent != nil {
+		r.Provenance.Parent = node.Parent.NameWithOwner
+	}
+	// Without a custom image GitHub renders a generic card with the repository name
+	if node.UsesCustomOpenGraphImage {
+		r.SocialImageURL = node.OpenGraphImageURL
+	}
+	for _, topic := range node.RepositoryTopics.Nodes {
+		r.Topics = append(r.Topics, topic.Topic.Name)
+	}
+	return r
+}
+
+// graphQLEndpoint derives the GraphQL endpoint from the REST base URL, which
+// is https://api.github.com/ or https://<host>/api/v3/ on GitHub Enterprise.
+func graphQLEndpoint(client *github.Client) string {
+	base := *client.BaseURL
+	if strings.HasSuffix(base.Path, "/api/v3/") {
+		base.Path = strings.TrimSuffix(base.Path, "v3/") + "graphql"
+		return base.String()
+	}
+	return base.ResolveReference(&url.URL{Path: "graphql"}).String()
+}
+
+func graphQL(ctx context.Context, client *github.Client, query string, vars map[string]interface{}, out interface{}) error {
+	body, err := json.Marshal(graphQLRequest{Query: query, Variables: vars})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", graphQLEndpoint(client), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("graphql request failed: status %d", resp.StatusCode)
+	}
+
+	var gqlResp graphQLResponse
+	if err := json.Unmarshal(respBody, &gqlResp); err != nil {
+		return err
+	}
+	if len(gqlResp.Errors) > 0 {
+		return fmt.Errorf("graphql request failed: %s", gqlResp.Errors[0].Message)
+	}
+
+	return json.Unmarshal(gqlResp.Data, out)
+}
@@ -0,0 +1,79 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v66/github"
+)
+
+func TestGraphQLEndpoint(t *testing.T) {
+	for base, want := range map[string]string{
+		"https://api.github.com/":         "https://api.github.com/graphql",
+		"https://ghe.example.com/api/v3/": "https://ghe.example.com/api/graphql",
+	} {
+		client := github.NewClient(nil)
+		client.BaseURL, _ = url.Parse(base)
+		if got := graphQLEndpoint(client); got != want {
+			t.Errorf("graphQLEndpoint(%s) = %s, want %s", base, got, want)
+		}
+	}
+}
+
+func TestQueryRepositoriesPaginates(t *testing.T) {
+	pages := []string{
+		`{"data":{"owner":{"repos":{"pageInfo":{"hasNextPage":true,"endCursor":"c1"},"nodes":[{"databaseId":1,"name":"one","nameWithOwner":"octo/one","url":"https://github.com/octo/one","owner":{"login":"octo"},"defaultBranchRef":{"name":"main"},"openGraphImageUrl":"https://opengraph.githubassets.com/one","repositoryTopics":{"nodes":[{"topic":{"name":"go"}}]}}]}}}}`,
+		`{"data":{"owner":{"repos":{"pageInfo":{"hasNextPage":false},"nodes":[{"databaseId":2,"name":"two","nameWithOwner":"octo/two","url":"https://github.com/octo/two","owner":{"login":"octo"},"isFork":true,"parent":{"nameWithOwner":"other/two"},"usesCustomOpenGraphImage":true,"openGraphImageUrl":"https://repository-images.githubusercontent.com/2"}]}}}}`,
+	}
+	var cursors []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/graphql" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		cursors = append(cursors, req.Variables["cursor"])
+		w.Write([]byte(pages[len(cursors)-1]))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	repos, err := queryRepositories(context.Background(), client, publicRepositoriesQuery, "octo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("expected 2 repositories, got %d", len(repos))
+	}
+	if cursors[0] != nil || cursors[1] != "c1" {
+		t.Errorf("unexpected cursors %v", cursors)
+	}
+	if repos[0].URL != "https://github.com/octo/one.git" || repos[0].DefaultBranch != "main" || repos[0].Topics[0] != "go" || repos[0].SocialImageURL != "" {
+		t.Errorf("unexpected repository %+v", repos[0])
+	}
+	if !repos[1].Fork || repos[1].Provenance.Parent != "other/two" || repos[1].SocialImageURL != "https://repository-images.githubusercontent.com/2" {
+		t.Errorf("unexpected repository %+v", repos[1])
+	}
+}
+
+func TestGraphQLReturnsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors":[{"message":"Could not resolve to a User"}]}`))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	if _, err := queryRepositories(context.Background(), client, publicRepositoriesQuery, "ghost"); err == nil {
+		t.Error("expected an error")
+	}
+}
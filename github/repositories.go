@@ -4,52 +4,173 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+	"github.com/jaedle/mirror-to-gitea/transport"
 	"golang.org/x/oauth2"
 )
 
-type Repository struct {
-	Name         string
-	URL          string
-	Private      bool
-	Fork         bool
-	Owner        string
-	FullName     string
-	HasIssues    bool
-	Organization string
-	Starred      bool
-}
-
 type FetchOptions struct {
 	Username             string
 	PrivateRepositories  bool
 	SkipForks            bool
 	MirrorStarred        bool
+	MirrorWatched        bool
 	MirrorOrganizations  bool
 	SingleRepo           string
 	IncludeOrgs          []string
 	ExcludeOrgs          []string
 	PreserveOrgStructure bool
 	UseSpecificUser      bool
+	// GraphQL discovers repositories with the GraphQL API instead of REST
+	GraphQL bool
+}
+
+// ClientOptions configures how the GitHub API is reached.
+type ClientOptions struct {
+	// APIURL replaces the public API endpoint, e.g. for recorded fixtures in end-to-end tests
+	APIURL string
+	// Proxy overrides the proxy from the environment
+	Proxy string
+	// Cache enables conditional requests with the ETags stored in the state
+	Cache *state.Store
+	// Requests counts the requests sent to GitHub, retries included
+	Requests *transport.Counter
+}
+
+// NewClient creates a GitHub client authenticating with token, or anonymously
+// if token is empty.
+func NewClient(token string, opts ClientOptions) (*github.Client, error) {
+	var ts oauth2.TokenSource
+	if token != "" {
+		ts = oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: token},
+		)
+	}
+	return NewClientWithTokenSource(ts, opts)
+}
+
+// NewClientWithTokenSource creates a GitHub client that authenticates with
+// the tokens of ts, or anonymously if ts is nil.
+func NewClientWithTokenSource(ts oauth2.TokenSource, opts ClientOptions) (*github.Client, error) {
+	rt, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{
+		Transport: transport.NewRetryTransport(rt),
+	}
+
+	if ts != nil {
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+		httpClient = oauth2.NewClient(ctx, ts)
+	}
+
+	return newClient(httpClient, opts)
+}
+
+// NewClientWithTokens creates a GitHub client that rotates through tokens
+// whenever the quota of the current one is exhausted. The returned rotation
+// reports which token is in use.
+func NewClientWithTokens(tokens []string, opts ClientOptions) (*github.Client, *transport.TokenRotation, error) {
+	rt, err := newTransport(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rotation := transport.NewTokenRotation(rt, tokens)
+	client, err := newClient(&http.Client{
+		Transport: transport.NewRetryTransport(rotation),
+	}, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, rotation, nil
+}
+
+// NewDownloadClient creates an HTTP client for downloads from GitHub and its
+// CDN, e.g. release archives, attachments and avatars. It uses the proxy of
+// the API client and retries the same way, but neither authenticates nor
+// answers from the cache.
+func NewDownloadClient(opts ClientOptions) (*http.Client, error) {
+	opts.Cache = nil
+	rt, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport.NewRetryTransport(rt)}, nil
+}
+
+func newTransport(opts ClientOptions) (http.RoundTripper, error) {
+	base, err := transport.NewHTTPTransport(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	var rt http.RoundTripper = base
+	if opts.Requests != nil {
+		rt = transport.NewCountingTransport(base, opts.Requests)
+	}
+
+	// Responses answered from the cache are traced as the 304 GitHub sent
+	traced := transport.NewDebugTransport(rt)
+	if opts.Cache != nil {
+		return transport.NewETagTransport(traced, opts.Cache), nil
+	}
+	return traced, nil
+}
+
+func newClient(httpClient *http.Client, opts ClientOptions) (*github.Client, error) {
+	client := github.NewClient(httpClient)
+	if opts.APIURL != "" {
+		baseURL, err := url.Parse(strings.TrimSuffix(opts.APIURL, "/") + "/")
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub API URL %s: %w", opts.APIURL, err)
+		}
+		client.BaseURL = baseURL
+	}
+
+	return client, nil
 }
 
-func NewClient(token string) *github.Client {
-	if token == "" {
-		return github.NewClient(nil)
+// TokenFunc adapts a function returning the current token to an
+// oauth2.TokenSource. The token is requested for every API call.
+type TokenFunc func() (string, error)
+
+func (f TokenFunc) Token() (*oauth2.Token, error) {
+	token, err := f()
+	if err != nil {
+		return nil, err
 	}
-	
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	return github.NewClient(tc)
+	return &oauth2.Token{AccessToken: token}, nil
 }
 
-func GetRepositories(ctx context.Context, client *github.Client, opts FetchOptions) ([]*Repository, error) {
-	var repositories []*Repository
+// GetOrganizationProfile fetches the public profile of a GitHub organization.
+func GetOrganizationProfile(ctx context.Context, client *github.Client, org string) (*repository.OrganizationProfile, error) {
+	o, _, err := client.Organizations.Get(ctx, org)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching organization %s: %w", org, err)
+	}
+
+	return &repository.OrganizationProfile{
+		FullName:    o.GetName(),
+		Description: o.GetDescription(),
+		Website:     o.GetBlog(),
+		Location:    o.GetLocation(),
+		AvatarURL:   o.GetAvatarURL(),
+	}, nil
+}
+
+func GetRepositories(ctx context.Context, client *github.Client, opts FetchOptions) ([]*repository.Repository, error) {
+	var repositories []*repository.Repository
 
 	// Check if we're mirroring a single repo
 	if opts.SingleRepo != "" {
@@ -60,6 +181,12 @@ func GetRepositories(ctx context.Context, client *github.Client, opts FetchOptio
 		if repo != nil {
 			repositories = append(repositories, repo)
 		}
+	} else if opts.GraphQL {
+		graphQLRepos, err := fetchWithGraphQL(ctx, client, opts)
+		if err != nil {
+			return nil, err
+		}
+		repositories = filterDuplicates(graphQLRepos)
 	} else {
 		// Standard mirroring logic
 		publicRepos, err := fetchPublicRepositories(ctx, client, opts.Username)
@@ -88,6 +215,18 @@ func GetRepositories(ctx context.Context, client *github.Client, opts FetchOptio
 			repositories = append(repositories, starredRepos...)
 		}
 
+		if opts.MirrorWatched {
+			var username string
+			if opts.UseSpecificUser {
+				username = opts.Username
+			}
+			watchedRepos, err := fetchWatchedRepositories(ctx, client, username)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch watched repositories: %w", err)
+			}
+			repositories = append(repositories, watchedRepos...)
+		}
+
 		if opts.MirrorOrganizations {
 			var username string
 			if opts.UseSpecificUser {
@@ -111,7 +250,143 @@ func GetRepositories(ctx context.Context, client *github.Client, opts FetchOptio
 	return repositories, nil
 }
 
-func fetchSingleRepository(ctx context.Context, client *github.Client, repoURL string) (*Repository, error) {
+// GetRepository fetches the repository fullName with the flags discovery by
+// GetRepositories would give it. It returns nil if opts don't select the
+// repository.
+func GetRepository(ctx context.Context, client *github.Client, opts FetchOptions, fullName string) (*repository.Repository, error) {
+	owner, name, ok := strings.Cut(fullName, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid repository name %s", fullName)
+	}
+	ghRepo, resp, err := client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error fetching repository %s: %w", fullName, err)
+	}
+	repo := toRepository(ghRepo, false)
+	if opts.SkipForks && repo.Fork {
+		return nil, nil
+	}
+
+	if opts.SingleRepo != "" {
+		single := strings.TrimSuffix(strings.TrimPrefix(opts.SingleRepo, "https://github.com/"), ".git")
+		if !strings.EqualFold(single, repo.FullName) {
+			return nil, nil
+		}
+		return repo, nil
+	}
+
+	var username string
+	if opts.UseSpecificUser {
+		username = opts.Username
+	}
+	// Like the duplicates merged by GetRepositories, a repository found by
+	// several sources gets what each of them knows about it
+	if strings.EqualFold(repo.Owner, opts.Username) && (!repo.Private || opts.PrivateRepositories) {
+		return repo, nil
+	}
+	selected := false
+	if opts.MirrorStarred {
+		starred, err := isStarred(ctx, client, username, repo)
+		if err != nil {
+			return nil, err
+		}
+		repo.Starred = starred
+		selected = selected || starred
+	}
+	if opts.MirrorWatched {
+		watched, err := isWatched(ctx, client, username, repo)
+		if err != nil {
+			return nil, err
+		}
+		repo.Watched = watched
+		selected = selected || watched
+	}
+	if opts.MirrorOrganizations && ghRepo.GetOwner().GetType() == "Organization" && (!repo.Private || opts.PrivateRepositories) {
+		member, err := isMember(ctx, client, username, repo.Owner)
+		if err != nil {
+			return nil, err
+		}
+		if member && selectedOrganization(repo.Owner, opts.IncludeOrgs, opts.ExcludeOrgs) {
+			if opts.PreserveOrgStructure {
+				repo.Organization = repo.Owner
+			}
+			selected = true
+		}
+	}
+	if !selected {
+		return nil, nil
+	}
+	return repo, nil
+}
+
+// isStarred reports whether username, or the authenticated user if empty,
+// starred the repository.
+func isStarred(ctx context.Context, client *github.Client, username string, repo *repository.Repository) (bool, error) {
+	if username == "" {
+		starred, _, err := client.Activity.IsStarred(ctx, repo.Owner, repo.Name)
+		return starred, err
+	}
+	repos, err := fetchStarredRepositories(ctx, client, username)
+	if err != nil {
+		return false, err
+	}
+	return containsRepository(repos, repo), nil
+}
+
+// isWatched reports whether username, or the authenticated user if empty,
+// watches the repository.
+func isWatched(ctx context.Context, client *github.Client, username string, repo *repository.Repository) (bool, error) {
+	if username == "" {
+		subscription, resp, err := client.Activity.GetRepositorySubscription(ctx, repo.Owner, repo.Name)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return subscription.GetSubscribed(), nil
+	}
+	repos, err := fetchWatchedRepositories(ctx, client, username)
+	if err != nil {
+		return false, err
+	}
+	return containsRepository(repos, repo), nil
+}
+
+// isMember reports whether username, or the authenticated user if empty, is
+// a member of the organization, as listed by fetchOrganizationRepositories.
+func isMember(ctx context.Context, client *github.Client, username, org string) (bool, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		orgs, resp, err := client.Organizations.List(ctx, username, opt)
+		if err != nil {
+			return false, err
+		}
+		for _, o := range orgs {
+			if strings.EqualFold(o.GetLogin(), org) {
+				return true, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return false, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+func containsRepository(repos []*repository.Repository, repo *repository.Repository) bool {
+	for _, r := range repos {
+		if strings.EqualFold(r.FullName, repo.FullName) {
+			return true
+		}
+	}
+	return false
+}
+
+func fetchSingleRepository(ctx context.Context, client *github.Client, repoURL string) (*repository.Repository, error) {
 	// Remove URL prefix if present and clean up
 	repoPath := repoURL
 	repoPath = strings.TrimPrefix(repoPath, "https://github.com/")
@@ -133,7 +408,7 @@ func fetchSingleRepository(ctx context.Context, client *github.Client, repoURL s
 	return toRepository(repo, false), nil
 }
 
-func fetchPublicRepositories(ctx context.Context, client *github.Client, username string) ([]*Repository, error) {
+func fetchPublicRepositories(ctx context.Context, client *github.Client, username string) ([]*repository.Repository, error) {
 	opt := &github.RepositoryListOptions{
 		ListOptions: github.ListOptions{PerPage: 100},
 	}
@@ -154,7 +429,7 @@ func fetchPublicRepositories(ctx context.Context, client *github.Client, usernam
 	return toRepositoryList(allRepos, false), nil
 }
 
-func fetchPrivateRepositories(ctx context.Context, client *github.Client) ([]*Repository, error) {
+func fetchPrivateRepositories(ctx context.Context, client *github.Client) ([]*repository.Repository, error) {
 	opt := &github.RepositoryListOptions{
 		Affiliation: "owner",
 		Visibility:  "private",
@@ -177,13 +452,13 @@ func fetchPrivateRepositories(ctx context.Context, client *github.Client) ([]*Re
 	return toRepositoryList(allRepos, false), nil
 }
 
-func fetchStarredRepositories(ctx context.Context, client *github.Client, username string) ([]*Repository, error) {
+func fetchStarredRepositories(ctx context.Context, client *github.Client, username string) ([]*repository.Repository, error) {
 	opt := &github.ActivityListStarredOptions{
 		ListOptions: github.ListOptions{PerPage: 100},
 	}
 
 	var allRepos []*github.Repository
-	
+
 	if username != "" {
 		// Use user-specific endpoint
 		for {
@@ -224,11 +499,36 @@ func fetchStarredRepositories(ctx context.Context, client *github.Client, userna
 	return repos, nil
 }
 
-func fetchOrganizationRepositories(ctx context.Context, client *github.Client, username string, includeOrgs, excludeOrgs []string, preserveOrgStructure, privateRepoAccess bool) ([]*Repository, error) {
+func fetchWatchedRepositories(ctx context.Context, client *github.Client, username string) ([]*repository.Repository, error) {
+	opt := &github.ListOptions{PerPage: 100}
+
+	var allRepos []*github.Repository
+	for {
+		// An empty username lists the watched repositories of the authenticated user
+		repos, resp, err := client.Activity.ListWatched(ctx, username, opt)
+		if err != nil {
+			return nil, err
+		}
+		allRepos = append(allRepos, repos...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	repos := toRepositoryList(allRepos, false)
+	for _, repo := range repos {
+		repo.Watched = true
+	}
+
+	return repos, nil
+}
+
+func fetchOrganizationRepositories(ctx context.Context, client *github.Client, username string, includeOrgs, excludeOrgs []string, preserveOrgStructure, privateRepoAccess bool) ([]*repository.Repository, error) {
 	opt := &github.ListOptions{PerPage: 100}
 
 	var allOrgs []*github.Organization
-	
+
 	if username != "" {
 		// Use user-specific endpoint
 		for {
@@ -260,55 +560,29 @@ func fetchOrganizationRepositories(ctx context.Context, client *github.Client, u
 	// Filter organizations
 	var orgsToProcess []*github.Organization
 	for _, org := range allOrgs {
-		orgName := org.GetLogin()
-		
-		// Check include list
-		if len(includeOrgs) > 0 {
-			include := false
-			for _, includeName := range includeOrgs {
-				if orgName == includeName {
-					include = true
-					break
-				}
-			}
-			if !include {
-				continue
-			}
-		}
-		
-		// Check exclude list
-		exclude := false
-		for _, excludeName := range excludeOrgs {
-			if orgName == excludeName {
-				exclude = true
-				break
-			}
+		if selectedOrganization(org.GetLogin(), includeOrgs, excludeOrgs) {
+			orgsToProcess = append(orgsToProcess, org)
 		}
-		if exclude {
-			continue
-		}
-		
-		orgsToProcess = append(orgsToProcess, org)
 	}
 
 	log.Printf("Processing repositories from %d organizations", len(orgsToProcess))
 
-	var allOrgRepos []*Repository
+	var allOrgRepos []*repository.Repository
 	for _, org := range orgsToProcess {
 		orgName := org.GetLogin()
 		log.Printf("Fetching repositories for organization: %s", orgName)
 
 		var orgRepos []*github.Repository
-		
+
 		if privateRepoAccess {
 			// Use search API for both public and private repositories
 			log.Printf("Using search API to fetch both public and private repositories for org: %s", orgName)
 			searchQuery := fmt.Sprintf("org:%s", orgName)
-			
+
 			searchOpt := &github.SearchOptions{
 				ListOptions: github.ListOptions{PerPage: 100},
 			}
-			
+
 			for {
 				result, resp, err := client.Search.Repositories(ctx, searchQuery, searchOpt)
 				if err != nil {
@@ -321,14 +595,14 @@ func fetchOrganizationRepositories(ctx context.Context, client *github.Client, u
 				}
 				searchOpt.Page = resp.NextPage
 			}
-			
+
 			log.Printf("Found %d repositories (public and private) for org: %s", len(orgRepos), orgName)
 		} else {
 			// Use standard API for public repositories only
 			repoOpt := &github.RepositoryListByOrgOptions{
 				ListOptions: github.ListOptions{PerPage: 100},
 			}
-			
+
 			for {
 				repos, resp, err := client.Repositories.ListByOrg(ctx, orgName, repoOpt)
 				if err != nil {
@@ -341,7 +615,7 @@ func fetchOrganizationRepositories(ctx context.Context, client *github.Client, u
 				}
 				repoOpt.Page = resp.NextPage
 			}
-			
+
 			log.Printf("Found %d public repositories for org: %s", len(orgRepos), orgName)
 		}
 
@@ -357,8 +631,17 @@ func fetchOrganizationRepositories(ctx context.Context, client *github.Client, u
 	return allOrgRepos, nil
 }
 
-func withoutForks(repositories []*Repository) []*Repository {
-	var result []*Repository
+// selectedOrganization reports whether the repositories of the organization
+// are mirrored with the include and exclude lists.
+func selectedOrganization(orgName string, includeOrgs, excludeOrgs []string) bool {
+	if len(includeOrgs) > 0 && !slices.Contains(includeOrgs, orgName) {
+		return false
+	}
+	return !slices.Contains(excludeOrgs, orgName)
+}
+
+func withoutForks(repositories []*repository.Repository) []*repository.Repository {
+	var result []*repository.Repository
 	for _, repo := range repositories {
 		if !repo.Fork {
 			result = append(result, repo)
@@ -367,37 +650,164 @@ func withoutForks(repositories []*Repository) []*Repository {
 	return result
 }
 
-func filterDuplicates(repositories []*Repository) []*Repository {
-	seen := make(map[string]bool)
-	var result []*Repository
+// filterDuplicates keeps the first of the repositories listed by several
+// sources, e.g. watched and of an organization, with what the others know
+// about it, so it still goes to its organization and gets its star.
+func filterDuplicates(repositories []*repository.Repository) []*repository.Repository {
+	seen := make(map[string]*repository.Repository)
+	var result []*repository.Repository
 
 	for _, repo := range repositories {
-		if !seen[repo.URL] {
-			seen[repo.URL] = true
+		first, ok := seen[repo.URL]
+		if !ok {
+			seen[repo.URL] = repo
 			result = append(result, repo)
+			continue
+		}
+		if first.Organization == "" {
+			first.Organization = repo.Organization
 		}
+		first.Starred = first.Starred || repo.Starred
+		first.Watched = first.Watched || repo.Watched
 	}
 
 	return result
 }
 
-func toRepository(repo *github.Repository, preserveOrg bool) *Repository {
-	r := &Repository{
-		Name:      repo.GetName(),
-		URL:       repo.GetCloneURL(),
-		Private:   repo.GetPrivate(),
-		Fork:      repo.GetFork(),
-		Owner:     repo.GetOwner().GetLogin(),
-		FullName:  repo.GetFullName(),
-		HasIssues: repo.GetHasIssues(),
+func toRepository(repo *github.Repository, preserveOrg bool) *repository.Repository {
+	r := &repository.Repository{
+		ID:            strconv.FormatInt(repo.GetID(), 10),
+		Name:          repo.GetName(),
+		URL:           repo.GetCloneURL(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		Private:       repo.GetPrivate(),
+		Fork:          repo.GetFork(),
+		Owner:         repo.GetOwner().GetLogin(),
+		FullName:      repo.GetFullName(),
+		HasIssues:     repo.GetHasIssues(),
+		Topics:        repo.Topics,
+		Stats: repository.Stats{
+			Language: repo.GetLanguage(),
+			Size:     repo.GetSize(),
+			Stars:    repo.GetStargazersCount(),
+			Forks:    repo.GetForksCount(),
+			PushedAt: repo.GetPushedAt().Time,
+		},
+		Provenance: repository.Provenance{
+			Provider: "github",
+			HTMLURL:  repo.GetHTMLURL(),
+			Parent:   repo.GetParent().GetFullName(),
+		},
 	}
 	return r
 }
 
-func toRepositoryList(repos []*github.Repository, preserveOrg bool) []*Repository {
-	result := make([]*Repository, 0, len(repos))
+func toRepositoryList(repos []*github.Repository, preserveOrg bool) []*repository.Repository {
+	result := make([]*repository.Repository, 0, len(repos))
 	for _, repo := range repos {
 		result = append(result, toRepository(repo, preserveOrg))
 	}
 	return result
 }
+
+// Parent returns the full name of the repository a fork was created from.
+// Repository listings leave the parent out, so it is looked up individually.
+func Parent(ctx context.Context, client *github.Client, owner, name string) (string, error) {
+	repo, _, err := client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		return "", err
+	}
+	return repo.GetParent().GetFullName(), nil
+}
+
+// RepositoryExists reports whether the repository owner/name is visible to the client.
+func RepositoryExists(ctx context.Context, client *github.Client, owner, name string) (bool, error) {
+	_, resp, err := client.Repositories.Get(ctx, owner, name)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CurrentFullName returns the full name owner/name has on GitHub now. GitHub
+// redirects the old name of a renamed or transferred repository to the new
+// one, so it differs from owner/name for those. It is empty if the
+// repository doesn't exist.
+func CurrentFullName(ctx context.Context, client *github.Client, owner, name string) (string, error) {
+	repo, resp, err := client.Repositories.Get(ctx, owner, name)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return repo.GetFullName(), nil
+}
+
+// EnsureRepository returns the clone URL of owner/name, creating the
+// repository first if it doesn't exist. owner is a user or an organization,
+// a user has to be the one authenticated.
+func EnsureRepository(ctx context.Context, client *github.Client, owner, name, description string, private bool) (string, bool, error) {
+	repo, resp, err := client.Repositories.Get(ctx, owner, name)
+	if err == nil {
+		return repo.GetCloneURL(), false, nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return "", false, err
+	}
+
+	user, _, err := client.Users.Get(ctx, owner)
+	if err != nil {
+		return "", false, err
+	}
+	org := owner
+	if user.GetType() != "Organization" {
+		// Repositories of the authenticated user are created without an owner
+		org = ""
+	}
+	repo, _, err = client.Repositories.Create(ctx, org, &github.Repository{
+		Name:        github.String(name),
+		Description: github.String(description),
+		Private:     github.Bool(private),
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return repo.GetCloneURL(), true, nil
+}
+
+// BranchHead returns the SHA of the commit a branch points to.
+func BranchHead(ctx context.Context, client *github.Client, owner, name, branch string) (string, error) {
+	b, _, err := client.Repositories.GetBranch(ctx, owner, name, branch, 1)
+	if err != nil {
+		return "", err
+	}
+	return b.GetCommit().GetSHA(), nil
+}
+
+// BranchHeads returns the commit SHA of every branch of a repository.
+func BranchHeads(ctx context.Context, client *github.Client, owner, name string) (map[string]string, error) {
+	opt := &github.BranchListOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	heads := make(map[string]string)
+	for {
+		branches, resp, err := client.Repositories.ListBranches(ctx, owner, name, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range branches {
+			heads[b.GetName()] = b.GetCommit().GetSHA()
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return heads, nil
+}
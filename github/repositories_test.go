@@ -0,0 +1,82 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestGetRepository(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/me/tool":
+			w.Write([]byte(`{"name":"tool","full_name":"me/tool","owner":{"login":"me","type":"User"}}`))
+		case "/repos/me/secret":
+			w.Write([]byte(`{"name":"secret","full_name":"me/secret","private":true,"owner":{"login":"me","type":"User"}}`))
+		case "/repos/other/lib":
+			w.Write([]byte(`{"name":"lib","full_name":"other/lib","owner":{"login":"other","type":"User"}}`))
+		case "/repos/acme/app":
+			w.Write([]byte(`{"name":"app","full_name":"acme/app","owner":{"login":"acme","type":"Organization"}}`))
+		case "/user/starred/other/lib", "/user/starred/acme/app":
+			w.WriteHeader(http.StatusNoContent)
+		case "/user/orgs":
+			w.Write([]byte(`[{"login":"acme"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	opts := FetchOptions{Username: "me", MirrorStarred: true, MirrorOrganizations: true, PreserveOrgStructure: true}
+
+	get := func(t *testing.T, opts FetchOptions, fullName string) *repository.Repository {
+		t.Helper()
+		repo, err := GetRepository(context.Background(), client, opts, fullName)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return repo
+	}
+
+	if repo := get(t, opts, "me/tool"); repo == nil || repo.Starred {
+		t.Errorf("expected an owned repository, got %+v", repo)
+	}
+	if repo := get(t, opts, "me/secret"); repo != nil {
+		t.Errorf("expected private repositories to need PRIVATE_REPOSITORIES, got %+v", repo)
+	}
+	if repo := get(t, opts, "other/lib"); repo == nil || !repo.Starred {
+		t.Errorf("expected a starred repository, got %+v", repo)
+	}
+	if repo := get(t, opts, "acme/app"); repo == nil || repo.Organization != "acme" || !repo.Starred {
+		t.Errorf("expected a starred organization repository, got %+v", repo)
+	}
+	if repo := get(t, FetchOptions{Username: "me", MirrorOrganizations: true, ExcludeOrgs: []string{"acme"}}, "acme/app"); repo != nil {
+		t.Errorf("expected excluded organizations to be ignored, got %+v", repo)
+	}
+	if repo := get(t, opts, "me/missing"); repo != nil {
+		t.Errorf("expected missing repositories to be ignored, got %+v", repo)
+	}
+}
+
+func TestFilterDuplicatesMergesSources(t *testing.T) {
+	repos := filterDuplicates([]*repository.Repository{
+		{FullName: "acme/app", URL: "https://github.com/acme/app.git", Watched: true},
+		{FullName: "me/tool", URL: "https://github.com/me/tool.git"},
+		{FullName: "acme/app", URL: "https://github.com/acme/app.git", Organization: "acme"},
+		{FullName: "acme/app", URL: "https://github.com/acme/app.git", Starred: true},
+	})
+
+	if len(repos) != 2 || repos[0].FullName != "acme/app" || repos[1].FullName != "me/tool" {
+		t.Fatalf("expected each repository once in order, got %+v", repos)
+	}
+	if app := repos[0]; app.Organization != "acme" || !app.Watched || !app.Starred {
+		t.Errorf("expected the watched repository to keep its organization and star, got %+v", app)
+	}
+}
@@ -0,0 +1,63 @@
+package github
+
+import (
+	"context"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/provider"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func init() {
+	provider.RegisterSource("github", newSource)
+}
+
+// Source reads the repositories of a GitHub user and the organizations,
+// starred and watched repositories selected by its options.
+type Source struct {
+	client *github.Client
+	opts   FetchOptions
+}
+
+// NewSource returns the source of the repositories selected by opts, for a
+// client set up with token rotation or a cache.
+func NewSource(client *github.Client, opts FetchOptions) *Source {
+	return &Source{client: client, opts: opts}
+}
+
+// NewFetchOptions selects the repositories to mirror as configured.
+func NewFetchOptions(cfg *config.Config) FetchOptions {
+	return FetchOptions{
+		Username:             cfg.GitHub.Username,
+		PrivateRepositories:  cfg.GitHub.PrivateRepositories,
+		SkipForks:            cfg.GitHub.SkipForks,
+		MirrorStarred:        cfg.GitHub.MirrorStarred,
+		MirrorWatched:        cfg.GitHub.MirrorWatched,
+		MirrorOrganizations:  cfg.GitHub.MirrorOrganizations,
+		SingleRepo:           cfg.GitHub.SingleRepo,
+		IncludeOrgs:          cfg.GitHub.IncludeOrgs,
+		ExcludeOrgs:          cfg.GitHub.ExcludeOrgs,
+		PreserveOrgStructure: cfg.GitHub.PreserveOrgStructure,
+		UseSpecificUser:      cfg.GitHub.UseSpecificUser,
+		GraphQL:              cfg.GitHub.Discovery == "graphql",
+	}
+}
+
+func newSource(cfg *config.Config) (provider.Source, error) {
+	client, err := NewClient(cfg.GitHub.Token, ClientOptions{APIURL: cfg.GitHub.APIURL, Proxy: cfg.GitHub.Proxy})
+	if err != nil {
+		return nil, err
+	}
+	return NewSource(client, NewFetchOptions(cfg)), nil
+}
+
+// ListRepositories implements provider.Source.
+func (s *Source) ListRepositories(ctx context.Context) ([]*repository.Repository, error) {
+	return GetRepositories(ctx, s.client, s.opts)
+}
+
+// GetRepository implements provider.RepositorySource.
+func (s *Source) GetRepository(ctx context.Context, fullName string) (*repository.Repository, error) {
+	return GetRepository(ctx, s.client, s.opts, fullName)
+}
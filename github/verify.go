@@ -0,0 +1,32 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v66/github"
+)
+
+// TokenScopes returns the login the client is authenticated as and the OAuth
+// scopes of its token. Fine-grained and GitHub App tokens don't report
+// scopes, for them ok is false.
+func TokenScopes(ctx context.Context, client *github.Client) (login string, scopes []string, ok bool, err error) {
+	user, resp, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	values, ok := resp.Header[http.CanonicalHeaderKey("X-OAuth-Scopes")]
+	if !ok {
+		return user.GetLogin(), nil, false, nil
+	}
+	for _, value := range values {
+		for _, scope := range strings.Split(value, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return user.GetLogin(), scopes, true, nil
+}
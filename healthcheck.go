@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jaedle/mirror-to-gitea/redact"
+)
+
+// healthcheckMessageLimit keeps the message within what Uptime Kuma takes in
+// the query and Healthchecks.io stores of a ping body.
+const healthcheckMessageLimit = 1000
+
+// healthcheck pings a dead man's switch around each run: Healthchecks.io
+// style URLs get /start, success and /fail pings with the summary as body,
+// Uptime Kuma push URLs an up or down ping with the summary as message.
+type healthcheck struct {
+	url    string
+	client *http.Client
+}
+
+// newHealthcheck returns the healthcheck pinging pingURL, or nil if it is empty.
+func newHealthcheck(pingURL string) *healthcheck {
+	if pingURL == "" {
+		return nil
+	}
+	return &healthcheck{url: pingURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// ping reports the start, success or fail of a run. Failed pings are only
+// logged, monitoring must not break the mirroring.
+func (h *healthcheck) ping(status, message string) {
+	if h == nil {
+		return
+	}
+	// The message leaves the host, errors in it may hold tokens
+	message = redact.String(message)
+	if len(message) > healthcheckMessageLimit {
+		cut := healthcheckMessageLimit
+		for cut > 0 && !utf8.RuneStart(message[cut]) {
+			cut--
+		}
+		message = message[:cut]
+	}
+	if err := h.send(status, message); err != nil {
+		log.Printf("Warning: Failed to send the %s ping: %v", status, err)
+	}
+}
+
+func (h *healthcheck) send(status, message string) error {
+	var req *http.Request
+	if strings.Contains(h.url, "/api/push/") {
+		// Uptime Kuma only knows up and down
+		if status == "start" {
+			return nil
+		}
+		u, err := url.Parse(h.url)
+		if err != nil {
+			return fmt.Errorf("invalid ping URL")
+		}
+		query := u.Query()
+		query.Set("status", "up")
+		if status == "fail" {
+			query.Set("status", "down")
+		}
+		query.Set("msg", message)
+		u.RawQuery = query.Encode()
+		if req, err = http.NewRequest("GET", u.String(), nil); err != nil {
+			return err
+		}
+	} else {
+		pingURL := strings.TrimSuffix(h.url, "/")
+		if status != "success" {
+			pingURL += "/" + status
+		}
+		var err error
+		if req, err = http.NewRequest("POST", pingURL, strings.NewReader(message)); err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain")
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		// The ping URL identifies the check and must not be logged
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
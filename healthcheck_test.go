@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jaedle/mirror-to-gitea/redact"
+)
+
+func TestHealthcheck(t *testing.T) {
+	var pings []string
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		pings = append(pings, r.Method+" "+r.URL.RequestURI())
+	}))
+	defer server.Close()
+
+	t.Run("pings Healthchecks.io", func(t *testing.T) {
+		pings = nil
+		health := newHealthcheck(server.URL + "/ping/check-uuid")
+		health.ping("start", "")
+		health.ping("fail", "1 repositories processed, 1 failed")
+
+		if len(pings) != 2 || pings[0] != "POST /ping/check-uuid/start" || pings[1] != "POST /ping/check-uuid/fail" {
+			t.Errorf("unexpected pings %v", pings)
+		}
+		if body != "1 repositories processed, 1 failed" {
+			t.Errorf("expected the summary as body, got %q", body)
+		}
+
+		pings = nil
+		health.ping("success", "")
+		if len(pings) != 1 || pings[0] != "POST /ping/check-uuid" {
+			t.Errorf("unexpected pings %v", pings)
+		}
+	})
+
+	t.Run("pings Uptime Kuma", func(t *testing.T) {
+		pings = nil
+		health := newHealthcheck(server.URL + "/api/push/token")
+		health.ping("start", "")
+		health.ping("fail", "1 failed")
+
+		if len(pings) != 1 || pings[0] != "GET /api/push/token?msg=1+failed&status=down" {
+			t.Errorf("unexpected pings %v", pings)
+		}
+	})
+
+	t.Run("masks secrets and cuts long messages between characters", func(t *testing.T) {
+		redact.Add("ghp_secret-token")
+		defer redact.Reset()
+		health := newHealthcheck(server.URL + "/ping/check-uuid")
+		health.ping("fail", "clone failed with ghp_secret-token")
+		if body != "clone failed with "+redact.Mask {
+			t.Errorf("expected the token to be masked, got %q", body)
+		}
+
+		health.ping("fail", "x"+strings.Repeat("ä", healthcheckMessageLimit))
+		if len(body) > healthcheckMessageLimit || !utf8.ValidString(body) {
+			t.Errorf("expected at most %d bytes of valid UTF-8, got %d bytes", healthcheckMessageLimit, len(body))
+		}
+	})
+
+	t.Run("does nothing without a URL", func(t *testing.T) {
+		newHealthcheck("").ping("start", "")
+	})
+}
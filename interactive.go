@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+var errSelectionAborted = errors.New("selection aborted")
+
+const pickerHelp = `Commands:
+  1 3 5-7   toggle repositories by number
+  /text     show only repositories containing text, "/" shows all again
+  a / n     select / deselect all shown repositories
+  d         done, mirror the selected repositories
+  q         quit without mirroring`
+
+// pickRepositories lets the user check the repositories to mirror from a list
+// that can be narrowed down by search. The list and prompts are written to
+// out and the commands read line by line from in.
+func pickRepositories(in io.Reader, out io.Writer, repos []*repository.Repository) ([]*repository.Repository, error) {
+	selected := make(map[*repository.Repository]bool)
+	search := ""
+	scanner := bufio.NewScanner(in)
+
+	fmt.Fprintln(out, pickerHelp)
+	for {
+		shown := searchRepositories(repos, search)
+
+		fmt.Fprintln(out)
+		for i, repo := range shown {
+			mark := " "
+			if selected[repo] {
+				mark = "x"
+			}
+			fmt.Fprintf(out, "%4d [%s] %s\n", i+1, mark, repo.FullName)
+		}
+		if search != "" {
+			fmt.Fprintf(out, "Showing %d of %d repositories matching %q\n", len(shown), len(repos), search)
+		}
+		fmt.Fprintf(out, "%d selected> ", len(selected))
+
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, errSelectionAborted
+		}
+		input := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case input == "":
+		case input == "d":
+			var result []*repository.Repository
+			for _, repo := range repos {
+				if selected[repo] {
+					result = append(result, repo)
+				}
+			}
+			return result, nil
+		case input == "q":
+			return nil, errSelectionAborted
+		case input == "a":
+			for _, repo := range shown {
+				selected[repo] = true
+			}
+		case input == "n":
+			for _, repo := range shown {
+				delete(selected, repo)
+			}
+		case strings.HasPrefix(input, "/"):
+			search = strings.TrimPrefix(input, "/")
+		default:
+			numbers, err := parseSelection(input, len(shown))
+			if err != nil {
+				fmt.Fprintf(out, "%v\n%s\n", err, pickerHelp)
+				continue
+			}
+			for _, n := range numbers {
+				repo := shown[n-1]
+				if selected[repo] {
+					delete(selected, repo)
+				} else {
+					selected[repo] = true
+				}
+			}
+		}
+	}
+}
+
+func searchRepositories(repos []*repository.Repository, search string) []*repository.Repository {
+	if search == "" {
+		return repos
+	}
+
+	var result []*repository.Repository
+	for _, repo := range repos {
+		if strings.Contains(strings.ToLower(repo.FullName), strings.ToLower(search)) {
+			result = append(result, repo)
+		}
+	}
+	return result
+}
+
+// parseSelection reads numbers and ranges like "1 3 5-7" between 1 and max.
+func parseSelection(input string, max int) ([]int, error) {
+	var numbers []int
+	for _, field := range strings.Fields(strings.ReplaceAll(input, ",", " ")) {
+		first, last, isRange := strings.Cut(field, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("unknown command %q", field)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil {
+				return nil, fmt.Errorf("invalid range %q", field)
+			}
+		}
+		if from < 1 || to > max || from > to {
+			return nil, fmt.Errorf("%q is not between 1 and %d", field, max)
+		}
+		for n := from; n <= to; n++ {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, nil
+}
+
+// includePatterns turns a selection into INCLUDE patterns matching exactly
+// the selected repositories.
+func includePatterns(repos []*repository.Repository) []string {
+	patterns := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		patterns = append(patterns, repo.FullName)
+	}
+	return patterns
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestPickRepositories(t *testing.T) {
+	repos := []*repository.Repository{
+		{Name: "infra", FullName: "myorg/infra"},
+		{Name: "website", FullName: "myorg/website"},
+		{Name: "dotfiles", FullName: "me/dotfiles"},
+	}
+
+	pick := func(t *testing.T, input string) []string {
+		t.Helper()
+		selected, err := pickRepositories(strings.NewReader(input), io.Discard, repos)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return includePatterns(selected)
+	}
+
+	t.Run("toggles repositories by number and range", func(t *testing.T) {
+		got := pick(t, "1-3\n2\nd\n")
+		if strings.Join(got, ",") != "myorg/infra,me/dotfiles" {
+			t.Errorf("unexpected selection %v", got)
+		}
+	})
+
+	t.Run("numbers refer to the search results", func(t *testing.T) {
+		got := pick(t, "/DOT\n1\n/\nd\n")
+		if strings.Join(got, ",") != "me/dotfiles" {
+			t.Errorf("unexpected selection %v", got)
+		}
+	})
+
+	t.Run("selects all shown repositories", func(t *testing.T) {
+		got := pick(t, "/myorg\na\nd\n")
+		if strings.Join(got, ",") != "myorg/infra,myorg/website" {
+			t.Errorf("unexpected selection %v", got)
+		}
+	})
+
+	t.Run("ignores invalid input", func(t *testing.T) {
+		got := pick(t, "4\nfoo\n1\nd\n")
+		if strings.Join(got, ",") != "myorg/infra" {
+			t.Errorf("unexpected selection %v", got)
+		}
+	})
+
+	t.Run("aborts on quit and end of input", func(t *testing.T) {
+		for _, input := range []string{"1\nq\n", "1\n"} {
+			if _, err := pickRepositories(strings.NewReader(input), io.Discard, repos); err != errSelectionAborted {
+				t.Errorf("expected an aborted selection for %q, got %v", input, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestMirrorIssuesThrottled(t *testing.T) {
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"number":7,"title":"Crash","body":"boom","state":"open","user":{"login":"octo"}}]`))
+	}))
+	defer githubServer.Close()
+
+	run := func(throttled int) (int, error) {
+		posts := 0
+		giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.Path {
+			case "GET /api/v1/repos/me/demo/issues":
+				w.Write([]byte(`[]`))
+			case "POST /api/v1/repos/me/demo/issues":
+				posts++
+				if posts <= throttled {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"number":1}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer giteaServer.Close()
+
+		giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ghClient, err := ghrepo.NewClient("", ghrepo.ClientOptions{APIURL: githubServer.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo := &repository.Repository{Owner: "octo", Name: "demo", FullName: "octo/demo", HasIssues: true}
+		err = giteaClient.MirrorIssues(context.Background(), ghClient, repo, &gitea.Target{Name: "me", Type: "user"}, gitea.IssueOptions{RetryDelay: time.Millisecond})
+		return posts, err
+	}
+
+	t.Run("retries throttled issues", func(t *testing.T) {
+		posts, err := run(2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if posts != 3 {
+			t.Errorf("expected 3 attempts, got %d", posts)
+		}
+	})
+
+	t.Run("stops when throttling persists", func(t *testing.T) {
+		if _, err := run(100); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestMirrorIssuesTimestamps(t *testing.T) {
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/octo/demo/issues":
+			w.Write([]byte(`[{"number":7,"title":"Crash","body":"boom","state":"open","comments":1,"user":{"login":"octo"},"created_at":"2020-01-02T03:04:05Z","updated_at":"2020-02-03T04:05:06Z"}]`))
+		case "/repos/octo/demo/issues/7/comments":
+			w.Write([]byte(`[{"id":9,"body":"same here","user":{"login":"hubot"},"created_at":"2020-01-05T00:00:00Z"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer githubServer.Close()
+
+	var comment, edit map[string]string
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/user":
+			w.Write([]byte(`{"id":1,"username":"admin","is_admin":true}`))
+		case "GET /api/v1/repos/me/demo/issues", "GET /api/v1/repos/me/demo/issues/1/comments":
+			w.Write([]byte(`[]`))
+		case "POST /api/v1/repos/me/demo/issues":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"number":1}`))
+		case "POST /api/v1/repos/me/demo/issues/1/comments":
+			json.NewDecoder(r.Body).Decode(&comment)
+			w.WriteHeader(http.StatusCreated)
+		case "PATCH /api/v1/repos/me/demo/issues/1":
+			json.NewDecoder(r.Body).Decode(&edit)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghClient, err := ghrepo.NewClient("", ghrepo.ClientOptions{APIURL: githubServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !giteaClient.IsAdmin() {
+		t.Fatal("expected the user to be an admin")
+	}
+	repo := &repository.Repository{Owner: "octo", Name: "demo", FullName: "octo/demo", HasIssues: true}
+	opts := gitea.IssueOptions{RetryDelay: time.Millisecond, Timestamps: true}
+	if err := giteaClient.MirrorIssues(context.Background(), ghClient, repo, &gitea.Target{Name: "me", Type: "user"}, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if comment["updated_at"] != "2020-01-05T00:00:00Z" {
+		t.Errorf("expected the comment to be dated back, got %v", comment)
+	}
+	if edit["updated_at"] != "2020-02-03T04:05:06Z" {
+		t.Errorf("expected the issue to be dated back, got %v", edit)
+	}
+}
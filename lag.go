@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// laggingMirror is a mirror out of date for longer than MAX_MIRROR_LAG.
+type laggingMirror struct {
+	Repository string    `json:"repository"`
+	Mirror     string    `json:"mirror"`
+	Since      time.Time `json:"outOfDateSince"`
+	Lag        string    `json:"lag"`
+}
+
+// checkMirrorLag returns the mirror of a repository if Gitea didn't sync it
+// for longer than maxLag after the last push to GitHub. Mirrors Gitea never
+// synced are still being migrated and repositories pushed by the clone
+// fallback aren't mirrors, neither are checked.
+func checkMirrorLag(repo *repository.Repository, target *gitea.Target, giteaClient *gitea.Client, maxLag time.Duration, now time.Time) (*laggingMirror, error) {
+	status, err := giteaClient.GetMirrorStatus(target.Name, repo.GiteaName())
+	if err != nil {
+		return nil, err
+	}
+	if status == nil || !status.Mirror || status.MirrorUpdated.IsZero() {
+		return nil, nil
+	}
+
+	// The mirror missed at least the last push, so it is out of date since then
+	pushedAt := repo.Stats.PushedAt
+	if !pushedAt.After(status.MirrorUpdated) || now.Sub(pushedAt) <= maxLag {
+		return nil, nil
+	}
+	return &laggingMirror{
+		Repository: repo.FullName,
+		Mirror:     target.Name + "/" + repo.GiteaName(),
+		Since:      pushedAt,
+		Lag:        now.Sub(pushedAt).Round(time.Minute).String(),
+	}, nil
+}
+
+// alertLaggingMirrors logs the lagging mirrors and posts them as JSON to the
+// alert webhook if one is set. The text field makes the message readable in
+// Slack and Mattermost incoming webhooks.
+func alertLaggingMirrors(lagging []laggingMirror, webhookURL string) error {
+	if len(lagging) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(lagging))
+	for _, mirror := range lagging {
+		log.Printf("Warning: Mirror %s of %s is out of date for %s", mirror.Mirror, mirror.Repository, mirror.Lag)
+		lines = append(lines, fmt.Sprintf("%s is out of date for %s", mirror.Mirror, mirror.Lag))
+	}
+	if webhookURL == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"text":    fmt.Sprintf("%d mirrors are behind GitHub:\n%s", len(lagging), strings.Join(lines, "\n")),
+		"mirrors": lagging,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		// The URL of incoming webhooks is a secret and must not be logged
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to post alert: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestCheckMirrorLag(t *testing.T) {
+	synced := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/repos/me/demo":
+			w.Write([]byte(`{"mirror":true,"mirror_updated":"` + synced.Format(time.RFC3339) + `"}`))
+		case "/api/v1/repos/me/pushed":
+			w.Write([]byte(`{"mirror":false}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &gitea.Target{Name: "me", Type: "user"}
+	now := synced.Add(48 * time.Hour)
+
+	tests := []struct {
+		name     string
+		repo     string
+		pushedAt time.Time
+		lagging  bool
+	}{
+		{"synced after the last push", "demo", synced.Add(-time.Hour), false},
+		{"push within the threshold", "demo", now.Add(-time.Hour), false},
+		{"push missed for too long", "demo", synced.Add(time.Hour), true},
+		{"not a mirror", "pushed", synced.Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &repository.Repository{Name: tt.repo, FullName: "octo/" + tt.repo, Stats: repository.Stats{PushedAt: tt.pushedAt}}
+			behind, err := checkMirrorLag(repo, target, giteaClient, 24*time.Hour, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (behind != nil) != tt.lagging {
+				t.Fatalf("expected lagging %v, got %+v", tt.lagging, behind)
+			}
+			if behind != nil && behind.Lag != "47h0m0s" {
+				t.Errorf("expected a lag of 47h, got %s", behind.Lag)
+			}
+		})
+	}
+}
+
+func TestAlertLaggingMirrors(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	lagging := []laggingMirror{{Repository: "octo/demo", Mirror: "me/demo", Lag: "47h0m0s"}}
+	if err := alertLaggingMirrors(lagging, server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if text, _ := received["text"].(string); !strings.Contains(text, "me/demo is out of date for 47h0m0s") {
+		t.Errorf("unexpected alert text %q", text)
+	}
+	if mirrors, _ := received["mirrors"].([]interface{}); len(mirrors) != 1 {
+		t.Errorf("expected one mirror in the alert, got %v", received["mirrors"])
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// listedRepository is an entry of the repository inventory.
+type listedRepository struct {
+	Name       string `json:"name"`
+	Owner      string `json:"owner"`
+	Visibility string `json:"visibility"`
+	Fork       bool   `json:"fork"`
+	Starred    bool   `json:"starred"`
+	Language   string `json:"language"`
+	Stars      int    `json:"stars"`
+	Forks      int    `json:"forks"`
+	// SizeKB is the size reported by the source in kilobytes
+	SizeKB int    `json:"sizeKB"`
+	Target string `json:"target"`
+	// Mirror is the owner and name of the mirror on Gitea, after name
+	// collisions were resolved
+	Mirror string `json:"mirror"`
+}
+
+// runList prints the repositories selected by the configuration and where
+// they are mirrored to, without mirroring anything. The format is table,
+// json or csv.
+func runList(ctx context.Context, cfg *config.Config, format string, out io.Writer) error {
+	if format == "" {
+		format = "table"
+	}
+	if format != "table" && format != "json" && format != "csv" {
+		return fmt.Errorf("unknown format %q, expected table, json or csv", format)
+	}
+
+	ghClient, err := ghrepo.NewClient(cfg.GitHub.Token, ghrepo.ClientOptions{APIURL: cfg.GitHub.APIURL, Proxy: cfg.GitHub.Proxy})
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		return fmt.Errorf("failed to create Gitea client: %w", err)
+	}
+	giteaUser, err := giteaClient.GetUser()
+	if err != nil {
+		return fmt.Errorf("failed to get Gitea user: %w", err)
+	}
+
+	store, err := state.Open(cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	repos, err := fetchRepositories(ctx, ghClient, cfg)
+	if err != nil {
+		return err
+	}
+
+	// The targets are only named, listing doesn't prepare any organization
+	targets := make(map[*repository.Repository]*gitea.Target)
+	byName := make(map[string]*gitea.Target)
+	for _, repo := range repos {
+		rule := findRule(cfg.Rules, repo)
+		applyMirrorName(repo, rule, cfg)
+		name := targetName(repo, rule, cfg, giteaUser.Name)
+		target, ok := byName[strings.ToLower(name)]
+		if !ok {
+			target = &gitea.Target{Name: name, Type: "organization"}
+			if strings.EqualFold(name, giteaUser.Name) {
+				target = giteaUser
+			}
+			byName[strings.ToLower(name)] = target
+		}
+		targets[repo] = target
+	}
+	repos = resolveCollisions(repos, targets, cfg.Gitea.CollisionStrategy, existingMirrors(giteaClient, store))
+
+	listed := make([]listedRepository, 0, len(repos))
+	for _, repo := range repos {
+		target := targets[repo].Name
+		visibility := "public"
+		if repo.Private {
+			visibility = "private"
+		}
+		listed = append(listed, listedRepository{
+			Name:       repo.Name,
+			Owner:      repo.Owner,
+			Visibility: visibility,
+			Fork:       repo.Fork,
+			Starred:    repo.Starred,
+			Language:   repo.Stats.Language,
+			Stars:      repo.Stats.Stars,
+			Forks:      repo.Stats.Forks,
+			SizeKB:     repo.Stats.Size,
+			Target:     target,
+			Mirror:     target + "/" + repo.GiteaName(),
+		})
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listed)
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write([]string{"name", "owner", "visibility", "fork", "starred", "language", "stars", "forks", "size_kb", "target", "mirror"})
+		for _, repo := range listed {
+			w.Write([]string{repo.Name, repo.Owner, repo.Visibility, strconv.FormatBool(repo.Fork), strconv.FormatBool(repo.Starred), repo.Language, strconv.Itoa(repo.Stars), strconv.Itoa(repo.Forks), strconv.Itoa(repo.SizeKB), repo.Target, repo.Mirror})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tOWNER\tVISIBILITY\tFORK\tSTARRED\tLANGUAGE\tSTARS\tFORKS\tSIZE\tTARGET")
+	for _, repo := range listed {
+		language := repo.Language
+		if language == "" {
+			language = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", repo.Name, repo.Owner, repo.Visibility, yesNo(repo.Fork), yesNo(repo.Starred), language, repo.Stars, repo.Forks, formatSize(repo.SizeKB), repo.Mirror)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d repositories selected\n", len(listed))
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// formatSize formats a size in kilobytes for humans.
+func formatSize(kb int) string {
+	switch {
+	case kb >= 1<<20:
+		return fmt.Sprintf("%.1f GB", float64(kb)/(1<<20))
+	case kb >= 1<<10:
+		return fmt.Sprintf("%.1f MB", float64(kb)/(1<<10))
+	}
+	return fmt.Sprintf("%d KB", kb)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+)
+
+func TestRunList(t *testing.T) {
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/octo/repos":
+			w.Write([]byte(`[
+				{"id":1,"name":"tool","full_name":"octo/tool","clone_url":"https://github.com/octo/tool.git","owner":{"login":"octo"},"size":2048,"language":"Go","stargazers_count":42,"forks_count":3},
+				{"id":2,"name":"fork","full_name":"octo/fork","clone_url":"https://github.com/octo/fork.git","owner":{"login":"octo"},"fork":true,"size":12},
+				{"id":3,"name":"skipped","full_name":"octo/skipped","clone_url":"https://github.com/octo/skipped.git","owner":{"login":"octo"}}
+			]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer githubServer.Close()
+
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/user":
+			w.Write([]byte(`{"id":1,"username":"mirror"}`))
+		case "/api/v1/users/mirror/repos":
+			// A repository of someone else already has the name of the fork
+			w.Write([]byte(`[{"name":"fork","original_url":"https://github.com/someone/fork.git"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	cfg := &config.Config{
+		GitHub:  config.GitHubConfig{Username: "octo", APIURL: githubServer.URL},
+		Gitea:   config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5, CollisionStrategy: "prefix"},
+		Include: []string{"**"},
+		Exclude: []string{"skipped"},
+		SortBy:  "name",
+	}
+
+	t.Run("table", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := runList(context.Background(), cfg, "", &out); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("expected a header, 2 rows and a total, got:\n%s", out.String())
+		}
+		if want := "tool  octo   public      no    no       Go        42     3      2.0 MB  mirror/tool"; strings.TrimSpace(lines[2]) != want {
+			t.Errorf("expected %q, got %q", want, lines[2])
+		}
+		if !strings.HasSuffix(lines[1], "mirror/octo-fork") {
+			t.Errorf("expected the resolved name of the colliding fork, got %q", lines[1])
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := runList(context.Background(), cfg, "json", &out); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var listed []listedRepository
+		if err := json.Unmarshal(out.Bytes(), &listed); err != nil {
+			t.Fatal(err)
+		}
+		if len(listed) != 2 || !listed[0].Fork || listed[0].Target != "mirror" || listed[1].SizeKB != 2048 || listed[1].Language != "Go" || listed[1].Stars != 42 {
+			t.Errorf("unexpected inventory: %+v", listed)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := runList(context.Background(), cfg, "csv", &out); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := "name,owner,visibility,fork,starred,language,stars,forks,size_kb,target,mirror\nfork,octo,public,true,false,,0,0,12,mirror,mirror/octo-fork\ntool,octo,public,false,false,Go,42,3,2048,mirror,mirror/tool\n"
+		if out.String() != want {
+			t.Errorf("expected:\n%s\ngot:\n%s", want, out.String())
+		}
+	})
+
+	t.Run("rejects unknown formats", func(t *testing.T) {
+		if err := runList(context.Background(), cfg, "yaml", &bytes.Buffer{}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package lock
+
+import "os"
+
+// lockFile is a no-op where flock isn't available, leaving the lease to the
+// exclusive creation of its file.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,211 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Lease is a leadership lease shared by replicas.
+type Lease interface {
+	// Acquire takes the lease for holder if it is free or expired, or renews
+	// it if holder has it already, and reports whether holder has it now.
+	Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release gives the lease up if holder has it.
+	Release(ctx context.Context, holder string) error
+}
+
+// OpenLease returns the lease at location, a redis:// URL or a file path.
+func OpenLease(location string) (Lease, error) {
+	if strings.HasPrefix(location, "redis://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis URL: %w", err)
+		}
+		return newRedisLease(u)
+	}
+	return &FileLease{Path: strings.TrimPrefix(location, "file://")}, nil
+}
+
+// Elector keeps trying to lead the replicas sharing a lease. A leader renews
+// the lease a few times per TTL, so another replica takes over within the TTL
+// once the leader dies.
+type Elector struct {
+	lease   Lease
+	holder  string
+	ttl     time.Duration
+	leading atomic.Bool
+}
+
+// NewElector returns an elector competing for lease with the given TTL.
+func NewElector(lease Lease, ttl time.Duration) *Elector {
+	return &Elector{lease: lease, holder: holderName(), ttl: ttl}
+}
+
+// Leading reports whether this replica held the lease at the last attempt.
+func (e *Elector) Leading() bool {
+	return e.leading.Load()
+}
+
+// Run competes for the lease until ctx is done, then releases it.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		e.attempt(ctx)
+		select {
+		case <-ctx.Done():
+			if e.leading.Load() {
+				// The shutdown must not keep the lease from being released
+				if err := e.lease.Release(context.WithoutCancel(ctx), e.holder); err != nil {
+					log.Printf("Warning: Failed to release the leader lease: %v", err)
+				}
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) attempt(ctx context.Context) {
+	leading, err := e.lease.Acquire(ctx, e.holder, e.ttl)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		// Without knowing the lease, a leader that can't renew it has to
+		// assume another replica takes over
+		log.Printf("Warning: Failed to acquire the leader lease: %v", err)
+		leading = false
+	}
+	if was := e.leading.Swap(leading); was != leading {
+		if leading {
+			log.Printf("Became the leader as %s", e.holder)
+		} else {
+			log.Printf("Lost the leadership, standing by")
+		}
+	}
+}
+
+// holderName names this replica. Replicas in containers often share the pid
+// and hostname, so a random instance ID tells them apart.
+func holderName() string {
+	holder := fmt.Sprintf("pid %d", os.Getpid())
+	if host, err := os.Hostname(); err == nil {
+		holder += " on " + host
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err == nil {
+		holder += ", instance " + hex.EncodeToString(id)
+	}
+	return holder
+}
+
+// FileLease is a lease file on a volume shared by the replicas. The file
+// holds the holder, its modification time is the last renewal. The replicas
+// check and take over the lease one at a time, holding a lock on a guard
+// file next to it.
+type FileLease struct {
+	Path string
+}
+
+func (l *FileLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	unlock, err := l.guard()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = f.WriteString(holder + "\n")
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(l.Path)
+				return false, fmt.Errorf("failed to write lease file: %w", err)
+			}
+			return true, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, fmt.Errorf("failed to create lease file: %w", err)
+		}
+
+		current, info, err := l.read()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if current == holder {
+			now := time.Now()
+			return true, os.Chtimes(l.Path, now, now)
+		}
+		if time.Since(info.ModTime()) < ttl {
+			return false, nil
+		}
+
+		// The leader stopped renewing the lease, take it over
+		if err := os.Remove(l.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("failed to remove expired lease file: %w", err)
+		}
+	}
+	return false, nil
+}
+
+func (l *FileLease) Release(ctx context.Context, holder string) error {
+	unlock, err := l.guard()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, _, err := l.read()
+	if errors.Is(err, os.ErrNotExist) || err == nil && current != holder {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(l.Path)
+}
+
+// guard locks the guard file of the lease until the returned function is
+// called, so no other replica reads the lease while it is replaced.
+func (l *FileLease) guard() (func(), error) {
+	f, err := os.OpenFile(l.Path+".guard", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lease guard file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock lease guard file: %w", err)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+func (l *FileLease) read() (string, os.FileInfo, error) {
+	info, err := os.Stat(l.Path)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(l.Path)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSpace(string(data)), info, nil
+}
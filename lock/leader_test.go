@@ -0,0 +1,222 @@
+package lock
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileLease(t *testing.T) {
+	ctx := context.Background()
+	lease := &FileLease{Path: filepath.Join(t.TempDir(), "leader.lock")}
+
+	if ok, err := lease.Acquire(ctx, "first", time.Minute); !ok || err != nil {
+		t.Fatalf("expected the free lease to be taken, got %v %v", ok, err)
+	}
+	if ok, err := lease.Acquire(ctx, "first", time.Minute); !ok || err != nil {
+		t.Fatalf("expected the lease to be renewed, got %v %v", ok, err)
+	}
+	if ok, err := lease.Acquire(ctx, "second", time.Minute); ok || err != nil {
+		t.Fatalf("expected the held lease to be refused, got %v %v", ok, err)
+	}
+
+	expired := time.Now().Add(-2 * time.Minute)
+	os.Chtimes(lease.Path, expired, expired)
+	if ok, err := lease.Acquire(ctx, "second", time.Minute); !ok || err != nil {
+		t.Fatalf("expected the expired lease to be taken over, got %v %v", ok, err)
+	}
+
+	if err := lease.Release(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lease.Path); err != nil {
+		t.Fatalf("expected the lease of another holder to be kept, got %v", err)
+	}
+	if err := lease.Release(ctx, "second"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lease.Path); !os.IsNotExist(err) {
+		t.Fatalf("expected the lease to be released, got %v", err)
+	}
+}
+
+func TestFileLeaseTakeoverRace(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "leader.lock")
+	os.WriteFile(path, []byte("gone\n"), 0o644)
+	expired := time.Now().Add(-2 * time.Minute)
+	os.Chtimes(path, expired, expired)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var leaders []string
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(holder string) {
+			defer wg.Done()
+			lease := &FileLease{Path: path}
+			ok, err := lease.Acquire(ctx, holder, time.Minute)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				mu.Lock()
+				leaders = append(leaders, holder)
+				mu.Unlock()
+			}
+		}("replica " + strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	if len(leaders) != 1 {
+		t.Fatalf("expected exactly one replica to take over, got %v", leaders)
+	}
+	if data, _ := os.ReadFile(path); strings.TrimSpace(string(data)) != leaders[0] {
+		t.Errorf("expected the lease file to name %s, got %q", leaders[0], data)
+	}
+}
+
+func TestHolderName(t *testing.T) {
+	first, second := holderName(), holderName()
+	if first == second || !strings.Contains(first, "instance ") {
+		t.Errorf("expected holder names with their own instance ID, got %q and %q", first, second)
+	}
+}
+
+func TestElector(t *testing.T) {
+	lease := &FileLease{Path: filepath.Join(t.TempDir(), "leader.lock")}
+	leader := NewElector(lease, time.Minute)
+	standby := &Elector{lease: lease, holder: "standby", ttl: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader.attempt(ctx)
+	standby.attempt(ctx)
+	if !leader.Leading() || standby.Leading() {
+		t.Fatalf("expected exactly the first elector to lead, got %v and %v", leader.Leading(), standby.Leading())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		leader.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	standby.attempt(context.Background())
+	if !standby.Leading() {
+		t.Error("expected the standby to take over the released lease")
+	}
+}
+
+// fakeRedis answers EVAL with the outcome of the acquire and release
+// scripts for a single key.
+type fakeRedis struct {
+	mu     sync.Mutex
+	holder string
+}
+
+func (f *fakeRedis) serve(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		reply := "+OK\r\n"
+		if args[0] == "EVAL" {
+			holder := args[4]
+			switch {
+			case args[1] == acquireScript && (f.holder == "" || f.holder == holder):
+				f.holder = holder
+				reply = ":1\r\n"
+			case args[1] == releaseScript && f.holder == holder:
+				f.holder = ""
+				reply = ":1\r\n"
+			default:
+				reply = ":0\r\n"
+			}
+		}
+		f.mu.Unlock()
+		conn.Write([]byte(reply))
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		size, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		length, _ := strconv.Atoi(strings.TrimSpace(size[1:]))
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args = append(args, string(data[:length]))
+	}
+	return args, nil
+}
+
+func TestRedisLease(t *testing.T) {
+	server := &fakeRedis{}
+	addr := server.serve(t)
+
+	lease, err := OpenLease("redis://:secret@" + addr + "/2?key=mirrors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redis := lease.(*RedisLease)
+	if redis.Client.Password != "secret" || redis.Client.DB != 2 || redis.Key != "mirrors" {
+		t.Fatalf("unexpected lease %+v", redis)
+	}
+
+	ctx := context.Background()
+	if ok, err := lease.Acquire(ctx, "first", time.Minute); !ok || err != nil {
+		t.Fatalf("expected the free lease to be taken, got %v %v", ok, err)
+	}
+	if ok, err := lease.Acquire(ctx, "second", time.Minute); ok || err != nil {
+		t.Fatalf("expected the held lease to be refused, got %v %v", ok, err)
+	}
+	if err := lease.Release(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := lease.Acquire(ctx, "second", time.Minute); !ok || err != nil {
+		t.Fatalf("expected the released lease to be taken, got %v %v", ok, err)
+	}
+}
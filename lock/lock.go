@@ -0,0 +1,100 @@
+// Package lock provides a file based lock that keeps mirroring runs sharing
+// a volume from overlapping, and the leader election of replicas.
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaleAfter is how long a lock may go without a heartbeat before it is
+// considered abandoned, e.g. by a crashed process.
+const StaleAfter = 5 * time.Minute
+
+const heartbeatInterval = time.Minute
+
+// ErrLocked is returned if another run holds the lock.
+var ErrLocked = errors.New("locked by another run")
+
+// Lock is a held lock file.
+type Lock struct {
+	path string
+	stop chan struct{}
+	once sync.Once
+}
+
+// Acquire creates the lock file at path. It fails with an error wrapping
+// ErrLocked if the file exists and was refreshed within StaleAfter. While
+// held, the modification time of the file is refreshed regularly.
+func Acquire(path string) (*Lock, error) {
+	owner := fmt.Sprintf("pid %d", os.Getpid())
+	if host, err := os.Hostname(); err == nil {
+		owner += " on " + host
+	}
+
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = f.WriteString(owner + "\n")
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file: %w", err)
+			}
+
+			l := &Lock{path: path, stop: make(chan struct{})}
+			go l.heartbeat()
+			return l, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to check lock file: %w", err)
+		}
+
+		if time.Since(info.ModTime()) < StaleAfter || attempt > 0 {
+			holder, _ := os.ReadFile(path)
+			return nil, fmt.Errorf("%w (%s, since %s)", ErrLocked, strings.TrimSpace(string(holder)), info.ModTime().Format(time.RFC3339))
+		}
+
+		// The holder stopped refreshing the lock, take it over
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale lock file: %w", err)
+		}
+	}
+}
+
+func (l *Lock) heartbeat() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			os.Chtimes(l.path, now, now)
+		}
+	}
+}
+
+// Release removes the lock file.
+func (l *Lock) Release() error {
+	var err error
+	l.once.Do(func() {
+		close(l.stop)
+		err = os.Remove(l.path)
+	})
+	return err
+}
@@ -0,0 +1,45 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	t.Run("excludes a second run until released", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "run.lock")
+
+		l, err := Acquire(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := Acquire(path); !errors.Is(err, ErrLocked) {
+			t.Fatalf("expected ErrLocked, got %v", err)
+		}
+
+		if err := l.Release(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		again, err := Acquire(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		again.Release()
+	})
+
+	t.Run("takes over stale locks", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "run.lock")
+		os.WriteFile(path, []byte("pid 1 on elsewhere\n"), 0o644)
+		stale := time.Now().Add(-2 * StaleAfter)
+		os.Chtimes(path, stale, stale)
+
+		l, err := Acquire(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		l.Release()
+	})
+}
@@ -3,7 +3,10 @@ package logger
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
+	"os"
 	"time"
 
 	"github.com/jaedle/mirror-to-gitea/config"
@@ -35,16 +38,38 @@ func (l *Logger) Error(msg string, args ...interface{}) {
 	}
 }
 
+// redactedBackup is the backup configuration without its credentials.
+type redactedBackup struct {
+	Endpoint  string `json:"endpoint"`
+	Bucket    string `json:"bucket"`
+	Region    string `json:"region"`
+	Prefix    string `json:"prefix,omitempty"`
+	Retention int    `json:"retention"`
+}
+
 func (l *Logger) ShowConfig(cfg *config.Config) {
+	l.WriteConfig(os.Stdout, cfg)
+}
+
+// WriteConfig writes the configuration with its secrets redacted to w.
+func (l *Logger) WriteConfig(w io.Writer, cfg *config.Config) {
 	// Create a copy of config with redacted tokens
 	redactedConfig := struct {
+		Source struct {
+			Type string `json:"type"`
+			URL  string `json:"url,omitempty"`
+		} `json:"source"`
 		GitHub struct {
 			Username             string   `json:"username"`
+			PushMirrorOwner      string   `json:"pushMirrorOwner,omitempty"`
 			Token                string   `json:"token"`
+			APIURL               string   `json:"apiUrl,omitempty"`
+			Proxy                string   `json:"proxy,omitempty"`
 			SkipForks            bool     `json:"skipForks"`
 			PrivateRepositories  bool     `json:"privateRepositories"`
 			MirrorIssues         bool     `json:"mirrorIssues"`
 			MirrorStarred        bool     `json:"mirrorStarred"`
+			MirrorWatched        bool     `json:"mirrorWatched"`
 			MirrorOrganizations  bool     `json:"mirrorOrganizations"`
 			UseSpecificUser      bool     `json:"useSpecificUser"`
 			SingleRepo           string   `json:"singleRepo"`
@@ -52,27 +77,125 @@ func (l *Logger) ShowConfig(cfg *config.Config) {
 			ExcludeOrgs          []string `json:"excludeOrgs"`
 			PreserveOrgStructure bool     `json:"preserveOrgStructure"`
 			SkipStarredIssues    bool     `json:"skipStarredIssues"`
+			ReleaseArchives      bool     `json:"releaseArchives"`
+			RehostAttachments    bool     `json:"rehostAttachments"`
+			MirrorLFS            bool     `json:"mirrorLfs"`
+			LFSEndpoint          string   `json:"lfsEndpoint,omitempty"`
+			MirrorWebhooks       bool     `json:"mirrorWebhooks"`
+			MirrorRulesets       bool     `json:"mirrorRulesets"`
+			MirrorTeams          bool     `json:"mirrorTeams"`
+			MirrorAvatars        bool     `json:"mirrorAvatars"`
+			NativeMigration      bool     `json:"nativeMigration"`
+			NativeItems          []string `json:"nativeMigrationItems,omitempty"`
+			PreserveTimestamps   bool     `json:"preserveIssueTimestamps"`
+			Discovery            string   `json:"discovery"`
+			FollowRenames        bool     `json:"followRenames"`
+			MoveTransferred      bool     `json:"moveTransferredMirrors"`
+			WebhookSecret        string   `json:"webhookSecret,omitempty"`
 		} `json:"github"`
 		Gitea struct {
-			URL             string `json:"url"`
-			Token           string `json:"token"`
-			Organization    string `json:"organization"`
-			Visibility      string `json:"visibility"`
-			StarredReposOrg string `json:"starredReposOrg"`
+			URL                     string            `json:"url"`
+			Token                   string            `json:"token"`
+			Proxy                   string            `json:"proxy,omitempty"`
+			SudoUser                string            `json:"sudoUser,omitempty"`
+			AuditLog                string            `json:"auditLog,omitempty"`
+			CACert                  string            `json:"caCert,omitempty"`
+			InsecureSkipVerify      bool              `json:"insecureSkipVerify"`
+			TimeoutSeconds          int               `json:"timeoutSeconds"`
+			MigrateTimeoutSeconds   int               `json:"migrateTimeoutSeconds"`
+			RequestsPerSecond       int               `json:"requestsPerSecond,omitempty"`
+			MigrationsPerMinute     int               `json:"migrationsPerMinute,omitempty"`
+			WaitForMigration        bool              `json:"waitForMigration"`
+			MigrationWaitSeconds    int               `json:"migrationWaitSeconds,omitempty"`
+			CloneFallback           bool              `json:"cloneFallback"`
+			CloneCacheDir           string            `json:"cloneCacheDir,omitempty"`
+			DefaultBranchOnly       bool              `json:"defaultBranchOnly"`
+			SkipTags                bool              `json:"skipTags"`
+			RepairBrokenMirrors     bool              `json:"repairBrokenMirrors"`
+			RepairPartial           bool              `json:"repairPartialMigrations"`
+			UpdateMirrorCredentials bool              `json:"updateMirrorCredentials"`
+			VerifyContent           string            `json:"verifyContent,omitempty"`
+			OrphanCleanup           string            `json:"orphanCleanup,omitempty"`
+			AtticOrganization       string            `json:"atticOrganization,omitempty"`
+			OrphanRetentionDays     int               `json:"orphanRetentionDays,omitempty"`
+			ProtectTopic            string            `json:"protectTopic"`
+			ProtectedRepos          []string          `json:"protectedRepos,omitempty"`
+			Organization            string            `json:"organization"`
+			Visibility              string            `json:"visibility"`
+			StarredReposOrg         string            `json:"starredReposOrg"`
+			WatchedReposOrg         string            `json:"watchedReposOrg,omitempty"`
+			RepoNameTemplate        string            `json:"repoNameTemplate,omitempty"`
+			OrgMapping              map[string]string `json:"orgMapping,omitempty"`
+			TopicMapping            map[string]string `json:"topicMapping,omitempty"`
+			OrgNameTemplate         string            `json:"orgNameTemplate,omitempty"`
+			CollisionStrategy       string            `json:"collisionStrategy"`
+			MaxRepoCreation         int               `json:"maxRepoCreation"`
+			DiskBudgetMB            int               `json:"diskBudgetMB"`
+			CheckQuota              bool              `json:"checkQuota"`
+			StarIntervalMs          int               `json:"starIntervalMs"`
+			StarredVisibility       string            `json:"starredVisibility"`
+			VisibilityOverride      string            `json:"visibilityOverride"`
+			WebhookURL              string            `json:"webhookUrl,omitempty"`
+			WebhookEvents           []string          `json:"webhookEvents,omitempty"`
+			WebhookSecret           string            `json:"webhookSecret,omitempty"`
+			DeployKeys              []string          `json:"deployKeys,omitempty"`
+			RepoUnits               []string          `json:"repoUnits,omitempty"`
 		} `json:"gitea"`
-		DryRun    bool     `json:"dryRun"`
-		Delay     int      `json:"delay"`
-		Include   []string `json:"include"`
-		Exclude   []string `json:"exclude"`
-		SingleRun bool     `json:"singleRun"`
+		DryRun           bool                            `json:"dryRun"`
+		Delay            int                             `json:"delay"`
+		DelayJitter      int                             `json:"delayJitter,omitempty"`
+		Include          []string                        `json:"include"`
+		Exclude          []string                        `json:"exclude"`
+		IncludeRegex     string                          `json:"includeRegex,omitempty"`
+		ExcludeRegex     string                          `json:"excludeRegex,omitempty"`
+		SingleRun        bool                            `json:"singleRun"`
+		Schedule         string                          `json:"schedule,omitempty"`
+		SortBy           string                          `json:"sortBy,omitempty"`
+		ConfigFile       string                          `json:"configFile,omitempty"`
+		Rules            []config.Rule                   `json:"rules,omitempty"`
+		Organizations    map[string]*config.Organization `json:"organizations,omitempty"`
+		UserMap          map[string]string               `json:"userMap,omitempty"`
+		StateFile        string                          `json:"stateFile,omitempty"`
+		SkipUnchanged    bool                            `json:"skipUnchanged"`
+		BackoffAfter     int                             `json:"failureBackoffAfter,omitempty"`
+		BackoffSeconds   int                             `json:"failureBackoffSeconds,omitempty"`
+		LockFile         string                          `json:"lockFile"`
+		ServeAddr        string                          `json:"serveAddr"`
+		API              string                          `json:"api,omitempty"`
+		Backup           *redactedBackup                 `json:"backup,omitempty"`
+		ProgressInterval int                             `json:"progressInterval"`
+		MaxMirrorLag     int                             `json:"maxMirrorLag,omitempty"`
+		MaxNewMirrors    int                             `json:"maxNewMirrorsPerRun,omitempty"`
+		AlertWebhook     string                          `json:"alertWebhookUrl,omitempty"`
+		HealthcheckPing  string                          `json:"healthcheckPingUrl,omitempty"`
+		Output           string                          `json:"output"`
+		LogLevel         string                          `json:"logLevel"`
+		RepoLogDir       string                          `json:"repoLogDir,omitempty"`
+		LeaderLock       string                          `json:"leaderLock,omitempty"`
+		LeaderLease      int                             `json:"leaderLeaseSeconds,omitempty"`
+		Queue            string                          `json:"queue,omitempty"`
+		QueueBatchSize   int                             `json:"queueBatchSize,omitempty"`
+		Secrets          struct {
+			Provider        string   `json:"provider"`
+			VaultAddr       string   `json:"vaultAddr,omitempty"`
+			VaultPath       string   `json:"vaultPath,omitempty"`
+			RefreshInterval int      `json:"refreshInterval,omitempty"`
+			Rotating        []string `json:"rotating,omitempty"`
+		} `json:"secrets"`
 	}{}
 
+	redactedConfig.Source.Type = cfg.Source.Type
+	redactedConfig.Source.URL = cfg.Source.URL
 	redactedConfig.GitHub.Username = cfg.GitHub.Username
+	redactedConfig.GitHub.PushMirrorOwner = cfg.GitHub.PushMirrorOwner
 	redactedConfig.GitHub.Token = "[REDACTED]"
+	redactedConfig.GitHub.APIURL = cfg.GitHub.APIURL
+	redactedConfig.GitHub.Proxy = redactProxy(cfg.GitHub.Proxy)
 	redactedConfig.GitHub.SkipForks = cfg.GitHub.SkipForks
 	redactedConfig.GitHub.PrivateRepositories = cfg.GitHub.PrivateRepositories
 	redactedConfig.GitHub.MirrorIssues = cfg.GitHub.MirrorIssues
 	redactedConfig.GitHub.MirrorStarred = cfg.GitHub.MirrorStarred
+	redactedConfig.GitHub.MirrorWatched = cfg.GitHub.MirrorWatched
 	redactedConfig.GitHub.MirrorOrganizations = cfg.GitHub.MirrorOrganizations
 	redactedConfig.GitHub.UseSpecificUser = cfg.GitHub.UseSpecificUser
 	redactedConfig.GitHub.SingleRepo = cfg.GitHub.SingleRepo
@@ -80,18 +203,150 @@ func (l *Logger) ShowConfig(cfg *config.Config) {
 	redactedConfig.GitHub.ExcludeOrgs = cfg.GitHub.ExcludeOrgs
 	redactedConfig.GitHub.PreserveOrgStructure = cfg.GitHub.PreserveOrgStructure
 	redactedConfig.GitHub.SkipStarredIssues = cfg.GitHub.SkipStarredIssues
+	redactedConfig.GitHub.ReleaseArchives = cfg.GitHub.ReleaseArchives
+	redactedConfig.GitHub.RehostAttachments = cfg.GitHub.RehostAttachments
+	redactedConfig.GitHub.MirrorLFS = cfg.GitHub.MirrorLFS
+	redactedConfig.GitHub.LFSEndpoint = cfg.GitHub.LFSEndpointTemplate
+	redactedConfig.GitHub.MirrorWebhooks = cfg.GitHub.MirrorWebhooks
+	redactedConfig.GitHub.MirrorRulesets = cfg.GitHub.MirrorRulesets
+	redactedConfig.GitHub.MirrorTeams = cfg.GitHub.MirrorTeams
+	redactedConfig.GitHub.MirrorAvatars = cfg.GitHub.MirrorAvatars
+	redactedConfig.GitHub.NativeMigration = cfg.GitHub.NativeMigration
+	redactedConfig.GitHub.NativeItems = cfg.GitHub.NativeItems
+	redactedConfig.GitHub.PreserveTimestamps = cfg.GitHub.PreserveTimestamps
+	redactedConfig.GitHub.Discovery = cfg.GitHub.Discovery
+	redactedConfig.GitHub.FollowRenames = cfg.GitHub.FollowRenames
+	redactedConfig.GitHub.MoveTransferred = cfg.GitHub.MoveTransferred
+	if cfg.GitHub.WebhookSecret != "" {
+		redactedConfig.GitHub.WebhookSecret = "[REDACTED]"
+	}
 
 	redactedConfig.Gitea.URL = cfg.Gitea.URL
 	redactedConfig.Gitea.Token = "[REDACTED]"
+	redactedConfig.Gitea.Proxy = redactProxy(cfg.Gitea.Proxy)
+	redactedConfig.Gitea.SudoUser = cfg.Gitea.SudoUser
+	redactedConfig.Gitea.AuditLog = cfg.Gitea.AuditLog
+	redactedConfig.Gitea.CACert = cfg.Gitea.CACert
+	redactedConfig.Gitea.InsecureSkipVerify = cfg.Gitea.InsecureSkipVerify
+	redactedConfig.Gitea.TimeoutSeconds = cfg.Gitea.TimeoutSeconds
+	redactedConfig.Gitea.MigrateTimeoutSeconds = cfg.Gitea.MigrateTimeoutSeconds
+	redactedConfig.Gitea.RequestsPerSecond = cfg.Gitea.RequestsPerSecond
+	redactedConfig.Gitea.MigrationsPerMinute = cfg.Gitea.MigrationsPerMinute
+	redactedConfig.Gitea.WaitForMigration = cfg.Gitea.WaitForMigration
+	redactedConfig.Gitea.MigrationWaitSeconds = cfg.Gitea.MigrationWaitSeconds
+	redactedConfig.Gitea.CloneFallback = cfg.Gitea.CloneFallback
+	redactedConfig.Gitea.DefaultBranchOnly = cfg.Gitea.DefaultBranchOnly
+	redactedConfig.Gitea.SkipTags = cfg.Gitea.SkipTags
+	if cfg.Gitea.CloneFallback || cfg.Gitea.DefaultBranchOnly {
+		redactedConfig.Gitea.CloneCacheDir = cfg.Gitea.CloneCacheDir
+	}
+	redactedConfig.Gitea.RepairBrokenMirrors = cfg.Gitea.RepairBrokenMirrors
+	redactedConfig.Gitea.RepairPartial = cfg.Gitea.RepairPartialMigrations
+	redactedConfig.Gitea.UpdateMirrorCredentials = cfg.Gitea.UpdateMirrorCredentials
+	redactedConfig.Gitea.VerifyContent = cfg.Gitea.VerifyContent
+	redactedConfig.Gitea.OrphanCleanup = cfg.Gitea.OrphanCleanup
+	redactedConfig.Gitea.ProtectTopic = cfg.Gitea.ProtectTopic
+	redactedConfig.Gitea.ProtectedRepos = cfg.Gitea.ProtectedRepos
+	if cfg.Gitea.OrphanCleanup != "" {
+		if cfg.Gitea.OrphanCleanup == "attic" {
+			redactedConfig.Gitea.AtticOrganization = cfg.Gitea.AtticOrganization
+		}
+		redactedConfig.Gitea.OrphanRetentionDays = cfg.Gitea.OrphanRetentionDays
+	}
 	redactedConfig.Gitea.Organization = cfg.Gitea.Organization
 	redactedConfig.Gitea.Visibility = cfg.Gitea.Visibility
 	redactedConfig.Gitea.StarredReposOrg = cfg.Gitea.StarredReposOrg
+	redactedConfig.Gitea.WatchedReposOrg = cfg.Gitea.WatchedReposOrg
+	redactedConfig.Gitea.RepoNameTemplate = cfg.Gitea.RepoNameTemplate
+	redactedConfig.Gitea.OrgMapping = cfg.Gitea.OrgMapping
+	redactedConfig.Gitea.TopicMapping = cfg.Gitea.TopicMapping
+	redactedConfig.Gitea.OrgNameTemplate = cfg.Gitea.OrgNameTemplate
+	redactedConfig.Gitea.CollisionStrategy = cfg.Gitea.CollisionStrategy
+	redactedConfig.Gitea.MaxRepoCreation = cfg.Gitea.MaxRepoCreation
+	redactedConfig.Gitea.DiskBudgetMB = cfg.Gitea.DiskBudgetMB
+	redactedConfig.Gitea.CheckQuota = cfg.Gitea.CheckQuota
+	redactedConfig.Gitea.StarIntervalMs = cfg.Gitea.StarIntervalMs
+	redactedConfig.Gitea.StarredVisibility = cfg.Gitea.StarredVisibility
+	redactedConfig.Gitea.VisibilityOverride = cfg.Gitea.VisibilityOverride
+	redactedConfig.Gitea.WebhookURL = cfg.Gitea.WebhookURL
+	if cfg.Gitea.WebhookURL != "" {
+		redactedConfig.Gitea.WebhookEvents = cfg.Gitea.WebhookEvents
+	}
+	if cfg.Gitea.WebhookSecret != "" {
+		redactedConfig.Gitea.WebhookSecret = "[REDACTED]"
+	}
+	redactedConfig.Gitea.RepoUnits = cfg.Gitea.RepoUnits
+	for _, key := range cfg.Gitea.DeployKeys {
+		redactedConfig.Gitea.DeployKeys = append(redactedConfig.Gitea.DeployKeys, key.Title)
+	}
 
 	redactedConfig.DryRun = cfg.DryRun
 	redactedConfig.Delay = cfg.Delay
+	redactedConfig.DelayJitter = cfg.DelayJitter
 	redactedConfig.Include = cfg.Include
 	redactedConfig.Exclude = cfg.Exclude
+	if cfg.IncludeRegex != nil {
+		redactedConfig.IncludeRegex = cfg.IncludeRegex.String()
+	}
+	if cfg.ExcludeRegex != nil {
+		redactedConfig.ExcludeRegex = cfg.ExcludeRegex.String()
+	}
 	redactedConfig.SingleRun = cfg.SingleRun
+	if cfg.Schedule != nil {
+		redactedConfig.Schedule = cfg.Schedule.String()
+	}
+	redactedConfig.SortBy = cfg.SortBy
+	redactedConfig.ConfigFile = cfg.ConfigFile
+	redactedConfig.Rules = cfg.Rules
+	redactedConfig.Organizations = cfg.Organizations
+	redactedConfig.UserMap = cfg.UserMap
+	redactedConfig.StateFile = redactProxy(cfg.StateFile)
+	redactedConfig.SkipUnchanged = cfg.SkipUnchanged
+	if cfg.FailureBackoffAfter > 0 {
+		redactedConfig.BackoffAfter = cfg.FailureBackoffAfter
+		redactedConfig.BackoffSeconds = cfg.FailureBackoff
+	}
+	redactedConfig.LockFile = cfg.LockFile
+	redactedConfig.ServeAddr = cfg.ServeAddr
+	if cfg.APIToken != "" {
+		redactedConfig.API = "[REDACTED]"
+	}
+	redactedConfig.ProgressInterval = cfg.ProgressInterval
+	redactedConfig.MaxMirrorLag = cfg.MaxMirrorLag
+	redactedConfig.MaxNewMirrors = cfg.MaxNewMirrorsPerRun
+	redactedConfig.Output = cfg.Output
+	redactedConfig.LogLevel = cfg.LogLevel
+	redactedConfig.RepoLogDir = cfg.RepoLogDir
+	if cfg.Queue != "" {
+		redactedConfig.Queue = redactProxy(cfg.Queue)
+		redactedConfig.QueueBatchSize = cfg.QueueBatchSize
+	}
+	if cfg.LeaderLock != "" {
+		redactedConfig.LeaderLock = redactProxy(cfg.LeaderLock)
+		redactedConfig.LeaderLease = cfg.LeaderLease
+	}
+	if cfg.AlertWebhookURL != "" {
+		redactedConfig.AlertWebhook = "[REDACTED]"
+	}
+	if cfg.HealthcheckPingURL != "" {
+		redactedConfig.HealthcheckPing = "[REDACTED]"
+	}
+	if cfg.Backup != nil {
+		redactedConfig.Backup = &redactedBackup{
+			Endpoint:  cfg.Backup.Endpoint,
+			Bucket:    cfg.Backup.Bucket,
+			Region:    cfg.Backup.Region,
+			Prefix:    cfg.Backup.Prefix,
+			Retention: cfg.Backup.Retention,
+		}
+	}
+	redactedConfig.Secrets.Provider = cfg.Secrets.Provider
+	redactedConfig.Secrets.VaultAddr = cfg.Secrets.VaultAddr
+	redactedConfig.Secrets.VaultPath = cfg.Secrets.VaultPath
+	if cfg.Secrets.Source != nil {
+		redactedConfig.Secrets.RefreshInterval = cfg.Secrets.RefreshInterval
+	}
+	redactedConfig.Secrets.Rotating = cfg.Secrets.Rotating
 
 	configJSON, err := json.MarshalIndent(redactedConfig, "", "  ")
 	if err != nil {
@@ -99,5 +354,14 @@ func (l *Logger) ShowConfig(cfg *config.Config) {
 		return
 	}
 
-	fmt.Printf("Applied configuration:\n%s\n", string(configJSON))
+	fmt.Fprintf(w, "Applied configuration:\n%s\n", string(configJSON))
+}
+
+// redactProxy hides the password of a proxy URL.
+func redactProxy(proxy string) string {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || proxy == "" {
+		return proxy
+	}
+	return proxyURL.Redacted()
 }
@@ -2,73 +2,345 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/bmatcuk/doublestar/v4"
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/backup"
+	"github.com/jaedle/mirror-to-gitea/bundle"
 	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/events"
+	"github.com/jaedle/mirror-to-gitea/gitcmd"
 	"github.com/jaedle/mirror-to-gitea/gitea"
 	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/lock"
 	"github.com/jaedle/mirror-to-gitea/logger"
-	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/provider"
+	"github.com/jaedle/mirror-to-gitea/redact"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/runlog"
+	"github.com/jaedle/mirror-to-gitea/secrets"
+	"github.com/jaedle/mirror-to-gitea/state"
+	"github.com/jaedle/mirror-to-gitea/transport"
 )
 
 func main() {
+	interactive := flag.Bool("interactive", false, "select the repositories to mirror from a list before starting")
+	confirm := flag.Bool("confirm", false, "ask before migrating each new repository")
+	limit := flag.Int("limit", 0, "mirror only the first `N` selected repositories, to try a configuration on a sample")
+	retryFailed := flag.Bool("retry-failed", false, "mirror repositories that keep failing despite their FAILURE_BACKOFF_AFTER cool-down")
+	flag.Parse()
+
+	// Secrets are masked in everything written, once they are known
+	log.SetOutput(redact.NewWriter(runlog.NewWriter(os.Stderr)))
+	stdout := redact.NewWriter(os.Stdout)
+
+	// Checking reports invalid configurations instead of failing on them
+	if flag.Arg(0) == "check" {
+		if err := runCheck(os.Environ(), stdout); err != nil {
+			log.Fatalf("Check failed: %v", err)
+		}
+		return
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("invalid configuration: %v", err)
 	}
+	registerSecrets(cfg)
+	transport.SetDebug(cfg.LogLevel == "debug")
+	// Events go to stdout, the log stays on stderr
+	if cfg.Output == "ndjson" {
+		events.SetOutput(stdout)
+	}
+
+	command := flag.Arg(0)
+	switch command {
+	case "", "serve", "work":
+	case "status":
+		if err := runStatus(cfg, stdout); err != nil {
+			log.Fatalf("Failed to show status: %v", err)
+		}
+		return
+	case "verify":
+		if err := runVerify(context.Background(), cfg, stdout); err != nil {
+			log.Fatalf("Verification failed: %v", err)
+		}
+		return
+	case "diff":
+		if err := runDiff(context.Background(), cfg, stdout); err != nil {
+			log.Fatalf("Diff failed: %v", err)
+		}
+		return
+	case "export":
+		if err := runExport(context.Background(), cfg, flag.Arg(1)); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		return
+	case "push-mirrors":
+		if err := runPushMirrors(context.Background(), cfg, stdout); err != nil {
+			log.Fatalf("Push mirrors failed: %v", err)
+		}
+		return
+	case "stats":
+		if err := runStats(cfg, flag.Arg(1), stdout); err != nil {
+			log.Fatalf("Failed to show statistics: %v", err)
+		}
+		return
+	case "list":
+		if err := runList(context.Background(), cfg, flag.Arg(1), stdout); err != nil {
+			log.Fatalf("List failed: %v", err)
+		}
+		return
+	case "plan":
+		if err := runPlanCommand(context.Background(), cfg, flag.Arg(1), stdout); err != nil {
+			log.Fatalf("Plan failed: %v", err)
+		}
+		return
+	case "apply":
+		if err := runApply(context.Background(), cfg, flag.Arg(1)); err != nil {
+			log.Fatalf("Apply failed: %v", err)
+		}
+		return
+	case "import":
+		if err := runImport(context.Background(), cfg, flag.Arg(1)); err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		return
+	default:
+		log.Fatalf("Unknown command %q", command)
+	}
 
 	lgr := logger.New()
 	lgr.ShowConfig(cfg)
 
-	ctx := context.Background()
+	if command == "serve" {
+		if err := runServe(cfg); err != nil {
+			log.Fatalf("Server failed: %v", err)
+		}
+		return
+	}
+
+	if command == "work" {
+		if err := runWorker(cfg); err != nil {
+			log.Fatalf("Worker failed: %v", err)
+		}
+		return
+	}
+
+	if cfg.Schedule != nil {
+		if err := runScheduled(cfg, runOptions{limit: *limit, retryFailed: *retryFailed}); err != nil {
+			log.Fatalf("Scheduler failed: %v", err)
+		}
+		return
+	}
+
+	// A shutdown lets the repository in progress finish and checkpoints the run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if !*interactive && !*confirm && !waitJitter(ctx, cfg.DelayJitter) {
+		return
+	}
+
+	if err := run(ctx, cfg, runOptions{interactive: *interactive, stdout: stdout, confirm: *confirm, limit: *limit, retryFailed: *retryFailed}); err != nil {
+		log.Fatalf("Mirroring failed: %v", err)
+	}
+}
+
+// runOptions adjust a single mirroring run.
+type runOptions struct {
+	interactive bool
+	// stdout receives the selection of interactive runs
+	stdout io.Writer
+	// confirm asks before migrating each new repository
+	confirm bool
+	// limit mirrors only the first selected repositories if positive
+	limit int
+	// retryFailed ignores the cool-down of repositories that keep failing
+	retryFailed bool
+	// only restricts the run to the repository with this full name
+	only string
+	// syncExisting makes Gitea sync repositories that are already mirrored
+	syncExisting bool
+	// queued are mirrored instead of discovering the repositories, by a worker
+	queued []*repository.Repository
+	// plan restricts the run to the reviewed changes of the plan command
+	plan *runPlan
+	// change is the structural change a webhook reported for the only repository
+	change *repositoryChange
+}
+
+// run mirrors the configured repositories once.
+func run(ctx context.Context, cfg *config.Config, opts runOptions) (err error) {
+	// Every line of the run carries its ID, and that of the repository in progress
+	runlog.StartRun(runlog.NewID())
+	defer runlog.EndRun()
+
+	// Workers mirror the repositories of the queue side by side
+	if opts.queued == nil {
+		runLock, err := lock.Acquire(cfg.LockFile)
+		if errors.Is(err, lock.ErrLocked) {
+			log.Printf("Skipping run, the lock file %s is %v", cfg.LockFile, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer runLock.Release()
+	}
+
+	// Runs for a single repository, e.g. from a webhook, are no scheduled runs to monitor
+	var health *healthcheck
+	if opts.only == "" && opts.queued == nil && opts.plan == nil {
+		health = newHealthcheck(cfg.HealthcheckPingURL)
+	}
+	health.ping("start", "")
+	defer func() {
+		if err != nil {
+			health.ping("fail", err.Error())
+		}
+	}()
+
+	store, err := state.Open(cfg.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to open state: %w", err)
+	}
+
+	// Secrets from an external provider are re-fetched during the run to pick up rotations
+	var rotating *secrets.Cached
+	if cfg.Secrets.Source != nil {
+		rotating = secrets.NewCached(cfg.Secrets.Source, time.Duration(cfg.Secrets.RefreshInterval)*time.Second)
+	}
 
 	// Create Gitea client
-	giteaClient := gitea.NewClient(&cfg.Gitea)
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		return fmt.Errorf("failed to create Gitea client: %w", err)
+	}
+	if rotating != nil && slices.Contains(cfg.Secrets.Rotating, "GITEA_TOKEN") {
+		giteaClient.SetTokenSource(secretFunc(ctx, rotating, "GITEA_TOKEN"))
+	}
+	detectServer(giteaClient)
+	if cfg.GitHub.PreserveTimestamps && cfg.GitHub.MirrorIssues && !cfg.DryRun && !giteaClient.IsAdmin() {
+		log.Printf("Warning: PRESERVE_ISSUE_TIMESTAMPS needs an admin Gitea token, mirrored issues are dated when they are copied")
+	}
 
 	// Create Gitea organization if specified
-	if cfg.Gitea.Organization != "" {
-		if err := giteaClient.CreateOrganization(cfg.Gitea.Organization, cfg.Gitea.Visibility, cfg.DryRun); err != nil {
+	if cfg.Gitea.Organization != "" && opts.plan.allowsOrganization(cfg.Gitea.Organization) {
+		if err := giteaClient.CreateOrganization(cfg.Gitea.Organization, cfg.Gitea.Visibility, nil, cfg.DryRun); err != nil {
 			log.Printf("Warning: Failed to create Gitea organization %s: %v", cfg.Gitea.Organization, err)
 		}
 	}
 
 	// Create the starred repositories organization if mirror starred is enabled
-	if cfg.GitHub.MirrorStarred && cfg.Gitea.StarredReposOrg != "" {
-		if err := giteaClient.CreateOrganization(cfg.Gitea.StarredReposOrg, cfg.Gitea.Visibility, cfg.DryRun); err != nil {
+	if cfg.GitHub.MirrorStarred && cfg.Gitea.StarredReposOrg != "" && opts.plan.allowsOrganization(cfg.Gitea.StarredReposOrg) {
+		if err := giteaClient.CreateOrganization(cfg.Gitea.StarredReposOrg, cfg.Gitea.Visibility, &repository.OrganizationProfile{
+			Description: fmt.Sprintf("Repositories starred by %s on GitHub", cfg.GitHub.Username),
+		}, cfg.DryRun); err != nil {
 			log.Printf("Warning: Failed to create Gitea starred organization %s: %v", cfg.Gitea.StarredReposOrg, err)
 		}
 	}
 
+	// Create the watched repositories organization if mirror watched is enabled
+	if cfg.GitHub.MirrorWatched && cfg.Gitea.WatchedReposOrg != "" && opts.plan.allowsOrganization(cfg.Gitea.WatchedReposOrg) {
+		if err := giteaClient.CreateOrganization(cfg.Gitea.WatchedReposOrg, cfg.Gitea.Visibility, &repository.OrganizationProfile{
+			Description: fmt.Sprintf("Repositories watched by %s on GitHub", cfg.GitHub.Username),
+		}, cfg.DryRun); err != nil {
+			log.Printf("Warning: Failed to create Gitea watched organization %s: %v", cfg.Gitea.WatchedReposOrg, err)
+		}
+	}
+
 	// Create GitHub client
-	ghClient := ghrepo.NewClient(cfg.GitHub.Token)
-
-	// Get GitHub repositories
-	githubRepos, err := ghrepo.GetRepositories(ctx, ghClient, ghrepo.FetchOptions{
-		Username:             cfg.GitHub.Username,
-		PrivateRepositories:  cfg.GitHub.PrivateRepositories,
-		SkipForks:            cfg.GitHub.SkipForks,
-		MirrorStarred:        cfg.GitHub.MirrorStarred,
-		MirrorOrganizations:  cfg.GitHub.MirrorOrganizations,
-		SingleRepo:           cfg.GitHub.SingleRepo,
-		IncludeOrgs:          cfg.GitHub.IncludeOrgs,
-		ExcludeOrgs:          cfg.GitHub.ExcludeOrgs,
-		PreserveOrgStructure: cfg.GitHub.PreserveOrgStructure,
-		UseSpecificUser:      cfg.GitHub.UseSpecificUser,
-	})
+	var ghClient *github.Client
+	var tokenRotation *transport.TokenRotation
+	githubRequests := &transport.Counter{}
+	ghOpts := ghrepo.ClientOptions{APIURL: cfg.GitHub.APIURL, Proxy: cfg.GitHub.Proxy, Cache: store, Requests: githubRequests}
+	if rotating != nil && slices.Contains(cfg.Secrets.Rotating, "GITHUB_TOKEN") {
+		ghClient, err = ghrepo.NewClientWithTokenSource(ghrepo.TokenFunc(secretFunc(ctx, rotating, "GITHUB_TOKEN")), ghOpts)
+	} else if len(cfg.GitHub.Tokens) > 1 {
+		ghClient, tokenRotation, err = ghrepo.NewClientWithTokens(cfg.GitHub.Tokens, ghOpts)
+	} else {
+		ghClient, err = ghrepo.NewClient(cfg.GitHub.Token, ghOpts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+	downloads, err := ghrepo.NewDownloadClient(ghOpts)
 	if err != nil {
-		log.Fatalf("Failed to fetch GitHub repositories: %v", err)
+		return fmt.Errorf("failed to create GitHub client: %w", err)
 	}
+	giteaClient.SetDownloadClient(downloads)
 
-	// Apply include/exclude filters
-	filteredRepos := filterRepositories(githubRepos, cfg.Include, cfg.Exclude)
+	// Deleted repositories are no longer discovered, their mirror is retired right away
+	if opts.change != nil && opts.change.action == "deleted" {
+		retireDeleted(ctx, opts.only, cfg, giteaClient, ghClient, store)
+		if err := store.Save(); err != nil {
+			log.Printf("Warning: Failed to save state: %v", err)
+		}
+		return nil
+	}
+
+	// Get GitHub repositories, unless the producer discovered them for this
+	// worker; runs for one repository only look that one up
+	filteredRepos := opts.queued
+	if filteredRepos == nil {
+		if opts.only != "" {
+			filteredRepos, err = fetchRepository(ctx, ghClient, cfg, opts.only)
+		} else {
+			filteredRepos, err = fetchRepositories(ctx, ghClient, cfg)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("Run interrupted while fetching the GitHub repositories")
+				return nil
+			}
+			return err
+		}
+	} else if opts.only != "" {
+		filteredRepos = onlyRepository(filteredRepos, opts.only)
+	}
+	if opts.plan != nil {
+		filteredRepos = opts.plan.selectRepositories(filteredRepos)
+	}
+	if opts.limit > 0 && len(filteredRepos) > opts.limit {
+		log.Printf("Limiting the run to the first %d of %d repositories", opts.limit, len(filteredRepos))
+		filteredRepos = filteredRepos[:opts.limit]
+	}
+
+	if opts.interactive {
+		filteredRepos, err = pickRepositories(os.Stdin, os.Stderr, filteredRepos)
+		if err != nil {
+			return fmt.Errorf("no repositories selected: %w", err)
+		}
+		// Printed on its own so the selection can be kept for unattended runs
+		include := strings.Join(includePatterns(filteredRepos), ",")
+		if cfg.Output == "ndjson" {
+			events.Emit(events.RepositoriesSelected, events.Fields{"include": include})
+		} else {
+			fmt.Fprintf(opts.stdout, "INCLUDE=%s\n", include)
+		}
+	}
 	log.Printf("Found %d repositories to mirror", len(filteredRepos))
+	for _, repo := range filteredRepos {
+		events.Emit(events.RepoDiscovered, events.Fields{"repository": repo.FullName, "private": repo.Private, "fork": repo.Fork, "starred": repo.Starred})
+	}
 
 	// Get Gitea user information
 	giteaUser, err := giteaClient.GetUser()
 	if err != nil {
-		log.Fatalf("Failed to get Gitea user: %v", err)
+		return fmt.Errorf("failed to get Gitea user: %w", err)
 	}
 
 	// Create a map to store organization targets if preserving structure
@@ -84,16 +356,29 @@ func main() {
 
 		// Create or get each organization in Gitea
 		for orgName := range uniqueOrgs {
-			log.Printf("Preparing Gitea organization for GitHub organization: %s", orgName)
+			giteaOrg := giteaOrganization(orgName, cfg)
+			log.Printf("Preparing Gitea organization %s for GitHub organization: %s", giteaOrg, orgName)
+
+			var profile *repository.OrganizationProfile
+			if cfg.Source.Type != "gitea" {
+				profile, err = ghrepo.GetOrganizationProfile(ctx, ghClient, orgName)
+				if err != nil {
+					log.Printf("Warning: Failed to fetch profile of GitHub organization %s: %v", orgName, err)
+				}
+			}
 
-			if err := giteaClient.CreateOrganization(orgName, cfg.Gitea.Visibility, cfg.DryRun); err != nil {
-				log.Printf("Error creating Gitea organization %s: %v", orgName, err)
+			visibility := cfg.Gitea.Visibility
+			if settings := cfg.Organizations[strings.ToLower(orgName)]; settings != nil && settings.Visibility != "" {
+				visibility = settings.Visibility
+			}
+			if err := giteaClient.CreateOrganization(giteaOrg, visibility, profile, cfg.DryRun); err != nil {
+				log.Printf("Error creating Gitea organization %s: %v", giteaOrg, err)
 				continue
 			}
 
-			orgTarget, err := giteaClient.GetOrganization(orgName)
+			orgTarget, err := giteaClient.GetOrganization(giteaOrg)
 			if err != nil {
-				log.Printf("Error getting Gitea organization %s: %v", orgName, err)
+				log.Printf("Error getting Gitea organization %s: %v", giteaOrg, err)
 				continue
 			}
 
@@ -101,103 +386,566 @@ func main() {
 		}
 	}
 
-	// Mirror repositories
+	// Resolve Gitea names and rules, and create the organizations targeted by
+	// rules, organization settings and topics
+	repoRules := make(map[*repository.Repository]*config.Rule)
+	ruleTargets := make(map[string]*gitea.Target)
 	for _, repo := range filteredRepos {
-		if err := mirrorRepository(ctx, repo, cfg, giteaClient, ghClient, giteaUser, orgTargets); err != nil {
-			log.Printf("Error mirroring repository %s: %v", repo.Name, err)
+		rule := findRule(cfg.Rules, repo)
+		applyMirrorName(repo, rule, cfg)
+		if rule != nil {
+			repoRules[repo] = rule
+		}
+
+		orgName, visibility := "", cfg.Gitea.Visibility
+		if rule != nil && rule.TargetOrganization != "" {
+			orgName = rule.TargetOrganization
+			log.Printf("Preparing Gitea organization for rule %q: %s", rule.Match, orgName)
+		} else if settings := organizationSettings(repo, cfg); settings != nil && settings.TargetOrganization != "" {
+			orgName = settings.TargetOrganization
+			if settings.Visibility != "" {
+				visibility = settings.Visibility
+			}
+		} else if org := topicOrganization(repo, cfg); org != "" {
+			orgName = org
+		}
+		if orgName == "" {
+			continue
+		}
+		if _, ok := ruleTargets[orgName]; ok {
+			continue
+		}
+
+		if err := giteaClient.CreateOrganization(orgName, visibility, nil, cfg.DryRun); err != nil {
+			log.Printf("Error creating Gitea organization %s: %v", orgName, err)
+			continue
+		}
+
+		orgTarget, err := giteaClient.GetOrganization(orgName)
+		if err != nil {
+			log.Printf("Error getting Gitea organization %s: %v", orgName, err)
+			continue
 		}
+
+		ruleTargets[orgName] = orgTarget
 	}
 
-	log.Println("Mirroring process completed")
-}
+	// Determine the Gitea target of every repository
+	repoTargets := make(map[*repository.Repository]*gitea.Target)
+	for _, repo := range filteredRepos {
+		repoTargets[repo] = resolveTarget(repo, repoRules[repo], cfg, giteaClient, giteaUser, orgTargets, ruleTargets)
+	}
 
-func filterRepositories(repos []*ghrepo.Repository, include, exclude []string) []*ghrepo.Repository {
-	var filtered []*ghrepo.Repository
+	// Make sure no two repositories end up under the same name in the same target
+	filteredRepos = resolveCollisions(filteredRepos, repoTargets, cfg.Gitea.CollisionStrategy, existingMirrors(giteaClient, store))
 
-	for _, repo := range repos {
-		// Check include patterns
-		includeMatch := false
-		for _, pattern := range include {
-			matched, err := doublestar.Match(pattern, repo.Name)
-			if err == nil && matched {
-				includeMatch = true
-				break
+	// With a queue, scheduled runs only discover and the workers mirror. Only
+	// the producer sees every repository, so it cleans up after deleted ones.
+	if cfg.Queue != "" && opts.queued == nil && opts.only == "" && opts.plan == nil && !opts.interactive && !opts.confirm {
+		queued, err := enqueueRepositories(ctx, cfg, filteredRepos)
+		if err != nil {
+			return err
+		}
+		if cfg.Gitea.OrphanCleanup != "" && ctx.Err() == nil && opts.limit == 0 {
+			cleanupOrphans(context.WithoutCancel(ctx), repoTargets, cfg, giteaClient, ghClient, store, nil, nil)
+			if err := store.Save(); err != nil {
+				log.Printf("Warning: Failed to save state: %v", err)
 			}
 		}
+		health.ping("success", fmt.Sprintf("%d repositories discovered, %d queued", len(filteredRepos), queued))
+		return nil
+	}
+
+	// Issue references and forks point at the mirrors of the run and those recorded before
+	mirrors := mirrorLinks(store, filteredRepos, repoTargets)
+	if opts.plan != nil {
+		filteredRepos = opts.plan.approvedTargets(filteredRepos, repoTargets, giteaClient)
+	}
+
+	// Hold back new mirrors that would exceed the creation limit of their target
+	filteredRepos = checkCreationQuota(filteredRepos, repoTargets, cfg.Gitea.MaxRepoCreation, giteaClient)
+	filteredRepos = limitNewMirrors(filteredRepos, repoTargets, cfg.MaxNewMirrorsPerRun, giteaClient)
+
+	// Stop before migrating anything Gitea has no space left for
+	if err := checkCapacity(filteredRepos, repoTargets, cfg, giteaClient); err != nil {
+		if !cfg.DryRun {
+			return err
+		}
+		log.Printf("DRY RUN: The run would stop, %v", err)
+	}
 
-		if !includeMatch {
+	// An interrupted run is resumed by skipping the repositories it already processed
+	checkpointed := opts.only == "" && opts.queued == nil && opts.plan == nil && opts.limit == 0 && !opts.interactive && !opts.confirm && !cfg.DryRun
+	checkpoint := &state.Checkpoint{StartedAt: time.Now()}
+	completed := make(map[string]bool)
+	if previous := store.Checkpoint(); checkpointed && previous != nil {
+		checkpoint = previous
+		for _, fullName := range previous.Completed {
+			completed[fullName] = true
+		}
+		log.Printf("Resuming the run interrupted since %s, skipping %d repositories processed already", previous.StartedAt.Format(time.RFC1123), len(completed))
+	}
+
+	// Renamed repositories keep their mirror instead of getting a second one
+	var renames map[string]renamedMirror
+	if cfg.GitHub.FollowRenames && opts.only == "" && opts.queued == nil && opts.plan == nil && opts.limit == 0 {
+		renames = findRenames(ctx, ghClient, giteaClient, repoTargets)
+	} else if cfg.GitHub.FollowRenames && opts.change != nil && opts.change.previous != "" {
+		renames = findRenamedMirror(giteaClient, store, repoTargets, opts.change.previous)
+	}
+
+	// Repositories in progress are finished even after a shutdown was requested
+	workCtx := context.WithoutCancel(ctx)
+
+	var backups *backup.S3
+	if cfg.Backup != nil && !cfg.DryRun {
+		backups = backup.NewS3(cfg.Backup)
+	}
+
+	var confirmation *confirmation
+	if opts.confirm {
+		confirmation = newConfirmation(os.Stdin, os.Stderr)
+	}
+
+	// Mirror repositories
+	summary := newRunSummary()
+	stars := giteaClient.NewStarBatch(time.Duration(cfg.Gitea.StarIntervalMs)*time.Millisecond, cfg.DryRun)
+	interrupted := false
+	var lagging []laggingMirror
+	progress := newRunProgress(len(filteredRepos)-len(completed), time.Duration(cfg.ProgressInterval)*time.Second, time.Now())
+	for _, repo := range filteredRepos {
+		if ctx.Err() != nil {
+			interrupted = true
+			break
+		}
+		if completed[repo.FullName] {
+			continue
+		}
+
+		// Dormant repositories need no Gitea calls at all, unless a webhook asked for them
+		if cfg.SkipUnchanged && opts.only == "" && unchanged(store, repo, repoTargets[repo]) {
+			log.Printf("Repository %s wasn't pushed to since the last run; skipping.", repo.Name)
+			completed[repo.FullName] = true
+			checkpoint.Completed = append(checkpoint.Completed, repo.FullName)
+			progress.record(nil, time.Now())
 			continue
 		}
 
-		// Check exclude patterns
-		excludeMatch := false
-		for _, pattern := range exclude {
-			matched, err := doublestar.Match(pattern, repo.Name)
-			if err == nil && matched {
-				excludeMatch = true
-				break
+		// Repositories that keep failing would slow every run down, unless asked for
+		if cfg.FailureBackoffAfter > 0 && opts.only == "" && !opts.retryFailed {
+			if until, ok := backingOff(store, repo, cfg.FailureBackoffAfter, time.Duration(cfg.FailureBackoff)*time.Second, time.Now()); ok {
+				mirror, _ := store.Mirror(repo.FullName)
+				log.Printf("Repository %s failed %d runs in a row; skipping it until %s.", repo.Name, mirror.Failures, until.Format(time.RFC1123))
+				completed[repo.FullName] = true
+				checkpoint.Completed = append(checkpoint.Completed, repo.FullName)
+				progress.record(nil, time.Now())
+				continue
+			}
+		}
+
+		// The token is also handed to Gitea as clone credential
+		if rotating != nil && slices.Contains(cfg.Secrets.Rotating, "GITHUB_TOKEN") {
+			if token, err := rotating.Secret(workCtx, "GITHUB_TOKEN"); err == nil {
+				cfg.GitHub.Token = token
+			}
+		}
+		if tokenRotation != nil {
+			cfg.GitHub.Token = tokenRotation.Token()
+		}
+
+		if confirmation != nil {
+			target := repoTargets[repo]
+			exists, err := giteaClient.IsRepositoryMirrored(repo.GiteaName(), target)
+			if err == nil && !exists && !confirmation.confirm(fmt.Sprintf("Migrate %s to %s/%s?", repo.FullName, target.Name, repo.GiteaName())) {
+				if !confirmation.stopped() {
+					log.Printf("Skipping %s, the migration wasn't confirmed", repo.FullName)
+				}
+				progress.record(nil, time.Now())
+				continue
+			}
+		}
+
+		// Broken mirrors are only re-migrated where the plan says so
+		repoCfg := cfg
+		if opts.plan != nil {
+			action, _ := opts.plan.repository(repo.FullName)
+			planned := *cfg
+			planned.Gitea.RepairBrokenMirrors = cfg.Gitea.RepairBrokenMirrors && action.Action == planRecreate
+			planned.Gitea.RepairPartialMigrations = cfg.Gitea.RepairPartialMigrations && action.Action == planRecreate
+			repoCfg = &planned
+		}
+
+		endScope := runlog.StartRepository(repo.FullName, cfg.RepoLogDir)
+		started, githubBefore, giteaBefore := time.Now(), githubRequests.Count(), giteaClient.Requests()
+		var err error
+		if renamed, ok := renames[strings.ToLower(repo.FullName)]; ok {
+			err = followRename(workCtx, repo, repoRules[repo], repoTargets[repo], renamed, repoCfg, giteaClient, ghClient, store, mirrors)
+		}
+		existed, _ := giteaClient.IsRepositoryMirrored(repo.GiteaName(), repoTargets[repo])
+		if err == nil {
+			err = mirrorRepository(workCtx, repo, repoRules[repo], repoTargets[repo], repoCfg, giteaClient, ghClient, stars, store, mirrors, opts.syncExisting)
+		}
+		if err == nil && existed && opts.change != nil && (opts.change.action == "privatized" || opts.change.action == "publicized") {
+			err = updateVisibility(workCtx, repo, repoRules[repo], repoTargets[repo], repoCfg, giteaClient, ghClient, mirrors)
+		}
+		metrics := repoMetrics{
+			name:        repo.FullName,
+			duration:    time.Since(started),
+			githubCalls: githubRequests.Count() - githubBefore,
+			giteaCalls:  giteaClient.Requests() - giteaBefore,
+		}
+		summary.measure(metrics)
+		events.Emit(events.RepoMetrics, events.Fields{
+			"repository":   repo.FullName,
+			"duration_ms":  metrics.duration.Milliseconds(),
+			"github_calls": metrics.githubCalls,
+			"gitea_calls":  metrics.giteaCalls,
+		})
+		if err != nil {
+			log.Printf("Error mirroring repository %s: %v", repo.Name, err)
+			events.Emit(events.Error, events.Fields{"repository": repo.FullName, "error": err})
+		} else if backups != nil {
+			if backedUp, err := backupRepository(workCtx, repo, cfg, backups, store); err != nil {
+				log.Printf("Warning: Failed to back up %s: %v", repo.FullName, err)
+			} else if backedUp {
+				log.Printf("Backed up %s to S3", repo.FullName)
+			} else {
+				log.Printf("Repository %s wasn't pushed to since its last backup; skipping the backup.", repo.Name)
 			}
 		}
+		summary.record(repo.FullName, err)
+		if err == nil && !existed && !cfg.DryRun {
+			summary.migrated(repo.Stats.Size)
+		}
+		progress.record(err, time.Now())
+		if !cfg.DryRun {
+			recordMirror(store, repo, repoTargets[repo], err)
+		}
+		if err == nil && cfg.MaxMirrorLag > 0 && !cfg.DryRun {
+			behind, err := checkMirrorLag(repo, repoTargets[repo], giteaClient, time.Duration(cfg.MaxMirrorLag)*time.Second, time.Now())
+			if err != nil {
+				log.Printf("Warning: Failed to check the lag of %s: %v", repo.FullName, err)
+			} else if behind != nil {
+				lagging = append(lagging, *behind)
+			}
+		}
+		endScope()
+		completed[repo.FullName] = true
+		checkpoint.Completed = append(checkpoint.Completed, repo.FullName)
+	}
 
-		if !excludeMatch {
-			filtered = append(filtered, repo)
+	if cfg.GitHub.MirrorTeams && !interrupted {
+		mirrorAccess(workCtx, filteredRepos, repoTargets, orgTargets, cfg, giteaClient, ghClient)
+	}
+
+	// Mirrors whose GitHub repository was deleted are retired before they are deleted
+	if cfg.Gitea.OrphanCleanup != "" && !interrupted && opts.only == "" && opts.queued == nil && opts.limit == 0 {
+		cleanupOrphans(workCtx, repoTargets, cfg, giteaClient, ghClient, store, opts.plan, confirmation)
+	}
+
+	if err := alertLaggingMirrors(lagging, cfg.AlertWebhookURL); err != nil {
+		log.Printf("Warning: Failed to send the lag alert: %v", err)
+	}
+
+	// Star all starred repositories in one paced pass
+	if err := stars.Flush(); err != nil {
+		log.Printf("Warning: Failed to star repositories: %v", err)
+	}
+
+	if checkpointed {
+		if interrupted {
+			store.SetCheckpoint(checkpoint)
+			log.Printf("Run interrupted, %d of %d repositories processed; the next start resumes from here", len(completed), len(filteredRepos))
+		} else {
+			store.SetCheckpoint(nil)
 		}
 	}
 
-	return filtered
+	// Syncs of single repositories would crowd out the statistics of runs
+	if opts.only == "" && !cfg.DryRun {
+		store.RecordRun(summary.stats(time.Now()))
+	}
+
+	if err := store.Save(); err != nil {
+		log.Printf("Warning: Failed to save state: %v", err)
+	}
+
+	summary.print()
+	if !interrupted {
+		status := "success"
+		if len(summary.failures) > 0 {
+			status = "fail"
+		}
+		health.ping(status, strings.Join(summary.lines(), "\n"))
+		log.Println("Mirroring process completed")
+	}
+	return nil
 }
 
-func mirrorRepository(
-	ctx context.Context,
-	repo *ghrepo.Repository,
+// fetchRepositories returns the GitHub repositories selected by the
+// configuration in mirroring order.
+func fetchRepositories(ctx context.Context, ghClient *github.Client, cfg *config.Config) ([]*repository.Repository, error) {
+	source, err := newSource(ghClient, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	repos, err := source.ListRepositories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch repositories from %s: %w", sourceName(cfg), err)
+	}
+
+	// Apply include/exclude filters
+	filteredRepos := filterRepositories(repos, cfg)
+	sortRepositories(filteredRepos, cfg.SortBy)
+	return filteredRepos, nil
+}
+
+// fetchRepository returns the repository fullName in a list of its own if the
+// configuration selects it, or an empty list. Sources that can't look up
+// single repositories list all of them.
+func fetchRepository(ctx context.Context, ghClient *github.Client, cfg *config.Config, fullName string) ([]*repository.Repository, error) {
+	source, err := newSource(ghClient, cfg)
+	if err != nil {
+		return nil, err
+	}
+	single, ok := source.(provider.RepositorySource)
+	if !ok {
+		repos, err := fetchRepositories(ctx, ghClient, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return onlyRepository(repos, fullName), nil
+	}
+
+	repo, err := single.GetRepository(ctx, fullName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s from %s: %w", fullName, sourceName(cfg), err)
+	}
+	var repos []*repository.Repository
+	if repo != nil {
+		repos = filterRepositories([]*repository.Repository{repo}, cfg)
+	}
+	if len(repos) == 0 {
+		log.Printf("Repository %s is not part of the configured repositories, ignoring it", fullName)
+	}
+	return repos, nil
+}
+
+// newSource returns the source of the repositories to mirror. GitHub uses
+// the client of the run, which rotates tokens and caches.
+func newSource(ghClient *github.Client, cfg *config.Config) (provider.Source, error) {
+	if cfg.Source.Type != "" && cfg.Source.Type != "github" {
+		return provider.NewSource(cfg)
+	}
+	return ghrepo.NewSource(ghClient, ghrepo.NewFetchOptions(cfg)), nil
+}
+
+// sourceName names the forge repositories are mirrored from in messages.
+func sourceName(cfg *config.Config) string {
+	if cfg.Source.Type == "gitea" {
+		return cfg.Source.URL
+	}
+	return "GitHub"
+}
+
+// applyMirrorName renders the Gitea name of a repository from the name
+// template of its rule or the configuration.
+func applyMirrorName(repo *repository.Repository, rule *config.Rule, cfg *config.Config) {
+	nameTemplate := cfg.Gitea.RepoName
+	if rule != nil && rule.Name != nil {
+		nameTemplate = rule.Name
+	}
+	if nameTemplate == nil {
+		return
+	}
+
+	name, err := renderName(nameTemplate, repo)
+	if err != nil {
+		log.Printf("Error rendering name for repository %s, keeping original name: %v", repo.Name, err)
+		return
+	}
+	repo.MirrorName = name
+}
+
+// detectServer adapts the Gitea client to the server it talks to, falling
+// back to a current Gitea if the server can't be identified.
+func detectServer(giteaClient *gitea.Client) {
+	server, err := giteaClient.DetectServer()
+	if err != nil {
+		log.Printf("Warning: Failed to detect the Gitea server, assuming a current Gitea: %v", err)
+		return
+	}
+	log.Printf("Mirroring to %s", server)
+}
+
+// resolveTarget determines the Gitea user or organization a repository is mirrored to.
+func resolveTarget(
+	repo *repository.Repository,
+	rule *config.Rule,
 	cfg *config.Config,
 	giteaClient *gitea.Client,
-	ghClient *github.Client,
 	giteaUser *gitea.Target,
 	orgTargets map[string]*gitea.Target,
-) error {
-	// Determine the target (user or organization)
-	var giteaTarget *gitea.Target
+	ruleTargets map[string]*gitea.Target,
+) *gitea.Target {
+	if rule != nil && rule.TargetOrganization != "" {
+		// Rules take precedence over all other routing
+		if target, ok := ruleTargets[rule.TargetOrganization]; ok {
+			return target
+		}
+		log.Printf("No Gitea organization found for rule %q, using default target", rule.Match)
+		return getDefaultTarget(cfg, giteaClient, giteaUser)
+	}
+
+	if settings := organizationSettings(repo, cfg); settings != nil && settings.TargetOrganization != "" {
+		// Followed by the settings of the GitHub organization
+		if target, ok := ruleTargets[settings.TargetOrganization]; ok {
+			return target
+		}
+		log.Printf("No Gitea organization found for %s, using default target", repo.Owner)
+		return getDefaultTarget(cfg, giteaClient, giteaUser)
+	}
+
+	if org := topicOrganization(repo, cfg); org != "" {
+		// Then the organization of the first mapped topic
+		if target, ok := ruleTargets[org]; ok {
+			return target
+		}
+		log.Printf("No Gitea organization found for the topics of %s, using default target", repo.Name)
+		return getDefaultTarget(cfg, giteaClient, giteaUser)
+	}
 
-	// For starred repositories, use the starred repos organization if configured
 	if repo.Starred && cfg.Gitea.StarredReposOrg != "" {
+		// For starred repositories, use the starred repos organization if configured
 		starredOrg, err := giteaClient.GetOrganization(cfg.Gitea.StarredReposOrg)
 		if err == nil {
 			log.Printf("Using organization \"%s\" for starred repository: %s", cfg.Gitea.StarredReposOrg, repo.Name)
-			giteaTarget = starredOrg
-		} else {
-			log.Printf("Could not find organization \"%s\" for starred repositories, using default target", cfg.Gitea.StarredReposOrg)
-			giteaTarget = getDefaultTarget(cfg, giteaClient, giteaUser)
+			return starredOrg
+		}
+		log.Printf("Could not find organization \"%s\" for starred repositories, using default target", cfg.Gitea.StarredReposOrg)
+		return getDefaultTarget(cfg, giteaClient, giteaUser)
+	}
+
+	if repo.Watched && cfg.Gitea.WatchedReposOrg != "" {
+		// For watched repositories, use the watched repos organization if configured
+		watchedOrg, err := giteaClient.GetOrganization(cfg.Gitea.WatchedReposOrg)
+		if err == nil {
+			log.Printf("Using organization \"%s\" for watched repository: %s", cfg.Gitea.WatchedReposOrg, repo.Name)
+			return watchedOrg
 		}
-	} else if cfg.GitHub.PreserveOrgStructure && repo.Organization != "" {
+		log.Printf("Could not find organization \"%s\" for watched repositories, using default target", cfg.Gitea.WatchedReposOrg)
+		return getDefaultTarget(cfg, giteaClient, giteaUser)
+	}
+
+	if cfg.GitHub.PreserveOrgStructure && repo.Organization != "" {
 		// Use the organization as target
 		if target, ok := orgTargets[repo.Organization]; ok {
-			giteaTarget = target
-		} else {
-			log.Printf("No Gitea organization found for %s, using default target", repo.Organization)
-			giteaTarget = getDefaultTarget(cfg, giteaClient, giteaUser)
+			return target
 		}
-	} else {
-		// Use the specified organization or user
-		giteaTarget = getDefaultTarget(cfg, giteaClient, giteaUser)
+		log.Printf("No Gitea organization found for %s, using default target", repo.Organization)
+		return getDefaultTarget(cfg, giteaClient, giteaUser)
 	}
 
+	// Use the specified organization or user
+	return getDefaultTarget(cfg, giteaClient, giteaUser)
+}
+
+func mirrorRepository(
+	ctx context.Context,
+	repo *repository.Repository,
+	rule *config.Rule,
+	giteaTarget *gitea.Target,
+	cfg *config.Config,
+	giteaClient *gitea.Client,
+	ghClient *github.Client,
+	stars *gitea.StarBatch,
+	store *state.Store,
+	mirrors map[string]gitea.RepoLink,
+	syncExisting bool,
+) error {
 	// Check if already mirrored
-	isAlreadyMirrored, err := giteaClient.IsRepositoryMirrored(repo.Name, giteaTarget)
+	isAlreadyMirrored, err := giteaClient.IsRepositoryMirrored(repo.GiteaName(), giteaTarget)
 	if err != nil {
 		return err
 	}
 
+	// Gitea doesn't sync repositories pushed by the clone fallback, so push again
+	fallback := false
+	if isAlreadyMirrored && (cfg.Gitea.CloneFallback || cfg.Gitea.DefaultBranchOnly) {
+		mirror, _ := store.Mirror(repo.FullName)
+		fallback = mirror.Fallback
+	}
+
+	// A migration that failed midway leaves an empty repository that looks mirrored
+	if isAlreadyMirrored && cfg.Gitea.RepairPartialMigrations && !fallback {
+		partial, err := cleanupPartialMigration(repo, giteaTarget, cfg, giteaClient)
+		if err != nil {
+			return err
+		}
+		isAlreadyMirrored = !partial
+	}
+
+	if fallback {
+		repo.SetExtension(cloneFallbackExtension, true)
+		if err := pushFallback(ctx, repo, giteaTarget, cfg, giteaClient); err != nil {
+			return err
+		}
+	} else if isAlreadyMirrored && syncExisting {
+		if err := giteaClient.SyncMirror(repo, giteaTarget, cfg.DryRun); err != nil {
+			return err
+		}
+		if !cfg.DryRun {
+			events.Emit(events.RepoSynced, events.Fields{"repository": repo.FullName, "mirror": giteaTarget.Name + "/" + repo.GiteaName()})
+		}
+	}
+
+	if isAlreadyMirrored && cfg.Gitea.UpdateMirrorCredentials && repo.Private && !fallback {
+		if err := updateMirrorCredentials(ctx, repo, rule, giteaTarget, cfg, giteaClient, ghClient, store, mirrors); err != nil {
+			return err
+		}
+	}
+
+	if isAlreadyMirrored && cfg.Gitea.RepairBrokenMirrors && !fallback {
+		remigrated, err := repairMirror(ctx, repo, rule, giteaTarget, cfg, giteaClient, ghClient, store, mirrors)
+		if err != nil {
+			return err
+		}
+		// The replacement lacks everything set up after the migration
+		if remigrated {
+			setupMirror(ctx, repo, rule, giteaTarget, cfg, giteaClient, ghClient, stars, store, mirrors)
+			return nil
+		}
+	}
+
+	if isAlreadyMirrored && cfg.Gitea.VerifyContent != "" {
+		if err := verifyContent(ctx, repo, giteaTarget, fallback, cfg, giteaClient, ghClient); err != nil {
+			return err
+		}
+	}
+
 	// Special handling for starred repositories
 	if repo.Starred {
 		if isAlreadyMirrored {
 			log.Printf("Repository %s is already mirrored in %s %s; checking if it needs to be starred.", repo.Name, giteaTarget.Type, giteaTarget.Name)
-			return giteaClient.StarRepository(repo.Name, giteaTarget, cfg.DryRun)
+			syncReleaseArchives(ctx, repo, cfg, giteaClient, ghClient, giteaTarget)
+			stars.Add(giteaTarget, repo.GiteaName())
+			mirrorIssues(ctx, repo, rule, giteaTarget, cfg, giteaClient, ghClient, store, mirrors)
+			return nil
 		}
 		if cfg.DryRun {
 			log.Printf("DRY RUN: Would mirror and star repository to %s %s: %s (starred)", giteaTarget.Type, giteaTarget.Name, repo.Name)
 			return nil
 		}
+	} else if isAlreadyMirrored && cfg.GitHub.ReleaseArchives {
+		log.Printf("Repository %s is already mirrored in %s %s; syncing release archives.", repo.Name, giteaTarget.Type, giteaTarget.Name)
+		syncReleaseArchives(ctx, repo, cfg, giteaClient, ghClient, giteaTarget)
+		mirrorIssues(ctx, repo, rule, giteaTarget, cfg, giteaClient, ghClient, store, mirrors)
+		return nil
+	} else if isAlreadyMirrored && cfg.GitHub.MirrorIssues {
+		log.Printf("Repository %s is already mirrored in %s %s; syncing issues.", repo.Name, giteaTarget.Type, giteaTarget.Name)
+		mirrorIssues(ctx, repo, rule, giteaTarget, cfg, giteaClient, ghClient, store, mirrors)
+		return nil
 	} else if isAlreadyMirrored {
 		log.Printf("Repository %s is already mirrored in %s %s; doing nothing.", repo.Name, giteaTarget.Type, giteaTarget.Name)
 		return nil
@@ -214,29 +962,395 @@ func mirrorRepository(
 	}())
 
 	// Mirror the repository
-	if err := giteaClient.MirrorRepository(repo, giteaTarget, cfg.GitHub.Token); err != nil {
-		return err
+	mirrorOpts := mirrorOptions(ctx, repo, rule, cfg, ghClient, mirrors)
+	if cfg.Gitea.DefaultBranchOnly {
+		// Pull mirrors fetch every branch, so leaving branches out takes a push
+		if err := giteaClient.CreateRepository(repo, giteaTarget, mirrorOpts); err != nil {
+			return err
+		}
+		repo.SetExtension(cloneFallbackExtension, true)
+		if err := pushFallback(ctx, repo, giteaTarget, cfg, giteaClient); err != nil {
+			return err
+		}
+	} else {
+		err = giteaClient.MirrorRepository(repo, giteaTarget, cfg.GitHub.Token, mirrorOpts)
+	}
+	// Empty source repositories never get any content, so there is nothing to wait for
+	if err == nil && !cfg.Gitea.DefaultBranchOnly && cfg.Gitea.WaitForMigration && repo.Stats.Size > 0 {
+		err = giteaClient.WaitForMigration(repo, giteaTarget, time.Duration(cfg.Gitea.MigrationWaitSeconds)*time.Second)
+	}
+	if err != nil {
+		if !cfg.Gitea.CloneFallback {
+			return err
+		}
+		log.Printf("Migration of %s failed, falling back to clone and push: %v", repo.Name, err)
+		if err := giteaClient.CreateRepository(repo, giteaTarget, mirrorOpts); err != nil {
+			return fmt.Errorf("clone fallback failed: %w", err)
+		}
+		repo.SetExtension(cloneFallbackExtension, true)
+		if err := pushFallback(ctx, repo, giteaTarget, cfg, giteaClient); err != nil {
+			return err
+		}
 	}
+	events.Emit(events.RepoMirrored, events.Fields{"repository": repo.FullName, "mirror": giteaTarget.Name + "/" + repo.GiteaName(), "fallback": repo.Extensions[cloneFallbackExtension] == true})
 
+	setupMirror(ctx, repo, rule, giteaTarget, cfg, giteaClient, ghClient, stars, store, mirrors)
+	return nil
+}
+
+// setupMirror sets up a new mirror after its migration: it is starred, gets
+// the deploy keys, units, avatar, release archives, webhooks and rulesets,
+// and its issues are mirrored.
+func setupMirror(
+	ctx context.Context,
+	repo *repository.Repository,
+	rule *config.Rule,
+	giteaTarget *gitea.Target,
+	cfg *config.Config,
+	giteaClient *gitea.Client,
+	ghClient *github.Client,
+	stars *gitea.StarBatch,
+	store *state.Store,
+	mirrors map[string]gitea.RepoLink,
+) {
 	// Star the repository if it's marked as starred
 	if repo.Starred {
-		if err := giteaClient.StarRepository(repo.Name, giteaTarget, cfg.DryRun); err != nil {
-			log.Printf("Warning: Failed to star repository %s: %v", repo.Name, err)
+		stars.Add(giteaTarget, repo.GiteaName())
+	}
+
+	giteaClient.AddDeployKeys(repo, giteaTarget, cfg.Gitea.DeployKeys, cfg.DryRun)
+
+	if cfg.Gitea.RepoUnits != nil {
+		if err := giteaClient.SetRepoUnits(repo, giteaTarget, repoUnits(repo, rule, cfg), cfg.DryRun); err != nil {
+			log.Printf("Warning: Failed to disable the units of %s: %v", repo.Name, err)
+		}
+	}
+
+	mirrorAvatar(ctx, repo, cfg, giteaClient, ghClient, giteaTarget)
+
+	syncReleaseArchives(ctx, repo, cfg, giteaClient, ghClient, giteaTarget)
+
+	if err := giteaClient.MirrorWebhooks(ctx, ghClient, repo, giteaTarget, webhookOptions(cfg)); err != nil {
+		log.Printf("Warning: Failed to mirror webhooks for %s: %v", repo.Name, err)
+	}
+
+	if cfg.GitHub.MirrorRulesets {
+		if err := giteaClient.MirrorRulesets(ctx, ghClient, repo, giteaTarget, cfg.DryRun); err != nil {
+			log.Printf("Warning: Failed to mirror rulesets for %s: %v", repo.Name, err)
 		}
 	}
 
-	// Mirror issues if requested
-	shouldMirrorIssues := cfg.GitHub.MirrorIssues && !(repo.Starred && cfg.GitHub.SkipStarredIssues)
+	mirrorIssues(ctx, repo, rule, giteaTarget, cfg, giteaClient, ghClient, store, mirrors)
+}
+
+// mirrorLinks locates the mirrors of the repositories of the run and of all
+// repositories the state recorded a mirror of, so runs of only some
+// repositories, e.g. for a webhook, a queue worker or with LIMIT, still
+// know the mirrors of the others.
+func mirrorLinks(store *state.Store, repos []*repository.Repository, targets map[*repository.Repository]*gitea.Target) map[string]gitea.RepoLink {
+	recorded := store.Mirrors()
+	links := make(map[string]gitea.RepoLink, len(recorded)+len(repos))
+	for fullName, mirror := range recorded {
+		links[strings.ToLower(fullName)] = gitea.RepoLink{Owner: mirror.Owner, Name: mirror.Name}
+	}
+	for _, repo := range repos {
+		links[strings.ToLower(repo.FullName)] = gitea.RepoLink{Owner: targets[repo].Name, Name: repo.GiteaName()}
+	}
+	return links
+}
 
-	if shouldMirrorIssues && !cfg.DryRun {
-		if err := giteaClient.MirrorIssues(ctx, ghClient, repo, giteaTarget, cfg.GitHub.Token, cfg.DryRun); err != nil {
+// mirrorOptions returns how a new mirror of the repository is created.
+func mirrorOptions(ctx context.Context, repo *repository.Repository, rule *config.Rule, cfg *config.Config, ghClient *github.Client, mirrors map[string]gitea.RepoLink) gitea.MirrorOptions {
+	mirrorOpts := gitea.MirrorOptions{
+		Private: mirrorPrivate(repo, cfg),
+		LFS:     cfg.GitHub.MirrorLFS,
+		Native:  cfg.GitHub.NativeMigration,
+		Service: cfg.Source.Type,
+		Issues:  shouldMirrorIssues(repo, rule, cfg),
+		Items:   cfg.GitHub.NativeItems,
+	}
+	if settings := organizationSettings(repo, cfg); settings != nil && settings.Private != nil {
+		mirrorOpts.Private = *settings.Private
+	}
+	if rule != nil {
+		if rule.Private != nil {
+			mirrorOpts.Private = *rule.Private
+		}
+		mirrorOpts.MirrorInterval = rule.MirrorInterval
+	}
+	if repo.Fork {
+		if parent := forkParent(ctx, repo, cfg, ghClient); parent != "" {
+			mirrorOpts.Description, mirrorOpts.Website = forkUpstream(parent, mirrors, cfg.Gitea.URL, sourceURL(cfg))
+		}
+	}
+	// Every repository has its own LFS endpoint, so the setting is rendered for each
+	if cfg.GitHub.MirrorLFS && cfg.GitHub.LFSEndpoint != nil {
+		endpoint, err := renderName(cfg.GitHub.LFSEndpoint, repo)
+		if err != nil {
+			log.Printf("Warning: Failed to render LFS_ENDPOINT for %s, using the endpoint of the clone URL: %v", repo.FullName, err)
+		} else {
+			mirrorOpts.LFSEndpoint = endpoint
+		}
+	}
+	return mirrorOpts
+}
+
+// mirrorPrivate returns whether the mirror of a repository is private:
+// STARRED_VISIBILITY decides for starred repositories, VISIBILITY_OVERRIDE
+// for all others, both copying the GitHub visibility if set to source.
+func mirrorPrivate(repo *repository.Repository, cfg *config.Config) bool {
+	visibility := cfg.Gitea.VisibilityOverride
+	if repo.Starred && cfg.Gitea.StarredVisibility != "source" {
+		visibility = cfg.Gitea.StarredVisibility
+	}
+	switch visibility {
+	case "private":
+		return true
+	case "public":
+		return false
+	}
+	return repo.Private
+}
+
+// updateVisibility gives the existing mirror of a repository the visibility
+// a new mirror of it would get, after the repository changed its visibility.
+func updateVisibility(
+	ctx context.Context,
+	repo *repository.Repository,
+	rule *config.Rule,
+	giteaTarget *gitea.Target,
+	cfg *config.Config,
+	giteaClient *gitea.Client,
+	ghClient *github.Client,
+	mirrors map[string]gitea.RepoLink,
+) error {
+	visibility := "public"
+	private := mirrorOptions(ctx, repo, rule, cfg, ghClient, mirrors).Private
+	if private {
+		visibility = "private"
+	}
+	if cfg.DryRun {
+		log.Printf("DRY RUN: Would make mirror %s/%s %s", giteaTarget.Name, repo.GiteaName(), visibility)
+		return nil
+	}
+	if err := giteaClient.SetRepositoryPrivate(giteaTarget, repo.GiteaName(), private); err != nil {
+		return err
+	}
+	log.Printf("Made mirror %s/%s %s", giteaTarget.Name, repo.GiteaName(), visibility)
+	return nil
+}
+
+// repoUnits returns the units a new mirror keeps. Mirrored issues, and pull
+// requests imported by the native migration, need theirs.
+func repoUnits(repo *repository.Repository, rule *config.Rule, cfg *config.Config) []string {
+	units := slices.Clone(cfg.Gitea.RepoUnits)
+	if shouldMirrorIssues(repo, rule, cfg) {
+		units = append(units, "issues")
+		if cfg.GitHub.NativeMigration && (cfg.GitHub.NativeItems == nil || slices.Contains(cfg.GitHub.NativeItems, "pull-requests")) {
+			units = append(units, "pulls")
+		}
+	}
+	return units
+}
+
+func shouldMirrorIssues(repo *repository.Repository, rule *config.Rule, cfg *config.Config) bool {
+	skipRuleIssues := rule != nil && rule.SkipIssues
+	return cfg.GitHub.MirrorIssues && !(repo.Starred && cfg.GitHub.SkipStarredIssues) && !skipRuleIssues
+}
+
+// mirrorIssues mirrors the issues of a repository if requested. Only issues
+// updated since the last successful sync are fetched again.
+func mirrorIssues(
+	ctx context.Context,
+	repo *repository.Repository,
+	rule *config.Rule,
+	giteaTarget *gitea.Target,
+	cfg *config.Config,
+	giteaClient *gitea.Client,
+	ghClient *github.Client,
+	store *state.Store,
+	mirrors map[string]gitea.RepoLink,
+) {
+	skipRuleIssues := rule != nil && rule.SkipIssues
+
+	if shouldMirrorIssues(repo, rule, cfg) && !cfg.DryRun {
+		issueOpts := gitea.IssueOptions{
+			GitHubToken:       cfg.GitHub.Token,
+			RehostAttachments: cfg.GitHub.RehostAttachments,
+			UserMap:           cfg.UserMap,
+			Mirrors:           mirrors,
+			Since:             store.IssuesSyncedAt(repo.FullName),
+			Timestamps:        cfg.GitHub.PreserveTimestamps && !cfg.DryRun && giteaClient.IsAdmin(),
+			DryRun:            cfg.DryRun,
+		}
+		startedAt := time.Now()
+		if err := giteaClient.MirrorIssues(ctx, ghClient, repo, giteaTarget, issueOpts); err != nil {
 			log.Printf("Warning: Failed to mirror issues for %s: %v", repo.Name, err)
+			return
 		}
+		store.SetIssuesSyncedAt(repo.FullName, startedAt)
+	} else if cfg.GitHub.MirrorIssues && skipRuleIssues {
+		log.Printf("Skipping issues for repository %s as configured by rule %q", repo.Name, rule.Match)
 	} else if repo.Starred && cfg.GitHub.SkipStarredIssues {
 		log.Printf("Skipping issues for starred repository: %s", repo.Name)
 	}
+}
 
-	return nil
+// cloneFallbackExtension marks repositories pushed instead of mirrored, by
+// the clone fallback or DEFAULT_BRANCH_ONLY.
+const cloneFallbackExtension = "cloneFallback"
+
+// pushFallback updates a repository pushed instead of mirrored.
+func pushFallback(ctx context.Context, repo *repository.Repository, giteaTarget *gitea.Target, cfg *config.Config, giteaClient *gitea.Client) error {
+	if cfg.DryRun {
+		log.Printf("DRY RUN: Would push %s to %s %s", repo.Name, giteaTarget.Type, giteaTarget.Name)
+		return nil
+	}
+	// Without a default branch the repository is empty and there is nothing to leave out
+	var refspecs []string
+	if cfg.Gitea.DefaultBranchOnly && repo.DefaultBranch != "" {
+		refspecs = gitcmd.BranchRefspecs(repo.DefaultBranch, !cfg.Gitea.SkipTags)
+	}
+	return giteaClient.PushMirror(ctx, repo, giteaTarget, cfg.Gitea.CloneCacheDir, cfg.GitHub.Token, refspecs)
+}
+
+// backupExtension holds the last push included in the backup uploaded by
+// backupRepository, for recordMirror.
+const backupExtension = "backedUp"
+
+// backupRepository uploads a git bundle of the repository to S3, unless it
+// wasn't pushed to since its last backup. It reports whether it uploaded one.
+func backupRepository(ctx context.Context, repo *repository.Repository, cfg *config.Config, backups *backup.S3, store *state.Store) (bool, error) {
+	if mirror, ok := store.Mirror(repo.FullName); ok && !repo.Stats.PushedAt.IsZero() && mirror.BackedUp.Equal(repo.Stats.PushedAt) {
+		return false, nil
+	}
+
+	dir, err := os.MkdirTemp("", "backup-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(dir)
+
+	bundlePath := filepath.Join(dir, repo.Name+".bundle")
+	if err := bundle.Create(ctx, repo.URL, gitcmd.GitHubAuthorization(cfg.GitHub.Token), bundlePath); err != nil {
+		return false, err
+	}
+	if err := backups.Backup(ctx, strings.ToLower(repo.FullName), bundlePath); err != nil {
+		return false, err
+	}
+	repo.SetExtension(backupExtension, repo.Stats.PushedAt)
+	return true, nil
+}
+
+// mirrorAvatar sets the social preview image of the GitHub repository as
+// avatar of the new mirror.
+func mirrorAvatar(ctx context.Context, repo *repository.Repository, cfg *config.Config, giteaClient *gitea.Client, ghClient *github.Client, giteaTarget *gitea.Target) {
+	if !cfg.GitHub.MirrorAvatars {
+		return
+	}
+
+	// GraphQL discovery already fetched the image along with the repository
+	imageURL := repo.SocialImageURL
+	if imageURL == "" && cfg.GitHub.Discovery == "rest" {
+		var err error
+		imageURL, err = ghrepo.SocialImage(ctx, ghClient, repo.Owner, repo.Name)
+		if err != nil {
+			log.Printf("Warning: Failed to fetch social preview image of %s: %v", repo.FullName, err)
+			return
+		}
+	}
+	if imageURL == "" {
+		return
+	}
+
+	if err := giteaClient.SetRepositoryAvatar(repo, giteaTarget, imageURL); err != nil {
+		log.Printf("Warning: Failed to set avatar of %s: %v", repo.Name, err)
+	}
+}
+
+func syncReleaseArchives(ctx context.Context, repo *repository.Repository, cfg *config.Config, giteaClient *gitea.Client, ghClient *github.Client, giteaTarget *gitea.Target) {
+	if !cfg.GitHub.ReleaseArchives {
+		return
+	}
+
+	if err := giteaClient.MirrorReleaseArchives(ctx, ghClient, repo, giteaTarget, cfg.DryRun); err != nil {
+		log.Printf("Warning: Failed to mirror release archives for %s: %v", repo.Name, err)
+	}
+}
+
+// mirrorAccess replicates the teams and collaborators of the preserved
+// organizations onto their Gitea counterparts.
+func mirrorAccess(
+	ctx context.Context,
+	repos []*repository.Repository,
+	repoTargets map[*repository.Repository]*gitea.Target,
+	orgTargets map[string]*gitea.Target,
+	cfg *config.Config,
+	giteaClient *gitea.Client,
+	ghClient *github.Client,
+) {
+	opts := gitea.AccessOptions{UserMap: cfg.UserMap, DryRun: cfg.DryRun}
+
+	repoNames := make(map[string]map[string]string)
+	for _, repo := range repos {
+		orgTarget, ok := orgTargets[repo.Organization]
+		if !ok || repoTargets[repo] != orgTarget {
+			continue
+		}
+		if repoNames[repo.Organization] == nil {
+			repoNames[repo.Organization] = make(map[string]string)
+		}
+		repoNames[repo.Organization][repo.Name] = repo.GiteaName()
+
+		if err := giteaClient.MirrorCollaborators(ctx, ghClient, repo, orgTarget, opts); err != nil {
+			log.Printf("Warning: Failed to mirror collaborators for %s: %v", repo.Name, err)
+		}
+	}
+
+	for orgName, orgTarget := range orgTargets {
+		if err := giteaClient.MirrorTeams(ctx, ghClient, orgName, orgTarget, repoNames[orgName], opts); err != nil {
+			log.Printf("Warning: Failed to mirror teams of organization %s: %v", orgName, err)
+		}
+	}
+}
+
+// registerSecrets masks the secrets of the configuration in all output.
+func registerSecrets(cfg *config.Config) {
+	redact.Add(cfg.GitHub.Tokens...)
+	redact.Add(cfg.GitHub.Token, cfg.GitHub.WebhookSecret, cfg.Gitea.Token, cfg.Gitea.WebhookSecret, cfg.AlertWebhookURL, cfg.HealthcheckPingURL, cfg.APIToken)
+	if cfg.Backup != nil {
+		redact.Add(cfg.Backup.AccessKey, cfg.Backup.SecretKey)
+	}
+	// Redis URLs often carry only a password, which URL masking misses
+	for _, location := range []string{cfg.LeaderLock, cfg.Queue} {
+		if u, err := url.Parse(location); err == nil && u.User != nil {
+			if password, ok := u.User.Password(); ok {
+				redact.Add(password)
+			}
+		}
+	}
+}
+
+func secretFunc(ctx context.Context, provider secrets.Provider, name string) func() (string, error) {
+	return func() (string, error) {
+		return provider.Secret(ctx, name)
+	}
+}
+
+func webhookOptions(cfg *config.Config) gitea.WebhookOptions {
+	opts := gitea.WebhookOptions{
+		CopyFromGitHub: cfg.GitHub.MirrorWebhooks,
+		DryRun:         cfg.DryRun,
+	}
+	if cfg.Gitea.WebhookURL != "" {
+		opts.Extra = append(opts.Extra, gitea.Webhook{
+			URL:         cfg.Gitea.WebhookURL,
+			ContentType: cfg.Gitea.WebhookContentType,
+			Events:      cfg.Gitea.WebhookEvents,
+			Secret:      cfg.Gitea.WebhookSecret,
+		})
+	}
+	return opts
 }
 
 func getDefaultTarget(cfg *config.Config, giteaClient *gitea.Client, giteaUser *gitea.Target) *gitea.Target {
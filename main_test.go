@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/audit"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/redact"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestMirrorPrivate(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		starred  string
+		repo     repository.Repository
+		private  bool
+	}{
+		{"copies the source", "source", "source", repository.Repository{Private: true}, true},
+		{"forces private", "private", "source", repository.Repository{}, true},
+		{"forces public", "public", "source", repository.Repository{Private: true}, false},
+		{"starred follows the override by default", "private", "source", repository.Repository{Starred: true}, true},
+		{"starred visibility wins", "private", "public", repository.Repository{Starred: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Gitea: config.GiteaConfig{VisibilityOverride: tt.override, StarredVisibility: tt.starred}}
+			if private := mirrorPrivate(&tt.repo, cfg); private != tt.private {
+				t.Errorf("expected private %v, got %v", tt.private, private)
+			}
+		})
+	}
+}
+
+func TestDetectServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		routes  map[string]string
+		flavor  gitea.Flavor
+		version string
+	}{
+		{"gitea", map[string]string{"/api/v1/version": `{"version":"1.22.1"}`}, gitea.FlavorGitea, "1.22.1"},
+		{"forgejo", map[string]string{"/api/v1/version": `{"version":"7.0.5+gitea-1.21.11"}`, "/api/forgejo/v1/version": `{"version":"7.0.5"}`}, gitea.FlavorForgejo, "7.0.5+gitea-1.21.11"},
+		{"gogs", map[string]string{}, gitea.FlavorGogs, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, ok := tt.routes[r.URL.Path]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write([]byte(body))
+			}))
+			defer server.Close()
+
+			giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			detected, err := giteaClient.DetectServer()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if detected.Flavor != tt.flavor || detected.Version != tt.version {
+				t.Errorf("expected %s %s, got %s", tt.flavor, tt.version, detected)
+			}
+		})
+	}
+}
+
+func TestMirrorToGogs(t *testing.T) {
+	var migrate, org map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/v1/repos/migrate":
+			json.NewDecoder(r.Body).Decode(&migrate)
+			w.WriteHeader(http.StatusCreated)
+		case "POST /api/v1/user/orgs":
+			json.NewDecoder(r.Body).Decode(&org)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := giteaClient.DetectServer(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := giteaClient.CreateOrganization("mirrors", "private", nil, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := org["visibility"]; ok || org["username"] != "mirrors" {
+		t.Errorf("unexpected organization request: %v", org)
+	}
+
+	repo := &repository.Repository{Name: "demo", FullName: "octo/demo", URL: "https://github.com/octo/demo.git"}
+	opts := gitea.MirrorOptions{MirrorInterval: "8h", LFS: true, Native: true}
+	if err := giteaClient.MirrorRepository(repo, &gitea.Target{ID: 1, Name: "me", Type: "user"}, "secret", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if migrate["auth_password"] != "secret" || migrate["auth_token"] != nil {
+		t.Errorf("expected the token as basic auth password, got %v", migrate)
+	}
+	for _, field := range []string{"mirror_interval", "lfs", "service", "wiki"} {
+		if _, ok := migrate[field]; ok {
+			t.Errorf("expected %s to be dropped, got %v", field, migrate)
+		}
+	}
+}
+
+func TestFetchGiteaRepositories(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/users/alice/repos":
+			w.Write([]byte(`[
+				{"id": 1, "name": "dotfiles", "full_name": "alice/dotfiles", "owner": {"login": "alice"}, "clone_url": "https://codeberg.example/alice/dotfiles.git"},
+				{"id": 2, "name": "fork", "full_name": "alice/fork", "owner": {"login": "alice"}, "clone_url": "https://codeberg.example/alice/fork.git", "fork": true, "parent": {"full_name": "bob/tool"}}
+			]`))
+		case "/api/v1/users/alice/starred":
+			w.Write([]byte(`[
+				{"id": 1, "name": "dotfiles", "full_name": "alice/dotfiles", "owner": {"login": "alice"}, "clone_url": "https://codeberg.example/alice/dotfiles.git"},
+				{"id": 3, "name": "lib", "full_name": "bob/lib", "owner": {"login": "bob"}, "clone_url": "https://codeberg.example/bob/lib.git"}
+			]`))
+		case "/api/v1/users/alice/orgs":
+			w.Write([]byte(`[{"id": 9, "username": "team"}]`))
+		case "/api/v1/orgs/team/repos":
+			w.Write([]byte(`[{"id": 4, "name": "site", "full_name": "team/site", "owner": {"login": "team"}, "clone_url": "https://codeberg.example/team/site.git"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Source:  config.SourceConfig{Type: "gitea", URL: server.URL},
+		GitHub:  config.GitHubConfig{Username: "alice", MirrorStarred: true, MirrorOrganizations: true, PreserveOrgStructure: true},
+		Gitea:   config.GiteaConfig{TimeoutSeconds: 5},
+		Include: []string{"**"},
+		SortBy:  "name",
+	}
+	repos, err := fetchRepositories(context.Background(), nil, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, repo := range repos {
+		names = append(names, repo.FullName)
+	}
+	if want := []string{"alice/dotfiles", "alice/fork", "bob/lib", "team/site"}; !slices.Equal(names, want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+	if repos[1].Provenance.Parent != "bob/tool" || repos[1].Provenance.Provider != "gitea" {
+		t.Errorf("unexpected provenance: %+v", repos[1].Provenance)
+	}
+	if !repos[2].Starred || repos[3].Organization != "team" {
+		t.Errorf("expected starred and organization repositories to be marked, got %+v and %+v", repos[2], repos[3])
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/v1/repos/migrate":
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5, AuditLog: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := giteaClient.GetOrganization("mirrors"); err == nil {
+		t.Fatal("expected missing organization")
+	}
+	repo := &repository.Repository{Name: "demo", FullName: "octo/demo", URL: "https://github.com/octo/demo.git"}
+	if err := giteaClient.MirrorRepository(repo, &gitea.Target{ID: 1, Name: "me", Type: "user"}, "secret", gitea.MirrorOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("expected the token to be left out, got %s", data)
+	}
+	var entry audit.Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("expected a single entry, got %s: %v", data, err)
+	}
+	if entry.Method != "POST" || entry.Target != "/api/v1/repos/migrate" || entry.Status != http.StatusCreated || entry.Payload["repo_name"] != "demo" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestRegisterSecrets(t *testing.T) {
+	defer redact.Reset()
+	registerSecrets(&config.Config{
+		GitHub: config.GitHubConfig{Token: "ghp_first", Tokens: []string{"ghp_first", "ghp_second"}},
+		Gitea:  config.GiteaConfig{Token: "gitea-token"},
+		Backup: &config.BackupConfig{SecretKey: "s3-secret"},
+	})
+
+	got := redact.String("tokens ghp_first, ghp_second, gitea-token and s3-secret")
+	if want := "tokens [REDACTED], [REDACTED], [REDACTED] and [REDACTED]"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSetRepoUnits(t *testing.T) {
+	var changes map[string]bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" || r.URL.Path != "/api/v1/repos/me/demo" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&changes)
+	}))
+	defer server.Close()
+
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &repository.Repository{Name: "demo", HasIssues: true}
+	cfg := &config.Config{
+		GitHub: config.GitHubConfig{MirrorIssues: true},
+		Gitea:  config.GiteaConfig{RepoUnits: []string{"code", "releases"}},
+	}
+	units := repoUnits(repo, nil, cfg)
+	if !slices.Equal(units, []string{"code", "releases", "issues"}) {
+		t.Fatalf("expected mirrored issues to keep their unit, got %v", units)
+	}
+
+	if err := giteaClient.SetRepoUnits(repo, &gitea.Target{Name: "me", Type: "user"}, units, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]bool{"has_issues": true, "has_releases": true, "has_wiki": false, "has_pull_requests": false, "has_projects": false, "has_packages": false, "has_actions": false}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %v, got %v", want, changes)
+	}
+	for field, enabled := range want {
+		if changes[field] != enabled {
+			t.Errorf("expected %s to be %v, got %v", field, enabled, changes[field])
+		}
+	}
+}
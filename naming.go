@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func renderName(tmpl *template.Template, repo *repository.Repository) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, repo); err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSpace(buf.String())
+	if name == "" {
+		return "", fmt.Errorf("template produced an empty name")
+	}
+	return name, nil
+}
+
+// giteaOrganization returns the Gitea organization the GitHub organization
+// org is mirrored to with PRESERVE_ORG_STRUCTURE: its entry in ORG_MAPPING,
+// else ORG_NAME_TEMPLATE rendered for it, else the same name.
+func giteaOrganization(org string, cfg *config.Config) string {
+	if name, ok := cfg.Gitea.OrgMapping[org]; ok {
+		return name
+	}
+	if cfg.Gitea.OrgName == nil {
+		return org
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.Gitea.OrgName.Execute(&buf, struct{ Org string }{org}); err != nil {
+		log.Printf("Error rendering name for organization %s, keeping original name: %v", org, err)
+		return org
+	}
+	name := strings.TrimSpace(buf.String())
+	if name == "" {
+		log.Printf("Error rendering name for organization %s, keeping original name: template produced an empty name", org)
+		return org
+	}
+	return name
+}
+
+// mirrorClaim tells whether a name in the target of a repository is taken
+// on Gitea, and if so whether by the mirror of that repository.
+type mirrorClaim func(target *gitea.Target, repo *repository.Repository, name string) (taken, ours bool)
+
+// existingMirrors looks up repositories on Gitea, listing each target once. A
+// repository is the mirror of a GitHub repository if it was migrated from it,
+// or if the state recorded it as its mirror, as for pushed mirrors.
+func existingMirrors(giteaClient *gitea.Client, store *state.Store) mirrorClaim {
+	listed := make(map[string]map[string]string)
+	return func(target *gitea.Target, repo *repository.Repository, name string) (bool, bool) {
+		urls, ok := listed[strings.ToLower(target.Name)]
+		if !ok {
+			infos, err := giteaClient.ListRepositories(target)
+			if err != nil {
+				// Without the list every name counts as free, as before
+				log.Printf("Warning: Failed to list the repositories of %s to resolve name collisions: %v", target.Name, err)
+			}
+			urls = make(map[string]string, len(infos))
+			for _, info := range infos {
+				urls[strings.ToLower(info.Name)] = info.OriginalURL
+			}
+			listed[strings.ToLower(target.Name)] = urls
+		}
+
+		originalURL, taken := urls[strings.ToLower(name)]
+		if !taken {
+			return false, false
+		}
+		mirror, recorded := store.Mirror(repo.FullName)
+		ours := sameRemote(originalURL, repo.URL) || (recorded && strings.EqualFold(mirror.Owner, target.Name) && strings.EqualFold(mirror.Name, name))
+		return true, ours
+	}
+}
+
+// sameRemote reports whether a mirror migrated from originalURL mirrors the
+// repository with the clone URL cloneURL.
+func sameRemote(originalURL, cloneURL string) bool {
+	normalize := func(u string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(u), "/"), ".git")
+	}
+	return originalURL != "" && normalize(originalURL) == normalize(cloneURL)
+}
+
+// resolveCollisions renames or drops repositories that would be mirrored under
+// the same name into the same Gitea owner, whether as another repository of
+// the run or as a repository already on Gitea that isn't their mirror. A
+// name stays with the repository it already mirrors, else goes to the first
+// by full name, so it doesn't depend on the order repositories are discovered
+// in, nor on which of them a run includes. Without claim, only the
+// repositories of the run are compared.
+func resolveCollisions(repos []*repository.Repository, targets map[*repository.Repository]*gitea.Target, strategy string, claim mirrorClaim) []*repository.Repository {
+	key := func(target *gitea.Target, name string) string {
+		// Gitea repository names are case-insensitive
+		return strings.ToLower(target.Name + "/" + name)
+	}
+	if claim == nil {
+		claim = func(*gitea.Target, *repository.Repository, string) (bool, bool) { return false, false }
+	}
+	ours := func(repo *repository.Repository, name string) bool {
+		_, ours := claim(targets[repo], repo, name)
+		return ours
+	}
+	foreign := func(repo *repository.Repository, name string) bool {
+		taken, ours := claim(targets[repo], repo, name)
+		return taken && !ours
+	}
+	byFullName := func(a, b *repository.Repository) int {
+		return strings.Compare(strings.ToLower(a.FullName), strings.ToLower(b.FullName))
+	}
+
+	// Every name goes to one of the repositories wanting it before the others are renamed
+	groups := make(map[string][]*repository.Repository)
+	for _, repo := range repos {
+		groups[key(targets[repo], repo.GiteaName())] = append(groups[key(targets[repo], repo.GiteaName())], repo)
+	}
+	taken := make(map[string]*repository.Repository)
+	kept := make(map[*repository.Repository]bool)
+	var colliding []*repository.Repository
+	for name, group := range groups {
+		if len(group) > 1 {
+			slices.SortFunc(group, func(a, b *repository.Repository) int {
+				if oursA, oursB := ours(a, a.GiteaName()), ours(b, b.GiteaName()); oursA != oursB {
+					if oursA {
+						return -1
+					}
+					return 1
+				}
+				return byFullName(a, b)
+			})
+		}
+		if foreign(group[0], group[0].GiteaName()) {
+			colliding = append(colliding, group...)
+			continue
+		}
+		taken[name] = group[0]
+		kept[group[0]] = true
+		colliding = append(colliding, group[1:]...)
+	}
+	slices.SortFunc(colliding, byFullName)
+
+	for _, repo := range colliding {
+		target := targets[repo]
+		owner := "another repository"
+		if first := taken[key(target, repo.GiteaName())]; first != nil {
+			owner = first.FullName
+		}
+		if strategy == "error" {
+			log.Printf("Error: repository %s would be mirrored as %s/%s, which is already used by %s; skipping", repo.FullName, target.Name, repo.GiteaName(), owner)
+			continue
+		}
+
+		base := repo.GiteaName()
+		candidate := fmt.Sprintf("%s-%d", base, 2)
+		if strategy == "prefix" {
+			candidate = repo.Owner + "-" + base
+		}
+		for n := 2; taken[key(target, candidate)] != nil || foreign(repo, candidate); n++ {
+			if strategy == "prefix" {
+				candidate = fmt.Sprintf("%s-%s-%d", repo.Owner, base, n)
+			} else {
+				candidate = fmt.Sprintf("%s-%d", base, n+1)
+			}
+		}
+
+		log.Printf("Repository %s collides with %s in %s %s; mirroring it as %s", repo.FullName, owner, target.Type, target.Name, candidate)
+		repo.MirrorName = candidate
+		taken[key(target, candidate)] = repo
+		kept[repo] = true
+	}
+
+	// The repositories are still processed in the configured order
+	var result []*repository.Repository
+	for _, repo := range repos {
+		if kept[repo] {
+			result = append(result, repo)
+		}
+	}
+	return result
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func TestGiteaOrganization(t *testing.T) {
+	cfg := &config.Config{Gitea: config.GiteaConfig{
+		OrgMapping: map[string]string{"acme": "acme-mirror"},
+		OrgName:    template.Must(template.New("name").Parse("gh-{{.Org}}")),
+	}}
+
+	if name := giteaOrganization("acme", cfg); name != "acme-mirror" {
+		t.Errorf("expected the mapping to win, got %s", name)
+	}
+	if name := giteaOrganization("other", cfg); name != "gh-other" {
+		t.Errorf("expected 'gh-other', got %s", name)
+	}
+	if name := giteaOrganization("other", &config.Config{}); name != "other" {
+		t.Errorf("expected the GitHub name, got %s", name)
+	}
+}
+
+func TestRenderName(t *testing.T) {
+	repo := &repository.Repository{Name: "dotfiles", Owner: "me", FullName: "me/dotfiles"}
+
+	t.Run("renders repository fields", func(t *testing.T) {
+		name, err := renderName(template.Must(template.New("name").Parse("{{.Owner}}-{{.Name}}")), repo)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if name != "me-dotfiles" {
+			t.Errorf("expected 'me-dotfiles', got %s", name)
+		}
+	})
+
+	t.Run("rejects empty names", func(t *testing.T) {
+		_, err := renderName(template.Must(template.New("name").Parse("{{if false}}x{{end}}")), repo)
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestMirrorOptionsLFSEndpoint(t *testing.T) {
+	cfg := &config.Config{GitHub: config.GitHubConfig{MirrorLFS: true}}
+	repo := &repository.Repository{Name: "demo", Owner: "octo", FullName: "octo/demo"}
+	if opts := mirrorOptions(context.Background(), repo, nil, cfg, nil, nil); opts.LFSEndpoint != "" {
+		t.Errorf("expected Gitea to derive the endpoint, got %q", opts.LFSEndpoint)
+	}
+
+	cfg.GitHub.LFSEndpoint = template.Must(template.New("name").Parse("https://lfs.example.com/{{.FullName}}.git/info/lfs"))
+	if opts := mirrorOptions(context.Background(), repo, nil, cfg, nil, nil); opts.LFSEndpoint != "https://lfs.example.com/octo/demo.git/info/lfs" {
+		t.Errorf("expected the endpoint of the repository, got %q", opts.LFSEndpoint)
+	}
+}
+
+func TestResolveCollisions(t *testing.T) {
+	user := &gitea.Target{Name: "me", Type: "user"}
+	org := &gitea.Target{Name: "archive", Type: "organization"}
+
+	setup := func() ([]*repository.Repository, map[*repository.Repository]*gitea.Target) {
+		repos := []*repository.Repository{
+			{Name: "infra", Owner: "org1", FullName: "org1/infra"},
+			{Name: "Infra", Owner: "org2", FullName: "org2/Infra"},
+			{Name: "infra", Owner: "org3", FullName: "org3/infra"},
+			{Name: "infra", Owner: "org4", FullName: "org4/infra"},
+		}
+		targets := map[*repository.Repository]*gitea.Target{
+			repos[0]: user,
+			repos[1]: user,
+			repos[2]: user,
+			repos[3]: org,
+		}
+		return repos, targets
+	}
+
+	giteaNames := func(repos []*repository.Repository) []string {
+		result := make([]string, 0, len(repos))
+		for _, repo := range repos {
+			result = append(result, repo.GiteaName())
+		}
+		return result
+	}
+
+	assertNames := func(t *testing.T, actual []string, expected ...string) {
+		t.Helper()
+		if len(actual) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+		for i := range expected {
+			if actual[i] != expected[i] {
+				t.Fatalf("expected %v, got %v", expected, actual)
+			}
+		}
+	}
+
+	t.Run("prefixes colliding repositories with their owner", func(t *testing.T) {
+		repos, targets := setup()
+
+		assertNames(t, giteaNames(resolveCollisions(repos, targets, "prefix", nil)), "infra", "org2-Infra", "org3-infra", "infra")
+	})
+
+	t.Run("suffixes colliding repositories with a number", func(t *testing.T) {
+		repos, targets := setup()
+
+		assertNames(t, giteaNames(resolveCollisions(repos, targets, "suffix", nil)), "infra", "Infra-2", "infra-3", "infra")
+	})
+
+	t.Run("skips colliding repositories on error strategy", func(t *testing.T) {
+		repos, targets := setup()
+
+		result := resolveCollisions(repos, targets, "error", nil)
+		if len(result) != 2 || result[0].FullName != "org1/infra" || result[1].FullName != "org4/infra" {
+			t.Fatalf("expected org1/infra and org4/infra, got %v", giteaNames(result))
+		}
+	})
+
+	t.Run("doesn't depend on the order of the repositories", func(t *testing.T) {
+		repos, targets := setup()
+		slices.Reverse(repos)
+
+		assertNames(t, giteaNames(resolveCollisions(repos, targets, "suffix", nil)), "infra", "infra-3", "Infra-2", "infra")
+	})
+
+	t.Run("leaves names with the repositories their mirrors were migrated from", func(t *testing.T) {
+		repos, targets := setup()
+		for _, repo := range repos {
+			repo.URL = "https://github.com/" + repo.FullName + ".git"
+		}
+		existing := func(target *gitea.Target, repo *repository.Repository, name string) (bool, bool) {
+			switch strings.ToLower(target.Name + "/" + name) {
+			case "me/infra":
+				return true, sameRemote("https://github.com/org3/infra", repo.URL)
+			case "me/infra-2":
+				return true, false
+			}
+			return false, false
+		}
+
+		assertNames(t, giteaNames(resolveCollisions(repos, targets, "suffix", existing)), "infra-3", "Infra-4", "infra", "infra")
+	})
+
+	t.Run("keeps runs of a single repository off the mirrors of others", func(t *testing.T) {
+		repos, targets := setup()
+		existing := func(target *gitea.Target, repo *repository.Repository, name string) (bool, bool) {
+			switch strings.ToLower(target.Name + "/" + name) {
+			case "me/infra":
+				return true, repo.FullName == "org1/infra"
+			case "me/org2-infra":
+				return true, repo.FullName == "org2/Infra"
+			}
+			return false, false
+		}
+
+		assertNames(t, giteaNames(resolveCollisions(repos[:1], targets, "prefix", existing)), "infra")
+		assertNames(t, giteaNames(resolveCollisions(repos[1:2], targets, "prefix", existing)), "org2-Infra")
+		assertNames(t, giteaNames(resolveCollisions(repos[2:3], targets, "prefix", existing)), "org3-infra")
+	})
+}
+
+func TestMirrorLinks(t *testing.T) {
+	store, _ := state.Open("")
+	store.RecordMirror("octo/other", &state.Mirror{Owner: "archive", Name: "other"})
+	store.RecordMirror("octo/Demo", &state.Mirror{Owner: "me", Name: "demo"})
+
+	repo := &repository.Repository{Name: "Demo", FullName: "octo/Demo", MirrorName: "octo-Demo"}
+	links := mirrorLinks(store, []*repository.Repository{repo}, map[*repository.Repository]*gitea.Target{repo: {Name: "team"}})
+
+	if link := links["octo/other"]; link.Owner != "archive" || link.Name != "other" {
+		t.Errorf("expected the recorded mirror of octo/other, got %+v", link)
+	}
+	if link := links["octo/demo"]; link.Owner != "team" || link.Name != "octo-Demo" {
+		t.Errorf("expected the mirror of the run to win, got %+v", link)
+	}
+}
+
+func TestSameRemote(t *testing.T) {
+	tests := []struct {
+		originalURL string
+		cloneURL    string
+		same        bool
+	}{
+		{"https://github.com/octo/demo.git", "https://github.com/octo/demo.git", true},
+		{"https://github.com/Octo/Demo", "https://github.com/octo/demo.git", true},
+		{"https://github.com/octo/demo/", "https://github.com/octo/demo.git", true},
+		{"https://github.com/octo/other.git", "https://github.com/octo/demo.git", false},
+		{"", "https://github.com/octo/demo.git", false},
+	}
+	for _, tt := range tests {
+		if same := sameRemote(tt.originalURL, tt.cloneURL); same != tt.same {
+			t.Errorf("sameRemote(%q, %q): expected %v, got %v", tt.originalURL, tt.cloneURL, tt.same, same)
+		}
+	}
+}
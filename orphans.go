@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// orphanedMirror is a mirror whose GitHub repository was deleted.
+type orphanedMirror struct {
+	target *gitea.Target
+	name   string
+	// source is the full name of the deleted GitHub repository
+	source string
+}
+
+// findOrphans returns the mirrors of the targets that aren't wanted by the
+// run and whose GitHub repository no longer exists. wanted holds the
+// lower-cased Gitea full names of the selected repositories. Mirrors of
+// repositories that are merely filtered out are never orphans, so a filter
+// mistake doesn't retire anything.
+func findOrphans(ctx context.Context, ghClient *github.Client, giteaClient *gitea.Client, targets []*gitea.Target, wanted map[string]bool, cfg *config.Config) []orphanedMirror {
+	var orphans []orphanedMirror
+	for _, target := range targets {
+		infos, err := giteaClient.ListRepositories(target)
+		if err != nil {
+			log.Printf("Warning: Failed to list the repositories of %s for orphans: %v", target.Name, err)
+			continue
+		}
+		for _, info := range infos {
+			if !info.Mirror || wanted[strings.ToLower(target.Name+"/"+info.Name)] {
+				continue
+			}
+			owner, name, ok := githubUpstream(info.OriginalURL)
+			if !ok {
+				continue
+			}
+			exists, err := ghrepo.RepositoryExists(ctx, ghClient, owner, name)
+			if err != nil {
+				log.Printf("Warning: Failed to look up %s/%s on GitHub, keeping %s/%s: %v", owner, name, target.Name, info.Name, err)
+				continue
+			}
+			if !exists && !protectedMirror(target.Name, info.Name, info.Topics, "retiring", cfg) {
+				orphans = append(orphans, orphanedMirror{target: target, name: info.Name, source: owner + "/" + name})
+			}
+		}
+	}
+	return orphans
+}
+
+// cleanupOrphans retires the orphaned mirrors among the targets of the run
+// and deletes the orphans whose retention passed.
+func cleanupOrphans(ctx context.Context, repoTargets map[*repository.Repository]*gitea.Target, cfg *config.Config, giteaClient *gitea.Client, ghClient *github.Client, store *state.Store, plan *runPlan, confirmation *confirmation) {
+	wanted := make(map[string]bool, len(repoTargets))
+	seen := make(map[string]bool)
+	var targets []*gitea.Target
+	for repo, target := range repoTargets {
+		wanted[strings.ToLower(target.Name+"/"+repo.GiteaName())] = true
+		if !seen[strings.ToLower(target.Name)] {
+			seen[strings.ToLower(target.Name)] = true
+			targets = append(targets, target)
+		}
+	}
+
+	now := time.Now()
+	orphans := findOrphans(ctx, ghClient, giteaClient, targets, wanted, cfg)
+	if len(orphans) > 0 && (orphanAction(cfg) != planMoveToAttic || prepareAttic(cfg, giteaClient, plan)) {
+		retireOrphans(orphans, cfg, giteaClient, store, plan, confirmation, now)
+	}
+	deleteExpiredOrphans(cfg, giteaClient, store, plan, confirmation, now)
+}
+
+// prepareAttic creates the attic organization if it doesn't exist yet. It
+// is private, as mirrors of deleted repositories shouldn't stay public.
+func prepareAttic(cfg *config.Config, giteaClient *gitea.Client, plan *runPlan) bool {
+	attic := cfg.Gitea.AtticOrganization
+	if _, err := giteaClient.GetOrganization(attic); err == nil {
+		return true
+	}
+	if !plan.allowsOrganization(attic) {
+		log.Printf("Warning: The attic organization %s isn't part of the plan, keeping the orphaned mirrors", attic)
+		return false
+	}
+	if err := giteaClient.CreateOrganization(attic, "private", nil, cfg.DryRun); err != nil {
+		log.Printf("Warning: Failed to create the attic organization %s, keeping the orphaned mirrors: %v", attic, err)
+		return false
+	}
+	return true
+}
+
+// orphanAction is the plan action retiring an orphan with the configured
+// cleanup.
+func orphanAction(cfg *config.Config) string {
+	if cfg.Gitea.OrphanCleanup == "attic" {
+		return planMoveToAttic
+	}
+	return planArchive
+}
+
+// retireOrphans archives the orphans in place or moves them to the attic
+// organization, recording them for deletion once their retention passed.
+func retireOrphans(orphans []orphanedMirror, cfg *config.Config, giteaClient *gitea.Client, store *state.Store, plan *runPlan, confirmation *confirmation, now time.Time) {
+	attic := cfg.Gitea.AtticOrganization
+	action := orphanAction(cfg)
+	for _, orphan := range orphans {
+		fullName := orphan.target.Name + "/" + orphan.name
+		if !plan.allowsCleanup(action, orphan.target.Name, orphan.name) {
+			continue
+		}
+		question := fmt.Sprintf("Archive %s, as %s no longer exists on GitHub?", fullName, orphan.source)
+		if action == planMoveToAttic {
+			question = fmt.Sprintf("Move %s to %s, as %s no longer exists on GitHub?", fullName, attic, orphan.source)
+		}
+		if !confirmation.confirm(question) {
+			continue
+		}
+
+		if action == planMoveToAttic {
+			if cfg.DryRun {
+				log.Printf("DRY RUN: Would move %s to %s, %s no longer exists on GitHub", fullName, attic, orphan.source)
+				continue
+			}
+			if err := giteaClient.TransferRepository(orphan.target, orphan.name, attic); err != nil {
+				log.Printf("Warning: Failed to move orphaned mirror %s to %s: %v", fullName, attic, err)
+				continue
+			}
+			store.RecordOrphan(&state.Orphan{Owner: attic, Name: orphan.name, Source: orphan.source, RetiredAt: now})
+			continue
+		}
+
+		if cfg.DryRun {
+			log.Printf("DRY RUN: Would archive %s, %s no longer exists on GitHub", fullName, orphan.source)
+			continue
+		}
+		if err := giteaClient.ArchiveRepository(orphan.target, orphan.name); err != nil {
+			log.Printf("Warning: Failed to archive orphaned mirror %s: %v", fullName, err)
+			continue
+		}
+		store.RecordOrphan(&state.Orphan{Owner: orphan.target.Name, Name: orphan.name, Source: orphan.source, RetiredAt: now, Archived: true})
+	}
+}
+
+// expiredOrphans returns the retired orphans kept longer than the
+// retention by Gitea full name. A retention of 0 keeps them forever.
+func expiredOrphans(store *state.Store, retentionDays int, now time.Time) map[string]state.Orphan {
+	expired := make(map[string]state.Orphan)
+	if retentionDays == 0 {
+		return expired
+	}
+	retention := time.Duration(retentionDays) * 24 * time.Hour
+	for fullName, orphan := range store.Orphans() {
+		if now.Sub(orphan.RetiredAt) >= retention {
+			expired[fullName] = orphan
+		}
+	}
+	return expired
+}
+
+// deleteExpiredOrphans deletes the orphans whose retention passed. Orphans
+// moved out of the attic or unarchived in the meantime were restored and are
+// forgotten instead.
+func deleteExpiredOrphans(cfg *config.Config, giteaClient *gitea.Client, store *state.Store, plan *runPlan, confirmation *confirmation, now time.Time) {
+	for fullName, orphan := range expiredOrphans(store, cfg.Gitea.OrphanRetentionDays, now) {
+		status, err := giteaClient.GetMirrorStatus(orphan.Owner, orphan.Name)
+		if err != nil {
+			log.Printf("Warning: Failed to get the status of orphaned mirror %s: %v", fullName, err)
+			continue
+		}
+		if status == nil || orphan.Archived && !status.Archived {
+			log.Printf("Orphaned mirror %s was restored, no longer deleting it", fullName)
+			store.RemoveOrphan(fullName)
+			continue
+		}
+		if protectedMirror(orphan.Owner, orphan.Name, status.Topics, "deleting", cfg) {
+			continue
+		}
+
+		if !plan.allowsCleanup(planDelete, orphan.Owner, orphan.Name) {
+			continue
+		}
+		retired := orphan.RetiredAt.Format(time.DateOnly)
+		if !confirmation.confirm(fmt.Sprintf("Delete %s, retired on %s?", fullName, retired)) {
+			continue
+		}
+		if cfg.DryRun {
+			log.Printf("DRY RUN: Would delete orphaned mirror %s, retired on %s", fullName, retired)
+			continue
+		}
+		if err := giteaClient.DeleteRepository(&gitea.Target{Name: orphan.Owner}, orphan.Name); err != nil {
+			log.Printf("Warning: Failed to delete orphaned mirror %s: %v", fullName, err)
+			continue
+		}
+		store.RemoveOrphan(fullName)
+		log.Printf("Deleted orphaned mirror %s of %s, retired on %s", fullName, orphan.Source, retired)
+	}
+}
+
+// retireDeleted retires the mirror of a repository a webhook reported as
+// deleted, as the cleanup of a full run would, once GitHub confirms it no
+// longer exists.
+func retireDeleted(ctx context.Context, fullName string, cfg *config.Config, giteaClient *gitea.Client, ghClient *github.Client, store *state.Store) {
+	if cfg.Gitea.OrphanCleanup == "" {
+		log.Printf("%s was deleted on GitHub, keeping its mirror as ORPHAN_CLEANUP isn't set", fullName)
+		return
+	}
+	mirror, ok := store.Mirror(fullName)
+	if !ok {
+		log.Printf("%s was deleted on GitHub, but no mirror of it is recorded", fullName)
+		return
+	}
+
+	owner, name, _ := strings.Cut(fullName, "/")
+	exists, err := ghrepo.RepositoryExists(ctx, ghClient, owner, name)
+	if err != nil {
+		log.Printf("Warning: Failed to look up %s on GitHub, keeping %s/%s: %v", fullName, mirror.Owner, mirror.Name, err)
+		return
+	}
+	if exists {
+		return
+	}
+	status, err := giteaClient.GetMirrorStatus(mirror.Owner, mirror.Name)
+	if err != nil || status == nil || !status.Mirror {
+		log.Printf("No mirror %s/%s of deleted %s found to retire: %v", mirror.Owner, mirror.Name, fullName, err)
+		return
+	}
+	if protectedMirror(mirror.Owner, mirror.Name, status.Topics, "retiring", cfg) {
+		return
+	}
+
+	if orphanAction(cfg) == planMoveToAttic && !prepareAttic(cfg, giteaClient, nil) {
+		return
+	}
+	orphan := orphanedMirror{target: &gitea.Target{Name: mirror.Owner}, name: mirror.Name, source: fullName}
+	retireOrphans([]orphanedMirror{orphan}, cfg, giteaClient, store, nil, nil, time.Now())
+}
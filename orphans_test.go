@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func TestCleanupOrphans(t *testing.T) {
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/octo/filtered" {
+			w.Write([]byte(`{"name":"filtered","full_name":"octo/filtered"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer githubServer.Close()
+
+	var requests []string
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/users/me/repos":
+			w.Write([]byte(`[
+				{"name":"demo","mirror":true,"original_url":"https://github.com/octo/demo.git"},
+				{"name":"gone","mirror":true,"original_url":"https://github.com/octo/gone.git"},
+				{"name":"filtered","mirror":true,"original_url":"https://github.com/octo/filtered.git"},
+				{"name":"kept","mirror":true,"original_url":"https://github.com/octo/kept.git","topics":["keep"]},
+				{"name":"own","mirror":false}
+			]`))
+		case "GET /api/v1/orgs/attic":
+			w.Write([]byte(`{"id":5,"username":"attic"}`))
+		case "POST /api/v1/repos/me/gone/transfer":
+			w.WriteHeader(http.StatusAccepted)
+		case "GET /api/v1/repos/attic/old":
+			w.Write([]byte(`{"mirror":true}`))
+		case "DELETE /api/v1/repos/attic/old":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	cfg := &config.Config{Gitea: config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5, OrphanCleanup: "attic", AtticOrganization: "attic", OrphanRetentionDays: 30, ProtectTopic: "keep"}}
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghClient, err := ghrepo.NewClient("", ghrepo.ClientOptions{APIURL: githubServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, _ := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	retired := time.Now().Add(-40 * 24 * time.Hour)
+	store.RecordOrphan(&state.Orphan{Owner: "attic", Name: "old", Source: "octo/old", RetiredAt: retired})
+	store.RecordOrphan(&state.Orphan{Owner: "attic", Name: "restored", Source: "octo/restored", RetiredAt: retired})
+	store.RecordOrphan(&state.Orphan{Owner: "attic", Name: "recent", Source: "octo/recent", RetiredAt: time.Now().Add(-24 * time.Hour)})
+
+	repoTargets := map[*repository.Repository]*gitea.Target{
+		{Name: "demo", FullName: "octo/demo"}: {ID: 1, Name: "me", Type: "user"},
+	}
+	cleanupOrphans(context.Background(), repoTargets, cfg, giteaClient, ghClient, store, nil, nil)
+
+	if !slices.Contains(requests, "POST /api/v1/repos/me/gone/transfer") {
+		t.Errorf("expected the orphan to be moved to the attic, got %v", requests)
+	}
+	if slices.Contains(requests, "POST /api/v1/repos/me/filtered/transfer") {
+		t.Error("expected a mirror of an existing repository to be kept")
+	}
+	if slices.Contains(requests, "POST /api/v1/repos/me/kept/transfer") {
+		t.Error("expected a protected mirror to be kept")
+	}
+	if !slices.Contains(requests, "DELETE /api/v1/repos/attic/old") {
+		t.Errorf("expected the expired orphan to be deleted, got %v", requests)
+	}
+
+	var remaining []string
+	for fullName := range store.Orphans() {
+		remaining = append(remaining, fullName)
+	}
+	slices.Sort(remaining)
+	if want := []string{"attic/gone", "attic/recent"}; !slices.Equal(remaining, want) {
+		t.Errorf("expected orphans %v, got %v", want, remaining)
+	}
+}
+
+func TestRetireDeleted(t *testing.T) {
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer githubServer.Close()
+
+	var requests []string
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/repos/me/gone":
+			w.Write([]byte(`{"mirror":true}`))
+		case "PATCH /api/v1/repos/me/gone":
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	cfg := &config.Config{Gitea: config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5, OrphanCleanup: "archive"}}
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghClient, err := ghrepo.NewClient("", ghrepo.ClientOptions{APIURL: githubServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, _ := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	store.RecordMirror("octo/gone", &state.Mirror{Owner: "me", Name: "gone"})
+
+	retireDeleted(context.Background(), "octo/gone", cfg, giteaClient, ghClient, store)
+	if !slices.Contains(requests, "PATCH /api/v1/repos/me/gone") {
+		t.Errorf("expected the mirror to be archived, got %v", requests)
+	}
+	if orphan, ok := store.Orphans()["me/gone"]; !ok || !orphan.Archived || orphan.Source != "octo/gone" {
+		t.Errorf("expected the mirror to be recorded as an archived orphan, got %v", store.Orphans())
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// planVersion is the format of the plan files written.
+const planVersion = 1
+
+// The actions of a plan.
+const (
+	// planCreateOrganization creates the Gitea organization Owner
+	planCreateOrganization = "create-organization"
+	// planCreate migrates a new mirror
+	planCreate = "create"
+	// planUpdate syncs the settings of an existing mirror
+	planUpdate = "update"
+	// planRecreate deletes a broken mirror and migrates it again
+	planRecreate = "recreate"
+	// planArchive archives an orphaned mirror in place
+	planArchive = "archive"
+	// planMoveToAttic moves an orphaned mirror to the attic organization
+	planMoveToAttic = "move-to-attic"
+	// planDelete deletes an orphan whose retention passed
+	planDelete = "delete"
+)
+
+// plannedAction is a change a run would make on Gitea.
+type plannedAction struct {
+	Action string `json:"action"`
+	// Repository is the full name of the source repository, empty for
+	// organizations and orphans
+	Repository string `json:"repository,omitempty"`
+	Owner      string `json:"owner"`
+	Name       string `json:"name,omitempty"`
+}
+
+// runPlan lists the changes of a run for review before applying them.
+type runPlan struct {
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"createdAt"`
+	GiteaURL  string          `json:"giteaUrl"`
+	Actions   []plannedAction `json:"actions"`
+}
+
+// runPlanCommand writes the plan of the next run to path and prints it.
+func runPlanCommand(ctx context.Context, cfg *config.Config, path string, out io.Writer) error {
+	if path == "" {
+		return fmt.Errorf("missing plan file, usage: plan <file>")
+	}
+	plan, err := buildPlan(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tSOURCE\tGITEA")
+	for _, action := range plan.Actions {
+		counts[action.Action]++
+		source, target := action.Repository, action.Owner
+		if source == "" {
+			source = "-"
+		}
+		if action.Name != "" {
+			target += "/" + action.Name
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", action.Action, source, target)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Plan: %d to create, %d to update, %d to recreate, %d organizations to create, %d orphans to retire, %d to delete. Written to %s, run apply %s to carry it out.\n",
+		counts[planCreate], counts[planUpdate], counts[planRecreate], counts[planCreateOrganization], counts[planArchive]+counts[planMoveToAttic], counts[planDelete], path, path)
+	return nil
+}
+
+// buildPlan works out what a run would change on Gitea without changing
+// anything, following the routing of the run.
+func buildPlan(ctx context.Context, cfg *config.Config) (*runPlan, error) {
+	ghClient, err := ghrepo.NewClient(cfg.GitHub.Token, ghrepo.ClientOptions{APIURL: cfg.GitHub.APIURL, Proxy: cfg.GitHub.Proxy})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gitea client: %w", err)
+	}
+	giteaUser, err := giteaClient.GetUser()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Gitea user: %w", err)
+	}
+
+	repos, err := fetchRepositories(ctx, ghClient, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &runPlan{Version: planVersion, CreatedAt: time.Now().UTC(), GiteaURL: cfg.Gitea.URL}
+	targets := make(map[string]*gitea.Target)
+	for _, repo := range repos {
+		rule := findRule(cfg.Rules, repo)
+		applyMirrorName(repo, rule, cfg)
+		owner := targetName(repo, rule, cfg, giteaUser.Name)
+
+		target, ok := targets[strings.ToLower(owner)]
+		if !ok {
+			target = giteaUser
+			if !strings.EqualFold(owner, giteaUser.Name) {
+				if target, err = giteaClient.GetOrganization(owner); err != nil {
+					target = nil
+					plan.Actions = append(plan.Actions, plannedAction{Action: planCreateOrganization, Owner: owner})
+				}
+			}
+			targets[strings.ToLower(owner)] = target
+		}
+
+		action := plannedAction{Action: planCreate, Repository: repo.FullName, Owner: owner, Name: repo.GiteaName()}
+		if target != nil {
+			exists, err := giteaClient.IsRepositoryMirrored(repo.GiteaName(), target)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				action.Action = planUpdate
+				if (cfg.Gitea.RepairBrokenMirrors || cfg.Gitea.RepairPartialMigrations) && plannedRepair(giteaClient, repo, owner, cfg) {
+					action.Action = planRecreate
+				}
+			}
+		}
+		plan.Actions = append(plan.Actions, action)
+	}
+
+	if cfg.Gitea.OrphanCleanup != "" {
+		if err := planOrphans(ctx, plan, ghClient, giteaClient, targets, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// planOrphans adds the retirement of orphaned mirrors and the deletion of
+// expired ones to the plan.
+func planOrphans(ctx context.Context, plan *runPlan, ghClient *github.Client, giteaClient *gitea.Client, targets map[string]*gitea.Target, cfg *config.Config) error {
+	wanted := make(map[string]bool)
+	for _, action := range plan.Actions {
+		if action.Repository != "" {
+			wanted[strings.ToLower(action.Owner+"/"+action.Name)] = true
+		}
+	}
+	var existing []*gitea.Target
+	for _, target := range targets {
+		if target != nil {
+			existing = append(existing, target)
+		}
+	}
+
+	orphans := findOrphans(ctx, ghClient, giteaClient, existing, wanted, cfg)
+	action := orphanAction(cfg)
+	if action == planMoveToAttic && len(orphans) > 0 {
+		if _, err := giteaClient.GetOrganization(cfg.Gitea.AtticOrganization); err != nil {
+			plan.Actions = append(plan.Actions, plannedAction{Action: planCreateOrganization, Owner: cfg.Gitea.AtticOrganization})
+		}
+	}
+	for _, orphan := range orphans {
+		plan.Actions = append(plan.Actions, plannedAction{Action: action, Owner: orphan.target.Name, Name: orphan.name})
+	}
+
+	store, err := state.Open(cfg.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to open state: %w", err)
+	}
+	for _, orphan := range expiredOrphans(store, cfg.Gitea.OrphanRetentionDays, time.Now()) {
+		plan.Actions = append(plan.Actions, plannedAction{Action: planDelete, Owner: orphan.Owner, Name: orphan.Name})
+	}
+	return nil
+}
+
+// plannedRepair reports whether the run would re-migrate a broken mirror or
+// one left behind by a failed migration.
+func plannedRepair(giteaClient *gitea.Client, repo *repository.Repository, owner string, cfg *config.Config) bool {
+	status, err := giteaClient.GetMirrorStatus(owner, repo.GiteaName())
+	if err != nil {
+		log.Printf("Warning: Failed to get the mirror status of %s/%s: %v", owner, repo.GiteaName(), err)
+		return false
+	}
+	if status == nil || protectedMirror(owner, repo.GiteaName(), status.Topics, "re-migrating", cfg) {
+		return false
+	}
+	now := time.Now()
+	return cfg.Gitea.RepairBrokenMirrors && brokenMirror(status, repo.Stats.PushedAt, now) ||
+		cfg.Gitea.RepairPartialMigrations && partialMigration(status, repo, now)
+}
+
+// readPlan loads a plan written by the plan command.
+func readPlan(path string) (*runPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan runPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("plan %s has version %d, expected %d", path, plan.Version, planVersion)
+	}
+	return &plan, nil
+}
+
+// runApply carries out a plan with a run restricted to the planned
+// repositories.
+func runApply(ctx context.Context, cfg *config.Config, path string) error {
+	if path == "" {
+		return fmt.Errorf("missing plan file, usage: apply <file>")
+	}
+	plan, err := readPlan(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(strings.TrimSuffix(plan.GiteaURL, "/"), strings.TrimSuffix(cfg.Gitea.URL, "/")) {
+		return fmt.Errorf("plan %s was made for %s, not %s", path, plan.GiteaURL, cfg.Gitea.URL)
+	}
+
+	// A shutdown lets the repository in progress finish
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("Applying the plan of %s with %d actions", plan.CreatedAt.Format(time.RFC1123), len(plan.Actions))
+	return run(ctx, cfg, runOptions{plan: plan})
+}
+
+// allowsOrganization reports whether the run may create the organization.
+// Without a plan it may create any.
+func (p *runPlan) allowsOrganization(name string) bool {
+	if p == nil {
+		return true
+	}
+	for _, action := range p.Actions {
+		if action.Action == planCreateOrganization && strings.EqualFold(action.Owner, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsCleanup reports whether the run may retire or delete the mirror
+// owner/name with action. Without a plan it may clean up any.
+func (p *runPlan) allowsCleanup(action, owner, name string) bool {
+	if p == nil {
+		return true
+	}
+	for _, planned := range p.Actions {
+		if planned.Action == action && planned.Repository == "" && strings.EqualFold(planned.Owner, owner) && strings.EqualFold(planned.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// repository returns the planned action of a repository.
+func (p *runPlan) repository(fullName string) (plannedAction, bool) {
+	for _, action := range p.Actions {
+		if action.Repository != "" && strings.EqualFold(action.Repository, fullName) {
+			return action, true
+		}
+	}
+	return plannedAction{}, false
+}
+
+// selectRepositories keeps the repositories the plan has actions for.
+func (p *runPlan) selectRepositories(repos []*repository.Repository) []*repository.Repository {
+	var selected []*repository.Repository
+	for _, repo := range repos {
+		if _, ok := p.repository(repo.FullName); ok {
+			selected = append(selected, repo)
+		}
+	}
+	if missing := p.repositoryCount() - len(selected); missing > 0 {
+		log.Printf("Warning: %d planned repositories are no longer selected, skipping them", missing)
+	}
+	return selected
+}
+
+func (p *runPlan) repositoryCount() int {
+	count := 0
+	for _, action := range p.Actions {
+		if action.Repository != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// approvedTargets drops the repositories whose mirror changed since the plan
+// was made, so apply never does what wasn't reviewed: another target, a
+// mirror that disappeared or one that broke.
+func (p *runPlan) approvedTargets(repos []*repository.Repository, targets map[*repository.Repository]*gitea.Target, giteaClient *gitea.Client) []*repository.Repository {
+	var approved []*repository.Repository
+	for _, repo := range repos {
+		action, _ := p.repository(repo.FullName)
+		target := targets[repo]
+		if !strings.EqualFold(action.Owner, target.Name) || !strings.EqualFold(action.Name, repo.GiteaName()) {
+			log.Printf("Warning: %s is now mirrored to %s/%s instead of the planned %s/%s, skipping it", repo.FullName, target.Name, repo.GiteaName(), action.Owner, action.Name)
+			continue
+		}
+		if action.Action != planCreate {
+			exists, err := giteaClient.IsRepositoryMirrored(repo.GiteaName(), target)
+			if err == nil && !exists {
+				log.Printf("Warning: The mirror of %s planned to %s no longer exists, skipping it", repo.FullName, action.Action)
+				continue
+			}
+		}
+		approved = append(approved, repo)
+	}
+	return approved
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestPlan(t *testing.T) {
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/octo/repos":
+			w.Write([]byte(`[
+				{"id":1,"name":"current","full_name":"octo/current","clone_url":"https://github.com/octo/current.git","owner":{"login":"octo"}},
+				{"id":2,"name":"new","full_name":"octo/new","clone_url":"https://github.com/octo/new.git","owner":{"login":"octo"}},
+				{"id":3,"name":"old","full_name":"octo/old","clone_url":"https://github.com/octo/old.git","owner":{"login":"octo"},"topics":["archived"]}
+			]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer githubServer.Close()
+
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/user":
+			w.Write([]byte(`{"id":1,"username":"mirror"}`))
+		case "/api/v1/users/mirror/repos":
+			w.Write([]byte(`[{"name":"current","mirror":true}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	cfg := &config.Config{
+		GitHub:  config.GitHubConfig{Username: "octo", APIURL: githubServer.URL},
+		Gitea:   config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5, TopicMapping: map[string]string{"archived": "attic"}},
+		Include: []string{"**"},
+		SortBy:  "name",
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	var out bytes.Buffer
+	if err := runPlanCommand(context.Background(), cfg, path, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	plan, err := readPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []plannedAction{
+		{Action: planUpdate, Repository: "octo/current", Owner: "mirror", Name: "current"},
+		{Action: planCreate, Repository: "octo/new", Owner: "mirror", Name: "new"},
+		{Action: planCreateOrganization, Owner: "attic"},
+		{Action: planCreate, Repository: "octo/old", Owner: "attic", Name: "old"},
+	}
+	if len(plan.Actions) != len(want) {
+		t.Fatalf("expected %v, got %v", want, plan.Actions)
+	}
+	for i := range want {
+		if plan.Actions[i] != want[i] {
+			t.Errorf("action %d: expected %+v, got %+v", i, want[i], plan.Actions[i])
+		}
+	}
+	if !plan.allowsOrganization("Attic") || plan.allowsOrganization("mirror") {
+		t.Error("expected only the planned organization to be allowed")
+	}
+}
+
+func TestPlanApprovedTargets(t *testing.T) {
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/users/mirror/repos" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[{"name":"current","mirror":true}]`))
+	}))
+	defer giteaServer.Close()
+
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := &runPlan{Actions: []plannedAction{
+		{Action: planUpdate, Repository: "octo/current", Owner: "mirror", Name: "current"},
+		{Action: planUpdate, Repository: "octo/gone", Owner: "mirror", Name: "gone"},
+		{Action: planCreate, Repository: "octo/moved", Owner: "mirror", Name: "moved"},
+	}}
+	user := &gitea.Target{ID: 1, Name: "mirror", Type: "user"}
+	current := &repository.Repository{Name: "current", FullName: "octo/current"}
+	gone := &repository.Repository{Name: "gone", FullName: "octo/gone"}
+	moved := &repository.Repository{Name: "moved", FullName: "octo/moved"}
+	unplanned := &repository.Repository{Name: "unplanned", FullName: "octo/unplanned"}
+
+	selected := plan.selectRepositories([]*repository.Repository{current, gone, moved, unplanned})
+	if len(selected) != 3 {
+		t.Fatalf("expected the 3 planned repositories, got %d", len(selected))
+	}
+
+	targets := map[*repository.Repository]*gitea.Target{
+		current: user,
+		gone:    user,
+		moved:   {ID: 2, Name: "elsewhere", Type: "organization"},
+	}
+	approved := plan.approvedTargets(selected, targets, giteaClient)
+	if len(approved) != 1 || approved[0] != current {
+		t.Errorf("expected only octo/current to be approved, got %v", approved)
+	}
+}
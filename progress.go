@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/events"
+)
+
+// progressBarWidth is the number of characters of the progress bar on a terminal.
+const progressBarWidth = 30
+
+// runProgress reports how far a run got at most every interval, with an
+// estimate of the remaining time from the pace so far.
+type runProgress struct {
+	total    int
+	done     int
+	failed   int
+	interval time.Duration
+	bar      bool
+
+	started  time.Time
+	reported time.Time
+}
+
+// newRunProgress tracks a run over total repositories. A zero interval
+// disables the reports.
+func newRunProgress(total int, interval time.Duration, now time.Time) *runProgress {
+	return &runProgress{
+		total:    total,
+		interval: interval,
+		bar:      isTerminal(os.Stderr),
+		started:  now,
+		reported: now,
+	}
+}
+
+// record counts a processed repository and reports the progress if the
+// interval passed since the last report.
+func (p *runProgress) record(err error, now time.Time) {
+	p.done++
+	if err != nil {
+		p.failed++
+	}
+	if p.interval <= 0 || now.Sub(p.reported) < p.interval || p.done == p.total {
+		return
+	}
+	p.reported = now
+
+	events.Emit(events.Progress, events.Fields{"done": p.done, "total": p.total, "failed": p.failed, "eta_seconds": int(p.eta(now).Seconds())})
+	if p.bar {
+		log.Printf("%s %s", p.progressBar(), p.line(now))
+	} else {
+		log.Printf("Progress: %s", p.line(now))
+	}
+}
+
+func (p *runProgress) line(now time.Time) string {
+	return fmt.Sprintf("repo %d/%d, %d failed, ETA %s", p.done, p.total, p.failed, formatETA(p.eta(now)))
+}
+
+// eta extrapolates the time the remaining repositories take.
+func (p *runProgress) eta(now time.Time) time.Duration {
+	if p.done == 0 {
+		return 0
+	}
+	return now.Sub(p.started) / time.Duration(p.done) * time.Duration(p.total-p.done)
+}
+
+func (p *runProgress) progressBar() string {
+	filled := progressBarWidth
+	if p.total > 0 {
+		filled = progressBarWidth * p.done / p.total
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled) + "]"
+}
+
+// formatETA rounds the estimate to minutes, or seconds below a minute.
+func formatETA(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	formatted := d.Round(time.Minute).String()
+	return strings.TrimSuffix(formatted, "0s")
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunProgress(t *testing.T) {
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	progress := newRunProgress(4, time.Minute, started)
+	progress.record(nil, started.Add(30*time.Second))
+	if !progress.reported.Equal(started) {
+		t.Error("expected no report before the interval passed")
+	}
+
+	progress.record(errors.New("migration failed"), started.Add(2*time.Minute))
+	if !progress.reported.Equal(started.Add(2 * time.Minute)) {
+		t.Error("expected a report after the interval passed")
+	}
+	if line := progress.line(started.Add(2 * time.Minute)); line != "repo 2/4, 1 failed, ETA 2m" {
+		t.Errorf("unexpected progress %q", line)
+	}
+	if bar := progress.progressBar(); bar != "[###############---------------]" {
+		t.Errorf("unexpected progress bar %q", bar)
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	tests := map[time.Duration]string{
+		42 * time.Second:                "42s",
+		24*time.Minute + 10*time.Second: "24m",
+		8*time.Hour + 5*time.Minute:     "8h5m",
+	}
+	for d, want := range tests {
+		if got := formatETA(d); got != want {
+			t.Errorf("expected %s for %s, got %s", want, d, got)
+		}
+	}
+}
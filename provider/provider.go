@@ -0,0 +1,124 @@
+// Package provider defines the interfaces between the forges repositories
+// are mirrored from and to, so forges can be added as packages registering
+// themselves instead of changes to the mirroring.
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// Source is a forge repositories are mirrored from.
+type Source interface {
+	// ListRepositories returns the repositories selected by the
+	// configuration, before INCLUDE and EXCLUDE are applied.
+	ListRepositories(ctx context.Context) ([]*repository.Repository, error)
+}
+
+// RepositorySource is a Source that looks up single repositories, so a run
+// for one repository doesn't list all of them.
+type RepositorySource interface {
+	Source
+	// GetRepository returns the repository fullName if the configuration
+	// selects it, nil otherwise, before INCLUDE and EXCLUDE are applied.
+	GetRepository(ctx context.Context, fullName string) (*repository.Repository, error)
+}
+
+// Owner is the user or organization mirrors are created for.
+type Owner struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"` // "user" or "organization"
+}
+
+// MirrorOptions carries per-repository settings for a new mirror.
+type MirrorOptions struct {
+	Private        bool
+	MirrorInterval string
+	// LFS fetches Git LFS objects, from LFSEndpoint if set or the clone URL otherwise
+	LFS         bool
+	LFSEndpoint string
+	// Description and Website are set on the new mirror if not empty
+	Description string
+	Website     string
+	// Native lets the migrator of the target for Service, github if empty,
+	// import labels, milestones, releases and the wiki, and issues and pull
+	// requests if Issues is set. Items limits the import to those listed.
+	Native  bool
+	Service string
+	Issues  bool
+	Items   []string
+}
+
+// Imports reports whether the native migration imports item.
+func (o MirrorOptions) Imports(item string) bool {
+	if o.Items != nil && !slices.Contains(o.Items, item) {
+		return false
+	}
+	if item == "issues" || item == "pull-requests" {
+		return o.Issues
+	}
+	return true
+}
+
+// Target is a forge repositories are mirrored to.
+type Target interface {
+	// GetUser returns the authenticated user
+	GetUser() (*Owner, error)
+	GetOrganization(name string) (*Owner, error)
+	// CreateOrganization creates the organization unless it exists
+	CreateOrganization(name, visibility string, profile *repository.OrganizationProfile, dryRun bool) error
+	IsRepositoryMirrored(name string, owner *Owner) (bool, error)
+	// MirrorRepository creates a pull mirror cloning with the source token
+	MirrorRepository(repo *repository.Repository, owner *Owner, sourceToken string, opts MirrorOptions) error
+	// SyncMirror fetches the mirror from its source right away
+	SyncMirror(repo *repository.Repository, owner *Owner, dryRun bool) error
+}
+
+// SourceFactory creates the source of a SOURCE_TYPE from the configuration.
+type SourceFactory func(cfg *config.Config) (Source, error)
+
+var (
+	mu      sync.RWMutex
+	sources = make(map[string]SourceFactory)
+)
+
+// RegisterSource makes a source available as SOURCE_TYPE name. It is meant
+// to be called from the init function of the package implementing it.
+func RegisterSource(name string, factory SourceFactory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := sources[name]; ok {
+		panic(fmt.Sprintf("provider: source %s registered twice", name))
+	}
+	sources[name] = factory
+}
+
+// NewSource creates the source registered for the SOURCE_TYPE of cfg.
+func NewSource(cfg *config.Config) (Source, error) {
+	mu.RLock()
+	factory, ok := sources[cfg.Source.Type]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source type %q, known are %v", cfg.Source.Type, Sources())
+	}
+	return factory(cfg)
+}
+
+// Sources returns the names of the registered sources.
+func Sources() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+type staticSource []*repository.Repository
+
+func (s staticSource) ListRepositories(ctx context.Context) ([]*repository.Repository, error) {
+	return s, nil
+}
+
+func TestNewSource(t *testing.T) {
+	RegisterSource("static", func(cfg *config.Config) (Source, error) {
+		return staticSource{{FullName: cfg.GitHub.Username + "/demo"}}, nil
+	})
+
+	t.Run("creates registered sources", func(t *testing.T) {
+		source, err := NewSource(&config.Config{Source: config.SourceConfig{Type: "static"}, GitHub: config.GitHubConfig{Username: "octo"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		repos, _ := source.ListRepositories(context.Background())
+		if len(repos) != 1 || repos[0].FullName != "octo/demo" {
+			t.Errorf("unexpected repositories: %v", repos)
+		}
+		if !slices.Contains(Sources(), "static") {
+			t.Errorf("expected static in %v", Sources())
+		}
+	})
+
+	t.Run("rejects unknown sources", func(t *testing.T) {
+		if _, err := NewSource(&config.Config{Source: config.SourceConfig{Type: "svn"}}); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
+	t.Run("rejects duplicate registrations", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		RegisterSource("static", nil)
+	})
+}
+
+func TestMirrorOptionsImports(t *testing.T) {
+	all := MirrorOptions{Native: true, Issues: true}
+	if !all.Imports("wiki") || !all.Imports("pull-requests") {
+		t.Error("expected every item to be imported without a list")
+	}
+	if (MirrorOptions{Native: true}).Imports("issues") {
+		t.Error("expected issues to require Issues")
+	}
+	some := MirrorOptions{Native: true, Issues: true, Items: []string{"releases", "issues"}}
+	if !some.Imports("releases") || !some.Imports("issues") || some.Imports("wiki") || some.Imports("pull-requests") {
+		t.Errorf("expected only the listed items to be imported, got %+v", some)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestPushDefaultBranchOnly(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	git := func(args ...string) string {
+		output, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	source := t.TempDir()
+	git("init", "--quiet", "--initial-branch=main", source)
+	git("-C", source, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "--allow-empty", "-m", "initial")
+	git("-C", source, "branch", "stale")
+	git("-C", source, "tag", "v1")
+
+	tests := []struct {
+		name     string
+		skipTags bool
+		refs     []string
+	}{
+		{"with tags", false, []string{"refs/heads/main", "refs/tags/v1"}},
+		{"without tags", true, []string{"refs/heads/main"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A local path stands in for the Gitea server git pushes to
+			server := t.TempDir()
+			remote := filepath.Join(server, "me", "demo.git")
+			git("init", "--quiet", "--bare", remote)
+
+			cfg := &config.Config{Gitea: config.GiteaConfig{URL: server, CloneCacheDir: t.TempDir(), DefaultBranchOnly: true, SkipTags: tt.skipTags}}
+			giteaClient, err := gitea.NewClient(&cfg.Gitea)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo := &repository.Repository{Name: "demo", FullName: "octo/demo", URL: source, DefaultBranch: "main"}
+			if err := pushFallback(context.Background(), repo, &gitea.Target{Name: "me", Type: "user"}, cfg, giteaClient); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			refs := strings.Fields(git("-C", remote, "for-each-ref", "--format=%(refname)"))
+			if !slices.Equal(refs, tt.refs) {
+				t.Errorf("expected %v, got %v", tt.refs, refs)
+			}
+		})
+	}
+}
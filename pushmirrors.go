@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// runPushMirrors backs up the repositories that only exist on Gitea to
+// GitHub: it creates each on GitHub below PUSH_MIRROR_OWNER and configures a
+// Gitea push mirror to it. Mirrors of GitHub repositories, including those
+// recorded in the state, are left out. It fails if any repository failed.
+func runPushMirrors(ctx context.Context, cfg *config.Config, out io.Writer) error {
+	if cfg.GitHub.Token == "" {
+		return fmt.Errorf("repositories are created on GitHub, set GITHUB_TOKEN")
+	}
+
+	ghClient, err := ghrepo.NewClient(cfg.GitHub.Token, ghrepo.ClientOptions{APIURL: cfg.GitHub.APIURL, Proxy: cfg.GitHub.Proxy})
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		return fmt.Errorf("failed to create Gitea client: %w", err)
+	}
+	if _, err := giteaClient.DetectServer(); err != nil {
+		log.Printf("Warning: Failed to detect the Gitea server, assuming a current Gitea: %v", err)
+	}
+	giteaUser, err := giteaClient.GetUser()
+	if err != nil {
+		return fmt.Errorf("failed to get Gitea user: %w", err)
+	}
+	store, err := state.Open(cfg.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to open state: %w", err)
+	}
+
+	targets := []*gitea.Target{giteaUser}
+	for _, org := range targetOrganizations(cfg) {
+		target, err := giteaClient.GetOrganization(org)
+		if err != nil {
+			log.Printf("Warning: Failed to get Gitea organization %s, skipping it: %v", org, err)
+			continue
+		}
+		targets = append(targets, target)
+	}
+
+	owner := cfg.GitHub.PushMirrorOwner
+	if owner == "" {
+		owner = cfg.GitHub.Username
+	}
+	mirrored := mirroredRepositories(store)
+	configured, failed := 0, 0
+	for _, target := range targets {
+		repos, err := giteaClient.ListRepositories(target)
+		if err != nil {
+			return err
+		}
+		for _, info := range repos {
+			if !giteaNative(info, target, mirrored) {
+				continue
+			}
+			if err := pushMirror(ctx, ghClient, giteaClient, cfg, target, info, owner, out); err != nil {
+				log.Printf("Error pushing %s/%s to GitHub: %v", target.Name, info.Name, err)
+				failed++
+				continue
+			}
+			configured++
+		}
+	}
+
+	fmt.Fprintf(out, "%d repositories are pushed to GitHub\n", configured)
+	if failed > 0 {
+		return fmt.Errorf("%d repositories failed", failed)
+	}
+	return nil
+}
+
+// mirroredRepositories returns the lower-cased Gitea full names of the
+// mirrors recorded in the state.
+func mirroredRepositories(store *state.Store) map[string]bool {
+	mirrored := make(map[string]bool)
+	for _, mirror := range store.Mirrors() {
+		mirrored[strings.ToLower(mirror.Owner+"/"+mirror.Name)] = true
+	}
+	return mirrored
+}
+
+// giteaNative reports whether a repository was created on Gitea rather than
+// mirrored or migrated from elsewhere. Empty repositories have nothing to back up.
+func giteaNative(info gitea.RepositoryInfo, target *gitea.Target, mirrored map[string]bool) bool {
+	return !info.Mirror && !info.Empty && info.OriginalURL == "" && !mirrored[strings.ToLower(target.Name+"/"+info.Name)]
+}
+
+// pushMirror creates the GitHub repository of a Gitea repository if needed
+// and adds a push mirror to it unless there already is one.
+func pushMirror(ctx context.Context, ghClient *github.Client, giteaClient *gitea.Client, cfg *config.Config, target *gitea.Target, info gitea.RepositoryInfo, owner string, out io.Writer) error {
+	existing, err := giteaClient.ListRemoteMirrors(target.Name, info.Name)
+	if err != nil {
+		return err
+	}
+	for _, mirror := range existing {
+		if pushesTo(mirror.RemoteAddress, owner, info.Name) {
+			return nil
+		}
+	}
+
+	var remoteURL string
+	if cfg.DryRun {
+		remoteURL = fmt.Sprintf("https://github.com/%s/%s.git", owner, info.Name)
+		log.Printf("DRY RUN: Would create GitHub repository %s/%s if missing", owner, info.Name)
+	} else {
+		var created bool
+		remoteURL, created, err = ghrepo.EnsureRepository(ctx, ghClient, owner, info.Name, info.Description, info.Private)
+		if err != nil {
+			return fmt.Errorf("failed to create GitHub repository: %w", err)
+		}
+		if created {
+			log.Printf("Created GitHub repository %s/%s", owner, info.Name)
+		}
+	}
+
+	if err := giteaClient.AddRemoteMirror(target.Name, info.Name, remoteURL, cfg.GitHub.Username, cfg.GitHub.Token, cfg.DryRun); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s/%s -> %s/%s\n", target.Name, info.Name, owner, info.Name)
+	return nil
+}
+
+// pushesTo reports whether a push mirror address points to the GitHub
+// repository owner/name.
+func pushesTo(address, owner, name string) bool {
+	address = strings.TrimSuffix(strings.ToLower(address), ".git")
+	return strings.HasSuffix(address, "/"+strings.ToLower(owner+"/"+name))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+)
+
+func TestRunPushMirrors(t *testing.T) {
+	var created, added map[string]interface{}
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/alice/notes":
+			w.WriteHeader(http.StatusNotFound)
+		case "GET /users/alice":
+			w.Write([]byte(`{"login": "alice", "type": "User"}`))
+		case "POST /user/repos":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"name": "notes", "clone_url": "https://github.com/alice/notes.git"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer github.Close()
+
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/version":
+			w.Write([]byte(`{"version": "1.22.1"}`))
+		case "GET /api/v1/user":
+			w.Write([]byte(`{"id": 1, "username": "alice"}`))
+		case "GET /api/v1/users/alice/repos":
+			w.Write([]byte(`[
+				{"name": "notes", "private": true, "description": "My notes"},
+				{"name": "backed-up"},
+				{"name": "tool", "mirror": true, "original_url": "https://github.com/alice/tool.git"},
+				{"name": "empty", "empty": true}
+			]`))
+		case "GET /api/v1/repos/alice/notes/push_mirrors":
+			w.Write([]byte(`[]`))
+		case "GET /api/v1/repos/alice/backed-up/push_mirrors":
+			w.Write([]byte(`[{"remote_address": "https://github.com/alice/backed-up.git"}]`))
+		case "POST /api/v1/repos/alice/notes/push_mirrors":
+			json.NewDecoder(r.Body).Decode(&added)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	cfg := &config.Config{
+		GitHub: config.GitHubConfig{Username: "alice", Token: "ghp_token", APIURL: github.URL + "/"},
+		Gitea:  config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5},
+	}
+	var out bytes.Buffer
+	if err := runPushMirrors(context.Background(), cfg, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if created["name"] != "notes" || created["private"] != true || created["description"] != "My notes" {
+		t.Errorf("unexpected GitHub repository: %v", created)
+	}
+	if added["remote_address"] != "https://github.com/alice/notes.git" || added["remote_password"] != "ghp_token" || added["sync_on_commit"] != true {
+		t.Errorf("unexpected push mirror: %v", added)
+	}
+	if got := out.String(); !strings.Contains(got, "alice/notes -> alice/notes") || !strings.Contains(got, "2 repositories are pushed") {
+		t.Errorf("unexpected report: %s", got)
+	}
+}
+
+func TestPushesTo(t *testing.T) {
+	if !pushesTo("https://github.com/Alice/Notes.git", "alice", "notes") {
+		t.Error("expected the address to match case-insensitively")
+	}
+	if pushesTo("https://github.com/alice/other-notes.git", "alice", "notes") {
+		t.Error("expected another repository not to match")
+	}
+}
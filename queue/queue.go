@@ -0,0 +1,183 @@
+// Package queue hands the repositories discovered by a producer to workers
+// mirroring them in parallel, through a Redis list.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/redis"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+const defaultKey = "mirror-to-gitea:queue"
+
+// pendingTTL is how long a repository counts as queued at most, so one lost
+// by a failing worker is queued again eventually.
+const pendingTTL = 24 * time.Hour
+
+// Queue is a list of repositories waiting to be mirrored. A pending key per
+// queued repository keeps it from being queued twice when the workers fall
+// behind the producer. Workers move the repositories they take to a
+// processing list and only release them once mirrored.
+type Queue struct {
+	client *redis.Client
+	key    string
+}
+
+// Batch is a set of repositories taken off the queue by a worker.
+type Batch struct {
+	Repositories []*repository.Repository
+	// items are the queued values, taken off the processing list by Ack
+	items []string
+}
+
+// Open returns the queue at a URL like redis://:password@host:6379/0?key=name.
+func Open(location string) (*Queue, error) {
+	if !strings.HasPrefix(location, "redis://") {
+		return nil, fmt.Errorf("unsupported queue %q, only redis:// URLs are supported", location)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client, err := redis.ParseURL(u)
+	if err != nil {
+		return nil, err
+	}
+	key := u.Query().Get("key")
+	if key == "" {
+		key = defaultKey
+	}
+	return &Queue{client: client, key: key}, nil
+}
+
+func (q *Queue) pendingKey(repo *repository.Repository) string {
+	return q.key + ":pending:" + strings.ToLower(repo.FullName)
+}
+
+func (q *Queue) processingKey() string {
+	return q.key + ":processing"
+}
+
+// Push queues the repositories not queued or processed already and returns
+// how many it queued. Repositories taken by a worker that died are released
+// once their pending key expired, so they are queued again.
+func (q *Queue) Push(ctx context.Context, repos []*repository.Repository) (int, error) {
+	if err := q.releaseExpired(ctx); err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, repo := range repos {
+		added, err := q.client.Do(ctx, "SET", q.pendingKey(repo), "1", "NX", "EX", strconv.Itoa(int(pendingTTL.Seconds())))
+		if err != nil {
+			return queued, err
+		}
+		if added == nil {
+			continue
+		}
+		data, err := json.Marshal(repo)
+		if err != nil {
+			return queued, err
+		}
+		if _, err := q.client.Int(ctx, "RPUSH", q.key, string(data)); err != nil {
+			return queued, err
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+// Pop waits up to wait for a repository and moves up to limit repositories
+// from the queue to the processing list. It returns nil if the queue stayed
+// empty. The repositories aren't queued again until the batch is acked.
+func (q *Queue) Pop(ctx context.Context, limit int, wait time.Duration) (*Batch, error) {
+	// The connection has to outlive the blocking wait
+	popCtx, cancel := context.WithTimeout(ctx, wait+10*time.Second)
+	defer cancel()
+	reply, err := q.client.Do(popCtx, "BLMOVE", q.key, q.processingKey(), "LEFT", "RIGHT", strconv.Itoa(max(int(wait.Seconds()), 1)))
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	first, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected Redis reply %v", reply)
+	}
+	items := []string{first}
+
+	// Failing to fill the batch leaves the rest to the next one
+	for len(items) < limit {
+		more, err := q.client.Do(ctx, "LMOVE", q.key, q.processingKey(), "LEFT", "RIGHT")
+		item, ok := more.(string)
+		if err != nil || !ok {
+			break
+		}
+		items = append(items, item)
+	}
+
+	batch := &Batch{items: items}
+	for _, item := range items {
+		var repo repository.Repository
+		if err := json.Unmarshal([]byte(item), &repo); err != nil {
+			log.Printf("Warning: Skipping invalid queued repository: %v", err)
+			continue
+		}
+		batch.Repositories = append(batch.Repositories, &repo)
+	}
+	return batch, nil
+}
+
+// Ack releases the repositories of a processed batch, so the producer can
+// queue them again.
+func (q *Queue) Ack(ctx context.Context, batch *Batch) error {
+	for _, item := range batch.items {
+		if _, err := q.client.Int(ctx, "LREM", q.processingKey(), "1", item); err != nil {
+			return err
+		}
+	}
+	for _, repo := range batch.Repositories {
+		if _, err := q.client.Int(ctx, "DEL", q.pendingKey(repo)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseExpired drops the repositories from the processing list whose
+// pending key expired, as the worker processing them is gone.
+func (q *Queue) releaseExpired(ctx context.Context) error {
+	reply, err := q.client.Do(ctx, "LRANGE", q.processingKey(), "0", "-1")
+	if err != nil {
+		return err
+	}
+	items, _ := reply.([]interface{})
+	for _, item := range items {
+		data, _ := item.(string)
+		var repo repository.Repository
+		if json.Unmarshal([]byte(data), &repo) == nil {
+			pending, err := q.client.Int(ctx, "EXISTS", q.pendingKey(&repo))
+			if err != nil {
+				return err
+			}
+			if pending > 0 {
+				continue
+			}
+		}
+		if _, err := q.client.Int(ctx, "LREM", q.processingKey(), "1", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len returns the number of repositories waiting.
+func (q *Queue) Len(ctx context.Context) (int64, error) {
+	return q.client.Int(ctx, "LLEN", q.key)
+}
@@ -0,0 +1,192 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// fakeRedis implements the list and key commands the queue uses.
+type fakeRedis struct {
+	mu    sync.Mutex
+	lists map[string][]string
+	keys  map[string]bool
+}
+
+func (f *fakeRedis) serve(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		conn.Write([]byte(f.reply(args)))
+		f.mu.Unlock()
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	switch args[0] {
+	case "SET":
+		if f.keys[args[1]] {
+			return "$-1\r\n"
+		}
+		f.keys[args[1]] = true
+		return "+OK\r\n"
+	case "DEL":
+		delete(f.keys, args[1])
+		return ":1\r\n"
+	case "EXISTS":
+		if f.keys[args[1]] {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "RPUSH":
+		f.lists[args[1]] = append(f.lists[args[1]], args[2])
+		return fmt.Sprintf(":%d\r\n", len(f.lists[args[1]]))
+	case "LLEN":
+		return fmt.Sprintf(":%d\r\n", len(f.lists[args[1]]))
+	case "BLMOVE", "LMOVE":
+		if len(f.lists[args[1]]) == 0 {
+			return "$-1\r\n"
+		}
+		item := f.lists[args[1]][0]
+		f.lists[args[1]] = f.lists[args[1]][1:]
+		f.lists[args[2]] = append(f.lists[args[2]], item)
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(item), item)
+	case "LRANGE":
+		reply := fmt.Sprintf("*%d\r\n", len(f.lists[args[1]]))
+		for _, item := range f.lists[args[1]] {
+			reply += fmt.Sprintf("$%d\r\n%s\r\n", len(item), item)
+		}
+		return reply
+	case "LREM":
+		list := f.lists[args[1]]
+		for i, item := range list {
+			if item == args[3] {
+				f.lists[args[1]] = append(list[:i:i], list[i+1:]...)
+				return ":1\r\n"
+			}
+		}
+		return ":0\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		size, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		length, _ := strconv.Atoi(strings.TrimSpace(size[1:]))
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args = append(args, string(data[:length]))
+	}
+	return args, nil
+}
+
+func TestQueue(t *testing.T) {
+	server := &fakeRedis{lists: make(map[string][]string), keys: make(map[string]bool)}
+	q, err := Open("redis://" + server.serve(t) + "?key=mirrors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	repos := []*repository.Repository{
+		{Name: "api", FullName: "acme/api", Topics: []string{"go"}},
+		{Name: "web", FullName: "acme/web"},
+		{Name: "docs", FullName: "acme/docs"},
+	}
+	if queued, err := q.Push(ctx, repos); queued != 3 || err != nil {
+		t.Fatalf("expected 3 repositories to be queued, got %d %v", queued, err)
+	}
+	if queued, err := q.Push(ctx, repos[:1]); queued != 0 || err != nil {
+		t.Fatalf("expected a waiting repository not to be queued again, got %d %v", queued, err)
+	}
+
+	batch, err := q.Pop(ctx, 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	popped := batch.Repositories
+	if len(popped) != 2 || popped[0].FullName != "acme/api" || popped[0].Topics[0] != "go" || popped[1].FullName != "acme/web" {
+		t.Fatalf("expected a batch of the first two repositories, got %+v", popped)
+	}
+	if waiting, err := q.Len(ctx); waiting != 1 || err != nil {
+		t.Errorf("expected one waiting repository, got %d %v", waiting, err)
+	}
+	if len(server.lists["mirrors:processing"]) != 2 {
+		t.Errorf("expected the batch to be processing, got %v", server.lists["mirrors:processing"])
+	}
+	if queued, err := q.Push(ctx, repos[:1]); queued != 0 || err != nil {
+		t.Errorf("expected a repository in progress not to be queued again, got %d %v", queued, err)
+	}
+
+	if err := q.Ack(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.lists["mirrors:processing"]) != 0 {
+		t.Errorf("expected an acked batch to be released, got %v", server.lists["mirrors:processing"])
+	}
+	if queued, err := q.Push(ctx, repos[:1]); queued != 1 || err != nil {
+		t.Errorf("expected a processed repository to be queued again, got %d %v", queued, err)
+	}
+
+	// A worker that died leaves its batch behind until the pending key expires
+	lost, err := q.Pop(ctx, 1, time.Second)
+	if err != nil || lost == nil {
+		t.Fatalf("expected a batch, got %v %v", lost, err)
+	}
+	delete(server.keys, "mirrors:pending:"+lost.Repositories[0].FullName)
+	if queued, err := q.Push(ctx, lost.Repositories); queued != 1 || err != nil {
+		t.Errorf("expected a lost repository to be queued again, got %d %v", queued, err)
+	}
+	if len(server.lists["mirrors:processing"]) != 0 {
+		t.Errorf("expected the lost batch to be released, got %v", server.lists["mirrors:processing"])
+	}
+
+	if _, err := Open("amqp://broker"); err == nil {
+		t.Error("expected other queues to be rejected")
+	}
+}
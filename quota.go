@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// checkCreationQuota compares the number of repositories that will be created
+// in each target against its creation limit, the one set on the user or
+// organization or else the configured limit of the instance. Repositories
+// beyond the remaining quota are held back so the run doesn't fail halfway
+// through.
+func checkCreationQuota(repos []*repository.Repository, targets map[*repository.Repository]*gitea.Target, limit int, giteaClient *gitea.Client) []*repository.Repository {
+	if limit < 0 {
+		return repos
+	}
+
+	type quota struct {
+		limit     int
+		remaining int
+		skipped   int
+	}
+	quotas := make(map[string]*quota)
+
+	var result []*repository.Repository
+	for _, repo := range repos {
+		target := targets[repo]
+
+		mirrored, err := giteaClient.IsRepositoryMirrored(repo.GiteaName(), target)
+		if err != nil || mirrored {
+			result = append(result, repo)
+			continue
+		}
+
+		q, ok := quotas[target.Name]
+		if !ok {
+			q = &quota{limit: limit}
+			if ownLimit, err := giteaClient.MaxRepoCreation(target); err != nil {
+				log.Printf("Warning: Could not get the repository limit of %s %s, assuming %d: %v", target.Type, target.Name, limit, err)
+			} else if ownLimit >= 0 {
+				q.limit = ownLimit
+			}
+			count, err := giteaClient.CountRepositories(target)
+			if err != nil {
+				log.Printf("Warning: Could not check repository quota of %s %s: %v", target.Type, target.Name, err)
+				count = 0
+			}
+			q.remaining = q.limit - count
+			quotas[target.Name] = q
+		}
+
+		if q.remaining <= 0 {
+			q.skipped++
+			continue
+		}
+
+		q.remaining--
+		result = append(result, repo)
+	}
+
+	for name, q := range quotas {
+		if q.skipped > 0 {
+			log.Printf("Warning: %s has reached its limit of %d repositories; postponing %d new mirrors until the limit is raised", name, q.limit, q.skipped)
+		}
+	}
+
+	return result
+}
+
+// limitNewMirrors holds back the new mirrors beyond the first max, so a run
+// that discovers many repositories spreads their migrations over several
+// runs instead of flooding the migration queue of Gitea. Existing mirrors are
+// all kept.
+func limitNewMirrors(repos []*repository.Repository, targets map[*repository.Repository]*gitea.Target, max int, giteaClient *gitea.Client) []*repository.Repository {
+	if max <= 0 {
+		return repos
+	}
+
+	var result []*repository.Repository
+	created, postponed := 0, 0
+	for _, repo := range repos {
+		mirrored, err := giteaClient.IsRepositoryMirrored(repo.GiteaName(), targets[repo])
+		if err == nil && !mirrored {
+			if created >= max {
+				postponed++
+				continue
+			}
+			created++
+		}
+		result = append(result, repo)
+	}
+
+	if postponed > 0 {
+		log.Printf("Migrating %d new repositories in this run, postponing %d to the following runs (MAX_NEW_MIRRORS_PER_RUN)", created, postponed)
+	}
+	return result
+}
+
+// checkCapacity estimates the space the new mirrors of the run take from
+// the size of their GitHub repositories, and fails if it exceeds the quota
+// of their target with GITEA_CHECK_QUOTA or, together with the repositories
+// of the targets, GITEA_DISK_BUDGET_MB. The run stops before migrating
+// anything instead of failing halfway once Gitea runs out of space.
+func checkCapacity(repos []*repository.Repository, targets map[*repository.Repository]*gitea.Target, cfg *config.Config, giteaClient *gitea.Client) error {
+	if !cfg.Gitea.CheckQuota && cfg.Gitea.DiskBudgetMB == 0 {
+		return nil
+	}
+
+	// Sizes are in kilobytes, like those of GitHub and Gitea
+	needed := make(map[string]int)
+	byName := make(map[string]*gitea.Target)
+	total := 0
+	for _, repo := range repos {
+		target := targets[repo]
+		byName[strings.ToLower(target.Name)] = target
+		mirrored, err := giteaClient.IsRepositoryMirrored(repo.GiteaName(), target)
+		if err != nil || mirrored {
+			continue
+		}
+		needed[strings.ToLower(target.Name)] += repo.Stats.Size
+		total += repo.Stats.Size
+	}
+	if total == 0 {
+		return nil
+	}
+
+	if cfg.Gitea.CheckQuota {
+		for name, size := range needed {
+			target := byName[name]
+			remaining, err := giteaClient.RemainingQuota(target)
+			if err != nil {
+				log.Printf("Warning: Could not check the quota of %s %s: %v", target.Type, target.Name, err)
+				continue
+			}
+			if remaining >= 0 && int64(size)*1024 > remaining {
+				return fmt.Errorf("not enough space on Gitea: the new mirrors of %s need about %s, but only %s remain of its quota", target.Name, formatSize(size), formatSize(int(remaining/1024)))
+			}
+		}
+	}
+
+	if cfg.Gitea.DiskBudgetMB > 0 {
+		used := 0
+		for _, target := range byName {
+			infos, err := giteaClient.ListRepositories(target)
+			if err != nil {
+				return fmt.Errorf("failed to check the disk budget: %w", err)
+			}
+			for _, info := range infos {
+				used += info.Size
+			}
+		}
+		if budget := cfg.Gitea.DiskBudgetMB * 1024; used+total > budget {
+			return fmt.Errorf("not enough space on Gitea: the new mirrors need about %s, but only %s of GITEA_DISK_BUDGET_MB remain", formatSize(total), formatSize(max(budget-used, 0)))
+		}
+	}
+
+	log.Printf("New mirrors need about %s on Gitea", formatSize(total))
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestLimitNewMirrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/users/mirror/repos" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[{"name":"existing","mirror":true}]`))
+	}))
+	defer server.Close()
+
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &gitea.Target{ID: 1, Name: "mirror", Type: "user"}
+	targets := make(map[*repository.Repository]*gitea.Target)
+	var repos []*repository.Repository
+	for _, name := range []string{"first", "existing", "second", "third"} {
+		repo := &repository.Repository{Name: name, FullName: "octo/" + name}
+		repos = append(repos, repo)
+		targets[repo] = user
+	}
+
+	if got := limitNewMirrors(repos, targets, 0, giteaClient); len(got) != 4 {
+		t.Errorf("expected no cap without a maximum, got %d repositories", len(got))
+	}
+
+	got := limitNewMirrors(repos, targets, 2, giteaClient)
+	var names []string
+	for _, repo := range got {
+		names = append(names, repo.Name)
+	}
+	if len(names) != 3 || names[0] != "first" || names[1] != "existing" || names[2] != "second" {
+		t.Errorf("expected the first two new mirrors and the existing one, got %v", names)
+	}
+}
+
+func TestCheckCreationQuota(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/users/mirror":
+			w.Write([]byte(`{"id":1,"username":"mirror","max_repo_creation":3}`))
+		case "/api/v1/orgs/acme":
+			w.Write([]byte(`{"id":2,"username":"acme"}`))
+		case "/api/v1/users/mirror/repos":
+			w.Header().Set("X-Total-Count", "2")
+			w.Write([]byte(`[{"name":"existing","mirror":true},{"name":"other"}]`))
+		case "/api/v1/orgs/acme/repos":
+			w.Header().Set("X-Total-Count", "2")
+			w.Write([]byte(`[{"name":"one"},{"name":"two"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &gitea.Target{ID: 1, Name: "mirror", Type: "user"}
+	org := &gitea.Target{ID: 2, Name: "acme", Type: "organization"}
+	targets := make(map[*repository.Repository]*gitea.Target)
+	var repos []*repository.Repository
+	for _, name := range []string{"first", "existing", "second", "acme-new"} {
+		repo := &repository.Repository{Name: name, FullName: "octo/" + name}
+		repos = append(repos, repo)
+		targets[repo] = user
+		if name == "acme-new" {
+			targets[repo] = org
+		}
+	}
+
+	if got := checkCreationQuota(repos, targets, -1, giteaClient); len(got) != 4 {
+		t.Errorf("expected no check without a limit, got %d repositories", len(got))
+	}
+
+	// The user may own 3 repositories, the organization the 2 of the instance
+	got := checkCreationQuota(repos, targets, 2, giteaClient)
+	var names []string
+	for _, repo := range got {
+		names = append(names, repo.Name)
+	}
+	if len(names) != 2 || names[0] != "first" || names[1] != "existing" {
+		t.Errorf("expected one new mirror of the user and the existing one, got %v", names)
+	}
+}
+
+func TestCheckCapacity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/users/mirror/repos":
+			w.Write([]byte(`[{"name":"existing","mirror":true,"size":4096}]`))
+		case "/api/v1/user/quota":
+			w.Write([]byte(`{"used":{"size":{"repos":{"public":1048576,"private":1048576}}},"groups":[{"rules":[{"limit":10485760,"subjects":["size:repos:all"]}]}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &gitea.Target{ID: 1, Name: "mirror", Type: "user"}
+	existing := &repository.Repository{Name: "existing", FullName: "octo/existing", Stats: repository.Stats{Size: 4096}}
+	huge := &repository.Repository{Name: "huge", FullName: "octo/huge", Stats: repository.Stats{Size: 9000}}
+	repos := []*repository.Repository{existing, huge}
+	targets := map[*repository.Repository]*gitea.Target{existing: user, huge: user}
+
+	for _, tt := range []struct {
+		name  string
+		gitea config.GiteaConfig
+		fails bool
+	}{
+		{"disabled", config.GiteaConfig{}, false},
+		{"within the budget", config.GiteaConfig{DiskBudgetMB: 20}, false},
+		{"beyond the budget", config.GiteaConfig{DiskBudgetMB: 12}, true},
+		{"beyond the quota", config.GiteaConfig{CheckQuota: true}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCapacity(repos, targets, &config.Config{Gitea: tt.gitea}, giteaClient)
+			if (err != nil) != tt.fails {
+				t.Errorf("expected failure %v, got %v", tt.fails, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// renamedMirror is a mirror of a GitHub repository that was renamed or
+// transferred since it was migrated.
+type renamedMirror struct {
+	owner  string
+	name   string
+	topics []string
+	// previous is the full name the mirror was migrated from
+	previous string
+}
+
+// findRenames looks up the mirrors of the targets that don't mirror any of
+// the selected repositories on GitHub, which redirects the old names of
+// renamed and transferred repositories. It returns the mirrors found by the
+// lower-cased new full name.
+func findRenames(ctx context.Context, ghClient *github.Client, giteaClient *gitea.Client, repoTargets map[*repository.Repository]*gitea.Target) map[string]renamedMirror {
+	selected := make(map[string]bool, len(repoTargets))
+	seen := make(map[string]bool)
+	var targets []*gitea.Target
+	for repo, target := range repoTargets {
+		selected[strings.ToLower(repo.FullName)] = true
+		if !seen[strings.ToLower(target.Name)] {
+			seen[strings.ToLower(target.Name)] = true
+			targets = append(targets, target)
+		}
+	}
+
+	renames := make(map[string]renamedMirror)
+	for _, target := range targets {
+		infos, err := giteaClient.ListRepositories(target)
+		if err != nil {
+			log.Printf("Warning: Failed to list the repositories of %s for renames: %v", target.Name, err)
+			continue
+		}
+		for _, info := range infos {
+			owner, name, ok := githubUpstream(info.OriginalURL)
+			if !info.Mirror || !ok || selected[strings.ToLower(owner+"/"+name)] {
+				continue
+			}
+			current, err := ghrepo.CurrentFullName(ctx, ghClient, owner, name)
+			if err != nil {
+				log.Printf("Warning: Failed to look up %s/%s on GitHub: %v", owner, name, err)
+				continue
+			}
+			if current == "" || strings.EqualFold(current, owner+"/"+name) || !selected[strings.ToLower(current)] {
+				continue
+			}
+			renames[strings.ToLower(current)] = renamedMirror{owner: target.Name, name: info.Name, topics: info.Topics, previous: owner + "/" + name}
+		}
+	}
+	return renames
+}
+
+// followRename turns the mirror of a renamed or transferred repository into
+// the mirror of its new name: it is moved to the target if MOVE_TRANSFERRED_MIRRORS
+// allows, renamed and updated in place. GitHub redirects the old remote of
+// the mirror to the new name; should it stop, REPAIR_BROKEN_MIRRORS replaces
+// the mirror. Mirrors of transferred repositories that stay with their
+// old owner are left alone, the repository gets a new mirror in its target.
+func followRename(
+	ctx context.Context,
+	repo *repository.Repository,
+	rule *config.Rule,
+	giteaTarget *gitea.Target,
+	renamed renamedMirror,
+	cfg *config.Config,
+	giteaClient *gitea.Client,
+	ghClient *github.Client,
+	store *state.Store,
+	mirrors map[string]gitea.RepoLink,
+) error {
+	fullName := renamed.owner + "/" + renamed.name
+	moved := !strings.EqualFold(renamed.owner, giteaTarget.Name)
+	if moved && !cfg.GitHub.MoveTransferred {
+		log.Printf("%s was transferred to %s, keeping its mirror %s and mirroring it to %s", renamed.previous, repo.FullName, fullName, giteaTarget.Name)
+		return nil
+	}
+	if protectedMirror(renamed.owner, renamed.name, renamed.topics, "moving", cfg) {
+		return nil
+	}
+	if exists, err := giteaClient.IsRepositoryMirrored(repo.GiteaName(), giteaTarget); err != nil || exists {
+		return err
+	}
+
+	if cfg.DryRun {
+		log.Printf("DRY RUN: Would move mirror %s of %s to %s/%s, as it was renamed to %s", fullName, renamed.previous, giteaTarget.Name, repo.GiteaName(), repo.FullName)
+		return nil
+	}
+	log.Printf("%s was renamed to %s, moving its mirror %s to %s/%s", renamed.previous, repo.FullName, fullName, giteaTarget.Name, repo.GiteaName())
+	if moved {
+		if err := giteaClient.TransferRepository(&gitea.Target{Name: renamed.owner}, renamed.name, giteaTarget.Name); err != nil {
+			return err
+		}
+	}
+	if !strings.EqualFold(renamed.name, repo.GiteaName()) {
+		if err := giteaClient.RenameRepository(giteaTarget, renamed.name, repo.GiteaName()); err != nil {
+			return err
+		}
+	}
+	if err := giteaClient.UpdateMirror(repo, giteaTarget, cfg.GitHub.Token, mirrorOptions(ctx, repo, rule, cfg, ghClient, mirrors)); err != nil {
+		return err
+	}
+	store.SetIssuesSyncedAt(repo.FullName, store.IssuesSyncedAt(renamed.previous))
+	store.RemoveMirror(renamed.previous)
+	return nil
+}
+
+// findRenamedMirror looks up the mirror of previous, the full name a webhook
+// reported the repository of the run as renamed or transferred from. The
+// mirror is found in the state, or among the mirrors of the repository's
+// target.
+func findRenamedMirror(giteaClient *gitea.Client, store *state.Store, repoTargets map[*repository.Repository]*gitea.Target, previous string) map[string]renamedMirror {
+	for repo, target := range repoTargets {
+		if mirror, ok := store.Mirror(previous); ok {
+			status, err := giteaClient.GetMirrorStatus(mirror.Owner, mirror.Name)
+			if err == nil && status != nil && status.Mirror {
+				return map[string]renamedMirror{
+					strings.ToLower(repo.FullName): {owner: mirror.Owner, name: mirror.Name, topics: status.Topics, previous: previous},
+				}
+			}
+		}
+
+		infos, err := giteaClient.ListRepositories(target)
+		if err != nil {
+			log.Printf("Warning: Failed to list the repositories of %s for the rename of %s: %v", target.Name, previous, err)
+			return nil
+		}
+		for _, info := range infos {
+			owner, name, ok := githubUpstream(info.OriginalURL)
+			if info.Mirror && ok && strings.EqualFold(owner+"/"+name, previous) {
+				return map[string]renamedMirror{
+					strings.ToLower(repo.FullName): {owner: target.Name, name: info.Name, topics: info.Topics, previous: previous},
+				}
+			}
+		}
+		log.Printf("No mirror of %s found, mirroring %s as a new repository", previous, repo.FullName)
+	}
+	return nil
+}
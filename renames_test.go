@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func TestFollowRename(t *testing.T) {
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/octo/old":
+			http.Redirect(w, r, "/repositories/1", http.StatusMovedPermanently)
+		case "/repositories/1":
+			w.Write([]byte(`{"id":1,"name":"new","full_name":"octo/new"}`))
+		case "/repos/octo/other":
+			w.Write([]byte(`{"id":2,"name":"other","full_name":"octo/other"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer githubServer.Close()
+
+	var requests []string
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/users/me/repos":
+			w.Write([]byte(`[
+				{"name":"old","mirror":true,"original_url":"https://github.com/octo/old.git"},
+				{"name":"other","mirror":true,"original_url":"https://github.com/octo/other.git"}
+			]`))
+		case "PATCH /api/v1/repos/me/old", "POST /api/v1/repos/me/new/mirror-sync":
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	cfg := &config.Config{
+		GitHub: config.GitHubConfig{FollowRenames: true},
+		Gitea:  config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5},
+	}
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghClient, err := ghrepo.NewClient("", ghrepo.ClientOptions{APIURL: githubServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, _ := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	store.RecordMirror("octo/old", &state.Mirror{Owner: "me", Name: "old"})
+
+	repo := &repository.Repository{Name: "new", FullName: "octo/new", URL: "https://github.com/octo/new.git"}
+	target := &gitea.Target{ID: 1, Name: "me", Type: "user"}
+	renames := findRenames(context.Background(), ghClient, giteaClient, map[*repository.Repository]*gitea.Target{repo: target})
+	renamed, ok := renames["octo/new"]
+	if len(renames) != 1 || !ok || renamed.name != "old" || renamed.previous != "octo/old" {
+		t.Fatalf("expected the rename of octo/old to be found, got %+v", renames)
+	}
+
+	t.Run("keeps mirrors of repositories transferred to another target", func(t *testing.T) {
+		before := len(requests)
+		transferred := renamedMirror{owner: "team", name: "old", previous: "team/old"}
+		if err := followRename(context.Background(), repo, nil, target, transferred, cfg, giteaClient, nil, store, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(requests) != before {
+			t.Errorf("expected no changes, got %v", requests[before:])
+		}
+	})
+
+	t.Run("renames and syncs the mirror in place", func(t *testing.T) {
+		requests = nil
+		if err := followRename(context.Background(), repo, nil, target, renamed, cfg, giteaClient, nil, store, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []string{"GET /api/v1/users/me/repos", "PATCH /api/v1/repos/me/old", "POST /api/v1/repos/me/new/mirror-sync"}
+		if !slices.Equal(requests, want) {
+			t.Errorf("expected %v, got %v", want, requests)
+		}
+		if _, ok := store.Mirror("octo/old"); ok {
+			t.Error("expected the old name to be forgotten")
+		}
+	})
+}
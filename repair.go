@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// missedSyncs is how many periodic syncs of a mirror must have passed without
+// picking up a push before the mirror counts as broken.
+const missedSyncs = 3
+
+// brokenMirror reports whether Gitea repeatedly failed to sync a mirror: the
+// last push to GitHub is older than missedSyncs mirror intervals and still
+// newer than the last sync. Gitea doesn't expose sync errors through the API,
+// so stale credentials or a moved remote only show this way.
+func brokenMirror(status *gitea.MirrorStatus, pushedAt, now time.Time) bool {
+	if status == nil || !status.Mirror || !pushedAt.After(status.MirrorUpdated) {
+		return false
+	}
+	interval, err := time.ParseDuration(status.MirrorInterval)
+	if err != nil || interval <= 0 {
+		// Mirrors without a periodic sync are never expected to catch up
+		return false
+	}
+	return now.Sub(pushedAt) > missedSyncs*interval
+}
+
+// partialMigrationGrace is how long a new mirror may stay empty while Gitea
+// is still migrating it.
+const partialMigrationGrace = time.Hour
+
+// partialMigration reports whether a migration failed midway: the mirror is
+// still empty well after it was created, though GitHub has content for it.
+func partialMigration(status *gitea.MirrorStatus, repo *repository.Repository, now time.Time) bool {
+	if status == nil || !status.Empty || repo.Stats.Size == 0 || status.Created.IsZero() {
+		return false
+	}
+	return now.Sub(status.Created) > partialMigrationGrace
+}
+
+// cleanupPartialMigration deletes the mirror of a repository left behind by
+// a failed migration, so it is migrated again like a new one. It reports
+// whether it deleted the mirror; dry runs only report it.
+func cleanupPartialMigration(repo *repository.Repository, giteaTarget *gitea.Target, cfg *config.Config, giteaClient *gitea.Client) (bool, error) {
+	status, err := giteaClient.GetMirrorStatus(giteaTarget.Name, repo.GiteaName())
+	if err != nil {
+		return false, err
+	}
+	if !partialMigration(status, repo, time.Now()) || protectedMirror(giteaTarget.Name, repo.GiteaName(), status.Topics, "deleting the partial migration of", cfg) {
+		return false, nil
+	}
+
+	if cfg.DryRun {
+		log.Printf("DRY RUN: Would delete mirror %s/%s, still empty since %s, and migrate it again", giteaTarget.Name, repo.GiteaName(), status.Created.Format(time.RFC1123))
+		return true, nil
+	}
+	log.Printf("Mirror %s/%s is still empty since %s, deleting the partial migration to migrate it again", giteaTarget.Name, repo.GiteaName(), status.Created.Format(time.RFC1123))
+	if err := giteaClient.DeleteRepository(giteaTarget, repo.GiteaName()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// repairExtension holds when repairMirror repaired a mirror in place, for
+// recordMirror.
+const repairExtension = "repairedAt"
+
+// repairMirror repairs the mirror of a repository if it is broken. A broken
+// mirror is first updated in place with the current token and synced; only
+// if it is still broken after that it is re-migrated, and reported as such
+// so it is set up like a new mirror. The issues are then mirrored from
+// scratch into the new mirror.
+func repairMirror(
+	ctx context.Context,
+	repo *repository.Repository,
+	rule *config.Rule,
+	giteaTarget *gitea.Target,
+	cfg *config.Config,
+	giteaClient *gitea.Client,
+	ghClient *github.Client,
+	store *state.Store,
+	mirrors map[string]gitea.RepoLink,
+) (bool, error) {
+	status, err := giteaClient.GetMirrorStatus(giteaTarget.Name, repo.GiteaName())
+	if err != nil {
+		return false, err
+	}
+	if !brokenMirror(status, repo.Stats.PushedAt, time.Now()) || protectedMirror(giteaTarget.Name, repo.GiteaName(), status.Topics, "re-migrating", cfg) {
+		return false, nil
+	}
+	mirror, _ := store.Mirror(repo.FullName)
+	inPlace := !mirror.RepairedAt.After(status.MirrorUpdated)
+
+	if cfg.DryRun {
+		if inPlace {
+			log.Printf("DRY RUN: Would update broken mirror %s/%s in place, last synced %s", giteaTarget.Name, repo.GiteaName(), status.MirrorUpdated.Format(time.RFC1123))
+		} else {
+			log.Printf("DRY RUN: Would re-migrate broken mirror %s/%s, last synced %s", giteaTarget.Name, repo.GiteaName(), status.MirrorUpdated.Format(time.RFC1123))
+		}
+		return false, nil
+	}
+
+	opts := mirrorOptions(ctx, repo, rule, cfg, ghClient, mirrors)
+	if inPlace {
+		log.Printf("Mirror %s/%s wasn't synced since %s, updating it in place", giteaTarget.Name, repo.GiteaName(), status.MirrorUpdated.Format(time.RFC1123))
+		if err := giteaClient.UpdateMirror(repo, giteaTarget, cfg.GitHub.Token, opts); err != nil {
+			return false, err
+		}
+		repo.SetExtension(repairExtension, time.Now())
+		return false, nil
+	}
+
+	log.Printf("Mirror %s/%s is still broken since its repair on %s, re-migrating it", giteaTarget.Name, repo.GiteaName(), mirror.RepairedAt.Format(time.RFC1123))
+	if err := giteaClient.RemigrateMirror(repo, giteaTarget, cfg.GitHub.Token, opts); err != nil {
+		return false, err
+	}
+	repo.SetExtension(repairExtension, time.Time{})
+	store.SetIssuesSyncedAt(repo.FullName, time.Time{})
+	return true, nil
+}
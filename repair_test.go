@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func TestBrokenMirror(t *testing.T) {
+	synced := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status := &gitea.MirrorStatus{Mirror: true, MirrorInterval: "8h0m0s", MirrorUpdated: synced}
+
+	tests := []struct {
+		name     string
+		status   *gitea.MirrorStatus
+		pushedAt time.Time
+		now      time.Time
+		broken   bool
+	}{
+		{"synced after the last push", status, synced.Add(-time.Hour), synced.Add(72 * time.Hour), false},
+		{"push waiting for the next sync", status, synced.Add(time.Hour), synced.Add(9 * time.Hour), false},
+		{"push missed by three syncs", status, synced.Add(time.Hour), synced.Add(26 * time.Hour), true},
+		{"periodic sync disabled", &gitea.MirrorStatus{Mirror: true, MirrorInterval: "0s", MirrorUpdated: synced}, synced.Add(time.Hour), synced.Add(72 * time.Hour), false},
+		{"not a mirror", &gitea.MirrorStatus{}, synced.Add(time.Hour), synced.Add(72 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if broken := brokenMirror(tt.status, tt.pushedAt, tt.now); broken != tt.broken {
+				t.Errorf("expected broken %v, got %v", tt.broken, broken)
+			}
+		})
+	}
+}
+
+func TestRepairMirror(t *testing.T) {
+	synced := time.Now().Add(-72 * time.Hour)
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/repos/me/demo":
+			w.Write([]byte(`{"mirror":true,"mirror_interval":"8h0m0s","mirror_updated":"` + synced.Format(time.RFC3339) + `"}`))
+		case "POST /api/v1/repos/migrate":
+			w.WriteHeader(http.StatusCreated)
+		case "DELETE /api/v1/repos/me/demo-broken":
+			w.WriteHeader(http.StatusNoContent)
+		case "PATCH /api/v1/repos/me/demo", "PATCH /api/v1/repos/me/demo-repair", "POST /api/v1/repos/me/demo/mirror-sync":
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHub: config.GitHubConfig{Token: "token"},
+		Gitea:  config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5, RepairBrokenMirrors: true},
+	}
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, _ := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	store.SetIssuesSyncedAt("octo/demo", synced)
+
+	target := &gitea.Target{ID: 1, Name: "me", Type: "user"}
+	repair := func() bool {
+		repo := &repository.Repository{Name: "demo", FullName: "octo/demo", Stats: repository.Stats{PushedAt: synced.Add(time.Hour)}}
+		remigrated, err := repairMirror(context.Background(), repo, nil, target, cfg, giteaClient, nil, store, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		recordMirror(store, repo, target, nil)
+		return remigrated
+	}
+
+	t.Run("updates the mirror in place first", func(t *testing.T) {
+		requests = nil
+		if repair() {
+			t.Error("expected the mirror not to be re-migrated")
+		}
+		want := []string{"GET /api/v1/repos/me/demo", "PATCH /api/v1/repos/me/demo", "POST /api/v1/repos/me/demo/mirror-sync"}
+		if !slices.Equal(requests, want) {
+			t.Errorf("expected requests %v, got %v", want, requests)
+		}
+		if store.IssuesSyncedAt("octo/demo").IsZero() {
+			t.Error("expected the issues to be kept")
+		}
+	})
+
+	t.Run("re-migrates mirrors still broken after the repair", func(t *testing.T) {
+		requests = nil
+		if !repair() {
+			t.Error("expected the mirror to be re-migrated")
+		}
+		want := []string{
+			"GET /api/v1/repos/me/demo",
+			"POST /api/v1/repos/migrate",
+			"PATCH /api/v1/repos/me/demo",
+			"PATCH /api/v1/repos/me/demo-repair",
+			"DELETE /api/v1/repos/me/demo-broken",
+		}
+		if !slices.Equal(requests, want) {
+			t.Errorf("expected requests %v, got %v", want, requests)
+		}
+		if !store.IssuesSyncedAt("octo/demo").IsZero() {
+			t.Error("expected the issues to be synced from scratch")
+		}
+	})
+}
+
+func TestRemigrateMirrorRollsBack(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/v1/repos/migrate":
+			w.WriteHeader(http.StatusCreated)
+		case "PATCH /api/v1/repos/me/demo", "PATCH /api/v1/repos/me/demo-broken":
+			w.Write([]byte(`{}`))
+		case "PATCH /api/v1/repos/me/demo-repair":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		case "DELETE /api/v1/repos/me/demo-repair":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &repository.Repository{Name: "demo", FullName: "octo/demo"}
+	if err := giteaClient.RemigrateMirror(repo, &gitea.Target{ID: 1, Name: "me", Type: "user"}, "", gitea.MirrorOptions{}); err == nil {
+		t.Fatal("expected the failed rename to be reported")
+	}
+
+	want := []string{
+		"POST /api/v1/repos/migrate",
+		"PATCH /api/v1/repos/me/demo",
+		"PATCH /api/v1/repos/me/demo-repair",
+		"PATCH /api/v1/repos/me/demo-broken",
+		"DELETE /api/v1/repos/me/demo-repair",
+	}
+	if !slices.Equal(requests, want) {
+		t.Errorf("expected requests %v, got %v", want, requests)
+	}
+}
+
+func TestCleanupPartialMigration(t *testing.T) {
+	created := time.Now().Add(-2 * time.Hour)
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/users/me/repos":
+			w.Write([]byte(`[{"name":"demo","mirror":true,"empty":true},{"name":"fresh","mirror":true,"empty":true}]`))
+		case "GET /api/v1/repos/me/demo":
+			w.Write([]byte(`{"mirror":true,"empty":true,"created_at":"` + created.Format(time.RFC3339) + `"}`))
+		case "GET /api/v1/repos/me/fresh":
+			w.Write([]byte(`{"mirror":true,"empty":true,"created_at":"` + time.Now().Format(time.RFC3339) + `"}`))
+		case "DELETE /api/v1/repos/me/demo":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Gitea: config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5, RepairPartialMigrations: true}}
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &gitea.Target{ID: 1, Name: "me", Type: "user"}
+	if mirrored, _ := giteaClient.IsRepositoryMirrored("demo", target); !mirrored {
+		t.Fatal("expected the partial migration to look mirrored")
+	}
+
+	fresh := &repository.Repository{Name: "fresh", FullName: "octo/fresh", Stats: repository.Stats{Size: 100}}
+	if partial, err := cleanupPartialMigration(fresh, target, cfg, giteaClient); err != nil || partial {
+		t.Errorf("expected a migration in progress to be left alone, got %v, %v", partial, err)
+	}
+
+	demo := &repository.Repository{Name: "demo", FullName: "octo/demo", Stats: repository.Stats{Size: 100}}
+	partial, err := cleanupPartialMigration(demo, target, cfg, giteaClient)
+	if err != nil || !partial {
+		t.Fatalf("expected the partial migration to be deleted, got %v, %v", partial, err)
+	}
+	if mirrored, _ := giteaClient.IsRepositoryMirrored("demo", target); mirrored {
+		t.Error("expected the deleted mirror to be dropped from the index")
+	}
+	if !slices.Contains(requests, "DELETE /api/v1/repos/me/demo") || slices.Contains(requests, "DELETE /api/v1/repos/me/fresh") {
+		t.Errorf("unexpected requests %v", requests)
+	}
+
+	empty := &repository.Repository{Name: "demo", FullName: "octo/demo"}
+	status := &gitea.MirrorStatus{Mirror: true, Empty: true, Created: created}
+	if partialMigration(status, empty, time.Now()) {
+		t.Error("expected mirrors of empty repositories to be complete")
+	}
+}
@@ -0,0 +1,82 @@
+// Package repository contains the provider-neutral repository model shared by
+// all sources and targets.
+package repository
+
+import "time"
+
+// Repository describes a source repository and how it is mirrored.
+type Repository struct {
+	// ID is the provider specific identifier of the repository
+	ID            string
+	Name          string
+	Owner         string
+	FullName      string
+	URL           string // clone URL
+	DefaultBranch string
+	Private       bool
+	Fork          bool
+	HasIssues     bool
+	Topics        []string
+	// SocialImageURL is the custom social preview image, empty if the
+	// provider generates one
+	SocialImageURL string
+	Stats          Stats
+	Provenance     Provenance
+
+	// Organization is set when the repository is mirrored into an organization of the same name
+	Organization string
+	Starred      bool
+	Watched      bool
+	// MirrorName is the name of the repository on the Gitea side, empty means Name
+	MirrorName string
+
+	// Extensions holds provider or feature specific metadata
+	Extensions map[string]interface{}
+}
+
+type Stats struct {
+	Language string
+	Size     int // in kilobytes
+	Stars    int
+	Forks    int
+	PushedAt time.Time
+}
+
+// Provenance records where a repository came from.
+type Provenance struct {
+	Provider string // e.g. "github"
+	HTMLURL  string
+	// Parent is the full name of the upstream repository of a fork
+	Parent string
+}
+
+// GiteaName returns the name under which the repository is mirrored to Gitea.
+func (r *Repository) GiteaName() string {
+	if r.MirrorName != "" {
+		return r.MirrorName
+	}
+	return r.Name
+}
+
+// SetExtension stores provider or feature specific metadata on the repository.
+func (r *Repository) SetExtension(key string, value interface{}) {
+	if r.Extensions == nil {
+		r.Extensions = make(map[string]interface{})
+	}
+	r.Extensions[key] = value
+}
+
+// Extension returns the metadata stored under key.
+func (r *Repository) Extension(key string) (interface{}, bool) {
+	value, ok := r.Extensions[key]
+	return value, ok
+}
+
+// OrganizationProfile is the public profile of an organization.
+type OrganizationProfile struct {
+	FullName    string
+	Description string
+	Website     string
+	Location    string
+	AvatarURL   string
+}
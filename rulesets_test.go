@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+func TestMirrorRulesets(t *testing.T) {
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/octo/demo/rulesets":
+			w.Write([]byte(`[{"id":1,"name":"main","enforcement":"active"},{"id":2,"name":"releases","enforcement":"active"},{"id":3,"name":"trial","enforcement":"evaluate"}]`))
+		case "/repos/octo/demo/rulesets/1":
+			w.Write([]byte(`{"id":1,"name":"main","target":"branch","enforcement":"active",
+				"conditions":{"ref_name":{"include":["~DEFAULT_BRANCH","refs/heads/release/*"],"exclude":[]}},
+				"rules":[{"type":"required_signatures"},{"type":"required_linear_history"},
+					{"type":"pull_request","parameters":{"required_approving_review_count":2,"dismiss_stale_reviews_on_push":true}},
+					{"type":"required_status_checks","parameters":{"required_status_checks":[{"context":"ci"}],"strict_required_status_checks_policy":true}}]}`))
+		case "/repos/octo/demo/rulesets/2":
+			w.Write([]byte(`{"id":2,"name":"releases","target":"tag","enforcement":"active",
+				"conditions":{"ref_name":{"include":["refs/tags/v*"],"exclude":[]}},
+				"rules":[{"type":"deletion"},{"type":"update"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer githubServer.Close()
+
+	var requests []string
+	protections := make(map[string]gitea.BranchProtection)
+	var repoEdit map[string]bool
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/repos/me/demo/branch_protections":
+			w.Write([]byte(`[{"rule_name":"trunk"}]`))
+		case "POST /api/v1/repos/me/demo/branch_protections", "PATCH /api/v1/repos/me/demo/branch_protections/trunk":
+			var protection gitea.BranchProtection
+			json.NewDecoder(r.Body).Decode(&protection)
+			protections[protection.RuleName] = protection
+			if r.Method == "POST" {
+				w.WriteHeader(http.StatusCreated)
+			}
+		case "GET /api/v1/repos/me/demo/tag_protections":
+			w.Write([]byte(`[]`))
+		case "POST /api/v1/repos/me/demo/tag_protections":
+			w.WriteHeader(http.StatusCreated)
+		case "PATCH /api/v1/repos/me/demo":
+			json.NewDecoder(r.Body).Decode(&repoEdit)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	giteaClient, err := gitea.NewClient(&config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghClient, err := ghrepo.NewClient("", ghrepo.ClientOptions{APIURL: githubServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &repository.Repository{Owner: "octo", Name: "demo", FullName: "octo/demo", DefaultBranch: "trunk"}
+	if err := giteaClient.MirrorRulesets(context.Background(), ghClient, repo, &gitea.Target{Name: "me", Type: "user"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	trunk, ok := protections["trunk"]
+	if !ok || trunk.EnablePush || !trunk.RequireSignedCommits || trunk.RequiredApprovals != 2 || !trunk.DismissStaleApproval ||
+		!trunk.EnableStatusCheck || !slices.Equal(trunk.StatusCheckContexts, []string{"ci"}) || !trunk.BlockOnOutdated {
+		t.Errorf("unexpected protection of the default branch: %+v", trunk)
+	}
+	if _, ok := protections["release/*"]; !ok {
+		t.Errorf("expected the release branches to be protected, got %v", protections)
+	}
+	if !slices.Contains(requests, "PATCH /api/v1/repos/me/demo/branch_protections/trunk") {
+		t.Errorf("expected the existing protection to be updated, got %v", requests)
+	}
+	if !slices.Contains(requests, "POST /api/v1/repos/me/demo/tag_protections") {
+		t.Errorf("expected the tags to be protected, got %v", requests)
+	}
+	if allowed, ok := repoEdit["allow_merge_commits"]; !ok || allowed {
+		t.Errorf("expected merge commits to be disabled for the linear history, got %v", repoEdit)
+	}
+}
@@ -0,0 +1,116 @@
+// Package runlog scopes the log output to the run and the repository in
+// progress. Every line logged is prefixed with the ID of the run and the
+// repository, and the lines of a repository can be copied to a log file of
+// their own. Runs are serialized, so the scope is that of the process.
+package runlog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	mu    sync.Mutex
+	runID string
+	file  *os.File
+)
+
+// NewWriter returns a writer for log.SetOutput that writes to out and to
+// the log file of the repository in progress.
+func NewWriter(out io.Writer) io.Writer {
+	return writer{out: out}
+}
+
+type writer struct {
+	out io.Writer
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	mu.Lock()
+	if file != nil {
+		file.Write(p)
+	}
+	mu.Unlock()
+	return w.out.Write(p)
+}
+
+// NewID returns a random ID for a run.
+func NewID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// StartRun scopes the log output to the run id until EndRun.
+func StartRun(id string) {
+	mu.Lock()
+	runID = id
+	mu.Unlock()
+	setPrefix(fmt.Sprintf("[run %s] ", id))
+}
+
+// EndRun ends the scope of the run.
+func EndRun() {
+	mu.Lock()
+	runID = ""
+	mu.Unlock()
+	setPrefix("")
+}
+
+// RunID returns the ID of the run in progress, or an empty string.
+func RunID() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return runID
+}
+
+// StartRepository scopes the log output to the repository fullName until
+// the returned function is called. With a directory the output is also
+// appended to the file dir/owner/name.log.
+func StartRepository(fullName, dir string) func() {
+	mu.Lock()
+	id := runID
+	mu.Unlock()
+	setPrefix(fmt.Sprintf("[run %s %s] ", id, fullName))
+
+	if dir != "" {
+		path := filepath.Join(dir, filepath.FromSlash(fullName)+".log")
+		f, err := openLog(path)
+		if err != nil {
+			log.Printf("Warning: Failed to open the log file of %s: %v", fullName, err)
+		} else {
+			mu.Lock()
+			file = f
+			mu.Unlock()
+		}
+	}
+
+	return func() {
+		mu.Lock()
+		if file != nil {
+			file.Close()
+			file = nil
+		}
+		mu.Unlock()
+		setPrefix(fmt.Sprintf("[run %s] ", id))
+	}
+}
+
+func openLog(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+}
+
+// setPrefix puts the scope between the time and the message of every line.
+func setPrefix(prefix string) {
+	log.SetFlags(log.Flags() | log.Lmsgprefix)
+	log.SetPrefix(prefix)
+}
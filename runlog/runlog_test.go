@@ -0,0 +1,54 @@
+package runlog
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScopes(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(NewWriter(&out))
+	defer log.SetOutput(os.Stderr)
+	defer log.SetPrefix("")
+
+	dir := t.TempDir()
+	StartRun("abcd1234")
+	if RunID() != "abcd1234" {
+		t.Errorf("expected the run ID, got %q", RunID())
+	}
+	log.Print("starting")
+	end := StartRepository("octo/demo", dir)
+	log.Print("mirroring")
+	end()
+	log.Print("done")
+	EndRun()
+	log.Print("idle")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for i, want := range []string{"[run abcd1234] starting", "[run abcd1234 octo/demo] mirroring", "[run abcd1234] done", " idle"} {
+		if !strings.HasSuffix(lines[i], want) {
+			t.Errorf("expected line %d to end with %q, got %q", i, want, lines[i])
+		}
+	}
+	if RunID() != "" {
+		t.Errorf("expected no run ID after the run, got %q", RunID())
+	}
+
+	repoLog, err := os.ReadFile(filepath.Join(dir, "octo", "demo.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(repoLog)); !strings.HasSuffix(got, "mirroring") || strings.Contains(got, "starting") {
+		t.Errorf("expected only the lines of the repository in its log file, got %q", got)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	if id := NewID(); len(id) != 8 || id == NewID() {
+		t.Errorf("expected random 8 character IDs, got %q", id)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/lock"
+	"github.com/jaedle/mirror-to-gitea/logger"
+	"github.com/jaedle/mirror-to-gitea/schedule"
+	"github.com/jaedle/mirror-to-gitea/transport"
+)
+
+// runScheduled mirrors at the run times of cfg.Schedule until the process is
+// stopped. Runs never overlap: run times that pass while a run is still in
+// progress are skipped. SIGHUP reloads the configuration for the next run.
+// With LEADER_LOCK only the replica leading runs.
+func runScheduled(cfg *config.Config, opts runOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	// Replicas only run while they lead, the others stand by to take over
+	var elector *lock.Elector
+	if cfg.LeaderLock != "" {
+		lease, err := lock.OpenLease(cfg.LeaderLock)
+		if err != nil {
+			return err
+		}
+		elector = lock.NewElector(lease, time.Duration(cfg.LeaderLease)*time.Second)
+		go elector.Run(ctx)
+	}
+
+	next := cfg.Schedule.Next(time.Now())
+	for {
+		if next.IsZero() {
+			return fmt.Errorf("schedule %q never matches", cfg.Schedule)
+		}
+		log.Printf("Next run scheduled at %s", next.Format(time.RFC1123))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-hangup:
+			timer.Stop()
+			reloaded := reloadConfig(cfg)
+			if reloaded.Schedule == nil {
+				log.Printf("Warning: SCHEDULE can't be removed by a reload, keeping %q", cfg.Schedule)
+				reloaded.Schedule = cfg.Schedule
+			}
+			cfg = reloaded
+			next = cfg.Schedule.Next(time.Now())
+			continue
+		case <-timer.C:
+		}
+		if elector != nil && !elector.Leading() {
+			log.Printf("Not the leader, leaving the run to another replica")
+			next, _ = nextRun(cfg.Schedule, next, time.Now())
+			continue
+		}
+		if !waitJitter(ctx, cfg.DelayJitter) {
+			return nil
+		}
+
+		started := time.Now()
+		if err := run(ctx, cfg, opts); err != nil {
+			log.Printf("Mirroring failed: %v", err)
+		}
+
+		var skipped int
+		next, skipped = nextRun(cfg.Schedule, next, time.Now())
+		if skipped > 0 {
+			log.Printf("Run took %s, skipping %d scheduled runs that passed meanwhile", time.Since(started).Round(time.Second), skipped)
+		}
+	}
+}
+
+// reloadConfig loads the configuration again, e.g. after the configuration
+// file or a secret file changed. The current configuration is kept if the
+// new one is invalid.
+func reloadConfig(cfg *config.Config) *config.Config {
+	reloaded, err := config.Load()
+	if err != nil {
+		log.Printf("Warning: Failed to reload the configuration, keeping the current one: %v", err)
+		return cfg
+	}
+	registerSecrets(reloaded)
+	transport.SetDebug(reloaded.LogLevel == "debug")
+	log.Printf("Reloaded the configuration")
+	logger.New().ShowConfig(reloaded)
+	return reloaded
+}
+
+// nextRun returns the first run time of s after now that follows previous,
+// and how many run times in between were missed.
+func nextRun(s *schedule.Schedule, previous, now time.Time) (time.Time, int) {
+	skipped := 0
+	next := s.Next(previous)
+	for !next.IsZero() && !next.After(now) {
+		skipped++
+		next = s.Next(next)
+	}
+	return next, skipped
+}
+
+// waitJitter sleeps for a random duration of up to maxSeconds, so replicas
+// started at the same time spread their runs. It returns false if ctx is
+// done before.
+func waitJitter(ctx context.Context, maxSeconds int) bool {
+	if maxSeconds <= 0 {
+		return true
+	}
+
+	jitter := rand.N(time.Duration(maxSeconds) * time.Second)
+	log.Printf("Waiting %s before starting the run", jitter.Round(time.Second))
+
+	timer := time.NewTimer(jitter)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
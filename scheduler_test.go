@@ -0,0 +1,50 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/schedule"
+)
+
+func TestNextRun(t *testing.T) {
+	s, err := schedule.Parse("*/10 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+
+	t.Run("continues with the following run time", func(t *testing.T) {
+		next, skipped := nextRun(s, previous, previous.Add(3*time.Minute))
+		if !next.Equal(previous.Add(10*time.Minute)) || skipped != 0 {
+			t.Errorf("unexpected next run %s (skipped %d)", next, skipped)
+		}
+	})
+
+	t.Run("skips run times passed during a long run", func(t *testing.T) {
+		next, skipped := nextRun(s, previous, previous.Add(25*time.Minute))
+		if !next.Equal(previous.Add(30*time.Minute)) || skipped != 2 {
+			t.Errorf("unexpected next run %s (skipped %d)", next, skipped)
+		}
+	})
+}
+
+func TestReloadConfig(t *testing.T) {
+	t.Setenv("GITHUB_USERNAME", "octo")
+	t.Setenv("GITEA_URL", "https://gitea.url")
+	t.Setenv("GITEA_TOKEN", "token")
+	t.Setenv("INCLUDE", "octo/*")
+
+	current := &config.Config{Include: []string{"**"}}
+	reloaded := reloadConfig(current)
+	if !slices.Equal(reloaded.Include, []string{"octo/*"}) {
+		t.Errorf("expected the new filters, got %v", reloaded.Include)
+	}
+
+	t.Setenv("SORT_BY", "random")
+	if kept := reloadConfig(reloaded); kept != reloaded {
+		t.Error("expected an invalid configuration to keep the current one")
+	}
+}
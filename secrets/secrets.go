@@ -0,0 +1,66 @@
+// Package secrets fetches tokens from external secret stores at runtime, so
+// rotated secrets are picked up without restarting the container.
+package secrets
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/redact"
+)
+
+// Provider returns the current value of a named secret. An unknown secret is
+// returned as empty string without error.
+type Provider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// Cached wraps a provider and keeps fetched secrets for the TTL.
+type Cached struct {
+	provider Provider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	value   string
+	fetched time.Time
+}
+
+func NewCached(provider Provider, ttl time.Duration) *Cached {
+	return &Cached{
+		provider: provider,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]cachedSecret),
+	}
+}
+
+// Secret returns the cached secret, refreshing it once the TTL has passed. If
+// refreshing fails the last known value is kept.
+func (c *Cached) Secret(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[name]
+	if ok && c.now().Sub(entry.fetched) < c.ttl {
+		return entry.value, nil
+	}
+
+	value, err := c.provider.Secret(ctx, name)
+	if err != nil {
+		if ok {
+			return entry.value, nil
+		}
+		return "", err
+	}
+
+	// Rotated secrets are masked in the output like the initial ones
+	redact.Add(value)
+	c.entries[name] = cachedSecret{value: value, fetched: c.now()}
+	return value, nil
+}
@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type countingProvider struct {
+	calls int
+	value string
+	err   error
+}
+
+func (p *countingProvider) Secret(ctx context.Context, name string) (string, error) {
+	p.calls++
+	return p.value, p.err
+}
+
+func TestCached(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("refreshes after the ttl", func(t *testing.T) {
+		provider := &countingProvider{value: "first"}
+		cached := NewCached(provider, time.Minute)
+		now := time.Unix(1700000000, 0)
+		cached.now = func() time.Time { return now }
+
+		cached.Secret(ctx, "TOKEN")
+		cached.Secret(ctx, "TOKEN")
+		if provider.calls != 1 {
+			t.Errorf("expected 1 call within ttl, got %d", provider.calls)
+		}
+
+		provider.value = "second"
+		now = now.Add(2 * time.Minute)
+		value, err := cached.Secret(ctx, "TOKEN")
+		if err != nil || value != "second" {
+			t.Errorf("expected refreshed value, got %q (%v)", value, err)
+		}
+	})
+
+	t.Run("keeps the last value if refreshing fails", func(t *testing.T) {
+		provider := &countingProvider{value: "first"}
+		cached := NewCached(provider, 0)
+
+		cached.Secret(ctx, "TOKEN")
+		provider.err = errors.New("unavailable")
+		value, err := cached.Secret(ctx, "TOKEN")
+		if err != nil || value != "first" {
+			t.Errorf("expected last known value, got %q (%v)", value, err)
+		}
+	})
+}
+
+func TestVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/mirror-to-gitea" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data": {"data": {"GITEA_TOKEN": "gitea-secret", "COUNT": 1}}}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	vault := NewVault(server.URL+"/", "vault-token", "/secret/mirror-to-gitea")
+
+	t.Run("reads keys of the secret", func(t *testing.T) {
+		value, err := vault.Secret(ctx, "GITEA_TOKEN")
+		if err != nil || value != "gitea-secret" {
+			t.Errorf("expected gitea-secret, got %q (%v)", value, err)
+		}
+	})
+
+	t.Run("returns empty string for missing keys", func(t *testing.T) {
+		value, err := vault.Secret(ctx, "GITHUB_TOKEN")
+		if err != nil || value != "" {
+			t.Errorf("expected empty value, got %q (%v)", value, err)
+		}
+	})
+
+	t.Run("rejects non-string values", func(t *testing.T) {
+		if _, err := vault.Secret(ctx, "COUNT"); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
+	t.Run("fails on denied access", func(t *testing.T) {
+		denied := NewVault(server.URL, "wrong", "secret/mirror-to-gitea")
+		if _, err := denied.Secret(ctx, "GITEA_TOKEN"); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Vault reads secrets from a key/value version 2 secrets engine of
+// HashiCorp Vault. All secrets are keys of the single secret at Path.
+type Vault struct {
+	Address string
+	Token   string
+	// Path is the secret including its mount, e.g. "secret/mirror-to-gitea"
+	Path string
+
+	httpClient *http.Client
+}
+
+func NewVault(address, token, path string) *Vault {
+	return &Vault{
+		Address:    strings.TrimSuffix(address, "/"),
+		Token:      token,
+		Path:       strings.Trim(path, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type vaultResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+func (v *Vault) Secret(ctx context.Context, name string) (string, error) {
+	data, err := v.read(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := data[name]
+	if !ok {
+		return "", nil
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s/%s is not a string", v.Path, name)
+	}
+	return str, nil
+}
+
+func (v *Vault) read(ctx context.Context) (map[string]interface{}, error) {
+	mount, path, found := strings.Cut(v.Path, "/")
+	if !found {
+		return nil, fmt.Errorf("invalid vault secret path %s, expected <mount>/<path>", v.Path)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/v1/%s/data/%s", v.Address, mount, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read vault secret %s: status %d", v.Path, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var vaultResp vaultResponse
+	if err := json.Unmarshal(body, &vaultResp); err != nil {
+		return nil, err
+	}
+
+	return vaultResp.Data.Data, nil
+}
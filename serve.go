@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// maxWebhookPayload limits the size of accepted deliveries.
+const maxWebhookPayload = 25 << 20
+
+type webhookPayload struct {
+	Action     string `json:"action"`
+	Repository struct {
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Changes struct {
+		Repository struct {
+			Name struct {
+				From string `json:"from"`
+			} `json:"name"`
+		} `json:"repository"`
+		Owner struct {
+			From struct {
+				User struct {
+					Login string `json:"login"`
+				} `json:"user"`
+				Organization struct {
+					Login string `json:"login"`
+				} `json:"organization"`
+			} `json:"from"`
+		} `json:"owner"`
+	} `json:"changes"`
+}
+
+// repositoryChange is a structural change of a repository reported by a
+// repository event, applied by the sync of the repository.
+type repositoryChange struct {
+	// action is deleted, renamed, transferred, privatized or publicized
+	action string
+	// previous is the full name before a rename or transfer
+	previous string
+}
+
+// syncQueue mirrors repositories one at a time. Repositories queued while
+// they are already waiting are only mirrored once.
+type syncQueue struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	// changes holds the latest structural change of pending repositories
+	changes map[string]repositoryChange
+	next    chan string
+}
+
+func newSyncQueue() *syncQueue {
+	return &syncQueue{pending: make(map[string]bool), changes: make(map[string]repositoryChange), next: make(chan string, 1000)}
+}
+
+func (q *syncQueue) add(fullName string) bool {
+	return q.addChange(fullName, nil)
+}
+
+// addChange queues the repository with a structural change if not nil.
+func (q *syncQueue) addChange(fullName string, change *repositoryChange) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.pending[fullName] {
+		select {
+		case q.next <- fullName:
+			q.pending[fullName] = true
+		default:
+			return false
+		}
+	}
+	if change != nil {
+		q.changes[fullName] = *change
+	}
+	return true
+}
+
+func (q *syncQueue) run(ctx context.Context, mirror func(fullName string, change *repositoryChange)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case fullName := <-q.next:
+			q.mu.Lock()
+			delete(q.pending, fullName)
+			var change *repositoryChange
+			if queued, ok := q.changes[fullName]; ok {
+				change = &queued
+				delete(q.changes, fullName)
+			}
+			q.mu.Unlock()
+			mirror(fullName, change)
+		}
+	}
+}
+
+// webhookHandler receives GitHub webhook deliveries and queues the affected
+// repository of push, create and repository events, the latter with their
+// structural change.
+func webhookHandler(secret string, queue *syncQueue) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+		if err != nil {
+			http.Error(w, "failed to read payload", http.StatusBadRequest)
+			return
+		}
+
+		if !validSignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+			log.Printf("Rejected webhook delivery %s with an invalid signature", r.Header.Get("X-GitHub-Delivery"))
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		event := r.Header.Get("X-GitHub-Event")
+		if event == "ping" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		var payload webhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		change := structuralChange(event, payload)
+		if change == nil && !syncsRepository(event, payload.Action) || payload.Repository.FullName == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if !queue.addChange(payload.Repository.FullName, change) {
+			http.Error(w, "too many pending repositories", http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("Received %s event for %s", event, payload.Repository.FullName)
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// syncsRepository reports whether an event changes the content or existence
+// of a repository in a way the mirror should follow.
+func syncsRepository(event, action string) bool {
+	switch event {
+	case "push", "create":
+		return true
+	case "repository":
+		return action != "deleted" && action != "archived"
+	}
+	return false
+}
+
+// structuralChange returns the change of a repository event the mirror
+// follows beyond a sync, or nil.
+func structuralChange(event string, payload webhookPayload) *repositoryChange {
+	if event != "repository" {
+		return nil
+	}
+	switch payload.Action {
+	case "deleted", "privatized", "publicized":
+		return &repositoryChange{action: payload.Action}
+	case "renamed":
+		owner, _, _ := strings.Cut(payload.Repository.FullName, "/")
+		if from := payload.Changes.Repository.Name.From; from != "" {
+			return &repositoryChange{action: payload.Action, previous: owner + "/" + from}
+		}
+	case "transferred":
+		from := payload.Changes.Owner.From.User.Login
+		if from == "" {
+			from = payload.Changes.Owner.From.Organization.Login
+		}
+		if from != "" {
+			return &repositoryChange{action: payload.Action, previous: from + "/" + payload.Repository.Name}
+		}
+	}
+	return nil
+}
+
+func validSignature(secret string, body []byte, signature string) bool {
+	digest, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// onlyRepository keeps the repository with the given full name.
+func onlyRepository(repos []*repository.Repository, fullName string) []*repository.Repository {
+	for _, repo := range repos {
+		if strings.EqualFold(repo.FullName, fullName) {
+			return []*repository.Repository{repo}
+		}
+	}
+	log.Printf("Repository %s is not part of the configured repositories, ignoring it", fullName)
+	return nil
+}
+
+// runServe receives GitHub webhooks on cfg.ServeAddr and mirrors or syncs the
+// affected repository right away, until the process is stopped. With
+// SCHEDULE it also runs at the scheduled times, and with API_TOKEN it serves
+// the management API.
+func runServe(cfg *config.Config) error {
+	if cfg.GitHub.WebhookSecret == "" {
+		return fmt.Errorf("GITHUB_WEBHOOK_SECRET is required to validate webhook deliveries")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP reloads the configuration of the following syncs, the server
+	// itself keeps its address and webhook secret
+	var current atomic.Pointer[config.Config]
+	current.Store(cfg)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				current.Store(reloadConfig(current.Load()))
+			}
+		}
+	}()
+
+	// Full runs and syncs go through the same queue so they never overlap
+	queue := newSyncQueue()
+	history := &runHistory{}
+	go queue.run(ctx, func(fullName string, change *repositoryChange) {
+		startedAt := time.Now()
+		if fullName == fullRun {
+			err := run(ctx, current.Load(), runOptions{})
+			history.record(fullName, startedAt, err)
+			if err != nil {
+				log.Printf("Mirroring failed: %v", err)
+			}
+			return
+		}
+		err := run(ctx, current.Load(), runOptions{only: fullName, syncExisting: true, change: change})
+		history.record(fullName, startedAt, err)
+		if err != nil {
+			log.Printf("Error mirroring repository %s: %v", fullName, err)
+		}
+	})
+
+	var scheduler *serveScheduler
+	if cfg.Schedule != nil {
+		scheduler = &serveScheduler{}
+		go scheduler.run(ctx, current.Load, queue)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", webhookHandler(cfg.GitHub.WebhookSecret, queue))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	if cfg.StateFile != "" {
+		mux.Handle("GET /metrics", metricsHandler(current.Load))
+	}
+	if cfg.APIToken != "" {
+		api := &managementAPI{
+			token:     cfg.APIToken,
+			queue:     queue,
+			current:   current.Load,
+			reload:    func() { current.Store(reloadConfig(current.Load())) },
+			scheduler: scheduler,
+			history:   history,
+		}
+		api.register(mux)
+	}
+
+	server := &http.Server{
+		Addr:              cfg.ServeAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Listening for GitHub webhooks on %s/webhook", cfg.ServeAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
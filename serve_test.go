@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	const secret = "webhook-secret"
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	deliver := func(handler http.Handler, event, body, signature string) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", event)
+		req.Header.Set("X-Hub-Signature-256", signature)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("queues the repository of a push", func(t *testing.T) {
+		queue := newSyncQueue()
+		body := `{"repository":{"full_name":"me/demo"}}`
+
+		if code := deliver(webhookHandler(secret, queue), "push", body, sign(body)); code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d", code)
+		}
+		if got := <-queue.next; got != "me/demo" {
+			t.Errorf("expected me/demo to be queued, got %s", got)
+		}
+	})
+
+	t.Run("rejects invalid signatures", func(t *testing.T) {
+		queue := newSyncQueue()
+		body := `{"repository":{"full_name":"me/demo"}}`
+
+		for _, signature := range []string{"", "sha256=00", sign(body + " ")} {
+			if code := deliver(webhookHandler(secret, queue), "push", body, signature); code != http.StatusUnauthorized {
+				t.Errorf("expected 401 for %q, got %d", signature, code)
+			}
+		}
+		if len(queue.next) != 0 {
+			t.Error("expected nothing to be queued")
+		}
+	})
+
+	t.Run("ignores unrelated events", func(t *testing.T) {
+		queue := newSyncQueue()
+		for event, body := range map[string]string{
+			"issues":     `{"action":"opened","repository":{"full_name":"me/demo"}}`,
+			"repository": `{"action":"archived","repository":{"full_name":"me/demo"}}`,
+		} {
+			if code := deliver(webhookHandler(secret, queue), event, body, sign(body)); code != http.StatusNoContent {
+				t.Errorf("expected 204 for %s, got %d", event, code)
+			}
+		}
+		if len(queue.next) != 0 {
+			t.Error("expected nothing to be queued")
+		}
+	})
+
+	t.Run("queues structural changes with the repository", func(t *testing.T) {
+		for _, tt := range []struct {
+			body     string
+			fullName string
+			want     repositoryChange
+		}{
+			{`{"action":"deleted","repository":{"name":"demo","full_name":"me/demo"}}`, "me/demo", repositoryChange{action: "deleted"}},
+			{`{"action":"privatized","repository":{"name":"demo","full_name":"me/demo"}}`, "me/demo", repositoryChange{action: "privatized"}},
+			{`{"action":"renamed","repository":{"name":"new","full_name":"me/new"},"changes":{"repository":{"name":{"from":"old"}}}}`, "me/new", repositoryChange{action: "renamed", previous: "me/old"}},
+			{`{"action":"transferred","repository":{"name":"demo","full_name":"team/demo"},"changes":{"owner":{"from":{"user":{"login":"me"}}}}}`, "team/demo", repositoryChange{action: "transferred", previous: "me/demo"}},
+		} {
+			queue := newSyncQueue()
+			if code := deliver(webhookHandler(secret, queue), "repository", tt.body, sign(tt.body)); code != http.StatusAccepted {
+				t.Fatalf("expected 202 for %s, got %d", tt.body, code)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			queue.run(ctx, func(fullName string, change *repositoryChange) {
+				if fullName != tt.fullName || change == nil || *change != tt.want {
+					t.Errorf("expected %s with %+v, got %s with %+v", tt.fullName, tt.want, fullName, change)
+				}
+				cancel()
+			})
+		}
+	})
+}
+
+func TestSyncQueueSkipsPendingRepositories(t *testing.T) {
+	queue := newSyncQueue()
+	queue.add("me/demo")
+	queue.add("me/demo")
+	queue.add("me/other")
+
+	if len(queue.next) != 2 {
+		t.Errorf("expected 2 queued repositories, got %d", len(queue.next))
+	}
+}
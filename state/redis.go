@@ -0,0 +1,232 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/redis"
+)
+
+const defaultRedisKey = "mirror-to-gitea:state"
+
+// redisState keeps the state in Redis, so workers of a queue share it. Every
+// entry is a field of a hash and a save only writes the entries that changed
+// since the state was loaded, so concurrent runs don't overwrite each other.
+type redisState struct {
+	client *redis.Client
+	key    string
+	// saved holds the entries as last loaded or saved by hash and field
+	saved map[string]map[string]string
+	// runs holds the runs recorded since the last save
+	runs []Run
+}
+
+func openRedis(location string) (*redisState, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client, err := redis.ParseURL(u)
+	if err != nil {
+		return nil, err
+	}
+	key := u.Query().Get("key")
+	if key == "" {
+		key = defaultRedisKey
+	}
+	return &redisState{client: client, key: key}, nil
+}
+
+// entries encodes the hashed parts of the state by hash and field.
+func entries(d *data) (map[string]map[string]string, error) {
+	hashes := map[string]map[string]string{"etags": {}, "mirrors": {}, "issues": {}, "orphans": {}, "meta": {}}
+	add := func(hash, field string, value interface{}) error {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		hashes[hash][field] = string(encoded)
+		return nil
+	}
+	for key, cached := range d.ETags {
+		if err := add("etags", key, cached); err != nil {
+			return nil, err
+		}
+	}
+	for fullName, mirror := range d.Mirrors {
+		if err := add("mirrors", fullName, mirror); err != nil {
+			return nil, err
+		}
+	}
+	for fullName, syncedAt := range d.IssuesSynced {
+		if err := add("issues", fullName, syncedAt); err != nil {
+			return nil, err
+		}
+	}
+	for fullName, orphan := range d.Orphans {
+		if err := add("orphans", fullName, orphan); err != nil {
+			return nil, err
+		}
+	}
+	if d.Checkpoint != nil {
+		if err := add("meta", "checkpoint", d.Checkpoint); err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+func (r *redisState) load(ctx context.Context, d *data) error {
+	r.saved = make(map[string]map[string]string)
+	for _, hash := range []string{"etags", "mirrors", "issues", "orphans", "meta"} {
+		fields, err := r.hash(ctx, r.key+":"+hash)
+		if err != nil {
+			return fmt.Errorf("failed to read state: %w", err)
+		}
+		r.saved[hash] = fields
+		for field, value := range fields {
+			var target interface{}
+			switch hash {
+			case "etags":
+				cached := &CachedResponse{}
+				d.ETags[field], target = cached, cached
+			case "mirrors":
+				mirror := &Mirror{}
+				d.Mirrors[field], target = mirror, mirror
+			case "issues":
+				var syncedAt time.Time
+				if err := json.Unmarshal([]byte(value), &syncedAt); err != nil {
+					return fmt.Errorf("failed to parse state %s: %w", field, err)
+				}
+				d.IssuesSynced[field] = syncedAt
+				continue
+			case "orphans":
+				orphan := &Orphan{}
+				d.Orphans[field], target = orphan, orphan
+			case "meta":
+				if field != "checkpoint" {
+					continue
+				}
+				d.Checkpoint = &Checkpoint{}
+				target = d.Checkpoint
+			}
+			if err := json.Unmarshal([]byte(value), target); err != nil {
+				return fmt.Errorf("failed to parse state %s: %w", field, err)
+			}
+		}
+	}
+
+	runs, err := r.client.Do(ctx, "LRANGE", r.key+":runs", "0", "-1")
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+	list, _ := runs.([]interface{})
+	for _, item := range list {
+		var run Run
+		data, _ := item.(string)
+		if err := json.Unmarshal([]byte(data), &run); err == nil {
+			d.Runs = append(d.Runs, run)
+		}
+	}
+
+	totals, err := r.hash(ctx, r.key+":totals")
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+	if len(totals) > 0 {
+		d.Totals = &Totals{}
+		d.Totals.Since, _ = time.Parse(time.RFC3339Nano, totals["since"])
+		d.Totals.Runs, _ = strconv.Atoi(totals["runs"])
+		duration, _ := strconv.ParseInt(totals["duration"], 10, 64)
+		d.Totals.Duration = time.Duration(duration)
+		d.Totals.Processed, _ = strconv.Atoi(totals["processed"])
+		d.Totals.Created, _ = strconv.Atoi(totals["created"])
+		d.Totals.MigratedKB, _ = strconv.Atoi(totals["migratedKB"])
+		d.Totals.Failed, _ = strconv.Atoi(totals["failed"])
+	}
+	return nil
+}
+
+func (r *redisState) hash(ctx context.Context, key string) (map[string]string, error) {
+	reply, err := r.client.Do(ctx, "HGETALL", key)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := reply.([]interface{})
+	fields := make(map[string]string, len(list)/2)
+	for i := 0; i+1 < len(list); i += 2 {
+		field, _ := list[i].(string)
+		value, _ := list[i+1].(string)
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+// save writes the entries that changed and removes those that are gone
+// since the last load or save, and adds the recorded runs.
+func (r *redisState) save(ctx context.Context, current map[string]map[string]string) error {
+	for hash, fields := range current {
+		set := []string{"HSET", r.key + ":" + hash}
+		for field, value := range fields {
+			if r.saved[hash][field] != value {
+				set = append(set, field, value)
+			}
+		}
+		if len(set) > 2 {
+			if _, err := r.client.Do(ctx, set...); err != nil {
+				return fmt.Errorf("failed to write state: %w", err)
+			}
+		}
+
+		del := []string{"HDEL", r.key + ":" + hash}
+		for field := range r.saved[hash] {
+			if _, ok := fields[field]; !ok {
+				del = append(del, field)
+			}
+		}
+		if len(del) > 2 {
+			if _, err := r.client.Do(ctx, del...); err != nil {
+				return fmt.Errorf("failed to write state: %w", err)
+			}
+		}
+	}
+	r.saved = current
+
+	for len(r.runs) > 0 {
+		run := r.runs[0]
+		encoded, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		if _, err := r.client.Do(ctx, "RPUSH", r.key+":runs", string(encoded)); err != nil {
+			return fmt.Errorf("failed to write state: %w", err)
+		}
+		if _, err := r.client.Do(ctx, "LTRIM", r.key+":runs", strconv.Itoa(-runRetention), "-1"); err != nil {
+			return fmt.Errorf("failed to write state: %w", err)
+		}
+
+		// Totals are added up in Redis, as every worker records its runs
+		totals := r.key + ":totals"
+		if _, err := r.client.Do(ctx, "HSETNX", totals, "since", run.StartedAt.Format(time.RFC3339Nano)); err != nil {
+			return fmt.Errorf("failed to write state: %w", err)
+		}
+		for field, n := range map[string]int64{
+			"runs":       1,
+			"duration":   int64(run.Duration),
+			"processed":  int64(run.Processed),
+			"created":    int64(run.Created),
+			"migratedKB": int64(run.MigratedKB),
+			"failed":     int64(run.Failed),
+		} {
+			if _, err := r.client.Int(ctx, "HINCRBY", totals, field, strconv.FormatInt(n, 10)); err != nil {
+				return fmt.Errorf("failed to write state: %w", err)
+			}
+		}
+		r.runs = r.runs[1:]
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package state
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis implements the hash and list commands the shared state uses.
+type fakeRedis struct {
+	mu     sync.Mutex
+	hashes map[string]map[string]string
+	lists  map[string][]string
+}
+
+func (f *fakeRedis) serve(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		conn.Write([]byte(f.reply(args)))
+		f.mu.Unlock()
+	}
+}
+
+func bulkArray(items []string) string {
+	reply := fmt.Sprintf("*%d\r\n", len(items))
+	for _, item := range items {
+		reply += fmt.Sprintf("$%d\r\n%s\r\n", len(item), item)
+	}
+	return reply
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	hash := f.hashes[args[1]]
+	if hash == nil {
+		hash = make(map[string]string)
+		f.hashes[args[1]] = hash
+	}
+	switch args[0] {
+	case "HGETALL":
+		var items []string
+		for field, value := range hash {
+			items = append(items, field, value)
+		}
+		return bulkArray(items)
+	case "HSET":
+		for i := 2; i+1 < len(args); i += 2 {
+			hash[args[i]] = args[i+1]
+		}
+		return ":1\r\n"
+	case "HSETNX":
+		if _, ok := hash[args[2]]; ok {
+			return ":0\r\n"
+		}
+		hash[args[2]] = args[3]
+		return ":1\r\n"
+	case "HDEL":
+		for _, field := range args[2:] {
+			delete(hash, field)
+		}
+		return ":1\r\n"
+	case "HINCRBY":
+		n, _ := strconv.ParseInt(hash[args[2]], 10, 64)
+		by, _ := strconv.ParseInt(args[3], 10, 64)
+		hash[args[2]] = strconv.FormatInt(n+by, 10)
+		return fmt.Sprintf(":%d\r\n", n+by)
+	case "RPUSH":
+		f.lists[args[1]] = append(f.lists[args[1]], args[2])
+		return fmt.Sprintf(":%d\r\n", len(f.lists[args[1]]))
+	case "LTRIM":
+		start, _ := strconv.Atoi(args[2])
+		if list := f.lists[args[1]]; -start < len(list) {
+			f.lists[args[1]] = list[len(list)+start:]
+		}
+		return "+OK\r\n"
+	case "LRANGE":
+		return bulkArray(f.lists[args[1]])
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		size, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		length, _ := strconv.Atoi(strings.TrimSpace(size[1:]))
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args = append(args, string(data[:length]))
+	}
+	return args, nil
+}
+
+func TestRedisStore(t *testing.T) {
+	server := &fakeRedis{hashes: make(map[string]map[string]string), lists: make(map[string][]string)}
+	location := "redis://" + server.serve(t) + "?key=shared"
+
+	// Two workers load the same state and record different repositories
+	first, err := Open(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Open(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	first.RecordMirror("octo/api", &Mirror{Owner: "octo", Name: "api"})
+	first.SetIssuesSyncedAt("octo/api", synced)
+	first.RecordRun(Run{StartedAt: synced, Processed: 2, Created: 1})
+	second.RecordMirror("octo/web", &Mirror{Owner: "octo", Name: "web", Failures: 2})
+	second.RecordRun(Run{StartedAt: synced.Add(time.Minute), Processed: 3, Failed: 1})
+	if err := first.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirrors := reopened.Mirrors()
+	if mirrors["octo/api"].Name != "api" || mirrors["octo/web"].Failures != 2 {
+		t.Errorf("expected the mirrors of both workers, got %+v", mirrors)
+	}
+	if got := reopened.IssuesSyncedAt("octo/api"); !got.Equal(synced) {
+		t.Errorf("expected the issue cursor to be shared, got %v", got)
+	}
+	if runs := reopened.Runs(); len(runs) != 2 {
+		t.Errorf("expected the runs of both workers, got %+v", runs)
+	}
+	if totals := reopened.Totals(); totals.Runs != 2 || totals.Processed != 5 || totals.Failed != 1 || !totals.Since.Equal(synced) {
+		t.Errorf("expected the totals of both workers, got %+v", totals)
+	}
+
+	// Removed entries are deleted, the others are left to the other workers
+	reopened.RemoveMirror("octo/api")
+	if err := reopened.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Save(); err != nil {
+		t.Fatal(err)
+	}
+	last, _ := Open(location)
+	if mirrors := last.Mirrors(); len(mirrors) != 1 || mirrors["octo/web"].Name != "web" {
+		t.Errorf("expected only the removed mirror to be gone, got %+v", mirrors)
+	}
+	if totals := last.Totals(); totals.Runs != 2 {
+		t.Errorf("expected saved runs not to be counted twice, got %+v", totals)
+	}
+}
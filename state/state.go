@@ -0,0 +1,388 @@
+// Package state persists data between runs in a single JSON file, or in
+// Redis when several workers share it.
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// etagRetention is how long unused cached responses are kept.
+const etagRetention = 30 * 24 * time.Hour
+
+// runRetention is how many runs the statistics keep.
+const runRetention = 500
+
+// CachedResponse is a response body stored under its ETag.
+type CachedResponse struct {
+	ETag     string    `json:"etag"`
+	Body     []byte    `json:"body"`
+	Link     string    `json:"link,omitempty"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// Mirror is what the last run recorded about a mirrored repository.
+type Mirror struct {
+	// Owner and Name locate the mirror on Gitea
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	// PushedAt is the last push to GitHub as seen by the run
+	PushedAt  time.Time `json:"pushedAt"`
+	LastRun   time.Time `json:"lastRun"`
+	LastError string    `json:"lastError,omitempty"`
+	// Failures counts the runs in a row that failed to mirror the repository
+	Failures int `json:"failures,omitempty"`
+	// Fallback marks repositories pushed by the clone fallback, which Gitea
+	// doesn't sync by itself
+	Fallback bool `json:"fallback,omitempty"`
+	// Credential fingerprints the GitHub token Gitea clones a private mirror with
+	Credential string `json:"credential,omitempty"`
+	// RepairedAt is when the mirror was last repaired in place
+	RepairedAt time.Time `json:"repairedAt,omitempty"`
+	// BackedUp is the last push to GitHub included in the latest backup
+	BackedUp time.Time `json:"backedUp,omitempty"`
+	// Language, SizeKB, Stars and Forks are the GitHub statistics as seen by the run
+	Language string `json:"language,omitempty"`
+	SizeKB   int    `json:"sizeKB,omitempty"`
+	Stars    int    `json:"stars,omitempty"`
+	Forks    int    `json:"forks,omitempty"`
+}
+
+// Checkpoint is the progress of a run that was interrupted.
+type Checkpoint struct {
+	StartedAt time.Time `json:"startedAt"`
+	// Completed holds the full names of the repositories already processed
+	Completed []string `json:"completed"`
+}
+
+// Orphan is a mirror whose GitHub repository was deleted and that cleanup
+// archived or moved to the attic, waiting to be deleted.
+type Orphan struct {
+	// Owner and Name locate the mirror on Gitea after the cleanup
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	// Source is the GitHub repository that was mirrored
+	Source    string    `json:"source"`
+	RetiredAt time.Time `json:"retiredAt"`
+	// Archived marks orphans archived in place instead of moved
+	Archived bool `json:"archived,omitempty"`
+}
+
+// Run is what a run recorded about itself.
+type Run struct {
+	ID        string        `json:"id,omitempty"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+	Processed int           `json:"processed"`
+	// Created counts the new mirrors, which migrated MigratedKB of content
+	Created     int   `json:"created"`
+	MigratedKB  int   `json:"migratedKB"`
+	Failed      int   `json:"failed"`
+	GitHubCalls int64 `json:"githubCalls"`
+	GiteaCalls  int64 `json:"giteaCalls"`
+}
+
+// Totals adds up every recorded run, including those no longer kept.
+type Totals struct {
+	Runs       int           `json:"runs"`
+	Since      time.Time     `json:"since"`
+	Duration   time.Duration `json:"duration"`
+	Processed  int           `json:"processed"`
+	Created    int           `json:"created"`
+	MigratedKB int           `json:"migratedKB"`
+	Failed     int           `json:"failed"`
+}
+
+type data struct {
+	ETags      map[string]*CachedResponse `json:"etags,omitempty"`
+	Mirrors    map[string]*Mirror         `json:"mirrors,omitempty"`
+	Checkpoint *Checkpoint                `json:"checkpoint,omitempty"`
+	// IssuesSynced holds the start of the last issue sync by GitHub full name
+	IssuesSynced map[string]time.Time `json:"issuesSynced,omitempty"`
+	// Orphans holds the retired mirrors by Gitea full name
+	Orphans map[string]*Orphan `json:"orphans,omitempty"`
+	// Runs holds the statistics of the latest runs, oldest first
+	Runs   []Run   `json:"runs,omitempty"`
+	Totals *Totals `json:"totals,omitempty"`
+}
+
+// Store is the state of a run. It is safe for concurrent use.
+type Store struct {
+	path  string
+	redis *redisState
+
+	mu   sync.Mutex
+	data data
+}
+
+// Open loads the state file at path, or the state in Redis at a URL like
+// redis://:password@host:6379/0?key=name. A missing file results in an
+// empty store. An empty path creates an in-memory store that is never saved.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	s.data.ETags = make(map[string]*CachedResponse)
+	s.data.Mirrors = make(map[string]*Mirror)
+	s.data.IssuesSynced = make(map[string]time.Time)
+	s.data.Orphans = make(map[string]*Orphan)
+	if path == "" {
+		return s, nil
+	}
+	if strings.HasPrefix(path, "redis://") {
+		redisState, err := openRedis(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := redisState.load(context.Background(), &s.data); err != nil {
+			return nil, err
+		}
+		s.redis = redisState
+		return s, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &s.data); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if s.data.ETags == nil {
+		s.data.ETags = make(map[string]*CachedResponse)
+	}
+	if s.data.Mirrors == nil {
+		s.data.Mirrors = make(map[string]*Mirror)
+	}
+	if s.data.IssuesSynced == nil {
+		s.data.IssuesSynced = make(map[string]time.Time)
+	}
+	if s.data.Orphans == nil {
+		s.data.Orphans = make(map[string]*Orphan)
+	}
+	return s, nil
+}
+
+// Save writes the state atomically, or the entries that changed to Redis,
+// dropping cached responses that haven't been used for a while.
+func (s *Store) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	for key, cached := range s.data.ETags {
+		if time.Since(cached.LastUsed) > etagRetention {
+			delete(s.data.ETags, key)
+		}
+	}
+	if s.redis != nil {
+		defer s.mu.Unlock()
+		current, err := entries(&s.data)
+		if err != nil {
+			return err
+		}
+		return s.redis.save(context.Background(), current)
+	}
+	content, err := json.Marshal(s.data)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".state-*")
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// CachedResponse returns the response cached for key.
+func (s *Store) CachedResponse(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cached, ok := s.data.ETags[key]
+	if ok {
+		cached.LastUsed = time.Now()
+	}
+	return cached, ok
+}
+
+// SetCachedResponse caches a response for key.
+func (s *Store) SetCachedResponse(key string, cached *CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cached.LastUsed = time.Now()
+	s.data.ETags[key] = cached
+}
+
+// RecordMirror stores the outcome of mirroring the GitHub repository fullName.
+func (s *Store) RecordMirror(fullName string, mirror *Mirror) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Mirrors[fullName] = mirror
+}
+
+// RemoveMirror forgets the mirror of the GitHub repository fullName.
+func (s *Store) RemoveMirror(fullName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data.Mirrors, fullName)
+}
+
+// Mirror returns the recorded mirror of the GitHub repository fullName.
+func (s *Store) Mirror(fullName string) (Mirror, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mirror, ok := s.data.Mirrors[fullName]
+	if !ok {
+		return Mirror{}, false
+	}
+	return *mirror, true
+}
+
+// Mirrors returns the recorded mirrors by GitHub full name.
+func (s *Store) Mirrors() map[string]Mirror {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mirrors := make(map[string]Mirror, len(s.data.Mirrors))
+	for fullName, mirror := range s.data.Mirrors {
+		mirrors[fullName] = *mirror
+	}
+	return mirrors
+}
+
+// Checkpoint returns the progress of an interrupted run, or nil.
+func (s *Store) Checkpoint() *Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Checkpoint == nil {
+		return nil
+	}
+	checkpoint := *s.data.Checkpoint
+	checkpoint.Completed = append([]string(nil), s.data.Checkpoint.Completed...)
+	return &checkpoint
+}
+
+// SetCheckpoint records the progress of an interrupted run, nil clears it.
+func (s *Store) SetCheckpoint(checkpoint *Checkpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Checkpoint = checkpoint
+}
+
+// IssuesSyncedAt returns when the issues of the GitHub repository fullName
+// were last synced, the zero time if never.
+func (s *Store) IssuesSyncedAt(fullName string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.IssuesSynced[fullName]
+}
+
+// SetIssuesSyncedAt records when the issues of the GitHub repository fullName
+// were synced.
+func (s *Store) SetIssuesSyncedAt(fullName string, syncedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.IssuesSynced[fullName] = syncedAt
+}
+
+// RecordOrphan stores a mirror retired by the cleanup.
+func (s *Store) RecordOrphan(orphan *Orphan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Orphans[orphan.Owner+"/"+orphan.Name] = orphan
+}
+
+// Orphans returns the retired mirrors by Gitea full name.
+func (s *Store) Orphans() map[string]Orphan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orphans := make(map[string]Orphan, len(s.data.Orphans))
+	for fullName, orphan := range s.data.Orphans {
+		orphans[fullName] = *orphan
+	}
+	return orphans
+}
+
+// RemoveOrphan forgets the retired mirror fullName once it was deleted or
+// restored.
+func (s *Store) RemoveOrphan(fullName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data.Orphans, fullName)
+}
+
+// RecordRun adds the statistics of a finished run.
+func (s *Store) RecordRun(run Run) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Runs = append(s.data.Runs, run)
+	if s.redis != nil {
+		s.redis.runs = append(s.redis.runs, run)
+	}
+	if len(s.data.Runs) > runRetention {
+		s.data.Runs = s.data.Runs[len(s.data.Runs)-runRetention:]
+	}
+
+	if s.data.Totals == nil {
+		s.data.Totals = &Totals{Since: run.StartedAt}
+	}
+	s.data.Totals.Runs++
+	s.data.Totals.Duration += run.Duration
+	s.data.Totals.Processed += run.Processed
+	s.data.Totals.Created += run.Created
+	s.data.Totals.MigratedKB += run.MigratedKB
+	s.data.Totals.Failed += run.Failed
+}
+
+// Runs returns the statistics of the latest runs, oldest first.
+func (s *Store) Runs() []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Run(nil), s.data.Runs...)
+}
+
+// Totals returns the statistics of all recorded runs.
+func (s *Store) Totals() Totals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Totals == nil {
+		return Totals{}
+	}
+	return *s.data.Totals
+}
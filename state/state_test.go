@@ -0,0 +1,147 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	t.Run("persists cached responses", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		store, err := Open(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		store.SetCachedResponse("https://api.github.com/user/repos", &CachedResponse{ETag: `"v1"`, Body: []byte("[]")})
+		if err := store.Save(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		reopened, err := Open(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cached, ok := reopened.CachedResponse("https://api.github.com/user/repos")
+		if !ok || cached.ETag != `"v1"` || string(cached.Body) != "[]" {
+			t.Errorf("unexpected cached response: %+v", cached)
+		}
+	})
+
+	t.Run("drops stale cached responses", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		store, _ := Open(path)
+		store.SetCachedResponse("stale", &CachedResponse{ETag: `"v1"`})
+		store.data.ETags["stale"].LastUsed = time.Now().Add(-2 * etagRetention)
+		store.Save()
+
+		reopened, _ := Open(path)
+		if _, ok := reopened.CachedResponse("stale"); ok {
+			t.Error("expected stale response to be dropped")
+		}
+	})
+
+	t.Run("persists mirrors", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		store, _ := Open(path)
+		store.RecordMirror("octo/demo", &Mirror{Owner: "octo", Name: "demo", LastError: "boom"})
+		if err := store.Save(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		reopened, _ := Open(path)
+		mirror, ok := reopened.Mirrors()["octo/demo"]
+		if !ok || mirror.Name != "demo" || mirror.LastError != "boom" {
+			t.Errorf("unexpected mirror: %+v", mirror)
+		}
+		if single, ok := reopened.Mirror("octo/demo"); !ok || single != mirror {
+			t.Errorf("unexpected mirror: %+v", single)
+		}
+	})
+
+	t.Run("persists checkpoints until cleared", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+
+		store, _ := Open(path)
+		store.SetCheckpoint(&Checkpoint{StartedAt: time.Now(), Completed: []string{"octo/one"}})
+		store.Save()
+
+		reopened, _ := Open(path)
+		checkpoint := reopened.Checkpoint()
+		if checkpoint == nil || len(checkpoint.Completed) != 1 || checkpoint.Completed[0] != "octo/one" {
+			t.Fatalf("unexpected checkpoint: %+v", checkpoint)
+		}
+
+		reopened.SetCheckpoint(nil)
+		reopened.Save()
+		if cleared, _ := Open(path); cleared.Checkpoint() != nil {
+			t.Error("expected the checkpoint to be cleared")
+		}
+	})
+
+	t.Run("persists issue sync times", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+		syncedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+		store, _ := Open(path)
+		if !store.IssuesSyncedAt("octo/demo").IsZero() {
+			t.Error("expected no sync time for a new repository")
+		}
+		store.SetIssuesSyncedAt("octo/demo", syncedAt)
+		store.Save()
+
+		reopened, _ := Open(path)
+		if got := reopened.IssuesSyncedAt("octo/demo"); !got.Equal(syncedAt) {
+			t.Errorf("expected %v, got %v", syncedAt, got)
+		}
+	})
+
+	t.Run("persists retired orphans", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+		retiredAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+		store, _ := Open(path)
+		store.RecordOrphan(&Orphan{Owner: "attic", Name: "gone", Source: "octo/gone", RetiredAt: retiredAt})
+		store.Save()
+
+		reopened, _ := Open(path)
+		orphan, ok := reopened.Orphans()["attic/gone"]
+		if !ok || orphan.Source != "octo/gone" || !orphan.RetiredAt.Equal(retiredAt) {
+			t.Fatalf("unexpected orphans: %v", reopened.Orphans())
+		}
+		reopened.RemoveOrphan("attic/gone")
+		if len(reopened.Orphans()) != 0 {
+			t.Error("expected the orphan to be removed")
+		}
+	})
+
+	t.Run("keeps the statistics of the latest runs", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.json")
+		startedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+		store, _ := Open(path)
+		for i := range runRetention + 2 {
+			store.RecordRun(Run{StartedAt: startedAt.Add(time.Duration(i) * time.Hour), Processed: 2, Created: 1, MigratedKB: 10})
+		}
+		store.Save()
+
+		reopened, _ := Open(path)
+		runs := reopened.Runs()
+		if len(runs) != runRetention || !runs[0].StartedAt.Equal(startedAt.Add(2*time.Hour)) {
+			t.Fatalf("expected the latest %d runs, got %d starting %v", runRetention, len(runs), runs[0].StartedAt)
+		}
+		totals := reopened.Totals()
+		if totals.Runs != runRetention+2 || totals.Processed != 2*(runRetention+2) || totals.MigratedKB != 10*(runRetention+2) || !totals.Since.Equal(startedAt) {
+			t.Errorf("expected the totals to include every run, got %+v", totals)
+		}
+	})
+
+	t.Run("treats a missing file as empty state", func(t *testing.T) {
+		if _, err := Open(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// statsShown is how many of the latest runs the stats table lists.
+const statsShown = 20
+
+// runStats prints the statistics the runs recorded in the state: the totals
+// and the latest runs. The format is table or json, which lists every
+// recorded run.
+func runStats(cfg *config.Config, format string, out io.Writer) error {
+	if format == "" {
+		format = "table"
+	}
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unknown format %q, expected table or json", format)
+	}
+	if cfg.StateFile == "" {
+		return fmt.Errorf("the statistics are read from the state, set STATE_FILE")
+	}
+	store, err := state.Open(cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	totals, runs := store.Totals(), store.Runs()
+	if format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Totals state.Totals `json:"totals"`
+			Runs   []state.Run  `json:"runs"`
+		}{totals, runs})
+	}
+
+	if totals.Runs == 0 {
+		fmt.Fprintln(out, "No runs recorded yet")
+		return nil
+	}
+	fmt.Fprintf(out, "%d runs since %s: %d repositories processed, %d mirrors created with %s, %d failures, %s in total\n\n",
+		totals.Runs, totals.Since.Local().Format(time.DateTime), totals.Processed, totals.Created, formatSize(totals.MigratedKB), totals.Failed, totals.Duration.Round(time.Second))
+
+	latest := slices.Clone(runs)
+	slices.Reverse(latest)
+	if len(latest) > statsShown {
+		latest = latest[:statsShown]
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tSTARTED\tDURATION\tPROCESSED\tCREATED\tMIGRATED\tFAILED\tGITHUB CALLS\tGITEA CALLS")
+	for _, run := range latest {
+		id := run.ID
+		if id == "" {
+			id = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%d\t%d\t%d\n", id, run.StartedAt.Local().Format(time.DateTime), run.Duration.Round(time.Second),
+			run.Processed, run.Created, formatSize(run.MigratedKB), run.Failed, run.GitHubCalls, run.GiteaCalls)
+	}
+	return w.Flush()
+}
+
+// metricsHandler serves the statistics of the state in the Prometheus text
+// format: the totals of all runs, the last run and the recorded mirrors.
+func metricsHandler(current func() *config.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store, err := state.Open(current().StateFile)
+		if err != nil {
+			log.Printf("Warning: Failed to read the state for metrics: %v", err)
+			http.Error(w, "failed to read the state", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, store)
+	})
+}
+
+func writeMetrics(w io.Writer, store *state.Store) {
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+	}
+
+	totals := store.Totals()
+	metric("mirror_to_gitea_runs_total", "counter", "Runs recorded in the state.", float64(totals.Runs))
+	metric("mirror_to_gitea_processed_repositories_total", "counter", "Repositories processed by all runs.", float64(totals.Processed))
+	metric("mirror_to_gitea_created_mirrors_total", "counter", "Mirrors created by all runs.", float64(totals.Created))
+	metric("mirror_to_gitea_migrated_bytes_total", "counter", "Size of the repositories migrated by all runs.", float64(totals.MigratedKB)*1024)
+	metric("mirror_to_gitea_failures_total", "counter", "Repositories that failed in all runs.", float64(totals.Failed))
+
+	if runs := store.Runs(); len(runs) > 0 {
+		last := runs[len(runs)-1]
+		metric("mirror_to_gitea_last_run_timestamp_seconds", "gauge", "Start of the last run.", float64(last.StartedAt.Unix()))
+		metric("mirror_to_gitea_last_run_duration_seconds", "gauge", "Duration of the last run.", last.Duration.Seconds())
+		metric("mirror_to_gitea_last_run_processed_repositories", "gauge", "Repositories processed by the last run.", float64(last.Processed))
+		metric("mirror_to_gitea_last_run_created_mirrors", "gauge", "Mirrors created by the last run.", float64(last.Created))
+		metric("mirror_to_gitea_last_run_migrated_bytes", "gauge", "Size of the repositories migrated by the last run.", float64(last.MigratedKB)*1024)
+		metric("mirror_to_gitea_last_run_failures", "gauge", "Repositories that failed in the last run.", float64(last.Failed))
+	}
+
+	failing := 0
+	mirrors := store.Mirrors()
+	for _, mirror := range mirrors {
+		if mirror.LastError != "" {
+			failing++
+		}
+	}
+	metric("mirror_to_gitea_mirrors", "gauge", "Mirrors recorded in the state.", float64(len(mirrors)))
+	metric("mirror_to_gitea_failing_mirrors", "gauge", "Mirrors whose last run failed.", float64(failing))
+}
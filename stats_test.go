@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func TestRunStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, _ := state.Open(path)
+	startedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store.RecordRun(state.Run{StartedAt: startedAt, Duration: 2 * time.Minute, Processed: 10, Created: 2, MigratedKB: 2048, Failed: 1})
+	store.RecordRun(state.Run{StartedAt: startedAt.Add(time.Hour), Duration: time.Minute, Processed: 10})
+	store.RecordMirror("octo/demo", &state.Mirror{Owner: "me", Name: "demo", LastError: "boom"})
+	store.Save()
+	cfg := &config.Config{StateFile: path}
+
+	var out bytes.Buffer
+	if err := runStats(cfg, "", &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "2 runs since") || !strings.Contains(out.String(), "20 repositories processed, 2 mirrors created with 2.0 MB, 1 failures") {
+		t.Errorf("unexpected totals:\n%s", out.String())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[3], "1m0s") {
+		t.Errorf("expected the latest run first, got:\n%s", out.String())
+	}
+
+	server := httptest.NewServer(metricsHandler(func() *config.Config { return cfg }))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var metrics bytes.Buffer
+	metrics.ReadFrom(resp.Body)
+	for _, want := range []string{
+		"mirror_to_gitea_runs_total 2\n",
+		"mirror_to_gitea_migrated_bytes_total 2.097152e+06\n",
+		"mirror_to_gitea_last_run_duration_seconds 60\n",
+		"# TYPE mirror_to_gitea_failing_mirrors gauge\nmirror_to_gitea_failing_mirrors 1\n",
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, metrics.String())
+		}
+	}
+
+	if err := runStats(&config.Config{}, "", &out); err == nil {
+		t.Error("expected an error without STATE_FILE")
+	}
+}
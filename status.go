@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/redact"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// recordMirror keeps the outcome of a repository in the state for the status command.
+func recordMirror(store *state.Store, repo *repository.Repository, target *gitea.Target, err error) {
+	mirror := &state.Mirror{
+		Owner:    target.Name,
+		Name:     repo.GiteaName(),
+		PushedAt: repo.Stats.PushedAt,
+		LastRun:  time.Now(),
+		Language: repo.Stats.Language,
+		SizeKB:   repo.Stats.Size,
+		Stars:    repo.Stats.Stars,
+		Forks:    repo.Stats.Forks,
+	}
+	previous, recorded := store.Mirror(repo.FullName)
+	if err != nil {
+		mirror.LastError = redact.String(err.Error())
+		mirror.Failures = previous.Failures + 1
+	}
+	_, mirror.Fallback = repo.Extension(cloneFallbackExtension)
+	if credential, ok := repo.Extension(credentialExtension); ok {
+		mirror.Credential = credential.(string)
+	} else if recorded {
+		mirror.Credential = previous.Credential
+	}
+	if repairedAt, ok := repo.Extension(repairExtension); ok {
+		mirror.RepairedAt = repairedAt.(time.Time)
+	} else if recorded {
+		mirror.RepairedAt = previous.RepairedAt
+	}
+	if backedUp, ok := repo.Extension(backupExtension); ok {
+		mirror.BackedUp = backedUp.(time.Time)
+	} else if recorded {
+		mirror.BackedUp = previous.BackedUp
+	}
+	store.RecordMirror(repo.FullName, mirror)
+}
+
+// unchanged reports whether the last run mirrored the repository to the same
+// target without an error and it wasn't pushed to since.
+func unchanged(store *state.Store, repo *repository.Repository, target *gitea.Target) bool {
+	mirror, ok := store.Mirror(repo.FullName)
+	if !ok || mirror.LastError != "" || repo.Stats.PushedAt.IsZero() {
+		return false
+	}
+	return mirror.Owner == target.Name && mirror.Name == repo.GiteaName() && mirror.PushedAt.Equal(repo.Stats.PushedAt)
+}
+
+// maxFailureBackoff caps the cool-down of repositories that keep failing.
+const maxFailureBackoff = 7 * 24 * time.Hour
+
+// backingOff returns until when a repository that failed after or more times
+// in a row is skipped. The cool-down starts at base and doubles with every
+// further failure.
+func backingOff(store *state.Store, repo *repository.Repository, after int, base time.Duration, now time.Time) (time.Time, bool) {
+	mirror, ok := store.Mirror(repo.FullName)
+	if !ok || after <= 0 || mirror.Failures < after {
+		return time.Time{}, false
+	}
+	backoff := base
+	for i := after; i < mirror.Failures && backoff < maxFailureBackoff; i++ {
+		backoff *= 2
+	}
+	until := mirror.LastRun.Add(min(backoff, maxFailureBackoff))
+	return until, now.Before(until)
+}
+
+// runStatus prints the health of every mirror recorded in the state: when
+// Gitea last synced it, how far that lags behind the last push to GitHub and
+// the error of the last run.
+func runStatus(cfg *config.Config, out io.Writer) error {
+	if cfg.StateFile == "" {
+		return fmt.Errorf("the status is read from the state, set STATE_FILE")
+	}
+
+	store, err := state.Open(cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		return err
+	}
+
+	mirrors := store.Mirrors()
+	names := make([]string, 0, len(mirrors))
+	for name := range mirrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tGITEA\tLAST SYNC\tINTERVAL\tBEHIND GITHUB\tLAST ERROR")
+	for _, name := range names {
+		mirror := mirrors[name]
+		lastSync, interval, behind := "-", "-", "-"
+
+		status, err := giteaClient.GetMirrorStatus(mirror.Owner, mirror.Name)
+		switch {
+		case err != nil:
+			lastSync = "unknown"
+			if mirror.LastError == "" {
+				mirror.LastError = err.Error()
+			}
+		case status == nil:
+			lastSync = "missing"
+		case mirror.Fallback:
+			// Pushed by the clone fallback, so the last run is the last sync
+			lastSync = mirror.LastRun.Local().Format(time.DateTime)
+			interval = "on each run"
+			behind = divergence(mirror.PushedAt, mirror.LastRun)
+		case !status.Mirror:
+			lastSync = "not a mirror"
+		case status.MirrorUpdated.IsZero() || status.Empty:
+			lastSync = "never"
+			interval = status.MirrorInterval
+		default:
+			lastSync = status.MirrorUpdated.Local().Format(time.DateTime)
+			interval = status.MirrorInterval
+			behind = divergence(mirror.PushedAt, status.MirrorUpdated)
+		}
+
+		lastError := mirror.LastError
+		if lastError == "" {
+			lastError = "-"
+		} else if mirror.Failures > 1 {
+			lastError = fmt.Sprintf("%s (%d runs in a row)", lastError, mirror.Failures)
+		}
+		fmt.Fprintf(w, "%s\t%s/%s\t%s\t%s\t%s\t%s\n", name, mirror.Owner, mirror.Name, lastSync, interval, behind, lastError)
+	}
+	return w.Flush()
+}
+
+// divergence describes how long the mirror missed pushes made to GitHub.
+func divergence(pushedAt, synced time.Time) string {
+	if pushedAt.IsZero() {
+		return "-"
+	}
+	if !pushedAt.After(synced) {
+		return "up to date"
+	}
+	return pushedAt.Sub(synced).Round(time.Minute).String()
+}
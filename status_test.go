@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	"github.com/jaedle/mirror-to-gitea/repository"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func TestRunStatus(t *testing.T) {
+	synced := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/repos/me/current":
+			w.Write([]byte(`{"mirror":true,"mirror_interval":"8h0m0s","mirror_updated":"` + synced.Format(time.RFC3339) + `"}`))
+		case "/api/v1/repos/me/behind":
+			w.Write([]byte(`{"mirror":true,"mirror_interval":"8h0m0s","mirror_updated":"` + synced.Format(time.RFC3339) + `"}`))
+		case "/api/v1/repos/me/pushed":
+			w.Write([]byte(`{"mirror":false}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	store, _ := state.Open(stateFile)
+	store.RecordMirror("me/current", &state.Mirror{Owner: "me", Name: "current", PushedAt: synced.Add(-time.Hour)})
+	store.RecordMirror("me/behind", &state.Mirror{Owner: "me", Name: "behind", PushedAt: synced.Add(2 * time.Hour)})
+	store.RecordMirror("me/gone", &state.Mirror{Owner: "me", Name: "gone", LastError: "migration failed"})
+	store.RecordMirror("me/pushed", &state.Mirror{Owner: "me", Name: "pushed", LastRun: synced, Fallback: true})
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{StateFile: stateFile, Gitea: config.GiteaConfig{URL: server.URL, TimeoutSeconds: 5}}
+	var out bytes.Buffer
+	if err := runStatus(cfg, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected a header and 4 rows, got:\n%s", out.String())
+	}
+	for i, want := range []string{"2h0m0s", "up to date", "missing", "on each run"} {
+		if !strings.Contains(lines[i+1], want) {
+			t.Errorf("expected row %d to contain %q, got %q", i+1, want, lines[i+1])
+		}
+	}
+	if !strings.Contains(lines[3], "migration failed") {
+		t.Errorf("expected the last error, got %q", lines[3])
+	}
+}
+
+func TestRunStatusRequiresStateFile(t *testing.T) {
+	if err := runStatus(&config.Config{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestUnchanged(t *testing.T) {
+	pushed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store, _ := state.Open("")
+	store.RecordMirror("octo/idle", &state.Mirror{Owner: "me", Name: "idle", PushedAt: pushed})
+	store.RecordMirror("octo/failed", &state.Mirror{Owner: "me", Name: "failed", PushedAt: pushed, LastError: "migration failed"})
+	target := &gitea.Target{Name: "me", Type: "user"}
+
+	tests := []struct {
+		name     string
+		repo     repository.Repository
+		target   *gitea.Target
+		expected bool
+	}{
+		{"not pushed to", repository.Repository{FullName: "octo/idle", Name: "idle", Stats: repository.Stats{PushedAt: pushed}}, target, true},
+		{"pushed to", repository.Repository{FullName: "octo/idle", Name: "idle", Stats: repository.Stats{PushedAt: pushed.Add(time.Minute)}}, target, false},
+		{"moved to another target", repository.Repository{FullName: "octo/idle", Name: "idle", Stats: repository.Stats{PushedAt: pushed}}, &gitea.Target{Name: "mirrors", Type: "organization"}, false},
+		{"failed last run", repository.Repository{FullName: "octo/failed", Name: "failed", Stats: repository.Stats{PushedAt: pushed}}, target, false},
+		{"never mirrored", repository.Repository{FullName: "octo/new", Name: "new", Stats: repository.Stats{PushedAt: pushed}}, target, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unchanged(store, &tt.repo, tt.target); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBackupSkipsUnchanged(t *testing.T) {
+	pushed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store, _ := state.Open("")
+	store.RecordMirror("octo/idle", &state.Mirror{Owner: "me", Name: "idle", PushedAt: pushed, BackedUp: pushed})
+	repo := &repository.Repository{FullName: "octo/idle", Name: "idle", Stats: repository.Stats{PushedAt: pushed}}
+
+	// Without a push since the last backup, nothing is cloned or uploaded
+	backedUp, err := backupRepository(context.Background(), repo, &config.Config{}, nil, store)
+	if backedUp || err != nil {
+		t.Fatalf("expected the backup to be skipped, got %v %v", backedUp, err)
+	}
+
+	recordMirror(store, repo, &gitea.Target{Name: "me", Type: "user"}, nil)
+	if mirror, _ := store.Mirror("octo/idle"); !mirror.BackedUp.Equal(pushed) {
+		t.Errorf("expected the last backup to be kept, got %v", mirror.BackedUp)
+	}
+	repo.SetExtension(backupExtension, pushed.Add(time.Hour))
+	recordMirror(store, repo, &gitea.Target{Name: "me", Type: "user"}, nil)
+	if mirror, _ := store.Mirror("octo/idle"); !mirror.BackedUp.Equal(pushed.Add(time.Hour)) {
+		t.Errorf("expected the new backup to be recorded, got %v", mirror.BackedUp)
+	}
+}
+
+func TestRecordMirrorStats(t *testing.T) {
+	store, _ := state.Open("")
+	repo := &repository.Repository{FullName: "octo/demo", Name: "demo", Stats: repository.Stats{Language: "Go", Size: 2048, Stars: 3, Forks: 1}}
+
+	recordMirror(store, repo, &gitea.Target{Name: "me", Type: "user"}, nil)
+	if mirror, _ := store.Mirror("octo/demo"); mirror.Language != "Go" || mirror.SizeKB != 2048 || mirror.Stars != 3 || mirror.Forks != 1 {
+		t.Errorf("expected the statistics to be recorded, got %+v", mirror)
+	}
+}
+
+func TestBackingOff(t *testing.T) {
+	lastRun := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store, _ := state.Open("")
+	store.RecordMirror("octo/flaky", &state.Mirror{LastRun: lastRun, LastError: "timeout", Failures: 1})
+	store.RecordMirror("octo/broken", &state.Mirror{LastRun: lastRun, LastError: "timeout", Failures: 5})
+	store.RecordMirror("octo/hopeless", &state.Mirror{LastRun: lastRun, LastError: "timeout", Failures: 40})
+	repo := func(fullName string) *repository.Repository { return &repository.Repository{FullName: fullName} }
+
+	tests := []struct {
+		name    string
+		repo    string
+		now     time.Time
+		until   time.Time
+		skipped bool
+	}{
+		{"below the threshold", "octo/flaky", lastRun, time.Time{}, false},
+		{"at the threshold", "octo/broken", lastRun.Add(time.Hour), lastRun.Add(8 * time.Hour), true},
+		{"after the cool-down", "octo/broken", lastRun.Add(9 * time.Hour), lastRun.Add(8 * time.Hour), false},
+		{"capped cool-down", "octo/hopeless", lastRun, lastRun.Add(maxFailureBackoff), true},
+		{"never mirrored", "octo/new", lastRun, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, skipped := backingOff(store, repo(tt.repo), 2, time.Hour, tt.now)
+			if skipped != tt.skipped || !until.Equal(tt.until) {
+				t.Errorf("expected %v until %s, got %v until %s", tt.skipped, tt.until, skipped, until)
+			}
+		})
+	}
+
+	failures := func(err error) int {
+		recordMirror(store, repo("octo/broken"), &gitea.Target{Name: "me"}, err)
+		mirror, _ := store.Mirror("octo/broken")
+		return mirror.Failures
+	}
+	if got := failures(errors.New("timeout")); got != 6 {
+		t.Errorf("expected another failure to be counted, got %d", got)
+	}
+	if got := failures(nil); got != 0 {
+		t.Errorf("expected a success to reset the failures, got %d", got)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/runlog"
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// slowestReported is how many of the slowest repositories the summary lists.
+const slowestReported = 5
+
+// repoMetrics is what mirroring a repository cost.
+type repoMetrics struct {
+	name        string
+	duration    time.Duration
+	githubCalls int64
+	giteaCalls  int64
+}
+
+// runSummary collects the outcome of every repository of a run.
+type runSummary struct {
+	startedAt time.Time
+	processed int
+	failures  map[string]string
+	metrics   []repoMetrics
+	// created counts the new mirrors and migratedKB their size on GitHub
+	created    int
+	migratedKB int
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{startedAt: time.Now(), failures: make(map[string]string)}
+}
+
+func (s *runSummary) record(name string, err error) {
+	s.processed++
+	if err != nil {
+		s.failures[name] = err.Error()
+	}
+}
+
+// migrated counts a new mirror of sizeKB.
+func (s *runSummary) migrated(sizeKB int) {
+	s.created++
+	s.migratedKB += sizeKB
+}
+
+// stats returns the statistics of the run kept in the state.
+func (s *runSummary) stats(now time.Time) state.Run {
+	run := state.Run{
+		ID:         runlog.RunID(),
+		StartedAt:  s.startedAt,
+		Duration:   now.Sub(s.startedAt),
+		Processed:  s.processed,
+		Created:    s.created,
+		MigratedKB: s.migratedKB,
+		Failed:     len(s.failures),
+	}
+	for _, m := range s.metrics {
+		run.GitHubCalls += m.githubCalls
+		run.GiteaCalls += m.giteaCalls
+	}
+	return run
+}
+
+// measure adds the time and API calls a repository took.
+func (s *runSummary) measure(metrics repoMetrics) {
+	s.metrics = append(s.metrics, metrics)
+}
+
+// slowest returns up to n of the measured repositories, slowest first.
+func (s *runSummary) slowest(n int) []repoMetrics {
+	sorted := append([]repoMetrics(nil), s.metrics...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].duration > sorted[j].duration })
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// lines describes the run: the counts first, then the failures, the
+// totals and the slowest repositories.
+func (s *runSummary) lines() []string {
+	lines := []string{fmt.Sprintf("%d repositories processed, %d failed", s.processed, len(s.failures))}
+
+	names := make([]string, 0, len(s.failures))
+	for name := range s.failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("failed: %s: %s", name, s.failures[name]))
+	}
+
+	if len(s.metrics) == 0 {
+		return lines
+	}
+	var total time.Duration
+	var githubCalls, giteaCalls int64
+	for _, m := range s.metrics {
+		total += m.duration
+		githubCalls += m.githubCalls
+		giteaCalls += m.giteaCalls
+	}
+	lines = append(lines, fmt.Sprintf("took %s with %d GitHub and %d Gitea API calls", total.Round(time.Second), githubCalls, giteaCalls))
+	for _, m := range s.slowest(slowestReported) {
+		lines = append(lines, fmt.Sprintf("slowest: %s: %s, %d GitHub and %d Gitea API calls", m.name, m.duration.Round(time.Millisecond), m.githubCalls, m.giteaCalls))
+	}
+	return lines
+}
+
+func (s *runSummary) print() {
+	lines := s.lines()
+	log.Printf("Run summary: %s", lines[0])
+	for _, line := range lines[1:] {
+		log.Printf("  %s", line)
+	}
+}
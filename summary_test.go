@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunSummarySlowest(t *testing.T) {
+	summary := newRunSummary()
+	summary.measure(repoMetrics{name: "octo/small", duration: time.Second, githubCalls: 3, giteaCalls: 2})
+	summary.measure(repoMetrics{name: "octo/huge", duration: time.Minute, githubCalls: 240, giteaCalls: 80})
+	summary.measure(repoMetrics{name: "octo/medium", duration: 10 * time.Second, githubCalls: 20, giteaCalls: 5})
+
+	slowest := summary.slowest(2)
+	if len(slowest) != 2 || slowest[0].name != "octo/huge" || slowest[1].name != "octo/medium" {
+		t.Errorf("expected the two slowest repositories, got %+v", slowest)
+	}
+	if len(summary.slowest(10)) != 3 {
+		t.Errorf("expected all repositories when fewer were measured")
+	}
+}
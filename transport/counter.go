@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Counter counts the requests sent through the transports sharing it.
+type Counter struct {
+	requests atomic.Int64
+}
+
+// Count returns the number of requests sent so far.
+func (c *Counter) Count() int64 {
+	return c.requests.Load()
+}
+
+// CountingTransport counts every attempt of a request, retries included,
+// as each of them uses up the rate limit.
+type CountingTransport struct {
+	Base    http.RoundTripper
+	Counter *Counter
+}
+
+func NewCountingTransport(base http.RoundTripper, counter *Counter) *CountingTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &CountingTransport{Base: base, Counter: counter}
+}
+
+func (t *CountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.Counter.requests.Add(1)
+	return t.Base.RoundTrip(req)
+}
@@ -0,0 +1,25 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountingTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	counter := &Counter{}
+	client := &http.Client{Transport: NewCountingTransport(nil, counter)}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if counter.Count() != 3 {
+		t.Errorf("expected 3 requests, got %d", counter.Count())
+	}
+}
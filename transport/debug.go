@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// debugBodyLimit is how much of an error response body is logged.
+const debugBodyLimit = 1024
+
+// rateLimitHeaders are logged with every traced response.
+var rateLimitHeaders = []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-RateLimit-Resource", "Retry-After"}
+
+// sensitiveParams are query parameters whose values are never logged.
+var sensitiveParams = []string{"token", "access_token", "client_secret", "sig", "signature"}
+
+var debug atomic.Bool
+
+// SetDebug enables tracing of all requests sent through a DebugTransport.
+func SetDebug(enabled bool) {
+	debug.Store(enabled)
+}
+
+// DebugTransport logs method, URL, status, latency and rate limit headers of
+// every request while debugging is enabled, and the body of error responses.
+// Credentials are never logged: the request body and headers are left out and
+// tokens in the URL redacted.
+type DebugTransport struct {
+	Base http.RoundTripper
+}
+
+func NewDebugTransport(base http.RoundTripper) *DebugTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &DebugTransport{Base: base}
+}
+
+func (t *DebugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !debug.Load() {
+		return t.Base.RoundTrip(req)
+	}
+
+	started := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	latency := time.Since(started).Round(time.Millisecond)
+	if err != nil {
+		log.Printf("Debug: %s %s failed after %s: %v", req.Method, RedactURL(req), latency, err)
+		return nil, err
+	}
+
+	var details []string
+	for _, header := range rateLimitHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			details = append(details, header+"="+value)
+		}
+	}
+	if resp.StatusCode >= http.StatusBadRequest && resp.Body != nil {
+		head, _ := io.ReadAll(io.LimitReader(resp.Body, debugBodyLimit))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+		if body := strings.TrimSpace(string(head)); body != "" {
+			details = append(details, "body="+body)
+		}
+	}
+	log.Printf("Debug: %s %s -> %d in %s %s", req.Method, RedactURL(req), resp.StatusCode, latency, strings.Join(details, " "))
+	return resp, nil
+}
+
+// RedactURL returns the URL of a request without credentials.
+func RedactURL(req *http.Request) string {
+	u := *req.URL
+	query := u.Query()
+	redacted := false
+	for _, param := range sensitiveParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if redacted {
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDebugTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message":"repository already exists"}`))
+	}))
+	defer server.Close()
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	SetDebug(true)
+	defer SetDebug(false)
+
+	client := &http.Client{Transport: NewDebugTransport(nil)}
+	req, _ := http.NewRequest("POST", server.URL+"/api/v1/repos/migrate?token=secret", strings.NewReader(`{"auth_token":"secret"}`))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	line := logged.String()
+	if strings.Contains(line, "secret") {
+		t.Errorf("expected the token to be redacted, got %s", line)
+	}
+	for _, want := range []string{"POST", "/api/v1/repos/migrate?token=REDACTED", "-> 422", "X-RateLimit-Remaining=4999", `body={"message":"repository already exists"}`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("expected %q in %s", want, line)
+		}
+	}
+	if string(body) != `{"message":"repository already exists"}` {
+		t.Errorf("expected the body to be restored, got %q", body)
+	}
+}
+
+func TestDebugTransportDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	client := &http.Client{Transport: NewDebugTransport(nil)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if logged.Len() != 0 {
+		t.Errorf("expected nothing to be logged, got %s", logged.String())
+	}
+}
@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+// ETagTransport sends the ETag of cached responses as If-None-Match and
+// answers 304 Not Modified from the cache, so unchanged GitHub data doesn't
+// count against the rate limit.
+type ETagTransport struct {
+	Base  http.RoundTripper
+	Cache *state.Store
+}
+
+func NewETagTransport(base http.RoundTripper, cache *state.Store) *ETagTransport {
+	return &ETagTransport{Base: base, Cache: cache}
+}
+
+func (t *ETagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.Base.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	cached, ok := t.Cache.CachedResponse(key)
+	if ok {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Header.Set("Content-Type", "application/json")
+		if cached.Link != "" {
+			resp.Header.Set("Link", cached.Link)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(cached.Body))
+		resp.ContentLength = int64(len(cached.Body))
+		return resp, nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	t.Cache.SetCachedResponse(key, &state.CachedResponse{
+		ETag: etag,
+		Body: body,
+		Link: resp.Header.Get("Link"),
+	})
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
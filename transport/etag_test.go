@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/state"
+)
+
+func TestETagTransport(t *testing.T) {
+	calls, notModified := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Link", `<https://api.github.com/user/repos?page=2>; rel="next"`)
+		w.Write([]byte(`[{"name": "demo"}]`))
+	}))
+	defer server.Close()
+
+	store, _ := state.Open("")
+	client := &http.Client{Transport: NewETagTransport(http.DefaultTransport, store)}
+
+	get := func(t *testing.T) *http.Response {
+		resp, err := client.Get(server.URL + "/user/repos")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	first := get(t)
+	io.ReadAll(first.Body)
+	first.Body.Close()
+
+	t.Run("answers not modified responses from the cache", func(t *testing.T) {
+		resp := get(t)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		if notModified != 1 {
+			t.Errorf("expected a conditional request, got %d", notModified)
+		}
+		if resp.StatusCode != http.StatusOK || string(body) != `[{"name": "demo"}]` {
+			t.Errorf("unexpected cached response: %d %s", resp.StatusCode, body)
+		}
+		if resp.Header.Get("Link") == "" {
+			t.Error("expected pagination header to be restored")
+		}
+	})
+
+	t.Run("passes other methods through", func(t *testing.T) {
+		before := calls
+		resp, err := client.Post(server.URL+"/user/repos", "application/json", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if calls != before+1 {
+			t.Errorf("expected request to reach the server")
+		}
+	})
+}
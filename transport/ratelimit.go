@@ -0,0 +1,80 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitTransport spaces out requests so small servers aren't flooded.
+// Migrations, which make the server clone a whole repository, are limited
+// separately from the other requests.
+type RateLimitTransport struct {
+	Base       http.RoundTripper
+	requests   *interval
+	migrations *interval
+}
+
+// NewRateLimitTransport limits requests to requestsPerSecond and migrations
+// to migrationsPerMinute, zero disabling either limit.
+func NewRateLimitTransport(base http.RoundTripper, requestsPerSecond, migrationsPerMinute int) *RateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &RateLimitTransport{Base: base}
+	if requestsPerSecond > 0 {
+		t.requests = &interval{every: time.Second / time.Duration(requestsPerSecond)}
+	}
+	if migrationsPerMinute > 0 {
+		t.migrations = &interval{every: time.Minute / time.Duration(migrationsPerMinute)}
+	}
+	return t
+}
+
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limit := t.requests
+	if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/repos/migrate") {
+		limit = t.migrations
+	}
+	if err := limit.wait(req); err != nil {
+		return nil, err
+	}
+	return t.Base.RoundTrip(req)
+}
+
+// interval lets a request pass every so often.
+type interval struct {
+	every time.Duration
+	mu    sync.Mutex
+	next  time.Time
+}
+
+// wait blocks until the request may be sent or its context is done.
+func (i *interval) wait(req *http.Request) error {
+	if i == nil {
+		return nil
+	}
+
+	i.mu.Lock()
+	now := time.Now()
+	slot := i.next
+	if slot.Before(now) {
+		slot = now
+	}
+	i.next = slot.Add(i.every)
+	i.mu.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
@@ -0,0 +1,54 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	send := func(client *http.Client, method, path string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	t.Run("spaces out requests", func(t *testing.T) {
+		client := &http.Client{Transport: NewRateLimitTransport(nil, 20, 0)}
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			send(client, "GET", "/api/v1/user")
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("expected at least 100ms for 3 requests at 20/s, took %s", elapsed)
+		}
+	})
+
+	t.Run("limits migrations separately", func(t *testing.T) {
+		client := &http.Client{Transport: NewRateLimitTransport(nil, 0, 1)}
+
+		send(client, "POST", "/api/v1/repos/migrate")
+		start := time.Now()
+		send(client, "GET", "/api/v1/user")
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("expected other requests to pass, took %s", elapsed)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "POST", server.URL+"/api/v1/repos/migrate", nil)
+		if _, err := client.Do(req); err == nil {
+			t.Error("expected the second migration to wait past the deadline")
+		}
+	})
+}
@@ -0,0 +1,195 @@
+// Package transport contains the HTTP plumbing shared by the GitHub and Gitea clients.
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultMaxRetries = 3
+	DefaultMaxWait    = 15 * time.Minute
+	// SecondaryRateLimitWait is how long GitHub asks to back off after a
+	// secondary rate limit response without Retry-After
+	SecondaryRateLimitWait = time.Minute
+)
+
+// RetryTransport retries requests that were rejected by a rate limiter (429,
+// or 403 with rate limit headers or GitHub's secondary rate limit message)
+// after the wait the server asked for via Retry-After or X-RateLimit-Reset.
+type RetryTransport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+	// MaxWait caps a single wait; responses asking for longer are returned as-is
+	MaxWait time.Duration
+	// Timeout limits each attempt including reading the body, zero means no limit
+	Timeout time.Duration
+}
+
+func NewRetryTransport(base http.RoundTripper) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RetryTransport{
+		Base:       base,
+		MaxRetries: DefaultMaxRetries,
+		MaxWait:    DefaultMaxWait,
+	}
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.roundTrip(req)
+		if err != nil || attempt >= t.MaxRetries {
+			return resp, err
+		}
+
+		wait, ok := RetryAfter(resp, time.Now())
+		if !ok || wait > t.MaxWait {
+			return resp, nil
+		}
+
+		// Requests with a body can only be retried if it can be replayed
+		var body io.ReadCloser
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+			body, err = req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		log.Printf("Rate limited by %s (status %d), retrying in %s", req.URL.Host, resp.StatusCode, wait.Round(time.Second))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			if body != nil {
+				body.Close()
+			}
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if body != nil {
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+type timeoutKey struct{}
+
+// WithTimeout overrides the per-attempt timeout for requests made with the
+// returned context. A zero timeout disables the limit.
+func WithTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+func (t *RetryTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	timeout := t.Timeout
+	if override, ok := req.Context().Value(timeoutKey{}).(time.Duration); ok {
+		timeout = override
+	}
+
+	if timeout <= 0 {
+		return t.Base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := t.Base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the attempt's timeout once the body has been consumed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// RetryAfter reports how long to wait before retrying a rate limited response.
+// It returns false if the response isn't a rate limit rejection.
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusForbidden {
+		return 0, false
+	}
+
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return clamp(time.Duration(seconds) * time.Second), true
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return clamp(date.Sub(now)), true
+		}
+	}
+
+	// A 403 is only a rate limit if the quota is actually exhausted or GitHub
+	// hit a secondary limit, such as for searches and content creation
+	if resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		if secondaryRateLimit(resp) {
+			return SecondaryRateLimitWait, true
+		}
+		return 0, false
+	}
+
+	if value := resp.Header.Get("X-RateLimit-Reset"); value != "" {
+		if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+			// Add a second of slack since the reset time is truncated
+			return clamp(time.Unix(epoch, 0).Sub(now) + time.Second), true
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return time.Second, true
+	}
+
+	return 0, false
+}
+
+// secondaryRateLimit reports whether the body of a forbidden response is
+// GitHub's secondary rate limit error. The body is restored for the caller.
+func secondaryRateLimit(resp *http.Response) bool {
+	if resp.Body == nil {
+		return false
+	}
+	head, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	if err != nil {
+		return false
+	}
+	message := bytes.ToLower(head)
+	return bytes.Contains(message, []byte("secondary rate limit")) || bytes.Contains(message, []byte("abuse detection"))
+}
+
+func clamp(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,188 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	response := func(status int, headers map[string]string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		for k, v := range headers {
+			resp.Header.Set(k, v)
+		}
+		return resp
+	}
+
+	t.Run("ignores successful responses", func(t *testing.T) {
+		if _, ok := RetryAfter(response(http.StatusOK, map[string]string{"Retry-After": "5"}), now); ok {
+			t.Error("expected no retry")
+		}
+	})
+
+	t.Run("reads Retry-After seconds", func(t *testing.T) {
+		wait, ok := RetryAfter(response(http.StatusTooManyRequests, map[string]string{"Retry-After": "5"}), now)
+		if !ok || wait != 5*time.Second {
+			t.Errorf("expected 5s, got %s (%v)", wait, ok)
+		}
+	})
+
+	t.Run("reads Retry-After dates", func(t *testing.T) {
+		date := now.Add(10 * time.Second).UTC().Format(http.TimeFormat)
+		wait, ok := RetryAfter(response(http.StatusTooManyRequests, map[string]string{"Retry-After": date}), now)
+		if !ok || wait != 10*time.Second {
+			t.Errorf("expected 10s, got %s (%v)", wait, ok)
+		}
+	})
+
+	t.Run("reads rate limit reset on exhausted quota", func(t *testing.T) {
+		reset := strconv.FormatInt(now.Add(30*time.Second).Unix(), 10)
+		wait, ok := RetryAfter(response(http.StatusForbidden, map[string]string{
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     reset,
+		}), now)
+		if !ok || wait != 31*time.Second {
+			t.Errorf("expected 31s, got %s (%v)", wait, ok)
+		}
+	})
+
+	t.Run("waits on secondary rate limits", func(t *testing.T) {
+		body := `{"message":"You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`
+		resp := response(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "4000"})
+		resp.Body = io.NopCloser(bytes.NewBufferString(body))
+		wait, ok := RetryAfter(resp, now)
+		if !ok || wait != SecondaryRateLimitWait {
+			t.Errorf("expected %s, got %s (%v)", SecondaryRateLimitWait, wait, ok)
+		}
+		if restored, _ := io.ReadAll(resp.Body); string(restored) != body {
+			t.Errorf("expected the body to be restored, got %q", restored)
+		}
+	})
+
+	t.Run("prefers Retry-After on secondary rate limits", func(t *testing.T) {
+		resp := response(http.StatusForbidden, map[string]string{"Retry-After": "7", "X-RateLimit-Remaining": "4000"})
+		resp.Body = io.NopCloser(bytes.NewBufferString(`{"message":"You have exceeded a secondary rate limit."}`))
+		wait, ok := RetryAfter(resp, now)
+		if !ok || wait != 7*time.Second {
+			t.Errorf("expected 7s, got %s (%v)", wait, ok)
+		}
+	})
+
+	t.Run("treats plain forbidden as hard failure", func(t *testing.T) {
+		if _, ok := RetryAfter(response(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "12"}), now); ok {
+			t.Error("expected no retry")
+		}
+	})
+}
+
+func TestRetryTransport(t *testing.T) {
+	t.Run("retries rate limited requests and replays the body", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != "payload" {
+				t.Errorf("expected body 'payload', got %q", body)
+			}
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer server.Close()
+
+		client := &http.Client{Transport: NewRetryTransport(nil)}
+		resp, err := client.Post(server.URL, "text/plain", bytes.NewBufferString("payload"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Errorf("expected status 201, got %d", resp.StatusCode)
+		}
+		if calls != 2 {
+			t.Errorf("expected 2 calls, got %d", calls)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		retry := NewRetryTransport(nil)
+		retry.MaxRetries = 2
+		client := &http.Client{Transport: retry}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("expected status 429, got %d", resp.StatusCode)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 calls, got %d", calls)
+		}
+	})
+
+	t.Run("returns responses asking for too long a wait", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		retry := NewRetryTransport(nil)
+		retry.MaxWait = time.Minute
+		client := &http.Client{Transport: retry}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("expected status 429, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("applies the per-request timeout override", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		retry := NewRetryTransport(nil)
+		retry.Timeout = 10 * time.Millisecond
+		client := &http.Client{Transport: retry}
+
+		if _, err := client.Get(server.URL); err == nil {
+			t.Error("expected timeout error, got nil")
+		}
+
+		req, _ := http.NewRequestWithContext(WithTimeout(context.Background(), time.Second), "GET", server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	})
+}
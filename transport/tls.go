@@ -0,0 +1,42 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// ConfigureTLS trusts the PEM encoded certificates in caCertFile in addition
+// to the system roots and optionally disables certificate verification.
+func ConfigureTLS(t *http.Transport, caCertFile string, insecureSkipVerify bool) error {
+	if caCertFile == "" && !insecureSkipVerify {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if t.TLSClientConfig != nil {
+		tlsConfig = t.TLSClientConfig.Clone()
+	}
+
+	if caCertFile != "" {
+		pem, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", caCertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	tlsConfig.InsecureSkipVerify = insecureSkipVerify
+	t.TLSClientConfig = tlsConfig
+	return nil
+}
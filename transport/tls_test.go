@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigureTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	get := func(t *testing.T, base *http.Transport) error {
+		resp, err := (&http.Client{Transport: base}).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	t.Run("rejects unknown certificates by default", func(t *testing.T) {
+		base, _ := NewHTTPTransport("")
+		if err := get(t, base); err == nil {
+			t.Error("expected certificate error, got nil")
+		}
+	})
+
+	t.Run("trusts the CA certificate", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		if err := os.WriteFile(caFile, cert, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		base, _ := NewHTTPTransport("")
+		if err := ConfigureTLS(base, caFile, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := get(t, base); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("skips verification", func(t *testing.T) {
+		base, _ := NewHTTPTransport("")
+		if err := ConfigureTLS(base, "", true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := get(t, base); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("rejects files without certificates", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		os.WriteFile(caFile, []byte("not a certificate"), 0o600)
+
+		base, _ := NewHTTPTransport("")
+		if err := ConfigureTLS(base, caFile, false); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// TokenRotation authenticates requests with one of several tokens and moves
+// on to the next one as soon as GitHub reports the current token's quota as
+// exhausted. Rejected requests are replayed with the next token; once every
+// token is exhausted the rejection is returned so RetryTransport can wait.
+type TokenRotation struct {
+	Base http.RoundTripper
+
+	mu      sync.Mutex
+	tokens  []string
+	current int
+}
+
+func NewTokenRotation(base http.RoundTripper, tokens []string) *TokenRotation {
+	return &TokenRotation{Base: base, tokens: tokens}
+}
+
+// Token returns the token requests are currently made with.
+func (t *TokenRotation) Token() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tokens[t.current]
+}
+
+func (t *TokenRotation) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		token := t.Token()
+
+		r := req.Clone(req.Context())
+		r.Header.Set("Authorization", "Bearer "+token)
+		if attempt > 1 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+
+		resp, err := t.Base.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+			return resp, nil
+		}
+		t.rotate(token)
+
+		rejected := resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests
+		replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+		if !rejected || !replayable || attempt >= len(t.tokens) {
+			return resp, nil
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// rotate switches to the next token unless another request already did.
+func (t *TokenRotation) rotate(exhausted string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.tokens) < 2 || t.tokens[t.current] != exhausted {
+		return
+	}
+	log.Printf("GitHub token %d of %d is out of quota, switching to the next one", t.current+1, len(t.tokens))
+	t.current = (t.current + 1) % len(t.tokens)
+}
@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenRotation(t *testing.T) {
+	quota := map[string]int{}
+
+	newServer := func(limits map[string]int) *httptest.Server {
+		for token, limit := range limits {
+			quota[token] = limit
+		}
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get("Authorization")[len("Bearer "):]
+			if quota[token] == 0 {
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			quota[token]--
+			w.Header().Set("X-RateLimit-Remaining", "1")
+			w.Write([]byte(token))
+		}))
+	}
+
+	t.Run("switches to the next token once the quota is exhausted", func(t *testing.T) {
+		server := newServer(map[string]int{"one": 1, "two": 5})
+		defer server.Close()
+
+		rotation := NewTokenRotation(http.DefaultTransport, []string{"one", "two"})
+		client := &http.Client{Transport: rotation}
+
+		for i, want := range []string{"one", "two", "two"} {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("request %d: expected 200, got %d", i, resp.StatusCode)
+			}
+			if rotation.Token() != want {
+				t.Errorf("request %d: expected token %s, got %s", i, want, rotation.Token())
+			}
+		}
+	})
+
+	t.Run("returns the rejection once every token is exhausted", func(t *testing.T) {
+		server := newServer(map[string]int{"three": 0, "four": 0})
+		defer server.Close()
+
+		client := &http.Client{Transport: NewTokenRotation(http.DefaultTransport, []string{"three", "four"})}
+
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", resp.StatusCode)
+		}
+	})
+}
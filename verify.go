@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/gitea"
+	ghrepo "github.com/jaedle/mirror-to-gitea/github"
+)
+
+// impliedScopes lists the GitHub scopes granting at least the key scope.
+var impliedScopes = map[string][]string{
+	"repo":           {"repo"},
+	"read:org":       {"read:org", "write:org", "admin:org"},
+	"read:repo_hook": {"read:repo_hook", "write:repo_hook", "admin:repo_hook", "repo"},
+}
+
+// requiredScopes maps the GitHub scopes the enabled features need to the
+// settings needing them.
+func requiredScopes(cfg *config.Config) map[string][]string {
+	required := make(map[string][]string)
+	if cfg.GitHub.PrivateRepositories {
+		required["repo"] = append(required["repo"], "MIRROR_PRIVATE_REPOSITORIES")
+	}
+	if cfg.GitHub.MirrorOrganizations {
+		required["read:org"] = append(required["read:org"], "MIRROR_ORGANIZATIONS")
+	}
+	if cfg.GitHub.MirrorTeams {
+		required["read:org"] = append(required["read:org"], "MIRROR_TEAMS")
+	}
+	if cfg.GitHub.MirrorWebhooks {
+		required["read:repo_hook"] = append(required["read:repo_hook"], "MIRROR_WEBHOOKS")
+	}
+	return required
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, granted := range impliedScopes[scope] {
+		if slices.Contains(scopes, granted) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetOrganizations returns the Gitea organizations the configuration
+// mirrors into. Organizations of PRESERVE_ORG_STRUCTURE are only known after
+// discovery and not included.
+func targetOrganizations(cfg *config.Config) []string {
+	orgs := make(map[string]bool)
+	if cfg.Gitea.Organization != "" {
+		orgs[cfg.Gitea.Organization] = true
+	}
+	if cfg.GitHub.MirrorStarred && cfg.Gitea.StarredReposOrg != "" {
+		orgs[cfg.Gitea.StarredReposOrg] = true
+	}
+	if cfg.GitHub.MirrorWatched && cfg.Gitea.WatchedReposOrg != "" {
+		orgs[cfg.Gitea.WatchedReposOrg] = true
+	}
+	for _, rule := range cfg.Rules {
+		if rule.TargetOrganization != "" {
+			orgs[rule.TargetOrganization] = true
+		}
+	}
+
+	result := make([]string, 0, len(orgs))
+	for org := range orgs {
+		result = append(result, org)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// runVerify checks the GitHub and Gitea tokens against the enabled features
+// and reports every problem found. It fails if any check failed.
+func runVerify(ctx context.Context, cfg *config.Config, out io.Writer) error {
+	failures := 0
+	ok := func(format string, args ...interface{}) {
+		fmt.Fprintf(out, "OK    "+format+"\n", args...)
+	}
+	fail := func(format string, args ...interface{}) {
+		failures++
+		fmt.Fprintf(out, "FAIL  "+format+"\n", args...)
+	}
+
+	if len(cfg.GitHub.Tokens) == 0 {
+		ok("no GITHUB_TOKEN set, only public repositories of %s are mirrored", cfg.GitHub.Username)
+	}
+	required := requiredScopes(cfg)
+	for i, token := range cfg.GitHub.Tokens {
+		name := "GitHub token"
+		if len(cfg.GitHub.Tokens) > 1 {
+			name = fmt.Sprintf("GitHub token %d", i+1)
+		}
+
+		client, err := ghrepo.NewClient(token, ghrepo.ClientOptions{APIURL: cfg.GitHub.APIURL, Proxy: cfg.GitHub.Proxy})
+		if err != nil {
+			return err
+		}
+		login, scopes, reported, err := ghrepo.TokenScopes(ctx, client)
+		if err != nil {
+			fail("%s is not accepted by GitHub: %v", name, err)
+			continue
+		}
+		ok("%s authenticates as %s", name, login)
+
+		if !reported {
+			ok("%s is fine-grained and doesn't report scopes, make sure it can read contents, metadata, issues and organization members of the mirrored repositories", name)
+			continue
+		}
+
+		needed := make([]string, 0, len(required))
+		for scope := range required {
+			needed = append(needed, scope)
+		}
+		sort.Strings(needed)
+		for _, scope := range needed {
+			if hasScope(scopes, scope) {
+				ok("%s has the %s scope needed for %s", name, scope, strings.Join(required[scope], ", "))
+			} else {
+				fail("%s lacks the %s scope needed for %s, add it to the token or disable the setting", name, scope, strings.Join(required[scope], ", "))
+			}
+		}
+	}
+
+	giteaClient, err := gitea.NewClient(&cfg.Gitea)
+	if err != nil {
+		return err
+	}
+	if server, err := giteaClient.DetectServer(); err != nil {
+		fail("could not detect the server at %s: %v", cfg.Gitea.URL, err)
+	} else {
+		ok("%s runs %s", cfg.Gitea.URL, server)
+	}
+	giteaUser, err := giteaClient.GetUser()
+	if err != nil {
+		fail("GITEA_TOKEN is not accepted by %s: %v", cfg.Gitea.URL, err)
+	} else {
+		ok("Gitea token authenticates as %s", giteaUser.Name)
+
+		for _, org := range targetOrganizations(cfg) {
+			permissions, err := giteaClient.GetOrganizationPermissions(giteaUser.Name, org)
+			switch {
+			case err != nil:
+				fail("could not check permissions in Gitea organization %s: %v", org, err)
+			case permissions == nil:
+				ok("Gitea organization %s doesn't exist yet and will be created by %s", org, giteaUser.Name)
+			case permissions.IsOwner || permissions.IsAdmin || permissions.CanCreateRepository:
+				ok("%s can create repositories in Gitea organization %s", giteaUser.Name, org)
+			default:
+				fail("%s can't create repositories in Gitea organization %s, add it to the owners or to a team allowed to create repositories", giteaUser.Name, org)
+			}
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d checks failed", failures)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+)
+
+func TestRunVerify(t *testing.T) {
+	githubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer limited" {
+			w.Header().Set("X-OAuth-Scopes", "public_repo")
+		} else {
+			w.Header().Set("X-OAuth-Scopes", "repo, admin:org")
+		}
+		w.Write([]byte(`{"login":"octo"}`))
+	}))
+	defer githubServer.Close()
+
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/user":
+			w.Write([]byte(`{"id":1,"username":"mirror"}`))
+		case "/api/v1/users/mirror/orgs/open/permissions":
+			w.Write([]byte(`{"can_create_repository":true}`))
+		case "/api/v1/users/mirror/orgs/closed/permissions":
+			w.Write([]byte(`{"can_read":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer giteaServer.Close()
+
+	newConfig := func() *config.Config {
+		return &config.Config{
+			GitHub: config.GitHubConfig{
+				Tokens:              []string{"token"},
+				APIURL:              githubServer.URL,
+				PrivateRepositories: true,
+				MirrorOrganizations: true,
+			},
+			Gitea: config.GiteaConfig{URL: giteaServer.URL, TimeoutSeconds: 5, Organization: "open"},
+			Rules: []config.Rule{{Match: "**", TargetOrganization: "new"}},
+		}
+	}
+
+	t.Run("passes with sufficient scopes and permissions", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := runVerify(context.Background(), newConfig(), &out); err != nil {
+			t.Fatalf("unexpected error: %v\n%s", err, out.String())
+		}
+		for _, want := range []string{"authenticates as octo", "repo scope", "read:org scope", "create repositories in Gitea organization open", "new doesn't exist yet"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("expected output to contain %q:\n%s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("reports missing scopes and permissions", func(t *testing.T) {
+		cfg := newConfig()
+		cfg.GitHub.Tokens = []string{"token", "limited"}
+		cfg.Gitea.Organization = "closed"
+
+		var out bytes.Buffer
+		if err := runVerify(context.Background(), cfg, &out); err == nil {
+			t.Fatalf("expected an error:\n%s", out.String())
+		}
+		if strings.Count(out.String(), "FAIL") != 3 {
+			t.Errorf("expected 3 failures:\n%s", out.String())
+		}
+		if !strings.Contains(out.String(), "GitHub token 2 lacks the repo scope") {
+			t.Errorf("expected the missing scope of the second token:\n%s", out.String())
+		}
+		if !strings.Contains(out.String(), "can't create repositories in Gitea organization closed") {
+			t.Errorf("expected the missing Gitea permission:\n%s", out.String())
+		}
+	})
+}
+
+func TestHasScope(t *testing.T) {
+	if !hasScope([]string{"admin:org"}, "read:org") {
+		t.Error("expected admin:org to grant read:org")
+	}
+	if hasScope([]string{"public_repo"}, "repo") {
+		t.Error("expected public_repo not to grant repo")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jaedle/mirror-to-gitea/config"
+	"github.com/jaedle/mirror-to-gitea/queue"
+	"github.com/jaedle/mirror-to-gitea/repository"
+)
+
+// queueWait is how long a worker waits for the queue before checking for a
+// shutdown again.
+const queueWait = 5 * time.Second
+
+// enqueueRepositories queues the discovered repositories for the workers
+// and returns how many weren't queued already.
+func enqueueRepositories(ctx context.Context, cfg *config.Config, repos []*repository.Repository) (int, error) {
+	q, err := queue.Open(cfg.Queue)
+	if err != nil {
+		return 0, err
+	}
+	if cfg.DryRun {
+		log.Printf("DRY RUN: Would queue %d repositories", len(repos))
+		return 0, nil
+	}
+
+	queued, err := q.Push(ctx, repos)
+	if err != nil {
+		return queued, fmt.Errorf("failed to queue repositories: %w", err)
+	}
+	waiting, err := q.Len(ctx)
+	if err != nil {
+		return queued, fmt.Errorf("failed to get the queue length: %w", err)
+	}
+	log.Printf("Queued %d repositories, %d are waiting for a worker", queued, waiting)
+	return queued, nil
+}
+
+// runWorker mirrors the repositories of the queue in batches of
+// QUEUE_BATCH_SIZE until the process is stopped. Any number of workers can
+// share a queue.
+func runWorker(cfg *config.Config) error {
+	if cfg.Queue == "" {
+		return fmt.Errorf("workers take the repositories from a queue, set QUEUE_URL")
+	}
+	q, err := queue.Open(cfg.Queue)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Waiting for repositories to mirror")
+	for ctx.Err() == nil {
+		batch, err := q.Pop(ctx, cfg.QueueBatchSize, queueWait)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("Warning: Failed to read the queue, retrying: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(queueWait):
+			}
+			continue
+		}
+		if batch == nil {
+			continue
+		}
+
+		if len(batch.Repositories) > 0 {
+			log.Printf("Mirroring %d queued repositories", len(batch.Repositories))
+			if err := run(ctx, cfg, runOptions{queued: batch.Repositories}); err != nil {
+				log.Printf("Mirroring failed: %v", err)
+			}
+		}
+		// Repositories skipped by a shutdown are queued again by the next run of the producer
+		if err := q.Ack(context.WithoutCancel(ctx), batch); err != nil {
+			log.Printf("Warning: Failed to release the mirrored repositories: %v", err)
+		}
+	}
+	return nil
+}